@@ -0,0 +1,142 @@
+CREATE TABLE IF NOT EXISTS DF_REPOSITORY
+(
+    REPO_ID           INT(8) NOT NULL AUTO_INCREMENT,
+    REPO_NAME         VARCHAR(128) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+    CH_REPO_NAME      VARCHAR(128) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+    CLASS             CHAR(32) NOT NULL,
+    CLASS_ID          INT(8) NOT NULL DEFAULT 0,
+    LABEL             CHAR(32) NOT NULL ,
+    CREATE_USER       VARCHAR(64) NOT NULL,
+    DESCRIPTION       VARCHAR(1024) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+    CREATE_TIME       TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UPDATE_TIME       TIMESTAMP NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+    STATUS            VARCHAR(2) NOT NULL,
+    IMAGE_URL         VARCHAR(255) NOT NULL,
+    PRIMARY KEY (REPO_ID),
+    UNIQUE (REPO_NAME),
+    KEY `IDX_REPO_CLASS_ID` (CLASS_ID)
+
+)  DEFAULT CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS DF_DATAITEM (
+  ITEM_ID       INT(8) NOT NULL AUTO_INCREMENT,
+  ITEM_NAME     VARCHAR(255) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+  REPO_NAME     VARCHAR(128) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+  URL           VARCHAR(255) NOT NULL,
+  CREATE_TIME   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UPDATE_TIME   TIMESTAMP NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP ,
+  STATUS        VARCHAR(2) NOT NULL,
+  SIMPLE        VARCHAR(1024) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+  SCHEMA_VERSION INT(8) NOT NULL DEFAULT 0,
+  COMPAT_MODE   VARCHAR(16) NOT NULL DEFAULT 'none',
+  PRIMARY KEY (ITEM_ID),
+  CONSTRAINT `FK_REPO_NAME` FOREIGN KEY (REPO_NAME) REFERENCES DF_REPOSITORY (REPO_NAME) 
+    ON UPDATE CASCADE,
+  CONSTRAINT `UK_REPO_ITEM` UNIQUE (REPO_NAME, ITEM_NAME)
+
+)  DEFAULT CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS DF_ATTRIBUTE
+(
+   ATTR_ID     INT(11) NOT NULL AUTO_INCREMENT,
+   ITEM_ID     INT(8) NOT NULL,
+   ATTR_NAME   VARCHAR(128) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+   INSTRUCTION VARCHAR(128) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+   ORDER_ID    INT(8) NOT NULL,
+   EXAMPLE     VARCHAR(512) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+   DATA_TYPE     VARCHAR(16) NOT NULL DEFAULT 'string',
+   NUM_PRECISION INT(4) NOT NULL DEFAULT 0,
+   NUM_SCALE     INT(4) NOT NULL DEFAULT 0,
+   ENUM_VALUES   VARCHAR(2048) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL DEFAULT '',
+   ELEMENT_TYPE  VARCHAR(16) NOT NULL DEFAULT '',
+   NULLABLE      TINYINT(1) NOT NULL DEFAULT 1,
+   PRIMARY_KEY   TINYINT(1) NOT NULL DEFAULT 0,
+   UNIT          VARCHAR(32) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL DEFAULT '',
+   MAX_LENGTH    INT(8) NOT NULL DEFAULT 0,
+   PRIMARY KEY (ATTR_ID),
+   CONSTRAINT `FK_ITEM_ID` FOREIGN KEY (ITEM_ID) REFERENCES DF_DATAITEM (ITEM_ID) 
+     ON UPDATE CASCADE
+
+)  DEFAULT CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS DF_ITEM_STAT
+(
+   STAT_KEY     VARCHAR(255) NOT NULL COMMENT '3*255 = 765 < 767',
+   STAT_VALUE   INT NOT NULL,
+   PRIMARY KEY (STAT_KEY)
+
+)  DEFAULT CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS DF_TAG
+(
+   TAG_ID      INT(11) NOT NULL AUTO_INCREMENT,
+   TAG_NAME    VARCHAR(64) NOT NULL,
+   CREATE_TIME TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   PRIMARY KEY (TAG_ID),
+   UNIQUE (TAG_NAME)
+
+)  DEFAULT CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS DF_REPO_TAG
+(
+   REPO_ID     INT(8) NOT NULL,
+   TAG_ID      INT(11) NOT NULL,
+   CREATE_TIME TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   PRIMARY KEY (REPO_ID, TAG_ID),
+   KEY `IDX_REPO_TAG_TAG_ID` (TAG_ID),
+   CONSTRAINT `FK_REPO_TAG_REPO_ID` FOREIGN KEY (REPO_ID) REFERENCES DF_REPOSITORY (REPO_ID)
+     ON DELETE CASCADE,
+   CONSTRAINT `FK_REPO_TAG_TAG_ID` FOREIGN KEY (TAG_ID) REFERENCES DF_TAG (TAG_ID)
+     ON DELETE CASCADE
+
+)  DEFAULT CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS DF_ITEM_TAG
+(
+   ITEM_ID     INT(8) NOT NULL,
+   TAG_ID      INT(11) NOT NULL,
+   CREATE_TIME TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   PRIMARY KEY (ITEM_ID, TAG_ID),
+   KEY `IDX_ITEM_TAG_TAG_ID` (TAG_ID),
+   CONSTRAINT `FK_ITEM_TAG_ITEM_ID` FOREIGN KEY (ITEM_ID) REFERENCES DF_DATAITEM (ITEM_ID)
+     ON DELETE CASCADE,
+   CONSTRAINT `FK_ITEM_TAG_TAG_ID` FOREIGN KEY (TAG_ID) REFERENCES DF_TAG (TAG_ID)
+     ON DELETE CASCADE
+
+)  DEFAULT CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS DF_CLASS
+(
+   CLASS_ID    INT(8) NOT NULL AUTO_INCREMENT,
+   PARENT_ID   INT(8) NOT NULL DEFAULT 0,
+   ORDER_ID    INT(8) NOT NULL DEFAULT 0,
+   CREATE_TIME TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   UPDATE_TIME TIMESTAMP NULL DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP,
+   PRIMARY KEY (CLASS_ID),
+   KEY `IDX_CLASS_PARENT_ID` (PARENT_ID)
+
+)  DEFAULT CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS DF_CLASS_NAME
+(
+   CLASS_ID    INT(8) NOT NULL,
+   LOCALE      VARCHAR(16) NOT NULL,
+   NAME        VARCHAR(128) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+   PRIMARY KEY (CLASS_ID, LOCALE),
+   CONSTRAINT `FK_CLASS_NAME_CLASS_ID` FOREIGN KEY (CLASS_ID) REFERENCES DF_CLASS (CLASS_ID)
+     ON DELETE CASCADE
+
+)  DEFAULT CHARSET=UTF8;
+
+CREATE TABLE IF NOT EXISTS DF_SCHEMA_VERSION
+(
+   ITEM_ID     INT(8) NOT NULL,
+   VERSION     INT(8) NOT NULL,
+   AUTHOR      VARCHAR(64) NOT NULL,
+   ATTRS       MEDIUMTEXT CHARACTER SET utf8 COLLATE utf8_bin NOT NULL,
+   CREATE_TIME TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+   PRIMARY KEY (ITEM_ID, VERSION),
+   CONSTRAINT `FK_SCHEMA_VERSION_ITEM_ID` FOREIGN KEY (ITEM_ID) REFERENCES DF_DATAITEM (ITEM_ID)
+     ON DELETE CASCADE
+
+)  DEFAULT CHARSET=UTF8;
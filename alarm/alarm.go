@@ -0,0 +1,371 @@
+package alarm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/asiainfoLDP/datafoundry_data_integration/log"
+	"github.com/rcrowley/go-metrics"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var logger = log.GetLogger()
+
+const (
+	DefaultCapacity     = 1000
+	DefaultBackoff      = time.Second
+	DefaultMaxBackoff   = 5 * time.Minute
+	DefaultSpoolMax     = 10000
+	DefaultDedupWindow  = 5 * time.Minute
+	DefaultRateLimit    = 60
+	DefaultRateInterval = time.Minute
+
+	// the dedup records are purged when there are more of them.
+	dedupMaxRecords = 1000
+)
+
+// Alarm is sent to the to_alarm.json topic. Repeated is the number of the
+// same alarms suppressed before it.
+type Alarm struct {
+	Sender   string    `json:"sender"`
+	Content  string    `json:"content"`
+	SendTime time.Time `json:"sendTime"`
+	Repeated int       `json:"repeated,omitempty"`
+}
+
+// SendFunc sends an alarm, and fails if it should be retried later.
+type SendFunc func(alarm *Alarm) error
+
+type dedupRecord struct {
+	sender   string
+	time     time.Time
+	repeated int
+}
+
+// Queue buffers the alarms in memory and sends them in the background, so
+// that the loggers never wait for the sending. During an outage, the alarms
+// are held in order, in the SpoolFile if set so that they survive restarts,
+// and retried with exponential backoff. The alarms are dropped when the queue
+// or the spool is full, or when more than RateLimit are enqueued in a
+// RateInterval, and the same alarms are suppressed in a DedupWindow, at the
+// end of which their number is sent.
+type Queue struct {
+	Send         SendFunc
+	Backoff      time.Duration // before the first retry
+	MaxBackoff   time.Duration
+	SpoolFile    string // the alarms are only held in memory if empty
+	SpoolMax     int
+	DedupWindow  time.Duration
+	RateLimit    int // 0 for unlimited
+	RateInterval time.Duration
+
+	Sent       metrics.Counter
+	Dropped    metrics.Counter
+	Suppressed metrics.Counter
+	Spooled    metrics.Counter
+
+	queue chan *Alarm
+	start sync.Once
+	now   func() time.Time
+
+	mu          sync.Mutex
+	dedup       map[string]*dedupRecord
+	windowStart time.Time
+	windowCount int
+}
+
+// NewQueue returns a queue with the default options, and its metrics are
+// registered as alarm.sent, alarm.dropped, alarm.suppressed and alarm.spooled
+// in the registry.
+func NewQueue(send SendFunc, capacity int, registry metrics.Registry) *Queue {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Queue{
+		Send:         send,
+		Backoff:      DefaultBackoff,
+		MaxBackoff:   DefaultMaxBackoff,
+		SpoolMax:     DefaultSpoolMax,
+		DedupWindow:  DefaultDedupWindow,
+		RateLimit:    DefaultRateLimit,
+		RateInterval: DefaultRateInterval,
+
+		Sent:       metrics.GetOrRegisterCounter("alarm.sent", registry),
+		Dropped:    metrics.GetOrRegisterCounter("alarm.dropped", registry),
+		Suppressed: metrics.GetOrRegisterCounter("alarm.suppressed", registry),
+		Spooled:    metrics.GetOrRegisterCounter("alarm.spooled", registry),
+
+		queue: make(chan *Alarm, capacity),
+		now:   time.Now,
+		dedup: map[string]*dedupRecord{},
+	}
+}
+
+// Start starts the sender in the background once, until the stop channel is
+// closed. The alarms spooled before are sent first.
+func (q *Queue) Start(stop <-chan struct{}) {
+	q.start.Do(func() {
+		go q.run(stop)
+	})
+}
+
+// Enqueue puts the alarm into the queue without waiting, and returns false
+// if it's suppressed or dropped.
+func (q *Queue) Enqueue(alarm *Alarm) bool {
+	if !q.admit(alarm) {
+		return false
+	}
+
+	select {
+	case q.queue <- alarm:
+		return true
+	default:
+		q.Dropped.Inc(1)
+		return false
+	}
+}
+
+// admit deduplicates and rate limits the alarm.
+func (q *Queue) admit(alarm *Alarm) bool {
+	now := q.now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	record := q.dedup[alarm.Content]
+	if record != nil && now.Sub(record.time) < q.DedupWindow {
+		record.repeated++
+		q.Suppressed.Inc(1)
+		return false
+	}
+
+	if q.RateLimit > 0 {
+		if now.Sub(q.windowStart) >= q.RateInterval {
+			q.windowStart, q.windowCount = now, 0
+		}
+		if q.windowCount >= q.RateLimit {
+			q.Dropped.Inc(1)
+			return false
+		}
+		q.windowCount++
+	}
+
+	if record != nil {
+		alarm.Repeated = record.repeated
+	}
+	if len(q.dedup) >= dedupMaxRecords {
+		for content, r := range q.dedup {
+			if now.Sub(r.time) >= q.DedupWindow {
+				delete(q.dedup, content)
+			}
+		}
+	}
+	q.dedup[alarm.Content] = &dedupRecord{sender: alarm.Sender, time: now}
+	return true
+}
+
+// expiredRepeats removes the dedup records whose windows ended, and returns
+// the alarms of the suppressed repeats in them, so that the repeats are
+// reported even if the alarms don't come again.
+func (q *Queue) expiredRepeats() []*Alarm {
+	now := q.now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	repeats := []*Alarm{}
+	for content, r := range q.dedup {
+		if now.Sub(r.time) < q.DedupWindow {
+			continue
+		}
+		if r.repeated > 0 {
+			repeats = append(repeats, &Alarm{Sender: r.sender, Content: content, SendTime: now, Repeated: r.repeated})
+		}
+		delete(q.dedup, content)
+	}
+	return repeats
+}
+
+func (q *Queue) run(stop <-chan struct{}) {
+	held, err := loadSpool(q.SpoolFile)
+	if err != nil {
+		logger.Error("Load alarm spool %s err: %v", q.SpoolFile, err)
+	}
+
+	backoff := q.Backoff
+	var retry <-chan time.Time
+	if len(held) > 0 {
+		retry = time.After(0)
+	}
+	send := func(alarm *Alarm) {
+		// the alarms are sent in order during an outage.
+		if len(held) > 0 {
+			held = q.hold(held, alarm)
+			return
+		}
+		if err := q.Send(alarm); err != nil {
+			logger.Warn("Send alarm err: %v, retry in %v", err, backoff)
+			held = q.hold(held, alarm)
+			retry = time.After(backoff)
+			return
+		}
+		q.Sent.Inc(1)
+	}
+
+	var expire <-chan time.Time
+	if q.DedupWindow > 0 {
+		ticker := time.NewTicker(q.DedupWindow)
+		defer ticker.Stop()
+		expire = ticker.C
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case alarm := <-q.queue:
+			send(alarm)
+		case <-expire:
+			for _, alarm := range q.expiredRepeats() {
+				send(alarm)
+			}
+		case <-retry:
+			held = q.flush(held)
+			if len(held) == 0 {
+				backoff, retry = q.Backoff, nil
+				continue
+			}
+			if backoff *= 2; backoff > q.MaxBackoff {
+				backoff = q.MaxBackoff
+			}
+			logger.Warn("%d alarms held, retry in %v", len(held), backoff)
+			retry = time.After(backoff)
+		}
+	}
+}
+
+// hold appends the alarm to the held ones and the spool, or drops it if the
+// spool is full.
+func (q *Queue) hold(held []*Alarm, alarm *Alarm) []*Alarm {
+	if len(held) >= q.SpoolMax {
+		q.Dropped.Inc(1)
+		return held
+	}
+	if err := appendSpool(q.SpoolFile, alarm); err != nil {
+		logger.Error("Spool alarm to %s err: %v", q.SpoolFile, err)
+	}
+	q.Spooled.Inc(1)
+	return append(held, alarm)
+}
+
+// flush sends the held alarms in order until a failure, and returns the
+// unsent ones.
+func (q *Queue) flush(held []*Alarm) []*Alarm {
+	sent := 0
+	for _, alarm := range held {
+		if err := q.Send(alarm); err != nil {
+			break
+		}
+		q.Sent.Inc(1)
+		sent++
+	}
+	if sent == 0 {
+		return held
+	}
+
+	held = held[sent:]
+	if err := rewriteSpool(q.SpoolFile, held); err != nil {
+		logger.Error("Rewrite alarm spool %s err: %v", q.SpoolFile, err)
+	}
+	return held
+}
+
+// loadSpool reads the alarms in the spool, a json per line. The broken lines
+// are skipped.
+func loadSpool(name string) ([]*Alarm, error) {
+	if name == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	alarms := []*Alarm{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		alarm := &Alarm{}
+		if err := json.Unmarshal(scanner.Bytes(), alarm); err != nil {
+			logger.Warn("Skip broken alarm in spool %s: %v", name, err)
+			continue
+		}
+		alarms = append(alarms, alarm)
+	}
+	return alarms, scanner.Err()
+}
+
+func appendSpool(name string, alarm *Alarm) error {
+	if name == "" {
+		return nil
+	}
+	data, err := json.Marshal(alarm)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewriteSpool replaces the spool with the alarms atomically, or removes it
+// if there are none.
+func rewriteSpool(name string, alarms []*Alarm) error {
+	if name == "" {
+		return nil
+	}
+	if len(alarms) == 0 {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	for _, alarm := range alarms {
+		data, err := json.Marshal(alarm)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
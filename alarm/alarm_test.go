@@ -0,0 +1,178 @@
+package alarm
+
+import (
+	"errors"
+	"github.com/rcrowley/go-metrics"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMQ records the sent alarms, and fails while down.
+type fakeMQ struct {
+	mu   sync.Mutex
+	down bool
+	sent []string
+}
+
+func (mq *fakeMQ) send(alarm *Alarm) error {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	if mq.down {
+		return errors.New("mq is down")
+	}
+	mq.sent = append(mq.sent, alarm.Content)
+	return nil
+}
+
+func (mq *fakeMQ) setDown(down bool) {
+	mq.mu.Lock()
+	mq.down = down
+	mq.mu.Unlock()
+}
+
+func (mq *fakeMQ) waitSent(t *testing.T, n int) []string {
+	for i := 0; i < 200; i++ {
+		mq.mu.Lock()
+		sent := append([]string{}, mq.sent...)
+		mq.mu.Unlock()
+		if len(sent) >= n {
+			return sent
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d alarms", n)
+	return nil
+}
+
+func TestDedupAndRateLimit(t *testing.T) {
+	q := NewQueue(nil, 10, metrics.NewRegistry())
+	q.RateLimit = 2
+	now := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	enqueue := func(content string) bool { return q.Enqueue(&Alarm{Content: content}) }
+	if !enqueue("a") || enqueue("a") || enqueue("a") || !enqueue("b") {
+		t.Errorf("expect the repeated a suppressed")
+	}
+	if enqueue("c") {
+		t.Errorf("expect c over the rate limit")
+	}
+	if q.Suppressed.Count() != 2 || q.Dropped.Count() != 1 {
+		t.Errorf("suppressed %d, dropped %d", q.Suppressed.Count(), q.Dropped.Count())
+	}
+
+	now = now.Add(q.DedupWindow)
+	alarm := &Alarm{Content: "a"}
+	if !q.Enqueue(alarm) || alarm.Repeated != 2 {
+		t.Errorf("expect a with 2 repeats, got %v", alarm.Repeated)
+	}
+}
+
+func TestExpiredRepeats(t *testing.T) {
+	q := NewQueue(nil, 10, metrics.NewRegistry())
+	now := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	for _, content := range []string{"a", "a", "a", "b"} {
+		q.Enqueue(&Alarm{Sender: "integration", Content: content})
+	}
+	if repeats := q.expiredRepeats(); len(repeats) != 0 {
+		t.Errorf("expect no repeats within the window, got %v", repeats)
+	}
+
+	now = now.Add(q.DedupWindow)
+	repeats := q.expiredRepeats()
+	if len(repeats) != 1 || repeats[0].Content != "a" || repeats[0].Sender != "integration" || repeats[0].Repeated != 2 {
+		t.Fatalf("expect a with 2 repeats, got %v", repeats)
+	}
+	if len(q.dedup) != 0 || len(q.expiredRepeats()) != 0 {
+		t.Errorf("expect the repeats reported once")
+	}
+	alarm := &Alarm{Content: "a"}
+	if !q.Enqueue(alarm) || alarm.Repeated != 0 {
+		t.Errorf("expect a again without the reported repeats, got %d", alarm.Repeated)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	q := NewQueue(nil, 2, metrics.NewRegistry())
+	for _, content := range []string{"a", "b", "c"} {
+		q.Enqueue(&Alarm{Content: content})
+	}
+	if len(q.queue) != 2 || q.Dropped.Count() != 1 {
+		t.Errorf("queued %d, dropped %d", len(q.queue), q.Dropped.Count())
+	}
+}
+
+func TestSpoolDuringOutage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alarm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mq := &fakeMQ{down: true}
+	q := NewQueue(mq.send, 10, metrics.NewRegistry())
+	q.SpoolFile = filepath.Join(dir, "alarms.spool")
+	q.Backoff = 10 * time.Millisecond
+	stop := make(chan struct{})
+	q.Start(stop)
+
+	for _, content := range []string{"a", "b", "c"} {
+		q.Enqueue(&Alarm{Content: content})
+	}
+	for i := 0; i < 200 && q.Spooled.Count() < 3; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+
+	// a restarted queue sends the spooled alarms first, in order.
+	spooled, err := loadSpool(q.SpoolFile)
+	if err != nil || len(spooled) != 3 {
+		t.Fatalf("expect 3 spooled alarms, got %d: %v", len(spooled), err)
+	}
+	mq.setDown(false)
+	q = NewQueue(mq.send, 10, metrics.NewRegistry())
+	q.SpoolFile = filepath.Join(dir, "alarms.spool")
+	stop = make(chan struct{})
+	defer close(stop)
+	q.Start(stop)
+	q.Enqueue(&Alarm{Content: "d"})
+
+	if sent := mq.waitSent(t, 4); !reflect.DeepEqual(sent, []string{"a", "b", "c", "d"}) {
+		t.Errorf("unexpected sent alarms %v", sent)
+	}
+	for i := 0; i < 200; i++ {
+		if _, err := os.Stat(q.SpoolFile); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Errorf("expect the spool removed")
+}
+
+func TestRetryInMemory(t *testing.T) {
+	mq := &fakeMQ{down: true}
+	q := NewQueue(mq.send, 10, metrics.NewRegistry())
+	q.Backoff = 5 * time.Millisecond
+	stop := make(chan struct{})
+	defer close(stop)
+	q.Start(stop)
+
+	q.Enqueue(&Alarm{Content: "a"})
+	q.Enqueue(&Alarm{Content: "b"})
+	time.Sleep(30 * time.Millisecond)
+	mq.setDown(false)
+
+	if sent := mq.waitSent(t, 2); !reflect.DeepEqual(sent, []string{"a", "b"}) {
+		t.Errorf("unexpected sent alarms %v", sent)
+	}
+	if q.Sent.Count() != 2 {
+		t.Errorf("sent %d", q.Sent.Count())
+	}
+}
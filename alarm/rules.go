@@ -0,0 +1,404 @@
+package alarm
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/rcrowley/go-metrics"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultEvalInterval = 15 * time.Second
+	DefaultCooldown     = 30 * time.Minute
+
+	FuncValue    = "value"    // the current value of the metric
+	FuncIncrease = "increase" // the increase of the metric in the window
+
+	FiringPrefix   = "[FIRING]"
+	ResolvedPrefix = "[RESOLVED]"
+)
+
+// Duration is a time.Duration in the rules files, e.g. "90s" or "5m", or a
+// number of seconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// Rule fires when the metric, divided by the per metric if set, compares to
+// the threshold by op for the For duration. The metrics are read from the
+// registry of the rules: the counts of the counters, meters, histograms and
+// timers, and the values of the gauges; missing metrics are 0.
+//
+// The notifications of a rule are at least Cooldown apart, a rule still
+// firing is notified again after it, and a resolved notification follows a
+// notified firing.
+type Rule struct {
+	Name      string   `json:"name"`
+	Metric    string   `json:"metric"`
+	Per       string   `json:"per,omitempty"`
+	MinPer    float64  `json:"minPer,omitempty"` // the ratio is ignored if per is less
+	Func      string   `json:"func,omitempty"`   // FuncValue by default
+	Window    Duration `json:"window,omitempty"` // for FuncIncrease
+	Op        string   `json:"op"`
+	Threshold float64  `json:"threshold"`
+	For       Duration `json:"for,omitempty"`
+	Cooldown  Duration `json:"cooldown,omitempty"` // DefaultCooldown by default
+	Message   string   `json:"message,omitempty"`
+}
+
+var ruleOps = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// DefaultRules watch the signals of the service: the db unreachable in the
+// successive checks, the auth failure rate, the handler timeouts and the
+// migrations stuck in the upgrading phase.
+var DefaultRules = []*Rule{
+	{
+		Name:      "db_unreachable",
+		Metric:    "db.unreachable.ticks",
+		Op:        ">=",
+		Threshold: 3,
+		Message:   "the db is unreachable",
+	},
+	{
+		Name:      "auth_failure_rate",
+		Metric:    "auth.failures",
+		Per:       "auth.requests",
+		MinPer:    20,
+		Func:      FuncIncrease,
+		Window:    Duration(5 * time.Minute),
+		Op:        ">",
+		Threshold: 0.5,
+		Message:   "most of the auth requests failed",
+	},
+	{
+		Name:      "http_timeouts",
+		Metric:    "http.timeouts",
+		Func:      FuncIncrease,
+		Window:    Duration(5 * time.Minute),
+		Op:        ">=",
+		Threshold: 10,
+		Message:   "the handlers timed out",
+	},
+	{
+		Name:      "db_upgrade_stuck",
+		Metric:    "db.phase",
+		Op:        "==",
+		Threshold: 1, // models.DbPhase_Upgrading
+		For:       Duration(10 * time.Minute),
+		Message:   "the db is stuck in upgrading",
+	},
+}
+
+// Validate checks the rule, and sets the defaults of the optional fields.
+func (rule *Rule) Validate() error {
+	if rule.Name == "" {
+		return fmt.Errorf("the name of a rule is needed")
+	}
+	if rule.Metric == "" {
+		return fmt.Errorf("rule %s: metric is needed", rule.Name)
+	}
+	if ruleOps[rule.Op] == nil {
+		return fmt.Errorf("rule %s: unknown op %q", rule.Name, rule.Op)
+	}
+
+	switch rule.Func {
+	case "":
+		rule.Func = FuncValue
+	case FuncValue:
+	case FuncIncrease:
+		if rule.Window <= 0 {
+			return fmt.Errorf("rule %s: window is needed by %s", rule.Name, FuncIncrease)
+		}
+	default:
+		return fmt.Errorf("rule %s: unknown func %q", rule.Name, rule.Func)
+	}
+
+	if rule.For < 0 || rule.Window < 0 || rule.Cooldown < 0 {
+		return fmt.Errorf("rule %s: negative duration", rule.Name)
+	}
+	if rule.Cooldown == 0 {
+		rule.Cooldown = Duration(DefaultCooldown)
+	}
+	return nil
+}
+
+// ParseRules parses the rules in yaml or json, e.g.
+//
+//	rules:
+//	  - name: db_unreachable
+//	    metric: db.unreachable.ticks
+//	    op: ">="
+//	    threshold: 3
+//	    cooldown: 30m
+func ParseRules(data []byte) ([]*Rule, error) {
+	file := struct {
+		Rules []*Rule `json:"rules"`
+	}{}
+	if err := common.UnmarshalYaml(data, &file); err != nil {
+		return nil, err
+	}
+	if err := validateRules(file.Rules); err != nil {
+		return nil, err
+	}
+	return file.Rules, nil
+}
+
+func validateRules(rules []*Rule) error {
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if rule == nil {
+			return fmt.Errorf("empty rule")
+		}
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return nil
+}
+
+// LoadRules reads the rules from the file.
+func LoadRules(name string) ([]*Rule, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return rules, nil
+}
+
+type ruleSample struct {
+	time  time.Time
+	value float64
+	per   float64
+}
+
+type ruleState struct {
+	samples      []ruleSample
+	pendingSince time.Time // when the condition became true
+	firing       bool
+	announced    bool // the firing is notified
+	notified     time.Time
+}
+
+// Evaluator evaluates the rules over the metrics of the registry every
+// Interval, and sends the notifications, prefixed by FiringPrefix or
+// ResolvedPrefix, by Notify.
+type Evaluator struct {
+	Rules    []*Rule
+	Registry metrics.Registry
+	Notify   func(msg string)
+	Interval time.Duration
+
+	now func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*ruleState
+}
+
+// NewEvaluator validates the rules, and returns an evaluator of them.
+func NewEvaluator(rules []*Rule, registry metrics.Registry, notify func(msg string)) (*Evaluator, error) {
+	// the rules are defaulted by the validation, so they are copied, e.g. not
+	// to change the shared DefaultRules.
+	copied := make([]*Rule, len(rules))
+	for i, rule := range rules {
+		if rule != nil {
+			r := *rule
+			copied[i] = &r
+		}
+	}
+	if err := validateRules(copied); err != nil {
+		return nil, err
+	}
+	return &Evaluator{
+		Rules:    copied,
+		Registry: registry,
+		Notify:   notify,
+		Interval: DefaultEvalInterval,
+		now:      time.Now,
+		states:   map[string]*ruleState{},
+	}, nil
+}
+
+// Loop evaluates the rules until the stop channel is closed.
+func (e *Evaluator) Loop(stop <-chan struct{}) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			e.Evaluate()
+		}
+	}
+}
+
+// Evaluate evaluates the rules once.
+func (e *Evaluator) Evaluate() {
+	now := e.now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rule := range e.Rules {
+		state := e.states[rule.Name]
+		if state == nil {
+			state = &ruleState{}
+			e.states[rule.Name] = state
+		}
+		if msg := e.evaluate(rule, state, now); msg != "" {
+			e.Notify(msg)
+		}
+	}
+}
+
+// evaluate updates the state of the rule, and returns the notification if
+// there is one.
+func (e *Evaluator) evaluate(rule *Rule, state *ruleState, now time.Time) string {
+	value, ok := rule.value(state, ruleSample{
+		time:  now,
+		value: metricValue(e.Registry, rule.Metric),
+		per:   metricValue(e.Registry, rule.Per),
+	})
+	cooled := now.Sub(state.notified) >= time.Duration(rule.Cooldown)
+
+	if ok && ruleOps[rule.Op](value, rule.Threshold) {
+		if state.pendingSince.IsZero() {
+			state.pendingSince = now
+		}
+		if now.Sub(state.pendingSince) < time.Duration(rule.For) {
+			return ""
+		}
+		state.firing = true
+		if !cooled {
+			return ""
+		}
+		state.announced, state.notified = true, now
+		return fmt.Sprintf("%s %s: %s (%s %g %s %g)", FiringPrefix, rule.Name, rule.Message,
+			rule.Metric, value, rule.Op, rule.Threshold)
+	}
+
+	state.pendingSince = time.Time{}
+	if !state.firing {
+		return ""
+	}
+	state.firing = false
+	if !state.announced {
+		return ""
+	}
+	state.announced, state.notified = false, now
+	return fmt.Sprintf("%s %s: %s (%s %g)", ResolvedPrefix, rule.Name, rule.Message, rule.Metric, value)
+}
+
+// value adds the sample, and returns the value of the rule, which is not ok
+// if the per metric is less than MinPer.
+func (rule *Rule) value(state *ruleState, sample ruleSample) (float64, bool) {
+	value, per := sample.value, sample.per
+	if rule.Func == FuncIncrease {
+		// the oldest sample kept is the last one at or before the window.
+		state.samples = append(state.samples, sample)
+		start := sample.time.Add(-time.Duration(rule.Window))
+		i := 0
+		for i+1 < len(state.samples) && !state.samples[i+1].time.After(start) {
+			i++
+		}
+		state.samples = state.samples[i:]
+
+		first := state.samples[0]
+		value, per = increase(first.value, value), increase(first.per, per)
+	}
+
+	if rule.Per == "" {
+		return value, true
+	}
+	if per <= 0 || per < rule.MinPer {
+		return 0, false
+	}
+	return value / per, true
+}
+
+// increase returns the increase of a counter, which restarts from 0 when
+// it's reset.
+func increase(from, to float64) float64 {
+	if to < from {
+		return to
+	}
+	return to - from
+}
+
+func metricValue(registry metrics.Registry, name string) float64 {
+	if name == "" {
+		return 0
+	}
+	switch m := registry.Get(name).(type) {
+	case metrics.Counter:
+		return float64(m.Count())
+	case metrics.Gauge:
+		return float64(m.Value())
+	case metrics.GaugeFloat64:
+		return m.Value()
+	case metrics.Meter:
+		return float64(m.Count())
+	case metrics.Histogram:
+		return float64(m.Count())
+	case metrics.Timer:
+		return float64(m.Count())
+	}
+	return 0
+}
+
+// String describes the rule in the logs.
+func (rule *Rule) String() string {
+	s := []string{rule.Name + ":"}
+	if rule.Func == FuncIncrease {
+		s = append(s, fmt.Sprintf("increase(%s[%v])", rule.Metric, time.Duration(rule.Window)))
+	} else {
+		s = append(s, rule.Metric)
+	}
+	if rule.Per != "" {
+		s = append(s, "/", rule.Per)
+	}
+	s = append(s, rule.Op, fmt.Sprintf("%g", rule.Threshold))
+	if rule.For > 0 {
+		s = append(s, "for", time.Duration(rule.For).String())
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,181 @@
+package alarm
+
+import (
+	"github.com/rcrowley/go-metrics"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]byte(`
+rules:
+  - name: timeouts
+    metric: http.timeouts
+    func: increase
+    window: 5m
+    op: ">="
+    threshold: 10
+    cooldown: 90
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Rule{Name: "timeouts", Metric: "http.timeouts", Func: FuncIncrease,
+		Window: Duration(5 * time.Minute), Op: ">=", Threshold: 10, Cooldown: Duration(90 * time.Second)}
+	if len(rules) != 1 || !reflect.DeepEqual(rules[0], expected) {
+		t.Errorf("unexpected rules %+v", rules)
+	}
+
+	rules, err = ParseRules([]byte(`{"rules": [{"name": "db", "metric": "db.phase", "op": "==", "threshold": 1, "for": "10m"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules[0].Func != FuncValue || rules[0].For != Duration(10*time.Minute) || rules[0].Cooldown != Duration(DefaultCooldown) {
+		t.Errorf("unexpected rule %+v", rules[0])
+	}
+
+	for _, data := range []string{
+		`rules: [{name: a, metric: m, op: "=", threshold: 1}]`,
+		`rules: [{name: a, metric: m, op: ">", func: increase, threshold: 1}]`,
+		`rules: [{name: a, metric: m, op: ">", threshold: 1}, {name: a, metric: n, op: ">", threshold: 1}]`,
+		`rules: [{name: a, metric: m, op: ">", threshold: 1, for: soon}]`,
+	} {
+		if _, err := ParseRules([]byte(data)); err == nil {
+			t.Errorf("expect error of %s", data)
+		}
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	before := make([]Rule, len(DefaultRules))
+	for i, rule := range DefaultRules {
+		before[i] = *rule
+	}
+	e, err := NewEvaluator(DefaultRules, metrics.NewRegistry(), func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, rule := range DefaultRules {
+		if !reflect.DeepEqual(*rule, before[i]) || e.Rules[i] == rule {
+			t.Errorf("expect the default rule %s not changed or shared", rule.Name)
+		}
+	}
+}
+
+// ruleTester evaluates the rules with a fake clock, and collects the
+// notifications.
+type ruleTester struct {
+	*Evaluator
+	clock time.Time
+	sent  []string
+}
+
+func newRuleTester(t *testing.T, registry metrics.Registry, rules ...*Rule) *ruleTester {
+	rt := &ruleTester{clock: time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)}
+	e, err := NewEvaluator(rules, registry, func(msg string) { rt.sent = append(rt.sent, msg) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.now = func() time.Time { return rt.clock }
+	rt.Evaluator = e
+	return rt
+}
+
+// tick advances the clock and evaluates, and returns the prefixes of the
+// new notifications.
+func (rt *ruleTester) tick(d time.Duration) []string {
+	rt.clock = rt.clock.Add(d)
+	n := len(rt.sent)
+	rt.Evaluate()
+	prefixes := []string{}
+	for _, msg := range rt.sent[n:] {
+		prefixes = append(prefixes, strings.SplitN(msg, " ", 2)[0])
+	}
+	return prefixes
+}
+
+func TestRuleForCooldownAndRecovery(t *testing.T) {
+	registry := metrics.NewRegistry()
+	ticks := metrics.GetOrRegisterGauge("db.unreachable.ticks", registry)
+	rt := newRuleTester(t, registry, &Rule{Name: "db", Metric: "db.unreachable.ticks", Op: ">=", Threshold: 3,
+		For: Duration(10 * time.Second), Cooldown: Duration(time.Minute), Message: "db down"})
+
+	ticks.Update(3)
+	if sent := rt.tick(0); len(sent) != 0 {
+		t.Errorf("expect pending, got %v", sent)
+	}
+	if sent := rt.tick(10 * time.Second); !reflect.DeepEqual(sent, []string{FiringPrefix}) {
+		t.Errorf("expect firing, got %v", sent)
+	}
+	if rt.sent[0] != "[FIRING] db: db down (db.unreachable.ticks 3 >= 3)" {
+		t.Errorf("unexpected notification %q", rt.sent[0])
+	}
+	if sent := rt.tick(30 * time.Second); len(sent) != 0 {
+		t.Errorf("expect cooldown, got %v", sent)
+	}
+	if sent := rt.tick(30 * time.Second); !reflect.DeepEqual(sent, []string{FiringPrefix}) {
+		t.Errorf("expect firing again, got %v", sent)
+	}
+
+	ticks.Update(0)
+	if sent := rt.tick(5 * time.Second); !reflect.DeepEqual(sent, []string{ResolvedPrefix}) {
+		t.Errorf("expect resolved, got %v", sent)
+	}
+
+	// a flap in the cooldown is neither notified nor resolved.
+	ticks.Update(5)
+	rt.tick(5 * time.Second)
+	if sent := rt.tick(10 * time.Second); len(sent) != 0 {
+		t.Errorf("expect cooldown, got %v", sent)
+	}
+	ticks.Update(0)
+	if sent := rt.tick(5 * time.Second); len(sent) != 0 {
+		t.Errorf("expect silent recovery, got %v", sent)
+	}
+}
+
+func TestRuleIncreaseRatio(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requests := metrics.GetOrRegisterCounter("auth.requests", registry)
+	failures := metrics.GetOrRegisterCounter("auth.failures", registry)
+	rt := newRuleTester(t, registry, &Rule{Name: "auth", Metric: "auth.failures", Per: "auth.requests", MinPer: 10,
+		Func: FuncIncrease, Window: Duration(time.Minute), Op: ">", Threshold: 0.5})
+
+	// the failures before the window don't count.
+	requests.Inc(100)
+	failures.Inc(100)
+	rt.tick(0)
+	requests.Inc(5)
+	failures.Inc(5)
+	if sent := rt.tick(30 * time.Second); len(sent) != 0 {
+		t.Errorf("expect too few requests, got %v", sent)
+	}
+	requests.Inc(10)
+	failures.Inc(6)
+	if sent := rt.tick(30 * time.Second); !reflect.DeepEqual(sent, []string{FiringPrefix}) {
+		t.Errorf("expect firing at 11/15, got %v", sent)
+	}
+
+	// 6 of the 40 requests in the last minute failed.
+	requests.Inc(30)
+	if sent := rt.tick(30 * time.Second); !reflect.DeepEqual(sent, []string{ResolvedPrefix}) {
+		t.Errorf("expect resolved, got %v", sent)
+	}
+}
+
+func TestRuleCounterReset(t *testing.T) {
+	registry := metrics.NewRegistry()
+	timeouts := metrics.GetOrRegisterCounter("http.timeouts", registry)
+	rt := newRuleTester(t, registry, &Rule{Name: "timeouts", Metric: "http.timeouts",
+		Func: FuncIncrease, Window: Duration(time.Minute), Op: ">=", Threshold: 3})
+
+	timeouts.Inc(10)
+	rt.tick(0)
+	timeouts.Clear()
+	timeouts.Inc(3)
+	if sent := rt.tick(10 * time.Second); !reflect.DeepEqual(sent, []string{FiringPrefix}) {
+		t.Errorf("expect firing after reset, got %v", sent)
+	}
+}
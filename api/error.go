@@ -21,25 +21,58 @@ const (
 
 	ErrorCodeNone = 0
 
-	ErrorCodeUnkown            = 1300
-	ErrorCodeJsonBuilding      = 1301
-	ErrorCodeParseJsonFailed   = 1302
-	ErrorCodeUrlNotSupported   = 1303
-	ErrorCodeDbNotInitlized    = 1304
-	ErrorCodeAuthFailed        = 1305
-	ErrorCodePermissionDenied  = 1306
-	ErrorCodeInvalidParameters = 1307
-	ErrorCodeRecordRepository  = 1308
-	ErrorCodeUpdateBalance     = 1309
-	ErrorCodeModifyApp         = 1310
-	ErrorCodeGetApp            = 1311
-	ErrorCodeQueryRepositorys  = 1312
-	ErrorCodeGetAiPayMsg       = 1313
-	ErrorCodeAmountsInvalid    = 1314
-	ErrorCodeAmountsNegative   = 1315
-	ErrorCodeAmountsTooBig     = 1316
-	ErrorCodeQueryDataitemss   = 1317
-	ErrorCodeQueryAttribute    = 1317
+	ErrorCodeUnkown                = 1300
+	ErrorCodeJsonBuilding          = 1301
+	ErrorCodeParseJsonFailed       = 1302
+	ErrorCodeUrlNotSupported       = 1303
+	ErrorCodeDbNotInitlized        = 1304
+	ErrorCodeAuthFailed            = 1305
+	ErrorCodePermissionDenied      = 1306
+	ErrorCodeInvalidParameters     = 1307
+	ErrorCodeRecordRepository      = 1308
+	ErrorCodeUpdateBalance         = 1309
+	ErrorCodeModifyApp             = 1310
+	ErrorCodeGetApp                = 1311
+	ErrorCodeQueryRepositorys      = 1312
+	ErrorCodeGetAiPayMsg           = 1313
+	ErrorCodeAmountsInvalid        = 1314
+	ErrorCodeAmountsNegative       = 1315
+	ErrorCodeAmountsTooBig         = 1316
+	ErrorCodeQueryDataitemss       = 1317
+	ErrorCodeQueryAttribute        = 1317
+	ErrorCodeAddTags               = 1318
+	ErrorCodeRemoveTag             = 1319
+	ErrorCodeQueryTags             = 1320
+	ErrorCodeTagNotFound           = 1321
+	ErrorCodeQueryClasses          = 1322
+	ErrorCodeCreateClass           = 1323
+	ErrorCodeUpdateClass           = 1324
+	ErrorCodeDeleteClass           = 1325
+	ErrorCodeClassNotFound         = 1326
+	ErrorCodeUpdateAttributes      = 1327
+	ErrorCodeInvalidAttributes     = 1328
+	ErrorCodeQuerySchemaVersions   = 1329
+	ErrorCodeSchemaVersionNotFound = 1330
+	ErrorCodeIncompatibleSchema    = 1331
+	ErrorCodeUpdateCompatMode      = 1332
+	ErrorCodeInferAttributes       = 1333
+	ErrorCodeIntrospectTable       = 1334
+	ErrorCodeRenderDictionary      = 1335
+	ErrorCodeImportAttributes      = 1336
+	ErrorCodeImportCatalog         = 1337
+	ErrorCodeRepoManaged           = 1338
+	ErrorCodeQueryReconcileRuns    = 1339
+	ErrorCodeReconcileRunNotFound  = 1340
+	ErrorCodeExportArchive         = 1341
+	ErrorCodeRenderDcat            = 1342
+	ErrorCodeQueryChanges          = 1343
+	ErrorCodeCreateWebhook         = 1344
+	ErrorCodeQueryWebhooks         = 1345
+	ErrorCodeWebhookNotFound       = 1346
+	ErrorCodeDeleteWebhook         = 1347
+	ErrorCodeQueryDeliveries       = 1348
+	ErrorCodeDeliveryNotFound      = 1349
+	ErrorCodeRedeliver             = 1350
 
 	NumErrors = 1500 // about 12k memroy wasted
 )
@@ -67,6 +100,39 @@ func init() {
 	initError(ErrorCodeAmountsTooBig, "recharge amount is too big")
 	initError(ErrorCodeQueryDataitemss, "failed to query dataitems")
 	initError(ErrorCodeQueryAttribute, "failed to query attributes")
+	initError(ErrorCodeAddTags, "failed to add tags")
+	initError(ErrorCodeRemoveTag, "failed to remove tag")
+	initError(ErrorCodeQueryTags, "failed to query tags")
+	initError(ErrorCodeTagNotFound, "tag not found")
+	initError(ErrorCodeQueryClasses, "failed to query classes")
+	initError(ErrorCodeCreateClass, "failed to create class")
+	initError(ErrorCodeUpdateClass, "failed to update class")
+	initError(ErrorCodeDeleteClass, "failed to delete class")
+	initError(ErrorCodeClassNotFound, "class not found")
+	initError(ErrorCodeUpdateAttributes, "failed to update attributes")
+	initError(ErrorCodeInvalidAttributes, "invalid attributes")
+	initError(ErrorCodeQuerySchemaVersions, "failed to query schema versions")
+	initError(ErrorCodeSchemaVersionNotFound, "schema version not found")
+	initError(ErrorCodeIncompatibleSchema, "incompatible schema")
+	initError(ErrorCodeUpdateCompatMode, "failed to update compatibility mode")
+	initError(ErrorCodeInferAttributes, "failed to infer attributes")
+	initError(ErrorCodeIntrospectTable, "failed to introspect table")
+	initError(ErrorCodeRenderDictionary, "failed to render data dictionary")
+	initError(ErrorCodeImportAttributes, "failed to import attributes")
+	initError(ErrorCodeImportCatalog, "failed to import catalog")
+	initError(ErrorCodeRepoManaged, "repository is managed by a reconciler")
+	initError(ErrorCodeQueryReconcileRuns, "failed to query reconcile runs")
+	initError(ErrorCodeReconcileRunNotFound, "reconcile run not found")
+	initError(ErrorCodeExportArchive, "failed to export catalog archive")
+	initError(ErrorCodeRenderDcat, "failed to render dcat catalog")
+	initError(ErrorCodeQueryChanges, "failed to query changes")
+	initError(ErrorCodeCreateWebhook, "failed to create webhook")
+	initError(ErrorCodeQueryWebhooks, "failed to query webhooks")
+	initError(ErrorCodeWebhookNotFound, "webhook not found")
+	initError(ErrorCodeDeleteWebhook, "failed to delete webhook")
+	initError(ErrorCodeQueryDeliveries, "failed to query webhook deliveries")
+	initError(ErrorCodeDeliveryNotFound, "webhook delivery not found")
+	initError(ErrorCodeRedeliver, "failed to redeliver")
 
 	ErrorNone = GetError(ErrorCodeNone)
 	ErrorUnkown = GetError(ErrorCodeUnkown)
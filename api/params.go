@@ -2,25 +2,25 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
-	//"net"
 
 	"github.com/julienschmidt/httprouter"
-	//"github.com/miekg/dns"
 
 	_ "github.com/go-sql-driver/mysql"
 
+	"github.com/asiainfoLDP/datafoundry_data_integration/alarm"
 	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/discovery"
 	"github.com/asiainfoLDP/datafoundry_data_integration/log"
 
 	"github.com/asiainfoLDP/datahub_commons/mq"
 	"github.com/astaxie/beego/logs"
-	"github.com/miekg/dns"
-	"net"
+	"github.com/rcrowley/go-metrics"
 	"sync"
 	"sync/atomic"
 	"unsafe"
@@ -108,6 +108,19 @@ func NewQueryListResult(count int64, results interface{}) *QueryListResult {
 	return &QueryListResult{Total: count, Results: results}
 }
 
+// QueryPageResult is the result of a cursor paginated listing.
+// Next and Prev are the cursors of the adjacent pages.
+type QueryPageResult struct {
+	Total   *int64      `json:"total,omitempty"`
+	Next    string      `json:"next,omitempty"`
+	Prev    string      `json:"prev,omitempty"`
+	Results interface{} `json:"results"`
+}
+
+func NewQueryPageResult(count *int64, next, prev string, results interface{}) *QueryPageResult {
+	return &QueryPageResult{Total: count, Next: next, Prev: prev, Results: results}
+}
+
 //======================================================
 //
 //======================================================
@@ -366,6 +379,13 @@ func OptionalOffsetAndSize(r *http.Request, defaultSize int64, minSize int64, ma
 	return page * size, int(size)
 }
 
+// OptionalCursorAndCount returns the cursor query param and whether or not
+// the total count is needed. The count is skipped in cursor mode by default.
+func OptionalCursorAndCount(r *http.Request) (string, bool) {
+	cursor := r.Form.Get("cursor")
+	return cursor, optionalBoolParamInQuery(r, "count", cursor == "")
+}
+
 func mustOffsetAndSize(r *http.Request, defaultSize, minSize, maxSize int) (offset int64, size int, e *Error) {
 	if minSize < 1 {
 		minSize = 1
@@ -415,26 +435,55 @@ func mustOffsetAndSize(r *http.Request, defaultSize, minSize, maxSize int) (offs
 //
 //==================================================================
 
+// InitMQ connects to kafka, and reconnects when its endpoints change.
 func InitMQ() {
-RETRY:
+	watcher := getKafkaWatcher()
+	watcher.OnChange(func(endpoints []discovery.Endpoint) {
+		logger.Info("Kafka moved to %v, reconnect.", endpoints)
+		connectMQ(endpoints)
+	})
 
-	//kafkas := net.JoinHostPort(KafkaAddrPort())
-	ip, port := "10.1.235.98", "9092"
-	kafkas := fmt.Sprintf("%s:%s", ip, port)
-	logger.Info("connectMQ, kafkas = %s", kafkas)
+	for connectMQ(watcher.Endpoints()) != nil {
+		time.Sleep(10 * time.Second)
+		watcher.Refresh()
+	}
+
+	logger.Info("MQ inited successfully.")
+}
 
-	messageQueue, err := mq.NewMQ([]string{kafkas}) // ex. {"192.168.1.1:9092", "192.168.1.2:9092"}
+// connectMQ connects to the kafka brokers, and closes the old connection.
+func connectMQ(endpoints []discovery.Endpoint) error {
+	kafkas := make([]string, len(endpoints))
+	for i, endpoint := range endpoints {
+		kafkas[i] = endpoint.String()
+	}
+	logger.Info("connectMQ, kafkas = %v", kafkas)
+
+	messageQueue, err := mq.NewMQ(kafkas) // ex. {"192.168.1.1:9092", "192.168.1.2:9092"}
 	if err != nil {
-		logger.Error("connectMQ error:", err.Error())
-		time.Sleep(10 * time.Second)
-		goto RETRY
+		logger.Error("connectMQ error: %v", err)
+		return err
 	}
 
 	q := &MQ{MessageQueue: messageQueue}
 
-	atomic.StorePointer(&theMQ, unsafe.Pointer(q))
+	old := (*MQ)(atomic.SwapPointer(&theMQ, unsafe.Pointer(q)))
+	if old != nil {
+		old.MessageQueue.Close()
+	}
+	return nil
+}
 
-	logger.Info("MQ inited successfully.")
+// MQProducer sends the messages by the mq of InitMQ, which is reconnected
+// when kafka moves. It's an events.Producer.
+type MQProducer struct{}
+
+func (MQProducer) SendSyncMessage(topic string, key, message []byte) (int32, int64, error) {
+	q := getMQ()
+	if q == nil {
+		return -1, -1, errMQNotInited
+	}
+	return q.MessageQueue.SendSyncMessage(topic, key, message)
 }
 
 type MQ struct {
@@ -446,139 +495,99 @@ func getMQ() *MQ {
 	return (*MQ)(atomic.LoadPointer(&theMQ))
 }
 
-func KafkaAddrPort() (string, string) {
-	switch Platform {
-	case Platform_DaoCloud:
-		entryList := dnsExchange(os.Getenv("kafka_service_name"))
+var (
+	kafkaWatcher     *discovery.Watcher
+	kafkaWatcherOnce sync.Once
+)
 
-		for _, v := range entryList {
-			if v.Port == "9092" {
-				return v.Ip, v.Port
-			}
+// getKafkaWatcher resolves kafka by KAFKA_ADDRS or KAFKA_CONSUL_SERVICE, or
+// by the platform.
+func getKafkaWatcher() *discovery.Watcher {
+	kafkaWatcherOnce.Do(func() {
+		fallback := kafkaResolver()
+		resolver, err := discovery.FromEnv("KAFKA", fallback)
+		if err != nil {
+			logger.Error("Resolver of kafka err: %v, fall back to the platform.", err)
+			resolver = fallback
 		}
+		kafkaWatcher = discovery.NewWatcher("kafka", resolver)
+		kafkaWatcher.Start(nil)
+	})
+	return kafkaWatcher
+}
+
+func kafkaResolver() discovery.Resolver {
+	switch Platform {
+	case Platform_DaoCloud:
+		consul := discovery.NewConsulDNS(os.Getenv("kafka_service_name"))
+		consul.Port = "9092"
+		return consul
 	case Platform_DataOS:
-		return os.Getenv(os.Getenv("ENV_NAME_KAFKA_ADDR")), os.Getenv(os.Getenv("ENV_NAME_KAFKA_PORT"))
-	case Platform_DaoCloudUT:
-		fallthrough
-	case Platform_Local:
-		return os.Getenv("MQ_KAFKA_ADDR"), os.Getenv("MQ_KAFKA_PORT")
+		return &discovery.Env{AddrEnv: "ENV_NAME_KAFKA_ADDR", PortEnv: "ENV_NAME_KAFKA_PORT", Indirect: true}
 	}
-
-	return "", ""
+	return &discovery.Env{AddrEnv: "MQ_KAFKA_ADDR", PortEnv: "MQ_KAFKA_PORT"}
 }
 
-type dnsEntry struct {
-	Ip   string
-	Port string
+func KafkaAddrPort() (string, string) {
+	endpoint, _ := getKafkaWatcher().Endpoint()
+	return endpoint.Host, endpoint.Port
 }
 
-func dnsExchange(srvName string) []*dnsEntry {
-	fiilSrvName := fmt.Sprintf("%s.service.consul", srvName)
-	agentAddr := net.JoinHostPort(consulAddrPort())
-	logger.Debug("DNS query %s @ %s", fiilSrvName, agentAddr)
-
-	m := new(dns.Msg)
-	m.SetQuestion(dns.Fqdn(fiilSrvName), dns.TypeSRV)
-	m.RecursionDesired = true
+// alarms buffers the alarms of the loggers, and spools them to the
+// ALARM_SPOOL_FILE if set while the mq is down or not inited yet.
+var alarms = newAlarmQueue(os.Getenv("ALARM_SPOOL_FILE"), metrics.DefaultRegistry)
 
-	c := &dns.Client{Net: "tcp"}
-	r, _, err := c.Exchange(m, agentAddr)
-	if err != nil {
-		logger.Error("dns  exchange err:", err)
-		return nil
-	}
-	if r.Rcode != dns.RcodeSuccess {
-		logger.Warn("dns query err:", r.Rcode)
-		return nil
-	}
-
-	/*
-		entries := make([]*dnsEntry, 0, 16)
-		for i := len(r.Answer) - 1; i >= 0; i-- {
-			answer := r.Answer[i]
-			logger.Defaultloggerger().Debugf("r.Answer[%d]=%s", i, answer.String())
-
-			srv, ok := answer.(*dns.SRV)
-			if ok {
-				m.SetQuestion(dns.Fqdn(srv.Target), dns.TypeA)
-				r1, _, err := c.Exchange(m, agentAddr)
-				if err != nil {
-					logger.DefaultLogger().Warningf("dns query error: %s", err.Error())
-					continue
-				}
-
-				for j := len(r1.Answer) - 1; j >= 0; j-- {
-					answer1 := r1.Answer[j]
-					log.DefaultLogger().Debugf("r1.Answer[%d]=%v", i, answer1)
-
-					a, ok := answer1.(*dns.A)
-					if ok {
-						a.A is the node ip instead of service ip
-						entries = append(entries,  &dnsEntry{ip: a.A.String(), port: fmt.Sprintf("%d", srv.Port)})
-					}
-				}
-			}
-		}
+var errMQNotInited = errors.New("mq is not inited")
 
-		return entries
-	*/
-
-	if len(r.Extra) != len(r.Answer) {
-		e := fmt.Sprintf("len(r.Extra)(%d) != len(r.Answer)(%d)", len(r.Extra), len(r.Answer))
-		logger.Warn(e)
-		return nil
-	}
-
-	num := len(r.Extra)
-	entries := make([]*dnsEntry, num)
-	index := 0
-	for i := 0; i < num; i++ {
-		a, oka := r.Extra[i].(*dns.A)
-		s, oks := r.Answer[i].(*dns.SRV)
-		if oka && oks {
-			entries[index] = &dnsEntry{Ip: a.A.String(), Port: fmt.Sprintf("%d", s.Port)}
-			index++
-		}
-	}
-
-	return entries[:index]
-}
-
-func consulAddrPort() (string, string) {
-	return os.Getenv("CONSUL_SERVER"), os.Getenv("CONSUL_DNS_PORT")
+func newAlarmQueue(spoolFile string, registry metrics.Registry) *alarm.Queue {
+	q := alarm.NewQueue(sendAlarmToMQ, alarm.DefaultCapacity, registry)
+	q.SpoolFile = spoolFile
+	return q
 }
 
 func init() {
-
 	logs.SetAlermSendingCallback(sendAlarm)
 }
 
-type alarmEvent struct {
-	Sender    string    `json:"sender"`
-	Content   string    `json:"content"`
-	Send_time time.Time `json:"sendTime"`
+func sendAlarm(msg string) {
+	alarms.Start(nil)
+	alarms.Enqueue(&alarm.Alarm{Sender: SENDER, Content: msg, SendTime: time.Now()})
+}
+
+// StartAlarmRules evaluates the alarm rules of the file, or the default rules
+// if the file is empty, in the background, and sends their notifications as
+// the alarms of the loggers.
+func StartAlarmRules(file string) error {
+	rules := alarm.DefaultRules
+	if file != "" {
+		var err error
+		if rules, err = alarm.LoadRules(file); err != nil {
+			return err
+		}
+	}
+
+	evaluator, err := alarm.NewEvaluator(rules, metrics.DefaultRegistry, sendAlarm)
+	if err != nil {
+		return err
+	}
+	for _, rule := range evaluator.Rules {
+		logger.Info("Alarm rule %s", rule)
+	}
+	go evaluator.Loop(nil)
+	return nil
 }
 
-func sendAlarm(msg string) {
-	// todo: need a buffered channel to store the alarms?
+func sendAlarmToMQ(a *alarm.Alarm) error {
 	q := getMQ()
 	if q == nil {
-		logger.Warn("mq is nil.")
-		return
+		return errMQNotInited
 	}
 
-	event := alarmEvent{Sender: SENDER, Content: msg, Send_time: time.Now()}
-
-	b, err := json.Marshal(&event)
+	b, err := json.Marshal(a)
 	if err != nil {
-		logger.Error("Marshal err:", err)
-		return
+		return err
 	}
 
 	_, _, err = q.MessageQueue.SendSyncMessage("to_alarm.json", []byte(""), b)
-	if err != nil {
-		logger.Error("sendAlarm (to_alarm.json) error: ", err)
-		return
-	}
-	return
+	return err
 }
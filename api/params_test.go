@@ -0,0 +1,74 @@
+package api
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/alarm"
+	"github.com/rcrowley/go-metrics"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withSpooledAlarms replaces the alarm queue with one spooled to a temp
+// file, and returns the name of the spool and the function to restore it.
+func withSpooledAlarms(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "alarm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool := filepath.Join(dir, "alarms.spool")
+	old := alarms
+	alarms = newAlarmQueue(spool, metrics.NewRegistry())
+	stop := make(chan struct{})
+	alarms.Start(stop)
+	return spool, func() {
+		close(stop)
+		alarms = old
+		os.RemoveAll(dir)
+	}
+}
+
+// waitSpooled waits for the spool to have the alarm.
+func waitSpooled(t *testing.T, spool, content string) {
+	for i := 0; i < 200; i++ {
+		if data, err := ioutil.ReadFile(spool); err == nil && strings.Contains(string(data), content) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %q spooled", content)
+}
+
+func TestAlarmSpooledBeforeInitMQ(t *testing.T) {
+	if getMQ() != nil {
+		t.Skip("mq is inited")
+	}
+	spool, restore := withSpooledAlarms(t)
+	defer restore()
+
+	sendAlarm("mysql is down")
+	waitSpooled(t, spool, "mysql is down")
+	if alarms.Dropped.Count() != 0 {
+		t.Errorf("expect no alarm dropped, got %d", alarms.Dropped.Count())
+	}
+}
+
+func TestRuleNotificationBeforeInitMQ(t *testing.T) {
+	if getMQ() != nil {
+		t.Skip("mq is inited")
+	}
+	spool, restore := withSpooledAlarms(t)
+	defer restore()
+
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterGauge("db.unreachable.ticks", registry).Update(3)
+	rules := []*alarm.Rule{{Name: "db", Metric: "db.unreachable.ticks", Op: ">=", Threshold: 3, Message: "db down"}}
+	evaluator, err := alarm.NewEvaluator(rules, registry, sendAlarm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluator.Evaluate()
+	waitSpooled(t, spool, alarm.FiringPrefix+" db: db down")
+}
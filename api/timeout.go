@@ -7,10 +7,14 @@ import (
 	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/rcrowley/go-metrics"
 
 	"github.com/asiainfoLDP/datahub_commons/log"
 )
 
+// handleTimeouts counts the timed out handlers, for the alarm rules.
+var handleTimeouts = metrics.GetOrRegisterCounter("http.timeouts", metrics.DefaultRegistry)
+
 func TimeoutHandle(dt time.Duration, h httprouter.Handle) httprouter.Handle {
 	return TimeoutHandleWithMessage(h, dt, "")
 }
@@ -26,7 +30,7 @@ func TimeoutHandleWithMessage(h httprouter.Handle, dt time.Duration, msg string)
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		done := make(chan bool, 1)
 
-		tw := &timeoutWriter{w: w}
+		tw := &timeoutWriter{w: w, streaming: make(chan struct{})}
 		go func() {
 			h(tw, r, params)
 			done <- true
@@ -34,14 +38,22 @@ func TimeoutHandleWithMessage(h httprouter.Handle, dt time.Duration, msg string)
 		select {
 		case <-done:
 			return
+		case <-tw.streaming:
+			<-done
 		case <-time.After(dt):
 			tw.mu.Lock()
+			if tw.streamed {
+				tw.mu.Unlock()
+				<-done
+				return
+			}
 			defer tw.mu.Unlock()
 			if !tw.wroteHeader {
 				tw.w.WriteHeader(http.StatusServiceUnavailable)
 				tw.w.Write(body)
 			}
 			tw.timedOut = true
+			handleTimeouts.Inc(1)
 			log.DefaultlLogger().Warningf("timeout: %s", r.URL.String())
 		}
 	}
@@ -55,6 +67,42 @@ type timeoutWriter struct {
 	mu          sync.Mutex
 	timedOut    bool
 	wroteHeader bool
+
+	streaming chan struct{} // closed by DisableTimeout
+	streamed  bool
+}
+
+// DisableTimeout lets the handler of TimeoutHandle run as long as it needs,
+// e.g. to stream the response. It returns false if the handler has timed out
+// already.
+func DisableTimeout(w http.ResponseWriter) bool {
+	tw, ok := w.(*timeoutWriter)
+	if !ok {
+		return true
+	}
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return false
+	}
+	if !tw.streamed {
+		tw.streamed = true
+		close(tw.streaming)
+	}
+	return true
+}
+
+// Flush makes timeoutWriter a http.Flusher if the wrapped writer is.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
 }
 
 func (tw *timeoutWriter) Header() http.Header {
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutHandle(t *testing.T) {
+	h := TimeoutHandle(20*time.Millisecond, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("late"))
+	})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/", nil), nil)
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() == "late" {
+		t.Errorf("expect timeout, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDisableTimeout(t *testing.T) {
+	flushed := make(chan bool, 1)
+	h := TimeoutHandle(20*time.Millisecond, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if !DisableTimeout(w) {
+			t.Errorf("expect the timeout disabled")
+		}
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		flushed <- true
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("data: 2\n\n"))
+	})
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", "/", nil), nil)
+	<-flushed
+	if w.Code != http.StatusOK || w.Body.String() != "data: 1\n\ndata: 2\n\n" || !w.Flushed {
+		t.Errorf("unexpected response %d %q, flushed %v", w.Code, w.Body.String(), w.Flushed)
+	}
+
+	// too late to disable.
+	disabled := make(chan bool, 1)
+	h = TimeoutHandle(20*time.Millisecond, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		time.Sleep(60 * time.Millisecond)
+		disabled <- DisableTimeout(w)
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil)
+	if <-disabled {
+		t.Errorf("expect the timeout not disabled after timed out")
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/events"
+	"github.com/asiainfoLDP/datafoundry_data_integration/federation"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/asiainfoLDP/datafoundry_data_integration/reconcile"
+	"github.com/asiainfoLDP/datafoundry_data_integration/webhook"
+	"github.com/asiainfoLDP/datahub_commons/mq"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// runCommand runs the subcommand in the args, if any, and returns the exit
+// code. ok is false if the args are not a subcommand.
+func runCommand(args []string) (code int, ok bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	switch args[0] {
+	case "import":
+		return importCommand(args[1:]), true
+	case "reconcile":
+		return reconcileCommand(args[1:]), true
+	case "federate":
+		return federateCommand(args[1:]), true
+	case "relay":
+		return relayCommand(args[1:]), true
+	case "deliver":
+		return deliverCommand(args[1:]), true
+	case "export":
+		return exportCommand(args[1:]), true
+	case "restore":
+		return restoreCommand(args[1:]), true
+	}
+	return 0, false
+}
+
+// importCommand imports the manifest files (- for the stdin) like
+// POST /integration/v1/catalog/import, as an admin.
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report the changes without committing them")
+	user := flags.String("user", "admin", "the owner of the created repositories")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s import [-dry-run] [-user name] manifest.yaml...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	manifests := make([]*models.CatalogManifest, 0, flags.NArg())
+	for _, name := range flags.Args() {
+		var data []byte
+		var err error
+		if name == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(name)
+		}
+		if err == nil {
+			var manifest *models.CatalogManifest
+			if manifest, err = models.ParseCatalogManifest(data); err == nil {
+				manifests = append(manifests, manifest)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 1
+		}
+	}
+
+	models.InitDB()
+	db := models.GetDB()
+	if db == nil {
+		fmt.Fprintln(os.Stderr, "failed to connect the database")
+		return 1
+	}
+
+	exitCode := 0
+	for i, manifest := range manifests {
+		report, err := models.ImportCatalog(db, manifest, *user, func(repo *models.Repository) bool {
+			return repo.ManagedBy == ""
+		}, *dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", flags.Arg(i), err)
+			exitCode = 1
+			continue
+		}
+
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Printf("%s\n", data)
+	}
+	return exitCode
+}
+
+// reconcileCommand converges the catalog to the manifest files in a
+// directory, a repository per file, once or whenever the files change.
+func reconcileCommand(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	dir := flags.String("dir", "", "the directory of the manifest files")
+	name := flags.String("name", "gitops", "the name of the reconciler, which manages the repositories")
+	user := flags.String("user", "admin", "the owner of the created repositories")
+	interval := flags.Duration("interval", 30*time.Second, "the interval between the checks of the directory")
+	prune := flags.Bool("prune", false, "delete the managed repositories and dataitems not in the files")
+	once := flags.Bool("once", false, "reconcile once and exit")
+	dryRun := flags.Bool("dry-run", false, "report the changes without committing them")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s reconcile -dir path [-name name] [-user name] [-interval 30s] [-prune] [-once] [-dry-run]\n",
+			os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *dir == "" || flags.NArg() > 0 || *interval <= 0 {
+		flags.Usage()
+		return 2
+	}
+	reconcilerName, ok := common.ValidateUrlWord(*name)
+	if !ok || len(reconcilerName) > models.ReconcilerNameMaxLength {
+		fmt.Fprintf(os.Stderr, "invalid reconciler name %q\n", *name)
+		return 2
+	}
+
+	models.InitDB()
+	db := models.GetDB()
+	if db == nil {
+		fmt.Fprintln(os.Stderr, "failed to connect the database")
+		return 1
+	}
+
+	reconciler := &reconcile.Reconciler{
+		Dir: *dir,
+		Options: models.ReconcileOptions{
+			Reconciler: reconcilerName,
+			Owner:      *user,
+			Prune:      *prune,
+			DryRun:     *dryRun,
+		},
+		Interval: *interval,
+	}
+	printRun := func(run *models.ReconcileRun) {
+		data, _ := json.MarshalIndent(run, "", "  ")
+		fmt.Printf("%s\n", data)
+	}
+
+	if *once {
+		run, err := reconciler.Run(db)
+		printRun(run)
+		if err != nil {
+			return 1
+		}
+		return 0
+	}
+
+	runs := make(chan *models.ReconcileRun)
+	go reconciler.Watch(db, nil, runs)
+	for run := range runs {
+		printRun(run)
+	}
+	return 0
+}
+
+// peerFlags collects the repeated -peer flags.
+type peerFlags []*federation.Peer
+
+func (peers *peerFlags) String() string {
+	names := make([]string, len(*peers))
+	for i, peer := range *peers {
+		names[i] = peer.Name + "=" + peer.Url
+	}
+	return strings.Join(names, ",")
+}
+
+func (peers *peerFlags) Set(value string) error {
+	peer, err := federation.ParsePeer(value)
+	if err != nil {
+		return err
+	}
+	for _, p := range *peers {
+		if p.Name == peer.Name {
+			return fmt.Errorf("duplicated peer %s", peer.Name)
+		}
+	}
+	*peers = append(*peers, peer)
+	return nil
+}
+
+// federateCommand mirrors the catalogs of the remote instances as read-only
+// repositories, once or periodically.
+func federateCommand(args []string) int {
+	var peers peerFlags
+	flags := flag.NewFlagSet("federate", flag.ContinueOnError)
+	flags.Var(&peers, "peer", "a remote instance as name=url, repeatable")
+	token := flags.String("token", os.Getenv("FEDERATION_TOKEN"), "the token to call the remote instances")
+	user := flags.String("user", "admin", "the owner of the mirrored repositories")
+	interval := flags.Duration("interval", 10*time.Minute, "the interval between the harvests")
+	retries := flags.Int("retries", 3, "the retries of a failed remote call")
+	backoff := flags.Duration("backoff", time.Second, "the wait before the first retry, doubled for each next one")
+	once := flags.Bool("once", false, "harvest once and exit")
+	dryRun := flags.Bool("dry-run", false, "report the changes without committing them")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s federate -peer name=url... [-token token] [-user name] [-interval 10m] [-retries 3] [-backoff 1s] [-once] [-dry-run]\n",
+			os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if len(peers) == 0 || flags.NArg() > 0 || *interval <= 0 || *retries < 0 {
+		flags.Usage()
+		return 2
+	}
+
+	models.InitDB()
+	db := models.GetDB()
+	if db == nil {
+		fmt.Fprintln(os.Stderr, "failed to connect the database")
+		return 1
+	}
+
+	federator := &federation.Federator{
+		Peers:    peers,
+		Token:    *token,
+		Owner:    *user,
+		Retries:  *retries,
+		Backoff:  *backoff,
+		Interval: *interval,
+		DryRun:   *dryRun,
+	}
+	printRun := func(run *models.ReconcileRun) {
+		data, _ := json.MarshalIndent(run, "", "  ")
+		fmt.Printf("%s\n", data)
+	}
+
+	if *once {
+		exitCode := 0
+		for _, run := range federator.RunAll(db) {
+			printRun(run)
+			if run.Status != models.ReconcileStatusOk {
+				exitCode = 1
+			}
+		}
+		return exitCode
+	}
+
+	runs := make(chan *models.ReconcileRun)
+	go federator.Loop(db, nil, runs)
+	for run := range runs {
+		printRun(run)
+	}
+	return 0
+}
+
+// relayCommand publishes the catalog change events in the outbox to kafka,
+// once or periodically. The topics are set by the CATALOG_EVENTS_TOPIC_*
+// envs. Without -kafka, kafka is discovered and followed as by the service.
+func relayCommand(args []string) int {
+	flags := flag.NewFlagSet("relay", flag.ContinueOnError)
+	kafka := flags.String("kafka", "", "the kafka brokers, separated by commas, or discovered like the service's")
+	batch := flags.Int("batch", events.DefaultBatchSize, "the max number of the events published in a transaction")
+	interval := flags.Duration("interval", events.DefaultInterval, "the interval between the polls of the outbox")
+	retention := flags.Duration("retention", events.DefaultRetention, "how long the sent events are kept in the outbox")
+	once := flags.Bool("once", false, "publish a batch and exit")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s relay [-kafka host:port[,host:port...]] [-batch 100] [-interval 5s] [-retention 168h] [-once]\n",
+			os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 || *batch <= 0 || *interval <= 0 || *retention <= 0 {
+		flags.Usage()
+		return 2
+	}
+
+	models.InitDB()
+	db := models.GetDB()
+	if db == nil {
+		fmt.Fprintln(os.Stderr, "failed to connect the database")
+		return 1
+	}
+	var producer events.Producer
+	if *kafka != "" {
+		messageQueue, err := mq.NewMQ(strings.Split(*kafka, ","))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to connect kafka: %v\n", err)
+			return 1
+		}
+		defer messageQueue.Close()
+		producer = messageQueue
+	} else {
+		if host, _ := api.KafkaAddrPort(); host == "" {
+			fmt.Fprintln(os.Stderr, "failed to discover kafka, set -kafka")
+			return 1
+		}
+		// kafka is reconnected when it moves.
+		api.InitMQ()
+		producer = api.MQProducer{}
+	}
+
+	relay := &events.Relay{
+		Producer:  producer,
+		Topics:    events.TopicsFromEnv(),
+		BatchSize: *batch,
+		Interval:  *interval,
+		Retention: *retention,
+	}
+
+	if *once {
+		n, err := relay.RelayOnce(db)
+		fmt.Printf("%d events published\n", n)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	relay.Loop(db, nil)
+	return 0
+}
+
+// deliverCommand sends the pending deliveries of the webhooks, once or
+// periodically.
+func deliverCommand(args []string) int {
+	flags := flag.NewFlagSet("deliver", flag.ContinueOnError)
+	attempts := flags.Int("attempts", webhook.DefaultMaxAttempts, "the max attempts of a delivery")
+	backoff := flags.Duration("backoff", webhook.DefaultBackoff, "the wait before the first retry, doubled for each next one")
+	maxBackoff := flags.Duration("max-backoff", webhook.DefaultMaxBackoff, "the max wait before a retry")
+	batch := flags.Int("batch", webhook.DefaultBatchSize, "the max number of the deliveries claimed at a time")
+	interval := flags.Duration("interval", webhook.DefaultInterval, "the interval between the polls of the deliveries")
+	once := flags.Bool("once", false, "send a batch and exit")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s deliver [-attempts 8] [-backoff 30s] [-max-backoff 1h] [-batch 20] [-interval 5s] [-once]\n",
+			os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 || *attempts <= 0 || *backoff <= 0 || *maxBackoff <= 0 || *batch <= 0 || *interval <= 0 {
+		flags.Usage()
+		return 2
+	}
+
+	models.InitDB()
+	db := models.GetDB()
+	if db == nil {
+		fmt.Fprintln(os.Stderr, "failed to connect the database")
+		return 1
+	}
+
+	dispatcher := &webhook.Dispatcher{
+		MaxAttempts: *attempts,
+		Backoff:     *backoff,
+		MaxBackoff:  *maxBackoff,
+		BatchSize:   *batch,
+		Interval:    *interval,
+	}
+
+	if *once {
+		n, err := dispatcher.DeliverOnce(db)
+		fmt.Printf("%d deliveries sent\n", n)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	dispatcher.Loop(db, nil)
+	return 0
+}
+
+// exportCommand writes the catalog archive to a file, or the stdout.
+func exportCommand(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "-", "the archive file, - for the stdout")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s export [-o archive.json]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	models.InitDB()
+	db := models.GetDB()
+	if db == nil {
+		fmt.Fprintln(os.Stderr, "failed to connect the database")
+		return 1
+	}
+
+	archive, err := models.ExportArchive(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	data = append(data, '\n')
+
+	if *output == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = ioutil.WriteFile(*output, data, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *output, err)
+		return 1
+	}
+	return 0
+}
+
+// restoreCommand validates an archive of the export command and loads it.
+func restoreCommand(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	policy := flags.String("policy", models.ConflictFail, "what to do with the existing entities: skip, overwrite or fail")
+	dryRun := flags.Bool("dry-run", false, "report the changes without committing them")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s restore [-policy skip|overwrite|fail] [-dry-run] archive.json\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || !models.ValidateConflictPolicy(*policy) {
+		flags.Usage()
+		return 2
+	}
+
+	name := flags.Arg(0)
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	archive := &models.Archive{}
+	if err == nil {
+		err = json.Unmarshal(data, archive)
+	}
+	if err == nil {
+		err = models.ValidateArchive(archive)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+
+	models.InitDB()
+	db := models.GetDB()
+	if db == nil {
+		fmt.Fprintln(os.Stderr, "failed to connect the database")
+		return 1
+	}
+
+	report, err := models.RestoreArchive(db, archive, *policy, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		return 1
+	}
+
+	data, _ = json.MarshalIndent(report, "", "  ")
+	fmt.Printf("%s\n", data)
+	return 0
+}
@@ -13,6 +13,12 @@ const (
 	GeneralRemoteCallTimeout = 10 // seconds
 )
 
+// RetryableStatus reports whether a request failed with the status code may
+// succeed later.
+func RetryableStatus(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusTooManyRequests
+}
+
 //=============================================================
 //
 //=============================================================
@@ -20,6 +26,30 @@ const (
 func RemoteCallWithBody(method, url string, token, user string, body []byte, contentType string) (*http.Response, []byte, error) {
 	log.DefaultLogger().Debugf("method: %s, url: %s, token: %s, contentType: %s, body: %s", method, url, token, contentType, string(body))
 
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		header.Set("Authorization", token)
+	}
+	if user != "" {
+		header.Set("User", user)
+	}
+	return RemoteCallWithHeader(method, url, header, body)
+}
+
+// RemoteCallWithHeader calls as RemoteCallWithBody, with the header of the
+// request.
+func RemoteCallWithHeader(method, url string, header http.Header, body []byte) (*http.Response, []byte, error) {
+	client := &http.Client{
+		Timeout: time.Duration(GeneralRemoteCallTimeout) * time.Second,
+	}
+	return RemoteCallWithClient(client, method, url, header, body)
+}
+
+// RemoteCallWithClient calls as RemoteCallWithHeader, by the client.
+func RemoteCallWithClient(client *http.Client, method, url string, header http.Header, body []byte) (*http.Response, []byte, error) {
 	var request *http.Request
 	var err error
 	if len(body) == 0 {
@@ -30,17 +60,8 @@ func RemoteCallWithBody(method, url string, token, user string, body []byte, con
 	if err != nil {
 		return nil, nil, err
 	}
-	if contentType != "" {
-		request.Header.Set("Content-Type", contentType)
-	}
-	if token != "" {
-		request.Header.Set("Authorization", token)
-	}
-	if user != "" {
-		request.Header.Set("User", user)
-	}
-	client := &http.Client{
-		Timeout: time.Duration(GeneralRemoteCallTimeout) * time.Second,
+	for key, values := range header {
+		request.Header[key] = values
 	}
 	response, err := client.Do(request)
 	if response != nil {
@@ -62,6 +83,33 @@ func RemoteCall(method string, url string, token, user string) (*http.Response,
 	return RemoteCallWithBody(method, url, token, user, nil, "")
 }
 
+// RemoteCallWithRetry calls as RemoteCall, and retries up to retries times
+// after a network error or a retryable status. It waits backoff before the
+// first retry, and twice as long before each next one.
+func RemoteCallWithRetry(method string, url string, token, user string, retries int, backoff time.Duration) (*http.Response, []byte, error) {
+	return RemoteCallWithBodyAndRetry(method, url, token, user, nil, "", retries, backoff)
+}
+
+// RemoteCallWithBodyAndRetry calls as RemoteCallWithBody, and retries as
+// RemoteCallWithRetry. Only the idempotent calls should be retried.
+func RemoteCallWithBodyAndRetry(method, url string, token, user string, body []byte, contentType string,
+	retries int, backoff time.Duration) (*http.Response, []byte, error) {
+	for i := 0; ; i++ {
+		response, data, err := RemoteCallWithBody(method, url, token, user, body, contentType)
+		if i >= retries || (err == nil && !RetryableStatus(response.StatusCode)) {
+			return response, data, err
+		}
+
+		if err != nil {
+			log.DefaultLogger().Warningf("%s %s error: %s, retry in %v", method, url, err.Error(), backoff)
+		} else {
+			log.DefaultLogger().Warningf("%s %s status code: %d, retry in %v", method, url, response.StatusCode, backoff)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
 func GetRequestData(r *http.Request) ([]byte, error) {
 	if r.Body == nil {
 		return nil, nil
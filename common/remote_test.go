@@ -0,0 +1,43 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRemoteCallWithRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	response, data, err := RemoteCallWithRetry("GET", server.URL, "Bearer abc", "", 2, time.Millisecond)
+	if err != nil || response.StatusCode != http.StatusOK || string(data) != "ok" || calls != 3 {
+		t.Errorf("expect ok at the 3rd call, got %v %q %v at the %dth call", response, data, err, calls)
+	}
+
+	calls = 0
+	response, _, err = RemoteCallWithRetry("GET", server.URL, "Bearer abc", "", 1, time.Millisecond)
+	if err != nil || response.StatusCode != http.StatusServiceUnavailable || calls != 2 {
+		t.Errorf("expect 503 after a retry, got %v %v at the %dth call", response, err, calls)
+	}
+
+	// the client errors are not retried.
+	calls = 0
+	response, _, err = RemoteCallWithRetry("GET", server.URL, "", "", 3, time.Millisecond)
+	if err != nil || response.StatusCode != http.StatusUnauthorized || calls != 1 {
+		t.Errorf("expect 401 without retries, got %v %v at the %dth call", response, err, calls)
+	}
+}
@@ -0,0 +1,426 @@
+package common
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	XlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+	XlsxSheetNameMaxLength = 31
+	xlsxColumnMaxWidth     = 60
+
+	// XlsxPartMaxSize limits the uncompressed size of a part read by ReadXlsx.
+	XlsxPartMaxSize = 64 << 20
+)
+
+var (
+	ErrInvalidXlsx   = errors.New("invalid xlsx workbook")
+	ErrXlsxPartLarge = errors.New("xlsx part is too large")
+)
+
+// XlsxSheet is a worksheet of plain text cells. The first HeaderRows rows
+// are bold.
+type XlsxSheet struct {
+	Name       string
+	Rows       [][]string
+	HeaderRows int
+}
+
+// XlsxSheetName makes a valid and unique (among used) sheet name.
+func XlsxSheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '[', ']', ':', '*', '?', '/', '\\':
+			return '_'
+		}
+		return r
+	}, strings.Trim(name, "'"))
+	if name == "" {
+		name = "Sheet"
+	}
+
+	base := name
+	for i := 2; ; i++ {
+		if utf8.RuneCountInString(name) > XlsxSheetNameMaxLength {
+			name = string([]rune(name)[:XlsxSheetNameMaxLength])
+		}
+		if !used[strings.ToLower(name)] {
+			break
+		}
+		suffix := fmt.Sprintf(" (%d)", i)
+		runes := []rune(base)
+		if len(runes)+len(suffix) > XlsxSheetNameMaxLength {
+			runes = runes[:XlsxSheetNameMaxLength-len(suffix)]
+		}
+		name = string(runes) + suffix
+	}
+
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// XlsxCellRef returns the reference of a cell, such as "A1" for (0, 0).
+func XlsxCellRef(row, col int) string {
+	letters := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		letters = string(rune('A'+(col-1)%26)) + letters
+	}
+	return fmt.Sprintf("%s%d", letters, row+1)
+}
+
+// WriteXlsx writes a minimal xlsx workbook with inline string cells.
+func WriteXlsx(w io.Writer, sheets []*XlsxSheet) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes(len(sheets))},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(sheets))},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+
+	for i, sheet := range sheets {
+		fw, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeXlsxSheet(fw, sheet); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// style 1 is bold and wrapped, style 2 is wrapped.
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyAlignment="1"><alignment vertical="top" wrapText="1"/></xf>` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0" applyAlignment="1"><alignment vertical="top" wrapText="1"/></xf></cellXfs>` +
+	`</styleSheet>`
+
+func xlsxContentTypes(n int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func xlsxWorkbook(sheets []*XlsxSheet) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.Name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func xlsxWorkbookRels(n int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, n+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// textWidth counts the wide (such as chinese) characters twice.
+func textWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if r >= 0x1100 {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+func writeXlsxSheet(w io.Writer, sheet *XlsxSheet) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+
+	widths := make([]int, 0, 8)
+	for _, row := range sheet.Rows {
+		for j, cell := range row {
+			if j >= len(widths) {
+				widths = append(widths, 8)
+			}
+			if width := textWidth(cell) + 2; width > widths[j] {
+				widths[j] = width
+			}
+		}
+	}
+	if len(widths) > 0 {
+		b.WriteString(`<cols>`)
+		for j, width := range widths {
+			if width > xlsxColumnMaxWidth {
+				width = xlsxColumnMaxWidth
+			}
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, j+1, j+1, width)
+		}
+		b.WriteString(`</cols>`)
+	}
+
+	b.WriteString(`<sheetData>`)
+	for i, row := range sheet.Rows {
+		style := 2
+		if i < sheet.HeaderRows {
+			style = 1
+		}
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, cell := range row {
+			if cell == "" {
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+				XlsxCellRef(i, j), style, xmlEscape(cell))
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// xlsx parts read by ReadXlsx.
+type (
+	xlsxWorkbookXml struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			Id   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+
+	xlsxRelsXml struct {
+		Relationships []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+
+	// xlsxText is a plain or rich text.
+	xlsxText struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+
+	xlsxSharedStringsXml struct {
+		Items []xlsxText `xml:"si"`
+	}
+
+	xlsxWorksheetXml struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R  string    `xml:"r,attr"`
+				T  string    `xml:"t,attr"`
+				V  string    `xml:"v"`
+				Is *xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+)
+
+func (t *xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+// ParseXlsxCellRef is the reverse of XlsxCellRef.
+func ParseXlsxCellRef(ref string) (row, col int, ok bool) {
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A') + 1
+	}
+	if i == 0 || i == len(ref) {
+		return 0, 0, false
+	}
+	for ; i < len(ref); i++ {
+		if ref[i] < '0' || ref[i] > '9' {
+			return 0, 0, false
+		}
+		row = row*10 + int(ref[i]-'0')
+	}
+	if row == 0 {
+		return 0, 0, false
+	}
+	return row - 1, col - 1, true
+}
+
+// ReadXlsx reads the cells of the worksheets as text. Numbers, booleans and
+// dates are read as stored, without number formats applied.
+func ReadXlsx(data []byte) ([]*XlsxSheet, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrInvalidXlsx
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	workbook := &xlsxWorkbookXml{}
+	if err := readXlsxPart(files, "xl/workbook.xml", workbook); err != nil {
+		return nil, err
+	}
+	rels := &xlsxRelsXml{}
+	if err := readXlsxPart(files, "xl/_rels/workbook.xml.rels", rels); err != nil {
+		return nil, err
+	}
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.Id] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.Id] = path.Join("xl", rel.Target)
+		}
+	}
+
+	sharedStrings := &xlsxSharedStringsXml{}
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readXlsxPart(files, "xl/sharedStrings.xml", sharedStrings); err != nil {
+			return nil, err
+		}
+	}
+
+	sheets := make([]*XlsxSheet, 0, len(workbook.Sheets))
+	for _, s := range workbook.Sheets {
+		worksheet := &xlsxWorksheetXml{}
+		if err := readXlsxPart(files, targets[s.Id], worksheet); err != nil {
+			return nil, err
+		}
+
+		sheet := &XlsxSheet{Name: s.Name}
+		for i, row := range worksheet.Rows {
+			r := i
+			if row.R > 0 {
+				r = row.R - 1
+			}
+			for j, cell := range row.Cells {
+				c := j
+				if cell.R != "" {
+					var ok bool
+					if _, c, ok = ParseXlsxCellRef(cell.R); !ok {
+						return nil, ErrInvalidXlsx
+					}
+				}
+
+				value := cell.V
+				switch cell.T {
+				case "s":
+					var index int
+					if _, err := fmt.Sscan(cell.V, &index); err != nil || index < 0 ||
+						index >= len(sharedStrings.Items) {
+						return nil, ErrInvalidXlsx
+					}
+					value = sharedStrings.Items[index].String()
+				case "inlineStr":
+					if cell.Is != nil {
+						value = cell.Is.String()
+					}
+				case "b":
+					value = map[string]string{"0": "FALSE", "1": "TRUE"}[cell.V]
+				}
+				if value == "" {
+					continue
+				}
+
+				for len(sheet.Rows) <= r {
+					sheet.Rows = append(sheet.Rows, nil)
+				}
+				for len(sheet.Rows[r]) <= c {
+					sheet.Rows[r] = append(sheet.Rows[r], "")
+				}
+				sheet.Rows[r][c] = value
+			}
+		}
+		sheets = append(sheets, sheet)
+	}
+	return sheets, nil
+}
+
+func readXlsxPart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return ErrInvalidXlsx
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return ErrInvalidXlsx
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rc, XlsxPartMaxSize+1))
+	if err != nil {
+		return ErrInvalidXlsx
+	}
+	if len(data) > XlsxPartMaxSize {
+		return ErrXlsxPartLarge
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return ErrInvalidXlsx
+	}
+	return nil
+}
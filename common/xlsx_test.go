@@ -0,0 +1,161 @@
+package common
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestXlsxCellRef(t *testing.T) {
+	cases := []struct {
+		row, col int
+		ref      string
+	}{
+		{0, 0, "A1"},
+		{9, 25, "Z10"},
+		{0, 26, "AA1"},
+		{1, 51, "AZ2"},
+		{2, 701, "ZZ3"},
+		{0, 702, "AAA1"},
+	}
+	for _, c := range cases {
+		if ref := XlsxCellRef(c.row, c.col); ref != c.ref {
+			t.Errorf("XlsxCellRef(%d, %d) => %s != %s", c.row, c.col, ref, c.ref)
+		}
+	}
+}
+
+func TestXlsxSheetName(t *testing.T) {
+	used := map[string]bool{}
+	cases := []struct{ name, expected string }{
+		{"orders", "orders"},
+		{"Orders", "Orders (2)"},
+		{"a/b:c", "a_b_c"},
+		{"", "Sheet"},
+		{strings.Repeat("x", 40), strings.Repeat("x", 31)},
+		{strings.Repeat("x", 40), strings.Repeat("x", 27) + " (2)"},
+	}
+	for _, c := range cases {
+		if name := XlsxSheetName(c.name, used); name != c.expected {
+			t.Errorf("XlsxSheetName(%s) => %s != %s", c.name, name, c.expected)
+		}
+	}
+}
+
+func TestWriteXlsx(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteXlsx(&buf, []*XlsxSheet{
+		{Name: "a&b", Rows: [][]string{{"name", "说明"}, {"id", "<key>"}}, HeaderRows: 1},
+		{Name: "empty"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml",
+		"xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("%s is missing", name)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `name="a&amp;b"`) {
+		t.Errorf("sheet name is not escaped: %s", files["xl/workbook.xml"])
+	}
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, s := range []string{`<c r="B1" s="1" t="inlineStr"><is><t xml:space="preserve">说明</t>`,
+		`<c r="B2" s="2" t="inlineStr"><is><t xml:space="preserve">&lt;key&gt;</t>`} {
+		if !strings.Contains(sheet, s) {
+			t.Errorf("sheet1 has no %s: %s", s, sheet)
+		}
+	}
+}
+
+func TestParseXlsxCellRef(t *testing.T) {
+	for _, ref := range []string{"A1", "Z10", "AA1", "AZ2", "ZZ3", "AAA1"} {
+		row, col, ok := ParseXlsxCellRef(ref)
+		if !ok || XlsxCellRef(row, col) != ref {
+			t.Errorf("ParseXlsxCellRef(%s) => (%d, %d, %t)", ref, row, col, ok)
+		}
+	}
+	for _, ref := range []string{"", "A", "1", "A0", "a1", "A1B"} {
+		if _, _, ok := ParseXlsxCellRef(ref); ok {
+			t.Errorf("ParseXlsxCellRef(%s) is ok", ref)
+		}
+	}
+}
+
+func TestReadXlsx(t *testing.T) {
+	written := []*XlsxSheet{
+		{Name: "first", Rows: [][]string{{"a", "", "c"}, nil, {"", "说明 & <b>"}}},
+		{Name: "second", Rows: [][]string{{"x"}}},
+	}
+	var buf bytes.Buffer
+	if err := WriteXlsx(&buf, written); err != nil {
+		t.Fatal(err)
+	}
+
+	sheets, err := ReadXlsx(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets) != 2 || sheets[0].Name != "first" || sheets[1].Name != "second" {
+		t.Fatalf("sheets %v", sheets)
+	}
+	rows := sheets[0].Rows
+	if len(rows) != 3 || strings.Join(rows[0], "|") != "a||c" || rows[1] != nil ||
+		strings.Join(rows[2], "|") != "|说明 & <b>" {
+		t.Errorf("rows %q", rows)
+	}
+
+	if _, err := ReadXlsx([]byte("a,b,c")); err != ErrInvalidXlsx {
+		t.Errorf("err %v != ErrInvalidXlsx", err)
+	}
+}
+
+func TestReadXlsxSharedStrings(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="worksheet" Target="/xl/worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>name</t></si><si><r><t>ri</t></r><r><t>ch</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>` +
+			`<row r="3"><c r="B3"><v>12.5</v></c><c r="C3" t="b"><v>1</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		fw, _ := zw.Create(name)
+		fw.Write([]byte(content))
+	}
+	zw.Close()
+
+	sheets, err := ReadXlsx(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := sheets[0].Rows
+	if len(rows) != 3 || strings.Join(rows[0], "|") != "name||rich" || strings.Join(rows[2], "|") != "|12.5|TRUE" {
+		t.Errorf("rows %q", rows)
+	}
+}
@@ -0,0 +1,240 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UnmarshalYaml decodes a yaml document into v through its json encoding, so
+// that the json tags and json.Unmarshaler of v apply. The plain (unquoted)
+// scalars are converted to the kinds of the fields of v, e.g. example: 123
+// is a string if the example field is a string. Duplicated keys are errors.
+func UnmarshalYaml(data []byte, v interface{}) error {
+	var node yamlNode
+	if err := yaml.UnmarshalStrict(data, &node); err != nil {
+		return err
+	}
+
+	jsonData, err := yamlToJson(&node, reflect.TypeOf(v), "")
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, v)
+}
+
+type yamlKind int
+
+const (
+	yamlNull yamlKind = iota
+	yamlScalar
+	yamlMapping
+	yamlSequence
+)
+
+// yamlNode keeps the text of the scalars besides the values resolved by
+// yaml, which converts e.g. 1.50 to 1.5.
+type yamlNode struct {
+	kind     yamlKind
+	value    string      // the text of the scalars
+	resolved interface{} // the resolved value of the scalars
+	values   map[string]*yamlNode
+	items    []*yamlNode
+}
+
+func (node *yamlNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	switch v.(type) {
+	case nil:
+		node.kind = yamlNull
+		return nil
+	case map[interface{}]interface{}:
+		node.kind = yamlMapping
+		return unmarshal(&node.values)
+	case []interface{}:
+		node.kind = yamlSequence
+		return unmarshal(&node.items)
+	}
+	node.kind = yamlScalar
+	node.resolved = v
+	return unmarshal(&node.value)
+}
+
+type YamlError struct {
+	Path    string
+	Message string
+}
+
+func (e *YamlError) Error() string {
+	if e.Path == "" {
+		return "yaml: " + e.Message
+	}
+	return fmt.Sprintf("yaml: %s: %s", e.Path, e.Message)
+}
+
+func yamlErrorf(path string, format string, args ...interface{}) error {
+	return &YamlError{path, fmt.Sprintf(format, args...)}
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// yamlToJson encodes the node as the json of type t, t is nil for the
+// values of interface{}. path is the node in the errors, e.g. attrs[0].name.
+func yamlToJson(node *yamlNode, t reflect.Type, path string) ([]byte, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// the null values of the mappings and sequences are nil nodes.
+	if node == nil || node.kind == yamlNull {
+		return []byte("null"), nil
+	}
+	if t != nil && t.Kind() == reflect.Interface {
+		t = nil
+	}
+
+	switch node.kind {
+	case yamlMapping:
+		return yamlMappingToJson(node, t, path)
+	case yamlSequence:
+		if t != nil && t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return nil, yamlErrorf(path, "a sequence can't be a %s", t)
+		}
+		var elem reflect.Type
+		if t != nil {
+			elem = t.Elem()
+		}
+		items := make([]json.RawMessage, len(node.items))
+		for i, item := range node.items {
+			data, err := yamlToJson(item, elem, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = data
+		}
+		return json.Marshal(items)
+	}
+
+	if t == nil {
+		return json.Marshal(node.resolved)
+	}
+	// the unmarshalers of the other kinds than string take the scalars as
+	// they are, e.g. a duration of 90 or 90s.
+	if t.Kind() != reflect.String && reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return json.Marshal(node.resolved)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return json.Marshal(node.value)
+	case reflect.Bool:
+		switch strings.ToLower(node.value) {
+		case "true":
+			return []byte("true"), nil
+		case "false":
+			return []byte("false"), nil
+		}
+		return nil, yamlErrorf(path, "%q is not a boolean", node.value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, err := strconv.ParseInt(node.value, 10, 64); err != nil {
+			return nil, yamlErrorf(path, "%q is not an integer", node.value)
+		}
+		return []byte(node.value), nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(node.value, 64)
+		if err != nil {
+			return nil, yamlErrorf(path, "%q is not a number", node.value)
+		}
+		return json.Marshal(f)
+	}
+	return nil, yamlErrorf(path, "a scalar can't be a %s", t)
+}
+
+func yamlMappingToJson(node *yamlNode, t reflect.Type, path string) ([]byte, error) {
+	var fields map[string]reflect.Type
+	if t != nil {
+		switch t.Kind() {
+		case reflect.Struct:
+			fields = make(map[string]reflect.Type)
+			collectJsonFields(t, fields)
+		case reflect.Map:
+			if t.Key().Kind() != reflect.String {
+				return nil, yamlErrorf(path, "a mapping can't be a %s", t)
+			}
+		default:
+			return nil, yamlErrorf(path, "a mapping can't be a %s", t)
+		}
+	}
+
+	keys := make([]string, 0, len(node.values))
+	for key := range node.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, key := range keys {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		var valueType reflect.Type
+		if fields != nil {
+			var ok bool
+			if valueType, ok = fields[strings.ToLower(key)]; !ok {
+				return nil, yamlErrorf(path, "unknown field %q", key)
+			}
+		} else if t != nil {
+			valueType = t.Elem()
+		}
+
+		data, err := yamlToJson(node.values[key], valueType, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		keyData, _ := json.Marshal(key)
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(keyData)
+		b.WriteByte(':')
+		b.Write(data)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// collectJsonFields collects the json names (lowered, as json matches the
+// names case insensitively) of the exported fields, with the embedded ones.
+func collectJsonFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectJsonFields(ft, fields)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+}
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type yamlTestAttr struct {
+	Name     string   `json:"name"`
+	Example  string   `json:"example,omitempty"`
+	Nullable bool     `json:"nullable"`
+	Scale    int      `json:"scale,omitempty"`
+	Values   []string `json:"values,omitempty"`
+}
+
+type yamlTestDoc struct {
+	Title  string                 `json:"title"`
+	Note   string                 `json:"note"`
+	Folded string                 `json:"folded"`
+	Ratio  float64                `json:"ratio"`
+	Attrs  []*yamlTestAttr        `json:"attrs"`
+	Labels map[string]string      `json:"labels"`
+	Extra  map[string]interface{} `json:"extra"`
+}
+
+func TestUnmarshalYaml(t *testing.T) {
+	data := `---
+# a comment
+title: "orders # not a comment"
+note: |
+  line 1
+    indented
+
+  line 3
+folded: >-
+  a
+  b
+
+  c
+ratio: 0.5
+attrs:
+- name: id
+  example: 123      # a string
+  nullable: false
+- name: 'it''s'
+  values: [a, "b, c", 'd']
+  scale: 2
+- {name: flow, nullable: true, example: 1.50}
+labels: {team: data, env: prod}
+extra:
+  count: 3
+  on: true
+  list:
+    - x
+    -
+      - nested
+  empty:
+  price: 1.50
+  defaults: &defaults {team: data}
+  merged:
+    <<: *defaults
+    env: prod
+`
+	doc := &yamlTestDoc{}
+	if err := UnmarshalYaml([]byte(data), doc); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &yamlTestDoc{
+		Title:  "orders # not a comment",
+		Note:   "line 1\n  indented\n\nline 3\n",
+		Folded: "a b\nc",
+		Ratio:  0.5,
+		Attrs: []*yamlTestAttr{
+			{Name: "id", Example: "123"},
+			{Name: "it's", Values: []string{"a", "b, c", "d"}, Scale: 2},
+			{Name: "flow", Example: "1.50", Nullable: true},
+		},
+		Labels: map[string]string{"team": "data", "env": "prod"},
+		Extra: map[string]interface{}{
+			"count": float64(3), "on": true,
+			"list":  []interface{}{"x", []interface{}{"nested"}},
+			"empty": nil, "price": 1.5,
+			"defaults": map[string]interface{}{"team": "data"},
+			"merged":   map[string]interface{}{"team": "data", "env": "prod"},
+		},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("%+v\n!=\n%+v", doc, expected)
+		for i := range doc.Attrs {
+			t.Errorf("attrs[%d] %+v", i, doc.Attrs[i])
+		}
+	}
+}
+
+func TestUnmarshalYamlErrors(t *testing.T) {
+	cases := []struct{ data, message string }{
+		{"title: a\ntitle: b\n", "line 2: key \"title\" already set in map"},
+		{"titel: a\n", `unknown field "titel"`},
+		{"attrs:\n- name: a\n  nullable: maybe\n", `attrs[0].nullable: "maybe" is not a boolean`},
+		{"attrs:\n- name: a\n  scale: x\n", `attrs[0].scale: "x" is not an integer`},
+		{"attrs: [a\n", "did not find expected ',' or ']'"},
+		{"title: a\n  note: b\n", "line 2: mapping values are not allowed"},
+		{"title: *ref\n", "unknown anchor 'ref'"},
+		{"attrs: a\n", "attrs: a scalar can't be"},
+	}
+	for _, c := range cases {
+		err := UnmarshalYaml([]byte(c.data), &yamlTestDoc{})
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("UnmarshalYaml(%q) => %v, %q expected", c.data, err, c.message)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+// Package dcat publishes the catalog for the open data portals and the
+// harvesters as W3C DCAT, in JSON-LD, Turtle or RDF/XML, and for the search
+// engines as schema.org datasets. A repository is a dcat:Catalog of its
+// dataitems, which are dcat:Datasets with their urls as dcat:Distributions
+// and their attributes as csvw:tableSchemas.
+package dcat
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatJsonLd    = "jsonld"
+	FormatTurtle    = "turtle"
+	FormatRdfXml    = "rdfxml"
+	FormatSchemaOrg = "schemaorg"
+
+	SchemaOrgProfile = "https://schema.org"
+
+	CatalogTitle = "DataFoundry Data Catalog"
+)
+
+var ErrUnknownFormat = errors.New("unknown dcat format")
+
+var ContentTypes = map[string]string{
+	FormatJsonLd:    "application/ld+json; charset=utf-8",
+	FormatTurtle:    "text/turtle; charset=utf-8",
+	FormatRdfXml:    "application/rdf+xml; charset=utf-8",
+	FormatSchemaOrg: "application/ld+json; charset=utf-8",
+}
+
+// the formats of the media types in the Accept header.
+var mediaTypes = map[string]string{
+	"application/ld+json": FormatJsonLd,
+	"application/json":    FormatJsonLd,
+	"text/turtle":         FormatTurtle,
+	"application/rdf+xml": FormatRdfXml,
+	"application/xml":     FormatRdfXml,
+	"*/*":                 FormatJsonLd,
+	"application/*":       FormatJsonLd,
+	"text/*":              FormatTurtle,
+}
+
+// the xsd datatypes of the attribute data types.
+var xsdTypes = map[string]string{
+	models.DataTypeString:   "string",
+	models.DataTypeInt:      "integer",
+	models.DataTypeDecimal:  "decimal",
+	models.DataTypeDate:     "date",
+	models.DataTypeTime:     "time",
+	models.DataTypeDatetime: "dateTime",
+	models.DataTypeBoolean:  "boolean",
+	models.DataTypeEnum:     "string",
+}
+
+type Item struct {
+	*models.Dataitem
+	Attrs []*models.Attribute // nil if the schema is not published
+}
+
+type Repo struct {
+	*models.Repository
+	Items []*Item
+}
+
+// Negotiate picks the format of the Accept header, JSON-LD if it's empty.
+// application/ld+json with the schema.org profile is the schema.org markup.
+// It returns "" if none of the accepted media types is supported.
+func Negotiate(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return FormatJsonLd
+	}
+
+	format, best := "", 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		f, ok := mediaTypes[mediaType]
+		if !ok || q <= best {
+			continue
+		}
+		if f == FormatJsonLd && strings.TrimRight(params["profile"], "/") == SchemaOrgProfile {
+			f = FormatSchemaOrg
+		}
+		format, best = f, q
+	}
+	return format
+}
+
+// Links are the iris of the published entities, which are their urls.
+type Links struct {
+	BaseUrl string // such as https://example.com, without the trailing slash
+}
+
+func (links Links) Catalog() string {
+	return links.BaseUrl + "/integration/v1/catalog.jsonld"
+}
+
+func (links Links) Repo(repoName string) string {
+	return links.BaseUrl + "/integration/v1/repository/" + url.PathEscape(repoName) + "/catalog.jsonld"
+}
+
+func (links Links) Item(repoName, itemName string) string {
+	return links.BaseUrl + "/integration/v1/dataitem/" + url.PathEscape(repoName) + "/" +
+		url.PathEscape(itemName) + "/dataset.jsonld"
+}
+
+// RenderCatalog renders the catalog of all the repositories.
+func RenderCatalog(format string, links Links, repos []*Repo) ([]byte, string, error) {
+	if format == FormatSchemaOrg {
+		datasets := make([]interface{}, len(repos))
+		for i, repo := range repos {
+			datasets[i] = schemaOrgRepo(links, repo)
+		}
+		return renderSchemaOrg(map[string]interface{}{
+			"@type":   "DataCatalog",
+			"@id":     links.Catalog(),
+			"url":     links.Catalog(),
+			"name":    CatalogTitle,
+			"dataset": datasets,
+		})
+	}
+
+	g := &graph{}
+	catalog := iri(links.Catalog())
+	g.add(catalog, rdfType, iri(NsDcat+"Catalog"))
+	g.add(catalog, NsDct+"title", literal(CatalogTitle))
+	for _, repo := range repos {
+		g.add(catalog, NsDcat+"catalog", iri(links.Repo(repo.RepoName)))
+	}
+	for _, repo := range repos {
+		addRepo(g, links, repo)
+	}
+	return render(format, g)
+}
+
+// RenderRepo renders a repository with its dataitems.
+func RenderRepo(format string, links Links, repo *Repo) ([]byte, string, error) {
+	if format == FormatSchemaOrg {
+		return renderSchemaOrg(schemaOrgRepo(links, repo))
+	}
+
+	g := &graph{}
+	addRepo(g, links, repo)
+	return render(format, g)
+}
+
+// RenderItem renders a dataitem of the repository.
+func RenderItem(format string, links Links, repoName string, item *Item) ([]byte, string, error) {
+	if format == FormatSchemaOrg {
+		dataset := schemaOrgItem(links, repoName, item)
+		dataset["isPartOf"] = map[string]interface{}{"@type": "Dataset", "@id": links.Repo(repoName)}
+		return renderSchemaOrg(dataset)
+	}
+
+	g := &graph{}
+	g.add(iri(links.Repo(repoName)), NsDcat+"dataset", iri(links.Item(repoName, item.ItemName)))
+	addItem(g, links, repoName, item)
+	return render(format, g)
+}
+
+func render(format string, g *graph) ([]byte, string, error) {
+	var data []byte
+	var err error
+	switch format {
+	case FormatJsonLd:
+		data, err = writeJsonLd(g)
+	case FormatTurtle:
+		data = writeTurtle(g)
+	case FormatRdfXml:
+		data, err = writeRdfXml(g)
+	default:
+		return nil, "", ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return data, ContentTypes[format], nil
+}
+
+func addRepo(g *graph, links Links, repo *Repo) {
+	node := iri(links.Repo(repo.RepoName))
+	g.add(node, rdfType, iri(NsDcat+"Catalog"))
+	g.add(node, NsDct+"identifier", literal(repo.RepoName))
+	g.add(node, NsDct+"title", literal(repo.RepoName))
+	if repo.ChRepoName != "" {
+		g.add(node, NsDct+"title", langLiteral(repo.ChRepoName, "zh"))
+	}
+	if repo.Description != "" {
+		g.add(node, NsDct+"description", literal(repo.Description))
+	}
+	if repo.CreateUser != "" {
+		publisher := g.newBlank()
+		g.add(node, NsDct+"publisher", publisher)
+		g.add(publisher, rdfType, iri(NsFoaf+"Agent"))
+		g.add(publisher, NsFoaf+"name", literal(repo.CreateUser))
+	}
+	addKeywords(g, node, repo.Tags)
+	addDates(g, node, repo.CreateTime, repo.UpdateTime)
+	for _, item := range repo.Items {
+		g.add(node, NsDcat+"dataset", iri(links.Item(repo.RepoName, item.ItemName)))
+	}
+
+	for _, item := range repo.Items {
+		addItem(g, links, repo.RepoName, item)
+	}
+}
+
+func addItem(g *graph, links Links, repoName string, item *Item) {
+	node := iri(links.Item(repoName, item.ItemName))
+	g.add(node, rdfType, iri(NsDcat+"Dataset"))
+	g.add(node, NsDct+"identifier", literal(repoName+"/"+item.ItemName))
+	g.add(node, NsDct+"title", literal(item.ItemName))
+	addKeywords(g, node, item.Tags)
+	addDates(g, node, item.CreateTime, item.UpdateTime)
+	if item.SchemaVersion > 0 {
+		g.add(node, NsDcat+"version", literal(strconv.Itoa(item.SchemaVersion)))
+	}
+
+	if accessUrl, ok := absoluteUrl(item.Url); ok {
+		distribution := g.newBlank()
+		g.add(node, NsDcat+"distribution", distribution)
+		g.add(distribution, rdfType, iri(NsDcat+"Distribution"))
+		g.add(distribution, NsDcat+"accessURL", iri(accessUrl))
+	}
+
+	if item.Attrs == nil {
+		return
+	}
+	schema := g.newBlank()
+	g.add(node, NsCsvw+"tableSchema", schema)
+	g.add(schema, rdfType, iri(NsCsvw+"Schema"))
+	columns := make([]term, len(item.Attrs))
+	for i := range item.Attrs {
+		columns[i] = g.newBlank()
+	}
+	g.add(schema, NsCsvw+"column", list(columns...))
+
+	keys := make([]string, 0, 2)
+	for i, attr := range item.Attrs {
+		column := columns[i]
+		g.add(column, rdfType, iri(NsCsvw+"Column"))
+		g.add(column, NsCsvw+"name", literal(attr.AttrName))
+		if datatype, ok := xsdTypes[attr.DataType]; ok {
+			g.add(column, NsCsvw+"datatype", iri(NsXsd+datatype))
+		} else {
+			g.add(column, NsCsvw+"datatype", literal(attr.TypeString()))
+		}
+		g.add(column, NsCsvw+"required", typedLiteral(strconv.FormatBool(!attr.Nullable), NsXsd+"boolean"))
+		if attr.Instruction != "" {
+			g.add(column, NsDct+"description", literal(attr.Instruction))
+		}
+		if attr.PrimaryKey {
+			keys = append(keys, attr.AttrName)
+		}
+	}
+	for _, key := range keys {
+		g.add(schema, NsCsvw+"primaryKey", literal(key))
+	}
+}
+
+func addKeywords(g *graph, node term, tags []string) {
+	for _, tag := range tags {
+		g.add(node, NsDcat+"keyword", literal(tag))
+	}
+}
+
+func addDates(g *graph, node term, issued, modified *time.Time) {
+	if issued != nil {
+		g.add(node, NsDct+"issued", typedLiteral(issued.UTC().Format(time.RFC3339), NsXsd+"dateTime"))
+	}
+	if modified != nil {
+		g.add(node, NsDct+"modified", typedLiteral(modified.UTC().Format(time.RFC3339), NsXsd+"dateTime"))
+	}
+}
+
+// absoluteUrl returns the url if it's an absolute http, https or ftp one.
+func absoluteUrl(s string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	switch u.Scheme {
+	case "http", "https", "ftp":
+		return u.String(), true
+	}
+	return "", false
+}
+
+func renderSchemaOrg(node map[string]interface{}) ([]byte, string, error) {
+	node["@context"] = SchemaOrgProfile
+	data, err := json.MarshalIndent(node, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	return data, ContentTypes[FormatSchemaOrg], nil
+}
+
+func schemaOrgRepo(links Links, repo *Repo) map[string]interface{} {
+	dataset := map[string]interface{}{
+		"@type":      "Dataset",
+		"@id":        links.Repo(repo.RepoName),
+		"url":        links.Repo(repo.RepoName),
+		"identifier": repo.RepoName,
+		"name":       repo.RepoName,
+		// the search engines require a description.
+		"description": repo.Description,
+		"includedInDataCatalog": map[string]interface{}{
+			"@type": "DataCatalog",
+			"@id":   links.Catalog(),
+			"name":  CatalogTitle,
+		},
+	}
+	if repo.Description == "" {
+		dataset["description"] = repo.RepoName
+	}
+	if repo.ChRepoName != "" {
+		dataset["alternateName"] = repo.ChRepoName
+	}
+	if repo.CreateUser != "" {
+		dataset["creator"] = map[string]interface{}{"@type": "Person", "name": repo.CreateUser}
+	}
+	if len(repo.Tags) > 0 {
+		dataset["keywords"] = repo.Tags
+	}
+	schemaOrgDates(dataset, repo.CreateTime, repo.UpdateTime)
+
+	if len(repo.Items) > 0 {
+		parts := make([]interface{}, len(repo.Items))
+		for i, item := range repo.Items {
+			parts[i] = schemaOrgItem(links, repo.RepoName, item)
+		}
+		dataset["hasPart"] = parts
+	}
+	return dataset
+}
+
+func schemaOrgItem(links Links, repoName string, item *Item) map[string]interface{} {
+	dataset := map[string]interface{}{
+		"@type":       "Dataset",
+		"@id":         links.Item(repoName, item.ItemName),
+		"url":         links.Item(repoName, item.ItemName),
+		"identifier":  repoName + "/" + item.ItemName,
+		"name":        item.ItemName,
+		"description": repoName + "/" + item.ItemName,
+	}
+	if item.SchemaVersion > 0 {
+		dataset["version"] = strconv.Itoa(item.SchemaVersion)
+	}
+	if len(item.Tags) > 0 {
+		dataset["keywords"] = item.Tags
+	}
+	schemaOrgDates(dataset, item.CreateTime, item.UpdateTime)
+	if contentUrl, ok := absoluteUrl(item.Url); ok {
+		dataset["distribution"] = []interface{}{
+			map[string]interface{}{"@type": "DataDownload", "contentUrl": contentUrl},
+		}
+	}
+
+	if len(item.Attrs) > 0 {
+		variables := make([]interface{}, len(item.Attrs))
+		for i, attr := range item.Attrs {
+			variable := map[string]interface{}{
+				"@type": "PropertyValue",
+				"name":  attr.AttrName,
+			}
+			if attr.Instruction != "" {
+				variable["description"] = attr.Instruction
+			}
+			if attr.Unit != "" {
+				variable["unitText"] = attr.Unit
+			}
+			variables[i] = variable
+		}
+		dataset["variableMeasured"] = variables
+	}
+	return dataset
+}
+
+func schemaOrgDates(dataset map[string]interface{}, created, modified *time.Time) {
+	if created != nil {
+		dataset["dateCreated"] = created.UTC().Format(time.RFC3339)
+	}
+	if modified != nil {
+		dataset["dateModified"] = modified.UTC().Format(time.RFC3339)
+	}
+}
@@ -0,0 +1,211 @@
+package dcat
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLinks = Links{BaseUrl: "https://catalog.example.com"}
+
+func testRepo() *Repo {
+	updated := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+	return &Repo{
+		Repository: &models.Repository{
+			RepoName:    "retail",
+			ChRepoName:  "零售",
+			CreateUser:  "alice",
+			Description: `sales "and" stores`,
+			UpdateTime:  &updated,
+			Tags:        []string{"sales"},
+		},
+		Items: []*Item{
+			{
+				Dataitem: &models.Dataitem{ItemName: "orders", Url: "https://data.example.com/orders.csv", SchemaVersion: 2},
+				Attrs: []*models.Attribute{
+					{AttrName: "id", DataType: models.DataTypeInt, PrimaryKey: true},
+					{AttrName: "amount", DataType: models.DataTypeDecimal, Nullable: true, Instruction: "in <CNY>", Unit: "CNY"},
+				},
+			},
+			{Dataitem: &models.Dataitem{ItemName: "stores", Url: "stores.csv"}},
+		},
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":            FormatJsonLd,
+		"*/*":         FormatJsonLd,
+		"text/turtle": FormatTurtle,
+		"application/rdf+xml;q=0.9, text/turtle;q=0.5":      FormatRdfXml,
+		"text/html, application/rdf+xml;q=0.1":              FormatRdfXml,
+		`application/ld+json; profile="https://schema.org"`: FormatSchemaOrg,
+		"text/html":                  "",
+		"image/png, text/html;q=0.8": "",
+	}
+	for accept, format := range cases {
+		if got := Negotiate(accept); got != format {
+			t.Errorf("%q: expect %q, got %q", accept, format, got)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	if link := testLinks.Item("retail", "orders 2024"); link != "https://catalog.example.com/integration/v1/dataitem/retail/orders%202024/dataset.jsonld" {
+		t.Errorf("item link %s", link)
+	}
+}
+
+func TestRenderRepoTurtle(t *testing.T) {
+	data, contentType, err := RenderRepo(FormatTurtle, testLinks, testRepo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(contentType, "text/turtle") {
+		t.Errorf("content type %s", contentType)
+	}
+
+	turtle := string(data)
+	for _, s := range []string{
+		"@prefix dcat: <http://www.w3.org/ns/dcat#> .",
+		"<https://catalog.example.com/integration/v1/repository/retail/catalog.jsonld>\n    a dcat:Catalog ;",
+		`dct:title "retail", "零售"@zh ;`,
+		`dct:description "sales \"and\" stores" ;`,
+		`dct:modified "2024-03-01T08:30:00Z"^^xsd:dateTime ;`,
+		"dcat:accessURL <https://data.example.com/orders.csv> .",
+		"csvw:column ( _:b4 _:b5 ) ;",
+		`csvw:primaryKey "id" .`,
+		"csvw:datatype xsd:integer ;",
+		`csvw:required "true"^^xsd:boolean .`,
+	} {
+		if !strings.Contains(turtle, s) {
+			t.Errorf("%q not in\n%s", s, turtle)
+		}
+	}
+	// the url of stores is not absolute, so it has no distribution.
+	if strings.Count(turtle, "dcat:Distribution") != 1 {
+		t.Errorf("distributions in\n%s", turtle)
+	}
+}
+
+func TestRenderRepoJsonLd(t *testing.T) {
+	data, _, err := RenderRepo(FormatJsonLd, testLinks, testRepo())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Context map[string]string            `json:"@context"`
+		Graph   []map[string]json.RawMessage `json:"@graph"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Context["dcat"] != NsDcat {
+		t.Errorf("context %v", doc.Context)
+	}
+	repo := doc.Graph[0]
+	if compactJson(repo["@type"]) != `["dcat:Catalog"]` {
+		t.Errorf("repo type %s", repo["@type"])
+	}
+	if !strings.Contains(compactJson(repo["dct:title"]), `{"@language":"zh","@value":"零售"}`) {
+		t.Errorf("repo title %s", repo["dct:title"])
+	}
+
+	for _, node := range doc.Graph {
+		if columns, ok := node["csvw:column"]; ok {
+			if compactJson(columns) != `[{"@list":[{"@id":"_:b4"},{"@id":"_:b5"}]}]` {
+				t.Errorf("columns %s", columns)
+			}
+			return
+		}
+	}
+	t.Errorf("no columns in\n%s", data)
+}
+
+func compactJson(data []byte) string {
+	var buf bytes.Buffer
+	json.Compact(&buf, data)
+	return buf.String()
+}
+
+func TestRenderCatalogRdfXml(t *testing.T) {
+	data, _, err := RenderCatalog(FormatRdfXml, testLinks, []*Repo{testRepo()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the document must be well formed.
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("%v in\n%s", err, data)
+		}
+	}
+
+	rdf := string(data)
+	for _, s := range []string{
+		`<rdf:Description rdf:about="https://catalog.example.com/integration/v1/catalog.jsonld">`,
+		`<dcat:catalog rdf:resource="https://catalog.example.com/integration/v1/repository/retail/catalog.jsonld"/>`,
+		`<dct:title xml:lang="zh">零售</dct:title>`,
+		`<dct:description>in &lt;CNY&gt;</dct:description>`,
+		`<csvw:column rdf:parseType="Collection">`,
+		`<dcat:distribution rdf:nodeID="b2"/>`,
+	} {
+		if !strings.Contains(rdf, s) {
+			t.Errorf("%q not in\n%s", s, rdf)
+		}
+	}
+}
+
+func TestRenderItemSchemaOrg(t *testing.T) {
+	repo := testRepo()
+	data, _, err := RenderItem(FormatSchemaOrg, testLinks, repo.RepoName, repo.Items[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dataset struct {
+		Context      string `json:"@context"`
+		Type         string `json:"@type"`
+		Name         string `json:"name"`
+		Distribution []struct {
+			ContentUrl string `json:"contentUrl"`
+		} `json:"distribution"`
+		VariableMeasured []struct {
+			Name     string `json:"name"`
+			UnitText string `json:"unitText"`
+		} `json:"variableMeasured"`
+		IsPartOf struct {
+			Id string `json:"@id"`
+		} `json:"isPartOf"`
+	}
+	if err := json.Unmarshal(data, &dataset); err != nil {
+		t.Fatal(err)
+	}
+	if dataset.Context != SchemaOrgProfile || dataset.Type != "Dataset" || dataset.Name != "orders" {
+		t.Errorf("dataset %s", data)
+	}
+	if len(dataset.Distribution) != 1 || dataset.Distribution[0].ContentUrl != "https://data.example.com/orders.csv" {
+		t.Errorf("distribution %s", data)
+	}
+	if len(dataset.VariableMeasured) != 2 || dataset.VariableMeasured[1].UnitText != "CNY" {
+		t.Errorf("variables %s", data)
+	}
+	if dataset.IsPartOf.Id != testLinks.Repo("retail") {
+		t.Errorf("isPartOf %s", data)
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	if _, _, err := RenderRepo("csv", testLinks, testRepo()); err != ErrUnknownFormat {
+		t.Errorf("err %v", err)
+	}
+}
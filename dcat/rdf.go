@@ -0,0 +1,336 @@
+package dcat
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	NsDcat = "http://www.w3.org/ns/dcat#"
+	NsDct  = "http://purl.org/dc/terms/"
+	NsFoaf = "http://xmlns.com/foaf/0.1/"
+	NsCsvw = "http://www.w3.org/ns/csvw#"
+	NsXsd  = "http://www.w3.org/2001/XMLSchema#"
+	NsRdf  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+	rdfType = NsRdf + "type"
+)
+
+// prefixes are used by all the serializations, in this order.
+var prefixes = []struct {
+	prefix    string
+	namespace string
+}{
+	{"dcat", NsDcat},
+	{"dct", NsDct},
+	{"foaf", NsFoaf},
+	{"csvw", NsCsvw},
+	{"xsd", NsXsd},
+	{"rdf", NsRdf},
+}
+
+var localNameValidator = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+type termKind int
+
+const (
+	iriTerm termKind = iota
+	blankTerm
+	literalTerm
+	listTerm
+)
+
+// term is a node or a literal of the graph.
+type term struct {
+	kind     termKind
+	value    string // the iri, the blank node label or the lexical form
+	datatype string // the datatype iri of a typed literal
+	lang     string
+	items    []term // of a list
+}
+
+func iri(value string) term {
+	return term{kind: iriTerm, value: value}
+}
+
+func literal(value string) term {
+	return term{kind: literalTerm, value: value}
+}
+
+func langLiteral(value, lang string) term {
+	return term{kind: literalTerm, value: value, lang: lang}
+}
+
+func typedLiteral(value, datatype string) term {
+	return term{kind: literalTerm, value: value, datatype: datatype}
+}
+
+func list(items ...term) term {
+	return term{kind: listTerm, items: items}
+}
+
+func (t term) key() string {
+	return strconv.Itoa(int(t.kind)) + t.value
+}
+
+type triple struct {
+	subject   term
+	predicate string
+	object    term
+}
+
+// graph keeps the triples in the insertion order, so that the serializations
+// are stable.
+type graph struct {
+	triples []triple
+	blanks  int
+}
+
+func (g *graph) newBlank() term {
+	g.blanks++
+	return term{kind: blankTerm, value: "b" + strconv.Itoa(g.blanks)}
+}
+
+func (g *graph) add(subject term, predicate string, object term) {
+	g.triples = append(g.triples, triple{subject, predicate, object})
+}
+
+// subject is a subject with its triples grouped by predicate.
+type subject struct {
+	term       term
+	predicates []string
+	objects    map[string][]term
+}
+
+func (g *graph) subjects() []*subject {
+	subjects := make([]*subject, 0, 16)
+	index := make(map[string]*subject)
+	for _, t := range g.triples {
+		s, ok := index[t.subject.key()]
+		if !ok {
+			s = &subject{term: t.subject, objects: make(map[string][]term)}
+			subjects = append(subjects, s)
+			index[t.subject.key()] = s
+		}
+		if _, ok := s.objects[t.predicate]; !ok {
+			s.predicates = append(s.predicates, t.predicate)
+		}
+		s.objects[t.predicate] = append(s.objects[t.predicate], t.object)
+	}
+	return subjects
+}
+
+// compact returns the prefixed name of the iri, if any.
+func compact(value string) (string, bool) {
+	for _, p := range prefixes {
+		if strings.HasPrefix(value, p.namespace) {
+			local := value[len(p.namespace):]
+			if localNameValidator.MatchString(local) {
+				return p.prefix + ":" + local, true
+			}
+		}
+	}
+	return "", false
+}
+
+// writeTurtle serializes the graph as text/turtle.
+func writeTurtle(g *graph) []byte {
+	var buf bytes.Buffer
+	for _, p := range prefixes {
+		fmt.Fprintf(&buf, "@prefix %s: <%s> .\n", p.prefix, p.namespace)
+	}
+
+	for _, s := range g.subjects() {
+		buf.WriteString("\n")
+		buf.WriteString(turtleTerm(s.term))
+		for i, predicate := range s.predicates {
+			name := "a"
+			if predicate != rdfType {
+				name = turtleTerm(iri(predicate))
+			}
+			objects := make([]string, len(s.objects[predicate]))
+			for j, object := range s.objects[predicate] {
+				objects[j] = turtleTerm(object)
+			}
+			separator := " ;"
+			if i == len(s.predicates)-1 {
+				separator = " ."
+			}
+			fmt.Fprintf(&buf, "\n    %s %s%s", name, strings.Join(objects, ", "), separator)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+var turtleStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+var iriEscaper = strings.NewReplacer("<", "%3C", ">", "%3E", `"`, "%22", " ", "%20", "{", "%7B", "}", "%7D",
+	"|", "%7C", "^", "%5E", "`", "%60", `\`, "%5C")
+
+func turtleTerm(t term) string {
+	switch t.kind {
+	case iriTerm:
+		if name, ok := compact(t.value); ok {
+			return name
+		}
+		return "<" + iriEscaper.Replace(t.value) + ">"
+	case blankTerm:
+		return "_:" + t.value
+	case listTerm:
+		items := make([]string, len(t.items))
+		for i, item := range t.items {
+			items[i] = turtleTerm(item)
+		}
+		return "( " + strings.Join(items, " ") + " )"
+	}
+
+	s := `"` + turtleStringEscaper.Replace(t.value) + `"`
+	if t.lang != "" {
+		return s + "@" + t.lang
+	}
+	if t.datatype != "" {
+		return s + "^^" + turtleTerm(iri(t.datatype))
+	}
+	return s
+}
+
+// writeJsonLd serializes the graph as a flattened application/ld+json
+// document, with the prefixes in the context.
+func writeJsonLd(g *graph) ([]byte, error) {
+	context := make(map[string]string, len(prefixes))
+	for _, p := range prefixes {
+		context[p.prefix] = p.namespace
+	}
+
+	nodes := make([]map[string]interface{}, 0, len(g.triples))
+	for _, s := range g.subjects() {
+		node := map[string]interface{}{"@id": jsonLdId(s.term)}
+		for _, predicate := range s.predicates {
+			objects := s.objects[predicate]
+			if predicate == rdfType {
+				types := make([]string, len(objects))
+				for i, object := range objects {
+					types[i] = jsonLdId(object)
+				}
+				node["@type"] = types
+				continue
+			}
+
+			name := predicate
+			if compacted, ok := compact(predicate); ok {
+				name = compacted
+			}
+			values := make([]interface{}, len(objects))
+			for i, object := range objects {
+				values[i] = jsonLdValue(object)
+			}
+			node[name] = values
+		}
+		nodes = append(nodes, node)
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"@context": context,
+		"@graph":   nodes,
+	}, "", "  ")
+}
+
+func jsonLdId(t term) string {
+	if t.kind == blankTerm {
+		return "_:" + t.value
+	}
+	if name, ok := compact(t.value); ok {
+		return name
+	}
+	return t.value
+}
+
+func jsonLdValue(t term) interface{} {
+	switch t.kind {
+	case iriTerm, blankTerm:
+		return map[string]string{"@id": jsonLdId(t)}
+	case listTerm:
+		items := make([]interface{}, len(t.items))
+		for i, item := range t.items {
+			items[i] = jsonLdValue(item)
+		}
+		return map[string]interface{}{"@list": items}
+	}
+
+	value := map[string]string{"@value": t.value}
+	if t.lang != "" {
+		value["@language"] = t.lang
+	} else if t.datatype != "" {
+		value["@type"] = jsonLdId(iri(t.datatype))
+	}
+	return value
+}
+
+// writeRdfXml serializes the graph as application/rdf+xml. The predicates
+// must be in the known prefixes, and the lists must be of nodes.
+func writeRdfXml(g *graph) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString("<rdf:RDF")
+	for _, p := range prefixes {
+		fmt.Fprintf(&buf, "\n    xmlns:%s=\"%s\"", p.prefix, xmlEscape(p.namespace))
+	}
+	buf.WriteString(">\n")
+
+	for _, s := range g.subjects() {
+		fmt.Fprintf(&buf, "  <rdf:Description %s>\n", xmlNodeAttr(s.term, "rdf:about"))
+		for _, predicate := range s.predicates {
+			name, ok := compact(predicate)
+			if !ok {
+				return nil, fmt.Errorf("predicate %s is not in the known namespaces", predicate)
+			}
+			for _, object := range s.objects[predicate] {
+				switch object.kind {
+				case iriTerm, blankTerm:
+					fmt.Fprintf(&buf, "    <%s %s/>\n", name, xmlNodeAttr(object, "rdf:resource"))
+				case listTerm:
+					fmt.Fprintf(&buf, "    <%s rdf:parseType=\"Collection\">\n", name)
+					for _, item := range object.items {
+						if item.kind != iriTerm && item.kind != blankTerm {
+							return nil, fmt.Errorf("the list of %s must be of nodes", name)
+						}
+						fmt.Fprintf(&buf, "      <rdf:Description %s/>\n", xmlNodeAttr(item, "rdf:about"))
+					}
+					fmt.Fprintf(&buf, "    </%s>\n", name)
+				default:
+					attr := ""
+					if object.lang != "" {
+						attr = fmt.Sprintf(" xml:lang=\"%s\"", xmlEscape(object.lang))
+					} else if object.datatype != "" {
+						attr = fmt.Sprintf(" rdf:datatype=\"%s\"", xmlEscape(object.datatype))
+					}
+					fmt.Fprintf(&buf, "    <%s%s>%s</%s>\n", name, attr, xmlEscape(object.value), name)
+				}
+			}
+		}
+		buf.WriteString("  </rdf:Description>\n")
+	}
+
+	buf.WriteString("</rdf:RDF>\n")
+	return buf.Bytes(), nil
+}
+
+// xmlNodeAttr refers to an iri by the attr, or to a blank node by rdf:nodeID.
+func xmlNodeAttr(t term, attr string) string {
+	if t.kind == blankTerm {
+		return fmt.Sprintf("rdf:nodeID=\"%s\"", xmlEscape(t.value))
+	}
+	return fmt.Sprintf("%s=\"%s\"", attr, xmlEscape(t.value))
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
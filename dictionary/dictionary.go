@@ -0,0 +1,296 @@
+// Package dictionary renders the data dictionary of a repository, which lists
+// the attributes of every dataitem, for the business users.
+package dictionary
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatHtml     = "html"
+	FormatMarkdown = "markdown"
+	FormatXlsx     = "xlsx"
+
+	LangEn = "en"
+	LangZh = "zh"
+)
+
+var ErrUnknownFormat = errors.New("unknown dictionary format")
+
+type Item struct {
+	*models.Dataitem
+	Attrs []*models.Attribute
+}
+
+type Dictionary struct {
+	Repo        *models.Repository
+	Items       []*Item
+	GeneratedAt time.Time
+}
+
+// labels are the headings in a language.
+type labels struct {
+	Title       string
+	Repository  string
+	Description string
+	Class       string
+	Owner       string
+	Generated   string
+	Dataitems   string
+	Overview    string
+	Version     string
+	Updated     string
+	NoAttrs     string
+	Columns     []string
+	Yes         string
+}
+
+var allLabels = map[string]*labels{
+	LangEn: {
+		Title:       "Data Dictionary",
+		Repository:  "Repository",
+		Description: "Description",
+		Class:       "Class",
+		Owner:       "Owner",
+		Generated:   "Generated",
+		Dataitems:   "Dataitems",
+		Overview:    "Overview",
+		Version:     "Schema version",
+		Updated:     "Updated",
+		NoAttrs:     "No attributes.",
+		Columns:     []string{"No.", "Name", "Type", "Nullable", "Primary key", "Unit", "Example", "Description"},
+		Yes:         "Yes",
+	},
+	LangZh: {
+		Title:       "数据字典",
+		Repository:  "数据仓库",
+		Description: "描述",
+		Class:       "类别",
+		Owner:       "所有者",
+		Generated:   "生成时间",
+		Dataitems:   "数据项",
+		Overview:    "概览",
+		Version:     "结构版本",
+		Updated:     "更新时间",
+		NoAttrs:     "无属性。",
+		Columns:     []string{"序号", "名称", "类型", "可为空", "主键", "单位", "示例", "说明"},
+		Yes:         "是",
+	},
+}
+
+// Lang returns the supported language of a lang param or an Accept-Language
+// header, which is zh by default.
+func Lang(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if strings.HasPrefix(lang, LangEn) {
+		return LangEn
+	}
+	return LangZh
+}
+
+// Render returns the dictionary in the format and the content type.
+func Render(format, lang string, dict *Dictionary) ([]byte, string, error) {
+	l := allLabels[Lang(lang)]
+
+	var buf bytes.Buffer
+	var err error
+	contentType := ""
+	switch strings.ToLower(format) {
+	case FormatHtml:
+		contentType = "text/html; charset=utf-8"
+		err = htmlTemplate.Execute(&buf, &htmlData{dict, l})
+	case FormatMarkdown:
+		contentType = "text/markdown; charset=utf-8"
+		err = renderMarkdown(&buf, dict, l)
+	case FormatXlsx:
+		contentType = common.XlsxContentType
+		err = common.WriteXlsx(&buf, xlsxSheets(dict, l))
+	default:
+		return nil, "", ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), contentType, nil
+}
+
+// attrRow returns the cells of an attribute in the order of labels.Columns.
+func attrRow(i int, attr *models.Attribute, l *labels) []string {
+	nullable, primaryKey := "", ""
+	if attr.Nullable {
+		nullable = l.Yes
+	}
+	if attr.PrimaryKey {
+		primaryKey = l.Yes
+	}
+
+	typeString := attr.TypeString()
+	if attr.DataType == models.DataTypeEnum {
+		typeString = fmt.Sprintf("enum(%s)", strings.Join(attr.EnumValues, ", "))
+	}
+
+	return []string{strconv.Itoa(i + 1), attr.AttrName, typeString, nullable, primaryKey,
+		attr.Unit, attr.Example, attr.Instruction}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// repoRows are the name-value pairs of the repository summary.
+func repoRows(dict *Dictionary, l *labels) [][]string {
+	repo := dict.Repo
+	name := repo.RepoName
+	if repo.ChRepoName != "" && repo.ChRepoName != repo.RepoName {
+		name = fmt.Sprintf("%s (%s)", repo.RepoName, repo.ChRepoName)
+	}
+
+	rows := [][]string{{l.Repository, name}}
+	if repo.Class != "" {
+		rows = append(rows, []string{l.Class, repo.Class})
+	}
+	if repo.CreateUser != "" {
+		rows = append(rows, []string{l.Owner, repo.CreateUser})
+	}
+	if repo.Description != "" {
+		rows = append(rows, []string{l.Description, repo.Description})
+	}
+	rows = append(rows, []string{l.Dataitems, strconv.Itoa(len(dict.Items))})
+	rows = append(rows, []string{l.Generated, dict.GeneratedAt.Format("2006-01-02 15:04")})
+	return rows
+}
+
+type htmlData struct {
+	*Dictionary
+	L *labels
+}
+
+var htmlTemplate = template.Must(template.New("dictionary").Funcs(template.FuncMap{
+	"attrRow":    attrRow,
+	"repoRows":   repoRows,
+	"formatTime": formatTime,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.L.Title}} - {{.Repo.RepoName}}</title>
+<style>
+body { font-family: "Helvetica Neue", Arial, "PingFang SC", "Microsoft YaHei", sans-serif; font-size: 13px; margin: 2em; color: #222; }
+h1 { font-size: 22px; }
+h2 { font-size: 17px; margin-top: 2em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; width: 100%; margin: 0.5em 0; }
+th, td { border: 1px solid #bbb; padding: 4px 6px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+table.summary { width: auto; }
+.meta { color: #666; }
+section { page-break-inside: avoid; }
+@media print { section { page-break-before: auto; } a { color: inherit; text-decoration: none; } }
+</style>
+</head>
+<body>
+<h1>{{.L.Title}} - {{.Repo.RepoName}}</h1>
+<table class="summary">
+{{- range repoRows .Dictionary .L}}
+<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{- end}}
+</table>
+{{- $l := .L}}
+{{- range .Items}}
+<section>
+<h2 id="{{.ItemName}}">{{.ItemName}}</h2>
+<p class="meta">{{$l.Version}}: {{.SchemaVersion}}{{with formatTime .UpdateTime}} · {{$l.Updated}}: {{.}}{{end}}</p>
+{{- if .Attrs}}
+<table>
+<tr>{{range $l.Columns}}<th>{{.}}</th>{{end}}</tr>
+{{- range $i, $attr := .Attrs}}
+<tr>{{range attrRow $i $attr $l}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- else}}
+<p>{{$l.NoAttrs}}</p>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// markdownCell escapes the pipes and line breaks, which end a table cell.
+func markdownCell(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "|", `\|`, -1)
+	s = strings.Replace(s, "\r\n", "<br>", -1)
+	return strings.Replace(s, "\n", "<br>", -1)
+}
+
+func writeMarkdownRow(buf *bytes.Buffer, cells []string) {
+	buf.WriteString("|")
+	for _, cell := range cells {
+		buf.WriteString(" " + markdownCell(cell) + " |")
+	}
+	buf.WriteString("\n")
+}
+
+func renderMarkdown(buf *bytes.Buffer, dict *Dictionary, l *labels) error {
+	fmt.Fprintf(buf, "# %s - %s\n\n", l.Title, dict.Repo.RepoName)
+	for _, row := range repoRows(dict, l) {
+		fmt.Fprintf(buf, "- **%s**: %s\n", row[0], markdownCell(row[1]))
+	}
+
+	for _, item := range dict.Items {
+		fmt.Fprintf(buf, "\n## %s\n\n", item.ItemName)
+		fmt.Fprintf(buf, "%s: %d", l.Version, item.SchemaVersion)
+		if updated := formatTime(item.UpdateTime); updated != "" {
+			fmt.Fprintf(buf, " · %s: %s", l.Updated, updated)
+		}
+		buf.WriteString("\n\n")
+
+		if len(item.Attrs) == 0 {
+			buf.WriteString(l.NoAttrs + "\n")
+			continue
+		}
+
+		writeMarkdownRow(buf, l.Columns)
+		buf.WriteString("|" + strings.Repeat(" --- |", len(l.Columns)) + "\n")
+		for i, attr := range item.Attrs {
+			writeMarkdownRow(buf, attrRow(i, attr, l))
+		}
+	}
+	return nil
+}
+
+// xlsxSheets returns an overview sheet and a sheet per dataitem.
+func xlsxSheets(dict *Dictionary, l *labels) []*common.XlsxSheet {
+	used := make(map[string]bool, len(dict.Items)+1)
+	overview := &common.XlsxSheet{Name: common.XlsxSheetName(l.Overview, used), Rows: repoRows(dict, l)}
+	overview.Rows = append(overview.Rows, []string{})
+	overview.Rows = append(overview.Rows, []string{l.Dataitems, l.Version, l.Updated})
+
+	sheets := []*common.XlsxSheet{overview}
+	for _, item := range dict.Items {
+		overview.Rows = append(overview.Rows,
+			[]string{item.ItemName, strconv.Itoa(item.SchemaVersion), formatTime(item.UpdateTime)})
+
+		sheet := &common.XlsxSheet{
+			Name:       common.XlsxSheetName(item.ItemName, used),
+			Rows:       [][]string{l.Columns},
+			HeaderRows: 1,
+		}
+		for i, attr := range item.Attrs {
+			sheet.Rows = append(sheet.Rows, attrRow(i, attr, l))
+		}
+		sheets = append(sheets, sheet)
+	}
+	return sheets
+}
@@ -0,0 +1,125 @@
+package dictionary
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testDictionary() *Dictionary {
+	updated := time.Date(2016, 8, 1, 10, 30, 0, 0, time.UTC)
+	return &Dictionary{
+		Repo: &models.Repository{RepoName: "retail", ChRepoName: "零售", CreateUser: "alice",
+			Description: "sales | orders"},
+		Items: []*Item{
+			{
+				Dataitem: &models.Dataitem{ItemName: "orders", SchemaVersion: 2, UpdateTime: &updated},
+				Attrs: []*models.Attribute{
+					{AttrName: "id", DataType: models.DataTypeInt, PrimaryKey: true},
+					{AttrName: "amount", DataType: models.DataTypeDecimal, Precision: 10, Scale: 2,
+						Nullable: true, Unit: "CNY", Instruction: "<total>\nwith tax"},
+					{AttrName: "status", DataType: models.DataTypeEnum, EnumValues: []string{"new", "paid"}},
+				},
+			},
+			{Dataitem: &models.Dataitem{ItemName: "empty"}},
+		},
+		GeneratedAt: updated,
+	}
+}
+
+func TestLang(t *testing.T) {
+	cases := map[string]string{
+		"":                       LangZh,
+		"en":                     LangEn,
+		"en-US,en;q=0.9":         LangEn,
+		"zh-CN,zh;q=0.9,en;q=.8": LangZh,
+		"fr":                     LangZh,
+	}
+	for lang, expected := range cases {
+		if l := Lang(lang); l != expected {
+			t.Errorf("Lang(%s) => %s != %s", lang, l, expected)
+		}
+	}
+}
+
+func TestRenderHtml(t *testing.T) {
+	data, contentType, err := Render(FormatHtml, LangEn, testDictionary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("content type %s", contentType)
+	}
+	html := string(data)
+	for _, s := range []string{
+		"<title>Data Dictionary - retail</title>",
+		"<td>retail (零售)</td>",
+		`<h2 id="orders">orders</h2>`,
+		"<td>decimal(10,2)</td>",
+		"<td>enum(new, paid)</td>",
+		"<td>&lt;total&gt;\nwith tax</td>",
+		"<p>No attributes.</p>",
+	} {
+		if !strings.Contains(html, s) {
+			t.Errorf("html has no %q:\n%s", s, html)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	data, _, err := Render(FormatMarkdown, LangZh, testDictionary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(data)
+	for _, s := range []string{
+		"# 数据字典 - retail\n",
+		"- **描述**: sales \\| orders\n",
+		"结构版本: 2 · 更新时间: 2016-08-01 10:30\n",
+		"| 序号 | 名称 | 类型 | 可为空 | 主键 | 单位 | 示例 | 说明 |\n",
+		"| 1 | id | int |  | 是 |  |  |  |\n",
+		"| 2 | amount | decimal(10,2) | 是 |  | CNY |  | <total><br>with tax |\n",
+		"## empty\n\n结构版本: 0\n\n无属性。\n",
+	} {
+		if !strings.Contains(md, s) {
+			t.Errorf("markdown has no %q:\n%s", s, md)
+		}
+	}
+}
+
+func TestRenderXlsx(t *testing.T) {
+	data, _, err := Render(FormatXlsx, LangEn, testDictionary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheets := 0
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, "xl/worksheets/") {
+			sheets++
+		}
+	}
+	if sheets != 3 {
+		t.Errorf("%d sheets != 3", sheets)
+	}
+
+	names := []string{}
+	for _, sheet := range xlsxSheets(testDictionary(), allLabels[LangEn]) {
+		names = append(names, sheet.Name)
+	}
+	if strings.Join(names, ",") != "Overview,orders,empty" {
+		t.Errorf("sheet names %v", names)
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	if _, _, err := Render("pdf", LangEn, testDictionary()); err != ErrUnknownFormat {
+		t.Errorf("err %v != ErrUnknownFormat", err)
+	}
+}
@@ -0,0 +1,106 @@
+package discovery
+
+import (
+	"fmt"
+	"github.com/miekg/dns"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultConsulTimeout = 2 * time.Second
+	ConsulDomain         = "service.consul"
+)
+
+// ConsulDNS resolves the endpoints of a consul service by the SRV records of
+// <Service>.service.consul, filtered by Port if set. The addresses of the
+// targets are taken from the additional section, or resolved by A queries.
+type ConsulDNS struct {
+	Service string
+	Port    string
+	Server  string // the host:port of the consul dns
+	Net     string // "tcp" or "udp"
+	Timeout time.Duration
+}
+
+// NewConsulDNS returns the resolver of the service, with the consul dns
+// server in the CONSUL_SERVER and CONSUL_DNS_PORT envs.
+func NewConsulDNS(service string) *ConsulDNS {
+	return &ConsulDNS{
+		Service: service,
+		Server:  net.JoinHostPort(os.Getenv("CONSUL_SERVER"), os.Getenv("CONSUL_DNS_PORT")),
+		Net:     "tcp",
+		Timeout: DefaultConsulTimeout,
+	}
+}
+
+func (c *ConsulDNS) Resolve() ([]Endpoint, error) {
+	client := &dns.Client{Net: c.Net, Timeout: c.Timeout}
+
+	r, err := c.exchange(client, fmt.Sprintf("%s.%s", c.Service, ConsulDomain), dns.TypeSRV)
+	if err != nil {
+		return nil, err
+	}
+
+	// the A records of a target are repeated for its ports.
+	addrs := map[string][]string{}
+	seen := map[string]bool{}
+	for _, rr := range r.Extra {
+		if a, ok := rr.(*dns.A); ok && !seen[a.String()] {
+			seen[a.String()] = true
+			addrs[a.Hdr.Name] = append(addrs[a.Hdr.Name], a.A.String())
+		}
+	}
+
+	endpoints := []Endpoint{}
+	for _, rr := range r.Answer {
+		srv, ok := rr.(*dns.SRV)
+		if !ok {
+			continue
+		}
+		port := strconv.Itoa(int(srv.Port))
+		if c.Port != "" && port != c.Port {
+			continue
+		}
+
+		hosts, ok := addrs[srv.Target]
+		if !ok {
+			if hosts, err = c.lookupA(client, srv.Target); err != nil {
+				return nil, err
+			}
+		}
+		for _, host := range hosts {
+			endpoints = append(endpoints, Endpoint{Host: host, Port: port})
+		}
+	}
+	return endpoints, nil
+}
+
+func (c *ConsulDNS) lookupA(client *dns.Client, name string) ([]string, error) {
+	r, err := c.exchange(client, name, dns.TypeA)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{}
+	for _, rr := range r.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			hosts = append(hosts, a.A.String())
+		}
+	}
+	return hosts, nil
+}
+
+func (c *ConsulDNS) exchange(client *dns.Client, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	r, _, err := client.Exchange(m, c.Server)
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("dns query %s: %s", name, dns.RcodeToString[r.Rcode])
+	}
+	return r, nil
+}
@@ -0,0 +1,210 @@
+package discovery
+
+import (
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/log"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logger = log.GetLogger()
+
+const (
+	DefaultInterval = 30 * time.Second
+
+	// the envs of a service are named by its prefix, e.g. MYSQL_ADDRS and
+	// MYSQL_CONSUL_SERVICE.
+	AddrsEnvSuffix         = "_ADDRS"
+	ConsulServiceEnvSuffix = "_CONSUL_SERVICE"
+	ConsulPortEnvSuffix    = "_CONSUL_PORT"
+)
+
+// Endpoint is an address of a service.
+type Endpoint struct {
+	Host string `json:"host"`
+	Port string `json:"port"`
+}
+
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Host, e.Port)
+}
+
+// Resolver resolves the endpoints of a service.
+type Resolver interface {
+	Resolve() ([]Endpoint, error)
+}
+
+// Static is a fixed list of endpoints.
+type Static []Endpoint
+
+// NewStatic parses the host:port addresses.
+func NewStatic(addrs ...string) (Static, error) {
+	endpoints := make(Static, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, Endpoint{Host: host, Port: port})
+	}
+	return endpoints, nil
+}
+
+func (s Static) Resolve() ([]Endpoint, error) {
+	return append([]Endpoint{}, s...), nil
+}
+
+// Env resolves the endpoint in the AddrEnv and PortEnv envs, which name the
+// envs of the addr and port if Indirect, e.g. ENV_NAME_MYSQL_ADDR.
+type Env struct {
+	AddrEnv  string
+	PortEnv  string
+	Indirect bool
+}
+
+func (e *Env) Resolve() ([]Endpoint, error) {
+	addrEnv, portEnv := e.AddrEnv, e.PortEnv
+	if e.Indirect {
+		addrEnv, portEnv = os.Getenv(addrEnv), os.Getenv(portEnv)
+	}
+
+	host, port := os.Getenv(addrEnv), os.Getenv(portEnv)
+	if host == "" {
+		return nil, fmt.Errorf("env %s is not set", addrEnv)
+	}
+	return []Endpoint{{Host: host, Port: port}}, nil
+}
+
+// FromEnv returns the resolver of the service of the prefix: the addresses in
+// <prefix>_ADDRS separated by commas, or the consul service in
+// <prefix>_CONSUL_SERVICE, whose SRV records are filtered by the port in
+// <prefix>_CONSUL_PORT if set, or the fallback.
+func FromEnv(prefix string, fallback Resolver) (Resolver, error) {
+	if addrs := os.Getenv(prefix + AddrsEnvSuffix); addrs != "" {
+		return NewStatic(strings.Split(addrs, ",")...)
+	}
+	if service := os.Getenv(prefix + ConsulServiceEnvSuffix); service != "" {
+		consul := NewConsulDNS(service)
+		consul.Port = os.Getenv(prefix + ConsulPortEnvSuffix)
+		return consul, nil
+	}
+	return fallback, nil
+}
+
+// Watcher re-resolves the endpoints of a service every Interval, and calls the
+// OnChange funcs when they change, e.g. to reconnect. The last endpoints are
+// kept if a resolution fails or finds none.
+type Watcher struct {
+	Name     string
+	Resolver Resolver
+	Interval time.Duration
+
+	start sync.Once
+
+	mu        sync.Mutex
+	endpoints []Endpoint
+	onChange  []func(endpoints []Endpoint)
+}
+
+// NewWatcher returns a watcher of the service with the default interval.
+func NewWatcher(name string, resolver Resolver) *Watcher {
+	return &Watcher{
+		Name:     name,
+		Resolver: resolver,
+		Interval: DefaultInterval,
+	}
+}
+
+// OnChange adds a func called with the new endpoints when they change.
+func (w *Watcher) OnChange(f func(endpoints []Endpoint)) {
+	w.mu.Lock()
+	w.onChange = append(w.onChange, f)
+	w.mu.Unlock()
+}
+
+// Start resolves the endpoints, and re-resolves them in the background until
+// the stop channel is closed, once.
+func (w *Watcher) Start(stop <-chan struct{}) {
+	w.start.Do(func() {
+		w.Refresh()
+		go w.loop(stop)
+	})
+}
+
+func (w *Watcher) loop(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.Refresh()
+		}
+	}
+}
+
+// Endpoints returns the last resolved endpoints.
+func (w *Watcher) Endpoints() []Endpoint {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Endpoint{}, w.endpoints...)
+}
+
+// Endpoint returns the first of the last resolved endpoints.
+func (w *Watcher) Endpoint() (Endpoint, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.endpoints) == 0 {
+		return Endpoint{}, false
+	}
+	return w.endpoints[0], true
+}
+
+// Refresh resolves the endpoints, and returns whether or not they changed.
+// The OnChange funcs are called on the changes after the first resolution.
+func (w *Watcher) Refresh() bool {
+	endpoints, err := w.Resolver.Resolve()
+	if err != nil {
+		logger.Warn("Resolve %s err: %v", w.Name, err)
+		return false
+	}
+	if len(endpoints) == 0 {
+		logger.Warn("Resolve %s: no endpoints", w.Name)
+		return false
+	}
+	sort.Sort(byAddr(endpoints))
+
+	w.mu.Lock()
+	if reflect.DeepEqual(endpoints, w.endpoints) {
+		w.mu.Unlock()
+		return false
+	}
+	first := w.endpoints == nil
+	w.endpoints = endpoints
+	onChange := w.onChange
+	w.mu.Unlock()
+
+	logger.Info("Resolve %s: %v", w.Name, endpoints)
+	if !first {
+		for _, f := range onChange {
+			f(append([]Endpoint{}, endpoints...))
+		}
+	}
+	return true
+}
+
+type byAddr []Endpoint
+
+func (s byAddr) Len() int           { return len(s) }
+func (s byAddr) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byAddr) Less(i, j int) bool { return s[i].String() < s[j].String() }
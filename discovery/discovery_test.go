@@ -0,0 +1,215 @@
+package discovery
+
+import (
+	"errors"
+	"github.com/miekg/dns"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// consulServer is an in-process consul dns, which answers the SRV queries of
+// the services and the A queries of the nodes.
+type consulServer struct {
+	server *dns.Server
+
+	mu       sync.Mutex
+	services map[string][]*dns.SRV // by the fqdn
+	nodes    map[string]string     // the ips by the fqdn
+	extra    bool                  // whether or not the A records are additional
+}
+
+func newConsulServer(t *testing.T) *consulServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := &consulServer{services: map[string][]*dns.SRV{}, nodes: map[string]string{}, extra: true}
+	started := make(chan struct{})
+	cs.server = &dns.Server{Listener: l, Handler: dns.HandlerFunc(cs.serve), NotifyStartedFunc: func() { close(started) }}
+	go cs.server.ActivateAndServe()
+	<-started
+	return cs
+}
+
+func (cs *consulServer) addr() string {
+	return cs.server.Listener.Addr().String()
+}
+
+func (cs *consulServer) set(service string, nodes map[string]string, ports ...uint16) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	name := dns.Fqdn(service + "." + ConsulDomain)
+	cs.services[name] = nil
+	for node, ip := range nodes {
+		target := dns.Fqdn(node + ".node.dc1.consul")
+		cs.nodes[target] = ip
+		for _, port := range ports {
+			cs.services[name] = append(cs.services[name], &dns.SRV{
+				Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeSRV, Class: dns.ClassINET},
+				Target: target,
+				Port:   port,
+			})
+		}
+	}
+}
+
+func (cs *consulServer) a(name string) *dns.A {
+	return &dns.A{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET},
+		A:   net.ParseIP(cs.nodes[name]),
+	}
+}
+
+func (cs *consulServer) serve(w dns.ResponseWriter, r *dns.Msg) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	q := r.Question[0]
+	switch q.Qtype {
+	case dns.TypeSRV:
+		srvs, ok := cs.services[q.Name]
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+		}
+		for _, srv := range srvs {
+			m.Answer = append(m.Answer, srv)
+			if cs.extra {
+				m.Extra = append(m.Extra, cs.a(srv.Target))
+			}
+		}
+	case dns.TypeA:
+		if _, ok := cs.nodes[q.Name]; ok {
+			m.Answer = append(m.Answer, cs.a(q.Name))
+		} else {
+			m.Rcode = dns.RcodeNameError
+		}
+	}
+	w.WriteMsg(m)
+}
+
+func TestConsulDNS(t *testing.T) {
+	cs := newConsulServer(t)
+	defer cs.server.Shutdown()
+	cs.set("kafka", map[string]string{"node1": "10.0.0.1", "node2": "10.0.0.2"}, 9092, 2181)
+
+	consul := NewConsulDNS("kafka")
+	consul.Server = cs.addr()
+	consul.Port = "9092"
+	w := NewWatcher("kafka", consul)
+	if !w.Refresh() {
+		t.Fatal("expect the endpoints resolved")
+	}
+	expected := []Endpoint{{"10.0.0.1", "9092"}, {"10.0.0.2", "9092"}}
+	if endpoints := w.Endpoints(); !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("unexpected endpoints %v", endpoints)
+	}
+
+	// the targets are resolved by A queries without the additional section.
+	cs.mu.Lock()
+	cs.extra = false
+	cs.mu.Unlock()
+	consul.Port = ""
+	endpoints, err := consul.Resolve()
+	if err != nil || len(endpoints) != 4 {
+		t.Errorf("expect 4 endpoints, got %v: %v", endpoints, err)
+	}
+
+	consul.Service = "mysql"
+	if _, err := consul.Resolve(); err == nil {
+		t.Errorf("expect error of unknown service")
+	}
+}
+
+func TestWatcherOnChange(t *testing.T) {
+	cs := newConsulServer(t)
+	defer cs.server.Shutdown()
+	cs.set("mysql", map[string]string{"node1": "10.0.0.1"}, 3306)
+
+	consul := NewConsulDNS("mysql")
+	consul.Server = cs.addr()
+	w := NewWatcher("mysql", consul)
+	w.Interval = 10 * time.Millisecond
+	changes := make(chan []Endpoint, 10)
+	w.OnChange(func(endpoints []Endpoint) { changes <- endpoints })
+	stop := make(chan struct{})
+	defer close(stop)
+	w.Start(stop)
+
+	if endpoint, ok := w.Endpoint(); !ok || endpoint.String() != "10.0.0.1:3306" {
+		t.Errorf("unexpected endpoint %v", endpoint)
+	}
+
+	// the last endpoints are kept while the service is missing.
+	cs.set("mysql", map[string]string{}, 3306)
+	time.Sleep(50 * time.Millisecond)
+	if endpoint, _ := w.Endpoint(); endpoint.String() != "10.0.0.1:3306" {
+		t.Errorf("expect the last endpoint kept, got %v", endpoint)
+	}
+
+	cs.set("mysql", map[string]string{"node2": "10.0.0.2"}, 3306)
+	select {
+	case endpoints := <-changes:
+		if !reflect.DeepEqual(endpoints, []Endpoint{{"10.0.0.2", "3306"}}) {
+			t.Errorf("unexpected change %v", endpoints)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for the change")
+	}
+	if len(changes) != 0 {
+		t.Errorf("expect only one change")
+	}
+}
+
+type failingResolver struct{}
+
+func (failingResolver) Resolve() ([]Endpoint, error) {
+	return nil, errors.New("resolve failed")
+}
+
+func TestStaticAndEnv(t *testing.T) {
+	if _, err := NewStatic("10.0.0.1"); err == nil {
+		t.Errorf("expect error of missing port")
+	}
+
+	os.Setenv("TEST_DISCOVERY_ADDRS", "10.0.0.2:3306, 10.0.0.1:3306")
+	defer os.Unsetenv("TEST_DISCOVERY_ADDRS")
+	resolver, err := FromEnv("TEST_DISCOVERY", failingResolver{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher("test", resolver)
+	w.Refresh()
+	if endpoints := w.Endpoints(); !reflect.DeepEqual(endpoints, []Endpoint{{"10.0.0.1", "3306"}, {"10.0.0.2", "3306"}}) {
+		t.Errorf("unexpected endpoints %v", endpoints)
+	}
+
+	os.Unsetenv("TEST_DISCOVERY_ADDRS")
+	if resolver, _ := FromEnv("TEST_DISCOVERY", failingResolver{}); resolver != (failingResolver{}) {
+		t.Errorf("expect the fallback, got %v", resolver)
+	}
+
+	os.Setenv("TEST_ENV_NAME_ADDR", "TEST_MYSQL_ADDR")
+	os.Setenv("TEST_MYSQL_ADDR", "10.0.0.3")
+	os.Setenv("TEST_MYSQL_PORT", "3306")
+	defer func() {
+		for _, env := range []string{"TEST_ENV_NAME_ADDR", "TEST_MYSQL_ADDR", "TEST_MYSQL_PORT"} {
+			os.Unsetenv(env)
+		}
+	}()
+	endpoints, err := (&Env{AddrEnv: "TEST_ENV_NAME_ADDR", PortEnv: "TEST_ENV_NAME_PORT", Indirect: true}).Resolve()
+	if err != nil || !reflect.DeepEqual(endpoints, []Endpoint{{"10.0.0.3", ""}}) {
+		t.Errorf("unexpected endpoints %v: %v", endpoints, err)
+	}
+	endpoints, err = (&Env{AddrEnv: "TEST_MYSQL_ADDR", PortEnv: "TEST_MYSQL_PORT"}).Resolve()
+	if err != nil || !reflect.DeepEqual(endpoints, []Endpoint{{"10.0.0.3", "3306"}}) {
+		t.Errorf("unexpected endpoints %v: %v", endpoints, err)
+	}
+}
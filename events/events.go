@@ -0,0 +1,170 @@
+package events
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/log"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"os"
+	"strings"
+	"time"
+)
+
+var logger = log.GetLogger()
+
+const (
+	DefaultBatchSize = 100
+	DefaultInterval  = 5 * time.Second
+	DefaultLease     = 5 * time.Minute
+	DefaultRetention = 7 * 24 * time.Hour
+
+	// TopicEnvPrefix and the entity in upper case name the env of its topic,
+	// e.g. CATALOG_EVENTS_TOPIC_REPOSITORY.
+	TopicEnvPrefix = "CATALOG_EVENTS_TOPIC_"
+)
+
+// DefaultTopics are the topics of the entities, in the naming of the topics
+// of the other datafoundry services, e.g. to_alarm.json. The attribute
+// changes are published as the updates of their dataitems. Subscriptions and
+// stars are not changed by this service, so they have no events here.
+var DefaultTopics = map[string]string{
+	models.EntityRepository: "catalog_repository.json",
+	models.EntityDataitem:   "catalog_dataitem.json",
+}
+
+// Producer sends a message to kafka synchronously. mq.MessageQueue is a
+// Producer.
+type Producer interface {
+	SendSyncMessage(topic string, key, message []byte) (int32, int64, error)
+}
+
+// TopicsFromEnv returns the default topics, overridden by the envs.
+func TopicsFromEnv() map[string]string {
+	topics := make(map[string]string, len(DefaultTopics))
+	for entity, topic := range DefaultTopics {
+		if t := os.Getenv(TopicEnvPrefix + strings.ToUpper(entity)); t != "" {
+			topic = t
+		}
+		topics[entity] = topic
+	}
+	return topics
+}
+
+// Relay publishes the events in the outbox to kafka. The events are put into
+// the outbox in the transactions of their changes, so they are published only
+// after the changes are committed, and at least once.
+type Relay struct {
+	Producer  Producer
+	Topics    map[string]string // by entity
+	BatchSize int
+	Interval  time.Duration // between the polls of the outbox in Loop
+	Lease     time.Duration // of the batches, longer than publishing them
+	Retention time.Duration // of the sent events in the outbox
+}
+
+// publish sends the events in order, and stops at the first failure so that
+// the events of an entity are never reordered. It returns the ids of the sent
+// events, and the failed event with its error if any.
+func (r *Relay) publish(events []*models.OutboxEvent) ([]int64, *models.OutboxEvent, error) {
+	sent := make([]int64, 0, len(events))
+	for _, event := range events {
+		topic := r.Topics[event.Entity]
+		if topic == "" {
+			return sent, event, fmt.Errorf("no topic of entity %s", event.Entity)
+		}
+		if _, _, err := r.Producer.SendSyncMessage(topic, []byte(event.Key), event.Payload); err != nil {
+			return sent, event, err
+		}
+		sent = append(sent, event.EventId)
+	}
+	return sent, nil, nil
+}
+
+// RelayOnce publishes a batch of the unsent events, and returns the number of
+// the sent ones. The batch is leased while being published, so the relays of
+// the other instances don't publish it again, unless the lease expires.
+func (r *Relay) RelayOnce(db *sql.DB) (int, error) {
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	lease := r.Lease
+	if lease <= 0 {
+		lease = DefaultLease
+	}
+
+	events, err := models.ClaimUnsentEvents(db, batchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	sent, failed, publishErr := r.publish(events)
+	if err := models.MarkEventsSent(db, sent); err != nil {
+		// the sent events will be sent again after the lease.
+		return 0, err
+	}
+	if failed == nil {
+		return len(sent), nil
+	}
+
+	if err := models.MarkEventFailed(db, failed.EventId, publishErr.Error()); err != nil {
+		logger.Error("Mark event %d failed err: %v", failed.EventId, err)
+	}
+	unsent := make([]int64, 0, len(events)-len(sent))
+	for _, event := range events[len(sent):] {
+		unsent = append(unsent, event.EventId)
+	}
+	if err := models.ReleaseEvents(db, unsent); err != nil {
+		logger.Error("Release events err: %v", err)
+	}
+	return len(sent), fmt.Errorf("publish event %d err: %v", failed.EventId, publishErr)
+}
+
+// Loop publishes the events every interval, without waiting while the batches
+// are full, and purges the sent events once an hour, until the stop channel is
+// closed.
+func (r *Relay) Loop(db *sql.DB, stop <-chan struct{}) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	retention := r.Retention
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var purgeTime time.Time
+
+	for {
+		for {
+			n, err := r.RelayOnce(db)
+			if err != nil {
+				logger.Error("Relay events err: %v", err)
+			}
+			if err != nil || n < batchSize {
+				break
+			}
+		}
+
+		if time.Since(purgeTime) >= time.Hour {
+			if n, err := models.PurgeSentEvents(db, retention); err != nil {
+				logger.Error("Purge sent events err: %v", err)
+			} else if n > 0 {
+				logger.Info("Purged %d sent events.", n)
+			}
+			purgeTime = time.Now()
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"errors"
+	"github.com/Shopify/sarama"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type message struct {
+	topic, key, value string
+}
+
+// fakeProducer fails at the failAt-th message, counted from 1.
+type fakeProducer struct {
+	messages []message
+	failAt   int
+}
+
+func (p *fakeProducer) SendSyncMessage(topic string, key, value []byte) (int32, int64, error) {
+	if len(p.messages)+1 == p.failAt {
+		return -1, -1, errors.New("kafka unavailable")
+	}
+	p.messages = append(p.messages, message{topic, string(key), string(value)})
+	return 0, int64(len(p.messages) - 1), nil
+}
+
+func testEvents() []*models.OutboxEvent {
+	return []*models.OutboxEvent{
+		{EventId: 1, Entity: models.EntityRepository, Key: "sales", Payload: []byte(`{"seq":1}`)},
+		{EventId: 2, Entity: models.EntityDataitem, Key: "sales/orders", Payload: []byte(`{"seq":2}`)},
+		{EventId: 3, Entity: models.EntityRepository, Key: "sales", Payload: []byte(`{"seq":3}`)},
+	}
+}
+
+func TestPublish(t *testing.T) {
+	producer := &fakeProducer{}
+	relay := &Relay{Producer: producer, Topics: DefaultTopics}
+	sent, failed, err := relay.publish(testEvents())
+	if err != nil || failed != nil {
+		t.Fatalf("unexpected failure of %v: %v", failed, err)
+	}
+	if !reflect.DeepEqual(sent, []int64{1, 2, 3}) {
+		t.Errorf("sent %v", sent)
+	}
+	expected := []message{
+		{"catalog_repository.json", "sales", `{"seq":1}`},
+		{"catalog_dataitem.json", "sales/orders", `{"seq":2}`},
+		{"catalog_repository.json", "sales", `{"seq":3}`},
+	}
+	if !reflect.DeepEqual(producer.messages, expected) {
+		t.Errorf("expect %v, got %v", expected, producer.messages)
+	}
+}
+
+func TestPublishStopsAtFailure(t *testing.T) {
+	producer := &fakeProducer{failAt: 2}
+	relay := &Relay{Producer: producer, Topics: DefaultTopics}
+	sent, failed, err := relay.publish(testEvents())
+	if err == nil || failed == nil || failed.EventId != 2 {
+		t.Fatalf("expect event 2 failed, got %v: %v", failed, err)
+	}
+	if !reflect.DeepEqual(sent, []int64{1}) || len(producer.messages) != 1 {
+		t.Errorf("sent %v, messages %v", sent, producer.messages)
+	}
+
+	relay.Topics = map[string]string{models.EntityDataitem: "items"}
+	if sent, failed, err := relay.publish(testEvents()); err == nil || failed.EventId != 1 || len(sent) != 0 {
+		t.Errorf("expect no topic of event 1, got %v %v: %v", sent, failed, err)
+	}
+}
+
+func TestTopicsFromEnv(t *testing.T) {
+	os.Setenv("CATALOG_EVENTS_TOPIC_DATAITEM", "items")
+	defer os.Unsetenv("CATALOG_EVENTS_TOPIC_DATAITEM")
+
+	expected := map[string]string{
+		models.EntityRepository: "catalog_repository.json",
+		models.EntityDataitem:   "items",
+	}
+	if topics := TopicsFromEnv(); !reflect.DeepEqual(topics, expected) {
+		t.Errorf("expect %v, got %v", expected, topics)
+	}
+}
+
+// syncProducer sends by a sarama SyncProducer, like mq.MessageQueue does.
+type syncProducer struct {
+	sarama.SyncProducer
+}
+
+func (p syncProducer) SendSyncMessage(topic string, key, value []byte) (int32, int64, error) {
+	return p.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.ByteEncoder(key),
+		Value: sarama.ByteEncoder(value),
+	})
+}
+
+func TestPublishToMockBroker(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	metadata := sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID())
+	for _, topic := range DefaultTopics {
+		metadata.SetLeader(topic, 0, broker.BrokerID())
+	}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"ProduceRequest":  sarama.NewMockProduceResponse(t),
+	})
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Retry.Max = 0
+	producer, err := sarama.NewSyncProducer([]string{broker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	relay := &Relay{Producer: syncProducer{producer}, Topics: DefaultTopics}
+	sent, failed, err := relay.publish(testEvents())
+	if err != nil || failed != nil || len(sent) != 3 {
+		t.Fatalf("sent %v, failed %v: %v", sent, failed, err)
+	}
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"ProduceRequest": sarama.NewMockProduceResponse(t).
+			SetError("catalog_dataitem.json", 0, sarama.ErrNotEnoughReplicas),
+	})
+	sent, failed, err = relay.publish(testEvents())
+	if err == nil || failed == nil || failed.EventId != 2 || !reflect.DeepEqual(sent, []int64{1}) {
+		t.Errorf("expect event 2 failed, got %v %v: %v", sent, failed, err)
+	}
+}
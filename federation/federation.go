@@ -0,0 +1,351 @@
+package federation
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/log"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var logger = log.GetLogger()
+
+const (
+	// ReconcilerPrefix and the peer name make the reconciler of the mirrored
+	// repositories of the peer.
+	ReconcilerPrefix = "federation-"
+
+	// OriginTagPrefix and the peer name make the tag of the mirrored
+	// repositories of the peer.
+	OriginTagPrefix = "origin:"
+
+	DefaultPageSize = 100
+)
+
+// Peer is a remote data integration instance.
+type Peer struct {
+	Name string
+	Url  string // the base url, without the trailing slash
+}
+
+// ParsePeer parses a peer in the form of name=url.
+func ParsePeer(s string) (*Peer, error) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return nil, fmt.Errorf("peer %q is not in the form of name=url", s)
+	}
+
+	name, ok := models.ValidateOriginName(s[:i])
+	if !ok || len(ReconcilerPrefix+name) > models.ReconcilerNameMaxLength {
+		return nil, fmt.Errorf("invalid peer name %q", s[:i])
+	}
+	u, err := url.Parse(strings.TrimSpace(s[i+1:]))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url of peer %s", name)
+	}
+	return &Peer{Name: name, Url: strings.TrimRight(u.String(), "/")}, nil
+}
+
+// Reconciler manages the mirrored repositories of the peer.
+func (p *Peer) Reconciler() string {
+	return ReconcilerPrefix + p.Name
+}
+
+// RepoUrl links to the repository in the peer.
+func (p *Peer) RepoUrl(repoName string) string {
+	return p.Url + "/integration/v1/repository/" + url.PathEscape(repoName)
+}
+
+// MirrorName names the mirror of a repository of the peer, which doesn't
+// collide with the mirrors of the other peers or the local repositories.
+func (p *Peer) MirrorName(repoName string) string {
+	return p.Name + models.MirrorSeparator + repoName
+}
+
+// Harvester reads the catalog of a peer over its REST API.
+type Harvester struct {
+	Peer     *Peer
+	Token    string
+	Retries  int           // of each call
+	Backoff  time.Duration // before the first retry
+	PageSize int
+}
+
+type remoteItem struct {
+	*models.Dataitem
+	Attrs []*models.Attribute `json:"attrs"`
+}
+
+type batchGetItemsBody struct {
+	Items []models.ItemKey `json:"items"`
+}
+
+type batchGetItemResult struct {
+	RepoName string      `json:"repoName"`
+	ItemName string      `json:"itemName"`
+	Found    bool        `json:"found"`
+	Error    string      `json:"error,omitempty"`
+	Item     *remoteItem `json:"item,omitempty"`
+}
+
+// get calls the api of the peer, and unmarshals the data of the result.
+func (h *Harvester) get(path string, query url.Values, into interface{}) error {
+	return h.call("GET", path, query, nil, into)
+}
+
+// post calls the api of the peer with the json of body, and unmarshals the
+// data of the result. The apis posted to must be safe to retry.
+func (h *Harvester) post(path string, body interface{}, into interface{}) error {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return h.call("POST", path, nil, jsonBody, into)
+}
+
+func (h *Harvester) call(method, path string, query url.Values, body []byte, into interface{}) error {
+	u := h.Peer.Url + path
+	if len(query) > 0 {
+		u = u + "?" + query.Encode()
+	}
+	contentType := ""
+	if body != nil {
+		contentType = "application/json; charset=utf-8"
+	}
+	response, data, err := common.RemoteCallWithBodyAndRetry(method, u, h.Token, "", body, contentType,
+		h.Retries, h.Backoff)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Code uint            `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || response.StatusCode != http.StatusOK ||
+		result.Code != api.ErrorCodeNone {
+		logger.Error("remote (%s) status code: %d. data=%s", u, response.StatusCode, string(data))
+		return fmt.Errorf("remote (%s) status code: %d, code: %d, msg: %s", u, response.StatusCode,
+			result.Code, result.Msg)
+	}
+	return json.Unmarshal(result.Data, into)
+}
+
+// list gets the pages of a listing api by the cursors, and calls add with
+// the results of each page.
+func (h *Harvester) list(path string, newResults func() interface{}, add func(results interface{})) error {
+	pageSize := h.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	cursor := ""
+	for {
+		query := url.Values{"size": {fmt.Sprint(pageSize)}, "count": {"false"}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		results := newResults()
+		page := &api.QueryPageResult{Results: results}
+		if err := h.get(path, query, page); err != nil {
+			return err
+		}
+		add(results)
+
+		if page.Next == "" {
+			return nil
+		}
+		cursor = page.Next
+	}
+}
+
+// Harvest returns the specs of the mirrors of the repositories of the peer.
+// The repositories mirrored by the peer are not harvested, so that the
+// peers can harvest each other.
+func (h *Harvester) Harvest() ([]*models.RepoSpec, error) {
+	repos := make([]*models.Repository, 0, 32)
+	err := h.list("/integration/v1/repositories",
+		func() interface{} { return &[]*models.Repository{} },
+		func(results interface{}) { repos = append(repos, *results.(*[]*models.Repository)...) })
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]*models.RepoSpec, 0, len(repos))
+	for _, repo := range repos {
+		if repo.Origin != "" {
+			continue
+		}
+		name := h.Peer.MirrorName(repo.RepoName)
+		if len(name) > models.RepoNameMaxLength {
+			logger.Warn("Skip repository %s of %s, the name of the mirror is too long.", repo.RepoName, h.Peer.Name)
+			continue
+		}
+
+		spec := &models.RepoSpec{
+			Name:        name,
+			ChName:      repo.ChRepoName,
+			Description: repo.Description,
+			ImageUrl:    repo.ImageUrl,
+			Tags:        append(repo.Tags, OriginTagPrefix+h.Peer.Name),
+			Items:       []*models.ItemSpec{},
+			Origin:      h.Peer.Name,
+			OriginUrl:   h.Peer.RepoUrl(repo.RepoName),
+		}
+		if spec.Items, err = h.harvestItems(repo.RepoName); err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+
+	if err := models.ValidateCatalogManifest(&models.CatalogManifest{Repositories: specs}); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+func (h *Harvester) harvestItems(repoName string) ([]*models.ItemSpec, error) {
+	items := make([]*models.Dataitem, 0, 32)
+	err := h.list("/integration/v1/repository/"+url.PathEscape(repoName)+"/items",
+		func() interface{} { return &[]*models.Dataitem{} },
+		func(results interface{}) { items = append(items, *results.(*[]*models.Dataitem)...) })
+	if err != nil {
+		return nil, err
+	}
+
+	// the details are fetched by the batch get api of the peer.
+	details := make(map[models.ItemKey]*remoteItem, len(items))
+	for start := 0; start < len(items); start += models.BatchGetMaxItems {
+		end := start + models.BatchGetMaxItems
+		if end > len(items) {
+			end = len(items)
+		}
+		body := &batchGetItemsBody{Items: make([]models.ItemKey, 0, end-start)}
+		for _, item := range items[start:end] {
+			body.Items = append(body.Items, models.ItemKey{RepoName: repoName, ItemName: item.ItemName})
+		}
+		var data struct {
+			Results []*batchGetItemResult `json:"results"`
+		}
+		if err := h.post("/integration/v1/dataitems:batchGet", body, &data); err != nil {
+			return nil, err
+		}
+		for _, result := range data.Results {
+			if result.Found && result.Item != nil && result.Item.Dataitem != nil {
+				details[models.ItemKey{RepoName: result.RepoName, ItemName: result.ItemName}] = result.Item
+			}
+		}
+	}
+
+	specs := make([]*models.ItemSpec, 0, len(items))
+	for _, item := range items {
+		detail := details[models.ItemKey{RepoName: repoName, ItemName: item.ItemName}]
+		if detail == nil {
+			return nil, fmt.Errorf("dataitem %s/%s of %s not found", repoName, item.ItemName, h.Peer.Name)
+		}
+
+		// the ids are of the peer.
+		for _, attr := range detail.Attrs {
+			attr.AttrId, attr.ItemId = 0, 0
+		}
+		specs = append(specs, &models.ItemSpec{
+			Name:       detail.ItemName,
+			Url:        detail.Url,
+			Simple:     detail.Simple,
+			CompatMode: detail.CompatMode,
+			Tags:       detail.Tags,
+			Attrs:      detail.Attrs,
+		})
+	}
+	return specs, nil
+}
+
+// Federator mirrors the catalogs of the peers, each by its own reconciler, so
+// that the mirrors are read-only, and the mirrors of the repositories gone
+// from a peer are deleted.
+type Federator struct {
+	Peers    []*Peer
+	Token    string
+	Owner    string // of the mirrors
+	Retries  int
+	Backoff  time.Duration
+	Interval time.Duration // between the harvests in Loop
+	DryRun   bool
+}
+
+// Run mirrors the catalog of the peer once and records the run, failed or
+// not.
+func (f *Federator) Run(db *sql.DB, peer *Peer) (*models.ReconcileRun, error) {
+	startTime := time.Now()
+	run := &models.ReconcileRun{
+		Reconciler: peer.Reconciler(),
+		Dir:        peer.Url,
+		DryRun:     f.DryRun,
+		Status:     models.ReconcileStatusOk,
+		StartTime:  &startTime,
+	}
+
+	harvester := &Harvester{Peer: peer, Token: f.Token, Retries: f.Retries, Backoff: f.Backoff}
+	specs, err := harvester.Harvest()
+	if err == nil {
+		run.Report, err = models.ReconcileCatalog(db, specs, &models.ReconcileOptions{
+			Reconciler: peer.Reconciler(),
+			Owner:      f.Owner,
+			Prune:      true,
+			DryRun:     f.DryRun,
+			Exclusive:  true,
+		})
+	}
+	if err != nil {
+		run.Status = models.ReconcileStatusFailed
+		run.Error = err.Error()
+	}
+	endTime := time.Now()
+	run.EndTime = &endTime
+
+	if err := models.RecordReconcileRun(db, run); err != nil {
+		logger.Error("Record federation run of %s err: %v", peer.Name, err)
+	}
+	return run, err
+}
+
+// RunAll mirrors the peers one by one. A failed peer doesn't stop the others.
+func (f *Federator) RunAll(db *sql.DB) []*models.ReconcileRun {
+	runs := make([]*models.ReconcileRun, 0, len(f.Peers))
+	for _, peer := range f.Peers {
+		run, err := f.Run(db, peer)
+		if err != nil {
+			logger.Error("Federate %s err: %v", peer.Name, err)
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// Loop mirrors the peers at first and then every interval, until the stop
+// channel is closed. The runs are sent to the runs channel if it's not nil.
+func (f *Federator) Loop(db *sql.DB, stop <-chan struct{}, runs chan<- *models.ReconcileRun) {
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, run := range f.RunAll(db) {
+			if runs != nil {
+				runs <- run
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package federation
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParsePeer(t *testing.T) {
+	peer, err := ParsePeer("east=https://east.example.com/ ")
+	if err != nil || peer.Name != "east" || peer.Url != "https://east.example.com" {
+		t.Errorf("expect east, got %v %v", peer, err)
+	}
+	if peer.Reconciler() != "federation-east" || peer.MirrorName("sales") != "east.sales" {
+		t.Errorf("reconciler %s, mirror %s", peer.Reconciler(), peer.MirrorName("sales"))
+	}
+	if link := peer.RepoUrl("a b"); link != "https://east.example.com/integration/v1/repository/a%20b" {
+		t.Errorf("repo url %s", link)
+	}
+
+	for _, s := range []string{"east", "=https://east.example.com", "local=https://east.example.com",
+		"east.1=https://east.example.com", "east=ftp://east.example.com", "east=/integration"} {
+		if _, err := ParsePeer(s); err == nil {
+			t.Errorf("%s: expect an error", s)
+		}
+	}
+}
+
+// fakePeer serves the repositories by pages of one, and fails the first
+// batch get of the dataitems. The repository events has one more item than
+// a batch get takes.
+func fakePeer(t *testing.T, batches *int) *httptest.Server {
+	failed := false
+	write := func(w http.ResponseWriter, data interface{}) {
+		json.NewEncoder(w).Encode(&api.Result{Code: api.ErrorCodeNone, Msg: "OK", Data: data})
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(&api.Result{Code: api.ErrorCodeAuthFailed, Msg: "auth failed"})
+			return
+		}
+
+		switch r.URL.Path {
+		case "/integration/v1/repositories":
+			switch r.FormValue("cursor") {
+			case "":
+				write(w, api.NewQueryPageResult(nil, "2", "", []*models.Repository{
+					{RepoName: "sales", ChRepoName: "销售", Description: "the sales", Tags: []string{"finance"}},
+				}))
+			case "2":
+				write(w, api.NewQueryPageResult(nil, "3", "1", []*models.Repository{
+					{RepoName: "west.hr", Origin: "west", OriginUrl: "https://west.example.com/integration/v1/repository/hr"},
+				}))
+			case "3":
+				write(w, api.NewQueryPageResult(nil, "", "2", []*models.Repository{{RepoName: "events"}}))
+			default:
+				t.Errorf("unexpected cursor %s", r.FormValue("cursor"))
+			}
+		case "/integration/v1/repository/sales/items":
+			write(w, api.NewQueryPageResult(nil, "", "", []*models.Dataitem{
+				{ItemName: "orders", RepoName: "sales"},
+			}))
+		case "/integration/v1/repository/events/items":
+			items := make([]*models.Dataitem, models.BatchGetMaxItems+1)
+			for i := range items {
+				items[i] = &models.Dataitem{ItemName: fmt.Sprintf("e%d", i), RepoName: "events"}
+			}
+			write(w, api.NewQueryPageResult(nil, "", "", items))
+		case "/integration/v1/dataitems:batchGet":
+			if r.Method != "POST" {
+				t.Errorf("unexpected method %s", r.Method)
+			}
+			if !failed {
+				failed = true
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			*batches++
+
+			body := &batchGetItemsBody{}
+			if err := json.NewDecoder(r.Body).Decode(body); err != nil || len(body.Items) > models.BatchGetMaxItems {
+				t.Errorf("unexpected batch get %v, %d items", err, len(body.Items))
+			}
+			results := make([]*batchGetItemResult, 0, len(body.Items))
+			for _, key := range body.Items {
+				result := &batchGetItemResult{RepoName: key.RepoName, ItemName: key.ItemName, Found: true}
+				if key.ItemName == "orders" {
+					result.Item = &remoteItem{
+						Dataitem: &models.Dataitem{ItemId: 7, ItemName: "orders", RepoName: "sales", Url: "hdfs://orders",
+							CompatMode: "backward", Tags: []string{"daily"}},
+						Attrs: []*models.Attribute{{AttrId: 3, ItemId: 7, AttrName: "id", DataType: models.DataTypeInt}},
+					}
+				} else {
+					result.Item = &remoteItem{Dataitem: &models.Dataitem{ItemName: key.ItemName, RepoName: key.RepoName}}
+				}
+				results = append(results, result)
+			}
+			write(w, map[string]interface{}{"results": results})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestHarvest(t *testing.T) {
+	batches := 0
+	server := fakePeer(t, &batches)
+	defer server.Close()
+
+	peer := &Peer{Name: "east", Url: server.URL}
+	harvester := &Harvester{Peer: peer, Token: "Bearer abc", Retries: 1}
+	specs, err := harvester.Harvest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the mirror of west is not harvested.
+	if len(specs) != 2 {
+		t.Fatalf("expect 2 specs, got %d", len(specs))
+	}
+	spec := specs[0]
+	if spec.Name != "east.sales" || spec.ChName != "销售" || spec.Origin != "east" ||
+		spec.OriginUrl != server.URL+"/integration/v1/repository/sales" {
+		t.Errorf("unexpected spec %+v", spec)
+	}
+	if !reflect.DeepEqual(spec.Tags, []string{"finance", "origin:east"}) {
+		t.Errorf("unexpected tags %v", spec.Tags)
+	}
+	if len(spec.Items) != 1 {
+		t.Fatalf("expect 1 item, got %d", len(spec.Items))
+	}
+	item := spec.Items[0]
+	if item.Name != "orders" || item.Url != "hdfs://orders" || item.CompatMode != "backward" ||
+		!reflect.DeepEqual(item.Tags, []string{"daily"}) {
+		t.Errorf("unexpected item %+v", item)
+	}
+	if len(item.Attrs) != 1 || item.Attrs[0].AttrId != 0 || item.Attrs[0].ItemId != 0 || item.Attrs[0].AttrName != "id" {
+		t.Errorf("unexpected attrs %+v", item.Attrs)
+	}
+
+	// one batch get for sales, and two for events.
+	if len(specs[1].Items) != models.BatchGetMaxItems+1 || batches != 3 {
+		t.Errorf("expect %d items by 3 batch gets, got %d by %d", models.BatchGetMaxItems+1, len(specs[1].Items), batches)
+	}
+
+	harvester.Token = ""
+	if _, err := harvester.Harvest(); err == nil {
+		t.Errorf("expect an error without the token")
+	}
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+)
+
+type attrsBody struct {
+	Attrs []*models.Attribute `json:"attrs"`
+}
+
+type compatModeBody struct {
+	Mode string `json:"mode"`
+}
+
+// getEditableRepo authenticates the request and gets the repository in the
+// path, which must be editable by the user. The error response has been
+// written if false is returned.
+func getEditableRepo(w http.ResponseWriter, r *http.Request, params httprouter.Params) (string, *models.Repository, bool) {
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return "", nil, false
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return "", nil, false
+	}
+
+	repo, err := models.QueryRepo(db, params.ByName("reponame"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+		return "", nil, false
+	}
+	if !checkEditableRepo(w, username, repo) {
+		return "", nil, false
+	}
+
+	return username, repo, true
+}
+
+// getEditableItem is getEditableRepo for the dataitem in the path.
+func getEditableItem(w http.ResponseWriter, r *http.Request, params httprouter.Params) (string, *models.Dataitem, bool) {
+	username, repo, ok := getEditableRepo(w, r, params)
+	if !ok {
+		return "", nil, false
+	}
+
+	item, err := models.QueryItem(models.GetDB(), repo.RepoName, params.ByName("itemname"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return "", nil, false
+	}
+
+	return username, item, true
+}
+
+func parseAttrsBody(w http.ResponseWriter, r *http.Request) ([]*models.Attribute, bool) {
+	body := &attrsBody{}
+	if err := common.ParseRequestJsonInto(r, body); err != nil {
+		logger.Error("Parse body err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeParseJsonFailed, err.Error()), nil)
+		return nil, false
+	}
+
+	if err := models.ValidateAttrs(body.Attrs); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidAttributes, err.Error()), nil)
+		return nil, false
+	}
+
+	return body.Attrs, true
+}
+
+func incompatibleSchemaResult(w http.ResponseWriter, mode string, violations []*models.CompatViolation) {
+	reasons := make([]string, len(violations))
+	for i, v := range violations {
+		reasons[i] = v.String()
+	}
+	api.JsonResult(w, http.StatusBadRequest,
+		api.GetError2(api.ErrorCodeIncompatibleSchema, mode+": "+strings.Join(reasons, "; ")),
+		struct {
+			Mode       string                    `json:"mode"`
+			Violations []*models.CompatViolation `json:"violations"`
+		}{mode, violations})
+}
+
+// UpdateAttrsHandler replaces the attribute set of a dataitem.
+func UpdateAttrsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: PUT %v.", r.URL)
+
+	logger.Info("Begin update Attrs handler.")
+	defer logger.Info("End update Attrs handler.")
+
+	username, item, ok := getEditableItem(w, r, params)
+	if !ok {
+		return
+	}
+
+	attrs, ok := parseAttrsBody(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := models.UpdateAttrs(models.GetDB(), item.ItemId, username, attrs)
+	if e, ok := err.(*models.IncompatibleSchemaError); ok {
+		incompatibleSchemaResult(w, e.Mode, e.Violations)
+		return
+	} else if err != nil {
+		logger.Error("Update attributes err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeUpdateAttributes, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}{version})
+}
+
+// CheckAttrsHandler is the dry run of UpdateAttrsHandler. The compatibility
+// mode of the dataitem can be overridden by the mode query param.
+func CheckAttrsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin check Attrs handler.")
+	defer logger.Info("End check Attrs handler.")
+
+	_, item, ok := getEditableItem(w, r, params)
+	if !ok {
+		return
+	}
+
+	mode := item.CompatMode
+	if s := r.FormValue("mode"); s != "" {
+		if mode, ok = models.ValidateCompatMode(s); !ok {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "mode"), nil)
+			return
+		}
+	}
+
+	attrs, ok := parseAttrsBody(w, r)
+	if !ok {
+		return
+	}
+
+	diff, violations, err := models.CheckItemCompatibility(models.GetDB(), item.ItemId, mode, attrs)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryAttribute, err.Error()), nil)
+		return
+	}
+	diff.From, diff.To = item.SchemaVersion, item.SchemaVersion+1
+
+	api.JsonResult(w, http.StatusOK, nil, struct {
+		Mode       string                    `json:"mode"`
+		Compatible bool                      `json:"compatible"`
+		Violations []*models.CompatViolation `json:"violations"`
+		Diff       *models.SchemaDiff        `json:"diff"`
+	}{mode, len(violations) == 0, violations, diff})
+}
+
+func UpdateCompatModeHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: PUT %v.", r.URL)
+
+	logger.Info("Begin update CompatMode handler.")
+	defer logger.Info("End update CompatMode handler.")
+
+	_, item, ok := getEditableItem(w, r, params)
+	if !ok {
+		return
+	}
+
+	body := &compatModeBody{}
+	if err := common.ParseRequestJsonInto(r, body); err != nil {
+		logger.Error("Parse body err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeParseJsonFailed, err.Error()), nil)
+		return
+	}
+
+	mode, ok := models.ValidateCompatMode(body.Mode)
+	if !ok {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "mode"), nil)
+		return
+	}
+
+	if err := models.UpdateCompatMode(models.GetDB(), item.ItemId, mode); err != nil {
+		logger.Error("Update compatibility mode err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeUpdateCompatMode, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, nil)
+}
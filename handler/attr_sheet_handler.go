@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/asiainfoLDP/datafoundry_data_integration/schema"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+)
+
+// the modes of ImportAttrsHandler.
+const (
+	ImportModeAtomic  = "atomic"
+	ImportModePartial = "partial"
+)
+
+var sheetExtensions = map[string]string{
+	".csv":  schema.SheetCsv,
+	".xlsx": schema.SheetXlsx,
+}
+
+type importedItem struct {
+	ItemName      string `json:"itemName"`
+	Attrs         int    `json:"attrs"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+type importResult struct {
+	Mode     string             `json:"mode"`
+	Imported []*importedItem    `json:"imported"`
+	Errors   []*schema.RowError `json:"errors"`
+}
+
+// ImportAttrsHandler creates or replaces the attributes of the dataitems of a
+// repository from an uploaded xlsx or csv sheet, with a row per attribute. The
+// mapping param is a json object from the sheet headers to the columns, see
+// schema.SheetColumns. The item param names the dataitem of the rows without
+// one. In the atomic mode (the default) nothing is imported if any row fails,
+// in the partial mode the dataitems without failed rows are imported.
+func ImportAttrsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin import Attrs handler.")
+	defer logger.Info("End import Attrs handler.")
+
+	username, repo, ok := getEditableRepo(w, r, params)
+	if !ok {
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = ImportModeAtomic
+	}
+	if mode != ImportModeAtomic && mode != ImportModePartial {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "mode"), nil)
+		return
+	}
+
+	data, extension, err := readUpload(w, r)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeImportAttributes, err.Error()), nil)
+		return
+	}
+
+	mapping := map[string]string{}
+	if s := r.FormValue("mapping"); s != "" {
+		if err := json.Unmarshal([]byte(s), &mapping); err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "mapping"), nil)
+			return
+		}
+		if err := schema.ValidateColumnMapping(mapping); err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, err.Error()), nil)
+			return
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = sheetExtensions[extension]
+	}
+	rows, err := schema.ReadSheet(data, format)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeImportAttributes, err.Error()), nil)
+		return
+	}
+	sheetItems, rowErrors, err := schema.ParseAttrSheet(rows, mapping, r.FormValue("item"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeImportAttributes, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	items, err := models.QueryItemList(db, repo.RepoName)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return
+	}
+	itemIds := make(map[string]int, len(items))
+	for _, item := range items {
+		itemIds[item.ItemName] = item.ItemId
+	}
+
+	result := &importResult{Mode: mode, Imported: []*importedItem{}, Errors: rowErrors}
+	updates := make([]*models.ItemAttrs, 0, len(sheetItems))
+	known := make([]*schema.SheetItem, 0, len(sheetItems))
+	for _, item := range sheetItems {
+		itemId, ok := itemIds[item.ItemName]
+		if !ok {
+			for _, row := range item.Rows {
+				result.Errors = append(result.Errors, &schema.RowError{Row: row, Item: item.ItemName,
+					Field: schema.ColumnItem, Message: "dataitem not found"})
+			}
+			continue
+		}
+		updates = append(updates, &models.ItemAttrs{ItemId: itemId, Attrs: item.Attrs})
+		known = append(known, item)
+	}
+
+	if mode == ImportModeAtomic {
+		if len(result.Errors) > 0 {
+			importFailedResult(w, result)
+			return
+		}
+
+		versions, failed, err := models.UpdateItemsAttrs(db, username, updates)
+		if err != nil {
+			logger.Error("Import attributes err: %v", err)
+			if failed < 0 {
+				api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeImportAttributes, err.Error()), nil)
+				return
+			}
+			result.Errors = append(result.Errors, &schema.RowError{Row: known[failed].Rows[0],
+				Item: known[failed].ItemName, Message: err.Error()})
+			importFailedResult(w, result)
+			return
+		}
+		for i, item := range known {
+			result.Imported = append(result.Imported, &importedItem{item.ItemName, len(item.Attrs), versions[i]})
+		}
+		api.JsonResult(w, http.StatusOK, nil, result)
+		return
+	}
+
+	for i, item := range known {
+		version, err := models.UpdateAttrs(db, updates[i].ItemId, username, item.Attrs)
+		if err != nil {
+			logger.Error("Import attributes of %s err: %v", item.ItemName, err)
+			result.Errors = append(result.Errors, &schema.RowError{Row: item.Rows[0], Item: item.ItemName,
+				Message: err.Error()})
+			continue
+		}
+		result.Imported = append(result.Imported, &importedItem{item.ItemName, len(item.Attrs), version})
+	}
+	api.JsonResult(w, http.StatusOK, nil, result)
+}
+
+func importFailedResult(w http.ResponseWriter, result *importResult) {
+	api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeImportAttributes,
+		fmt.Sprintf("%d rows failed, nothing is imported", len(result.Errors))), result)
+}
+
+// ExportAttrsHandler downloads the attributes of the dataitems of a
+// repository as a xlsx (by default) or csv sheet, which ImportAttrsHandler
+// reads back. The items param limits the dataitems, separated by commas.
+func ExportAttrsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin export Attrs handler.")
+	defer logger.Info("End export Attrs handler.")
+
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = schema.SheetXlsx
+	}
+	if format != schema.SheetXlsx && format != schema.SheetCsv {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "format"), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	repoName := params.ByName("reponame")
+	if _, err := models.QueryRepo(db, repoName); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+		return
+	}
+	items, err := models.QueryItemList(db, repoName)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return
+	}
+
+	var selected map[string]bool
+	if s := r.FormValue("items"); s != "" {
+		selected = make(map[string]bool)
+		for _, name := range strings.Split(s, ",") {
+			selected[strings.TrimSpace(name)] = true
+		}
+	}
+
+	sheetItems := make([]*schema.SheetItem, 0, len(items))
+	for _, item := range items {
+		if selected != nil && !selected[item.ItemName] {
+			continue
+		}
+		attrs, err := models.QueryAttrList(db, item.ItemId)
+		if err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryAttribute, err.Error()), nil)
+			return
+		}
+		sheetItems = append(sheetItems, &schema.SheetItem{ItemName: item.ItemName, Attrs: attrs})
+	}
+
+	var buf bytes.Buffer
+	contentType, err := schema.WriteAttrSheet(&buf, format, sheetItems)
+	if err != nil {
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError2(api.ErrorCodeUnkown, err.Error()), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-attrs.%s"`, repoName, format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
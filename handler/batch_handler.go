@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type batchGetItemsBody struct {
+	Items []models.ItemKey `json:"items"`
+}
+
+type batchGetItemResult struct {
+	RepoName string                 `json:"repoName"`
+	ItemName string                 `json:"itemName"`
+	Found    bool                   `json:"found"`
+	Error    string                 `json:"error,omitempty"`
+	Item     *models.DataitemDetail `json:"item,omitempty"`
+}
+
+// the dependencies of BatchGetItemsHandler, replaced in the tests.
+var (
+	batchGetUser     = getDFUserame
+	batchGetDB       = models.GetDB
+	queryItemDetails = models.QueryItemDetails
+)
+
+// DataItemsActionHandler serves the custom methods of the dataitems collection,
+// such as POST /integration/v1/dataitems:batchGet.
+func DataItemsActionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	switch params.ByName("action") {
+	case ":batchGet":
+		BatchGetItemsHandler(w, r, params)
+	default:
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeUrlNotSupported), nil)
+	}
+}
+
+func BatchGetItemsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin batch get DataItems handler.")
+	defer logger.Info("End batch get DataItems handler.")
+
+	if _, err := batchGetUser(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := batchGetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	body := &batchGetItemsBody{}
+	if err := common.ParseRequestJsonInto(r, body); err != nil {
+		logger.Error("Parse body err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeParseJsonFailed, err.Error()), nil)
+		return
+	}
+	if len(body.Items) == 0 || len(body.Items) > models.BatchGetMaxItems {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters,
+			fmt.Sprintf("the number of items must be in [1, %d]", models.BatchGetMaxItems)), nil)
+		return
+	}
+
+	results, err := batchGetItems(db, body.Items)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, struct {
+		Results []*batchGetItemResult `json:"results"`
+	}{results})
+}
+
+// batchGetItems queries the distinct keys at once, and returns a result for
+// each of the keys in order, the duplicated ones included. The inactive
+// dataitems and repositories are reported as not found.
+func batchGetItems(db *sql.DB, keys []models.ItemKey) ([]*batchGetItemResult, error) {
+	distinct := make([]models.ItemKey, 0, len(keys))
+	seen := make(map[models.ItemKey]bool, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, key)
+		}
+	}
+
+	details, err := queryItemDetails(db, distinct)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*batchGetItemResult, len(keys))
+	for i, key := range keys {
+		result := &batchGetItemResult{RepoName: key.RepoName, ItemName: key.ItemName}
+		if detail, ok := details[key]; ok {
+			result.Found = true
+			result.Item = detail
+		} else {
+			result.Error = "dataitem not found"
+		}
+		results[i] = result
+	}
+	return results, nil
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeBatchGet replaces the dependencies of BatchGetItemsHandler. The
+// dataitems in details are the active ones the user may see, and the keys
+// of the queries are recorded.
+type fakeBatchGet struct {
+	details map[models.ItemKey]*models.DataitemDetail
+	queried [][]models.ItemKey
+}
+
+func (f *fakeBatchGet) install() func() {
+	user, db, query := batchGetUser, batchGetDB, queryItemDetails
+	batchGetUser = func(token string) (string, error) {
+		if token != "Bearer valid" {
+			return "", errors.New("invalid token")
+		}
+		return "alice", nil
+	}
+	batchGetDB = func() *sql.DB { return &sql.DB{} }
+	queryItemDetails = func(db *sql.DB, keys []models.ItemKey) (map[models.ItemKey]*models.DataitemDetail, error) {
+		f.queried = append(f.queried, keys)
+		details := map[models.ItemKey]*models.DataitemDetail{}
+		for _, key := range keys {
+			if detail, ok := f.details[key]; ok {
+				details[key] = detail
+			}
+		}
+		return details, nil
+	}
+	return func() { batchGetUser, batchGetDB, queryItemDetails = user, db, query }
+}
+
+func newFakeBatchGet(names ...string) *fakeBatchGet {
+	f := &fakeBatchGet{details: map[models.ItemKey]*models.DataitemDetail{}}
+	for _, name := range names {
+		parts := strings.SplitN(name, "/", 2)
+		f.details[models.ItemKey{RepoName: parts[0], ItemName: parts[1]}] = &models.DataitemDetail{
+			Dataitem: &models.Dataitem{RepoName: parts[0], ItemName: parts[1]},
+			Attrs:    []*models.Attribute{},
+		}
+	}
+	return f
+}
+
+func batchGet(token string, keys ...string) *httptest.ResponseRecorder {
+	items := make([]string, len(keys))
+	for i, key := range keys {
+		parts := strings.SplitN(key, "/", 2)
+		items[i] = fmt.Sprintf(`{"repoName":%q,"itemName":%q}`, parts[0], parts[1])
+	}
+	r := httptest.NewRequest("POST", "/integration/v1/dataitems:batchGet",
+		strings.NewReader(`{"items":[`+strings.Join(items, ",")+`]}`))
+	r.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	BatchGetItemsHandler(w, r, nil)
+	return w
+}
+
+func batchGetFound(t *testing.T, w *httptest.ResponseRecorder) []bool {
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+	}
+	result := struct {
+		Data struct {
+			Results []*batchGetItemResult `json:"results"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	found := []bool{}
+	for _, r := range result.Data.Results {
+		if r.Found != (r.Item != nil) || r.Found == (r.Error != "") {
+			t.Errorf("inconsistent result %+v", r)
+		}
+		found = append(found, r.Found)
+	}
+	return found
+}
+
+func TestBatchGetFoundAndMissing(t *testing.T) {
+	f := newFakeBatchGet("sales/orders", "sales/refunds")
+	defer f.install()()
+
+	found := batchGetFound(t, batchGet("Bearer valid", "sales/orders", "sales/missing", "hr/people", "sales/refunds"))
+	if !reflect.DeepEqual(found, []bool{true, false, false, true}) {
+		t.Errorf("unexpected found %v", found)
+	}
+	if len(f.queried) != 1 || len(f.queried[0]) != 4 {
+		t.Errorf("expect one query of 4 keys, got %v", f.queried)
+	}
+}
+
+func TestBatchGetDuplicates(t *testing.T) {
+	f := newFakeBatchGet("sales/orders")
+	defer f.install()()
+
+	found := batchGetFound(t, batchGet("Bearer valid", "sales/orders", "sales/x", "sales/orders", "sales/x"))
+	if !reflect.DeepEqual(found, []bool{true, false, true, false}) {
+		t.Errorf("unexpected found %v", found)
+	}
+	expected := []models.ItemKey{{RepoName: "sales", ItemName: "orders"}, {RepoName: "sales", ItemName: "x"}}
+	if len(f.queried) != 1 || !reflect.DeepEqual(f.queried[0], expected) {
+		t.Errorf("expect the distinct keys queried, got %v", f.queried)
+	}
+}
+
+func TestBatchGetSizeLimit(t *testing.T) {
+	f := newFakeBatchGet()
+	defer f.install()()
+
+	if w := batchGet("Bearer valid"); w.Code != http.StatusBadRequest {
+		t.Errorf("expect no items rejected, got %d", w.Code)
+	}
+
+	keys := make([]string, models.BatchGetMaxItems+1)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("sales/item%d", i)
+	}
+	if w := batchGet("Bearer valid", keys...); w.Code != http.StatusBadRequest {
+		t.Errorf("expect %d items rejected, got %d", len(keys), w.Code)
+	}
+	if found := batchGetFound(t, batchGet("Bearer valid", keys[1:]...)); len(found) != models.BatchGetMaxItems {
+		t.Errorf("expect %d results, got %d", models.BatchGetMaxItems, len(found))
+	}
+	if len(f.queried) != 1 {
+		t.Errorf("expect only the accepted request queried, got %d queries", len(f.queried))
+	}
+}
+
+func TestBatchGetPermission(t *testing.T) {
+	f := newFakeBatchGet("sales/orders")
+	defer f.install()()
+
+	if w := batchGet("Bearer stolen", "sales/orders"); w.Code != http.StatusBadRequest {
+		t.Errorf("expect the invalid token rejected, got %d", w.Code)
+	}
+	if len(f.queried) != 0 {
+		t.Errorf("expect no query of a rejected request")
+	}
+
+	// the dataitems filtered out by the query, e.g. of inactive repositories,
+	// are reported as missing rather than failing the request.
+	delete(f.details, models.ItemKey{RepoName: "sales", ItemName: "orders"})
+	found := batchGetFound(t, batchGet("Bearer valid", "sales/orders"))
+	if !reflect.DeepEqual(found, []bool{false}) {
+		t.Errorf("unexpected found %v", found)
+	}
+}
+
+func TestBatchGetAmbiguousNames(t *testing.T) {
+	f := newFakeBatchGet()
+	f.details[models.ItemKey{RepoName: "a/b", ItemName: "c"}] = &models.DataitemDetail{
+		Dataitem: &models.Dataitem{RepoName: "a/b", ItemName: "c"},
+	}
+	defer f.install()()
+
+	results, err := batchGetItems(nil, []models.ItemKey{{RepoName: "a", ItemName: "b/c"}, {RepoName: "a/b", ItemName: "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Found || !results[1].Found {
+		t.Errorf("expect only a/b c found, got %v %v", results[0].Found, results[1].Found)
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+const MaxManifestSize = 10 << 20
+
+// ImportCatalogHandler upserts the repositories, dataitems and attributes of
+// a json or yaml manifest in the body, see models.CatalogManifest. With
+// dryRun=true the changes are reported but not committed.
+func ImportCatalogHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin import Catalog handler.")
+	defer logger.Info("End import Catalog handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	dryRun := false
+	if s := r.URL.Query().Get("dryRun"); s != "" {
+		if dryRun, err = strconv.ParseBool(s); err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "dryRun"), nil)
+			return
+		}
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	defer r.Body.Close()
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxManifestSize))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeImportCatalog, err.Error()), nil)
+		return
+	}
+	manifest, err := models.ParseCatalogManifest(data)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeImportCatalog, err.Error()), nil)
+		return
+	}
+
+	report, err := models.ImportCatalog(db, manifest, username, func(repo *models.Repository) bool {
+		return canEditRepo(username, repo)
+	}, dryRun)
+	if e, ok := err.(*models.RepoNotEditableError); ok && e.ManagedBy != "" {
+		api.JsonResult(w, http.StatusForbidden, api.GetError2(api.ErrorCodeRepoManaged, e.Error()), nil)
+		return
+	} else if ok {
+		api.JsonResult(w, http.StatusForbidden, api.GetError2(api.ErrorCodePermissionDenied, e.Error()), nil)
+		return
+	} else if err != nil {
+		logger.Error("Import catalog err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeImportCatalog, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, report)
+}
+
+// ExportArchiveHandler downloads the whole catalog as a json archive, which
+// the restore command loads, see models.Archive. Only the admins can export.
+func ExportArchiveHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin export Archive handler.")
+	defer logger.Info("End export Archive handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+	if !isAdmin(username) {
+		api.JsonResult(w, http.StatusForbidden, api.GetError(api.ErrorCodePermissionDenied), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	archive, err := models.ExportArchive(db)
+	if err != nil {
+		logger.Error("Export archive err: %v", err)
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError2(api.ErrorCodeExportArchive, err.Error()), nil)
+		return
+	}
+	data, err := json.Marshal(archive)
+	if err != nil {
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError2(api.ErrorCodeExportArchive, err.Error()), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="catalog-%s.json"`,
+		archive.ExportedAt.Format("20060102-150405")))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+const (
+	ChangesDefaultLimit = 100
+	ChangesMaxLimit     = 1000
+)
+
+// ChangeFeed is a page of the change log. Next is the since param of the
+// next page, which is since itself if there are no more changes yet.
+type ChangeFeed struct {
+	Changes []*models.Change `json:"changes"`
+	Next    int64            `json:"next"`
+}
+
+// QueryChangesHandler lists the changes of the repositories, dataitems and
+// attributes after the since sequence number, so that the consumers sync
+// incrementally by passing the next of each page as the since of the next
+// request.
+func QueryChangesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get Changes handler.")
+	defer logger.Info("End get Changes handler.")
+
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	since := int64(0)
+	if s := r.FormValue("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseInt(s, 10, 64); err != nil || since < 0 {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "since"), nil)
+			return
+		}
+	}
+	limit := ChangesDefaultLimit
+	if s := r.FormValue("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > ChangesMaxLimit {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "limit"), nil)
+			return
+		}
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	changes, err := models.QueryChanges(db, since, limit)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryChanges, err.Error()), nil)
+		return
+	}
+
+	feed := &ChangeFeed{Changes: changes, Next: since}
+	if len(changes) > 0 {
+		feed.Next = changes[len(changes)-1].Seq
+	}
+	api.JsonResult(w, http.StatusOK, nil, feed)
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+func QueryClassTreeHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get ClassTree handler.")
+	defer logger.Info("End get ClassTree handler.")
+
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	classes, err := models.QueryClassList(db)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryClasses, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, models.BuildClassTree(classes))
+}
+
+func QueryClassHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get Class handler.")
+	defer logger.Info("End get Class handler.")
+
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	classId, err := strconv.Atoi(params.ByName("classid"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "classid"), nil)
+		return
+	}
+
+	class, err := models.QueryClass(db, classId)
+	if err == models.ErrClassNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeClassNotFound), nil)
+		return
+	} else if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryClasses, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, class)
+}
+
+func CreateClassHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin create Class handler.")
+	defer logger.Info("End create Class handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+	if !isAdmin(username) {
+		api.JsonResult(w, http.StatusForbidden, api.GetError(api.ErrorCodePermissionDenied), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	class := &models.Class{}
+	if err := common.ParseRequestJsonInto(r, class); err != nil {
+		logger.Error("Parse body err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeParseJsonFailed, err.Error()), nil)
+		return
+	}
+
+	classId, err := models.CreateClass(db, class)
+	if err != nil {
+		logger.Error("Create class err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeCreateClass, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, struct {
+		ClassId int `json:"classId"`
+	}{classId})
+}
+
+func UpdateClassHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: PUT %v.", r.URL)
+
+	logger.Info("Begin update Class handler.")
+	defer logger.Info("End update Class handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+	if !isAdmin(username) {
+		api.JsonResult(w, http.StatusForbidden, api.GetError(api.ErrorCodePermissionDenied), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	classId, err := strconv.Atoi(params.ByName("classid"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "classid"), nil)
+		return
+	}
+
+	class := &models.Class{}
+	if err := common.ParseRequestJsonInto(r, class); err != nil {
+		logger.Error("Parse body err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeParseJsonFailed, err.Error()), nil)
+		return
+	}
+	class.ClassId = classId
+
+	err = models.UpdateClass(db, class)
+	if err == models.ErrClassNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeClassNotFound), nil)
+		return
+	} else if err != nil {
+		logger.Error("Update class err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeUpdateClass, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, nil)
+}
+
+func DeleteClassHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: DELETE %v.", r.URL)
+
+	logger.Info("Begin delete Class handler.")
+	defer logger.Info("End delete Class handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+	if !isAdmin(username) {
+		api.JsonResult(w, http.StatusForbidden, api.GetError(api.ErrorCodePermissionDenied), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	classId, err := strconv.Atoi(params.ByName("classid"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "classid"), nil)
+		return
+	}
+
+	err = models.DeleteClass(db, classId)
+	if err == models.ErrClassNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeClassNotFound), nil)
+		return
+	} else if err != nil {
+		logger.Error("Delete class err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeDeleteClass, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, nil)
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/dcat"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// dcatPageSize is the page size to list all the repositories of the catalog.
+const dcatPageSize = 500
+
+// dcatPublic reports whether the dcat endpoints are open to the anonymous
+// harvesters, portals and search engines, by DCAT_PUBLIC=yes. Then they
+// publish all the active repositories, the local and the mirrored ones, with
+// their active dataitems and schemas, as any user signed in may read them.
+func dcatPublic() bool {
+	return os.Getenv("DCAT_PUBLIC") == "yes"
+}
+
+// checkDcatAuth requires a datafoundry token unless the dcat endpoints are
+// public. The error response has been written if false is returned.
+func checkDcatAuth(w http.ResponseWriter, r *http.Request) bool {
+	if dcatPublic() {
+		return true
+	}
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return false
+	}
+	return true
+}
+
+// getDcatFormat gets the format query param, or negotiates the format by the
+// Accept header. The error response has been written if false is returned.
+func getDcatFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if format := r.FormValue("format"); format != "" {
+		if _, ok := dcat.ContentTypes[format]; !ok {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "format"), nil)
+			return "", false
+		}
+		return format, true
+	}
+
+	format := dcat.Negotiate(r.Header.Get("Accept"))
+	if format == "" {
+		api.JsonResult(w, http.StatusNotAcceptable, api.GetError2(api.ErrorCodeInvalidParameters, "Accept"), nil)
+		return "", false
+	}
+	return format, true
+}
+
+// dcatLinks makes the iris from the DCAT_BASE_URL env, or the request.
+func dcatLinks(r *http.Request) dcat.Links {
+	if baseUrl := os.Getenv("DCAT_BASE_URL"); baseUrl != "" {
+		return dcat.Links{BaseUrl: strings.TrimRight(baseUrl, "/")}
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return dcat.Links{BaseUrl: scheme + "://" + r.Host}
+}
+
+func writeDcat(w http.ResponseWriter, data []byte, contentType string, err error) {
+	if err != nil {
+		logger.Error("Render dcat err: %v", err)
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError2(api.ErrorCodeRenderDcat, err.Error()), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// CatalogDcatHandler publishes all the active repositories and their
+// dataitems, without the schemas, to the anonymous clients if dcatPublic.
+func CatalogDcatHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin catalog Dcat handler.")
+	defer logger.Info("End catalog Dcat handler.")
+
+	if !checkDcatAuth(w, r) {
+		return
+	}
+
+	format, ok := getDcatFormat(w, r)
+	if !ok {
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	repos := make([]*dcat.Repo, 0, dcatPageSize)
+	sortKeys, _ := models.RepoSortKeys("", "")
+	opts := &models.ListOptions{SortKeys: sortKeys, Limit: dcatPageSize}
+	for {
+		page, list, err := models.QueryRepoList(db, &models.RepoFilter{}, opts)
+		if err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+			return
+		}
+		repoNames := make([]string, len(list))
+		for i, repo := range list {
+			repoNames[i] = repo.RepoName
+		}
+		items, err := models.QueryRepoItems(db, repoNames)
+		if err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+			return
+		}
+		for _, repo := range list {
+			repos = append(repos, &dcat.Repo{Repository: repo, Items: dcatItems(items[repo.RepoName])})
+		}
+
+		if page.Next == "" {
+			break
+		}
+		if opts.Cursor, err = models.DecodeCursor(page.Next); err != nil {
+			api.JsonResult(w, http.StatusInternalServerError, api.GetError2(api.ErrorCodeUnkown, err.Error()), nil)
+			return
+		}
+	}
+
+	data, contentType, err := dcat.RenderCatalog(format, dcatLinks(r), repos)
+	writeDcat(w, data, contentType, err)
+}
+
+func dcatItems(items []*models.Dataitem) []*dcat.Item {
+	result := make([]*dcat.Item, len(items))
+	for i, item := range items {
+		result[i] = &dcat.Item{Dataitem: item}
+	}
+	return result
+}
+
+// RepoDcatHandler publishes a repository with its dataitems and schemas.
+func RepoDcatHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin repo Dcat handler.")
+	defer logger.Info("End repo Dcat handler.")
+
+	if !checkDcatAuth(w, r) {
+		return
+	}
+
+	format, ok := getDcatFormat(w, r)
+	if !ok {
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	repoName := params.ByName("reponame")
+	repo, err := models.QueryRepo(db, repoName)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+		return
+	}
+	items, err := models.QueryItemList(db, repoName)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return
+	}
+
+	itemIds := make([]int, len(items))
+	for i, item := range items {
+		itemIds[i] = item.ItemId
+	}
+	attrs, err := models.QueryItemsAttrs(db, itemIds)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryAttribute, err.Error()), nil)
+		return
+	}
+
+	dcatRepo := &dcat.Repo{Repository: repo, Items: dcatItems(items)}
+	for _, item := range dcatRepo.Items {
+		if item.Attrs = attrs[item.ItemId]; item.Attrs == nil {
+			item.Attrs = []*models.Attribute{}
+		}
+	}
+
+	data, contentType, err := dcat.RenderRepo(format, dcatLinks(r), dcatRepo)
+	writeDcat(w, data, contentType, err)
+}
+
+// ItemDcatHandler publishes a dataitem with its schema.
+func ItemDcatHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin item Dcat handler.")
+	defer logger.Info("End item Dcat handler.")
+
+	if !checkDcatAuth(w, r) {
+		return
+	}
+
+	format, ok := getDcatFormat(w, r)
+	if !ok {
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	repoName := params.ByName("reponame")
+	item, err := models.QueryItem(db, repoName, params.ByName("itemname"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return
+	}
+	attrs, err := models.QueryAttrList(db, item.ItemId)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryAttribute, err.Error()), nil)
+		return
+	}
+
+	data, contentType, err := dcat.RenderItem(format, dcatLinks(r), repoName, &dcat.Item{Dataitem: item, Attrs: attrs})
+	writeDcat(w, data, contentType, err)
+}
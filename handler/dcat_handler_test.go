@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/dcat"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestDcatPublic(t *testing.T) {
+	os.Setenv("DCAT_PUBLIC", "yes")
+	defer os.Unsetenv("DCAT_PUBLIC")
+
+	// the anonymous requests pass to the db, which isn't inited in the tests.
+	params := httprouter.Params{{Key: "reponame", Value: "sales"}, {Key: "itemname", Value: "orders"}}
+	for _, handle := range []httprouter.Handle{CatalogDcatHandler, RepoDcatHandler, ItemDcatHandler} {
+		r := httptest.NewRequest("GET", "/integration/v1/catalog.jsonld?format="+dcat.FormatJsonLd, nil)
+		w := httptest.NewRecorder()
+		handle(w, r, params)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("expect the anonymous request accepted, got %d: %s", w.Code, w.Body)
+		}
+	}
+}
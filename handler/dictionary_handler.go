@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/dictionary"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"time"
+)
+
+var dictionaryExtensions = map[string]string{
+	dictionary.FormatHtml:     "html",
+	dictionary.FormatMarkdown: "md",
+	dictionary.FormatXlsx:     "xlsx",
+}
+
+// DataDictionaryHandler renders every dataitem of a repository with its
+// attributes as html (by default), markdown or xlsx. The headings are in the
+// lang query param, or the Accept-Language header.
+func DataDictionaryHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin data Dictionary handler.")
+	defer logger.Info("End data Dictionary handler.")
+
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = dictionary.FormatHtml
+	}
+	extension, ok := dictionaryExtensions[format]
+	if !ok {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "format"), nil)
+		return
+	}
+
+	lang := r.FormValue("lang")
+	if lang == "" {
+		lang = r.Header.Get("Accept-Language")
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	repoName := params.ByName("reponame")
+	repo, err := models.QueryRepo(db, repoName)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+		return
+	}
+	items, err := models.QueryItemList(db, repoName)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return
+	}
+
+	itemIds := make([]int, len(items))
+	for i, item := range items {
+		itemIds[i] = item.ItemId
+	}
+	attrs, err := models.QueryItemsAttrs(db, itemIds)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryAttribute, err.Error()), nil)
+		return
+	}
+
+	dict := &dictionary.Dictionary{Repo: repo, GeneratedAt: time.Now()}
+	for _, item := range items {
+		itemAttrs := attrs[item.ItemId]
+		if itemAttrs == nil {
+			itemAttrs = []*models.Attribute{}
+		}
+		dict.Items = append(dict.Items, &dictionary.Item{Dataitem: item, Attrs: itemAttrs})
+	}
+
+	data, contentType, err := dictionary.Render(format, lang, dict)
+	if err != nil {
+		logger.Error("Render dictionary of %s err: %v", repoName, err)
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError2(api.ErrorCodeRenderDictionary, err.Error()), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if format == dictionary.FormatXlsx {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-dictionary.%s"`, repoName, extension))
+	} else {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s-dictionary.%s"`, repoName, extension))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
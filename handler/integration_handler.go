@@ -1,12 +1,15 @@
 package handler
 
 import (
+	"fmt"
 	"github.com/asiainfoLDP/datafoundry_data_integration/api"
 	"github.com/asiainfoLDP/datafoundry_data_integration/common"
 	"github.com/asiainfoLDP/datafoundry_data_integration/models"
 	"github.com/julienschmidt/httprouter"
 	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -52,6 +55,36 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+func isAdmin(username string) bool {
+	for _, admin := range AdminUsers {
+		if username == admin {
+			return true
+		}
+	}
+	return false
+}
+
+// only the creator of the repository and the admins can modify it, unless
+// it's managed by a reconciler.
+func canEditRepo(username string, repo *models.Repository) bool {
+	return repo.ManagedBy == "" && (username == repo.CreateUser || isAdmin(username))
+}
+
+// checkEditableRepo writes the error response if the user can't modify the
+// repository.
+func checkEditableRepo(w http.ResponseWriter, username string, repo *models.Repository) bool {
+	if repo.ManagedBy != "" {
+		api.JsonResult(w, http.StatusForbidden, api.GetError2(api.ErrorCodeRepoManaged,
+			fmt.Sprintf("repository %s is managed by %s", repo.RepoName, repo.ManagedBy)), nil)
+		return false
+	}
+	if !canEditRepo(username, repo) {
+		api.JsonResult(w, http.StatusForbidden, api.GetError(api.ErrorCodePermissionDenied), nil)
+		return false
+	}
+	return true
+}
+
 func CreateRepoHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	logger.Info("Request url: POST %v.", r.URL)
 
@@ -80,8 +113,27 @@ func CreateRepoHandler(w http.ResponseWriter, r *http.Request, params httprouter
 		return
 	}
 
+	// the repositories created over the api are local, whose names can't
+	// collide with the mirrors.
+	name, ok := models.ValidateRepoName(repo.RepoName, "")
+	if !ok {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters,
+			fmt.Sprintf("invalid repository name %q", repo.RepoName)), nil)
+		return
+	}
+	repo.RepoName = name
+	repo.ManagedBy, repo.Origin, repo.OriginUrl = "", "", ""
 	repo.Status = "A"
 
+	if repo.ClassId > 0 {
+		class, err := models.QueryClass(db, repo.ClassId)
+		if err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeClassNotFound, err.Error()), nil)
+			return
+		}
+		repo.Class = class.Name(models.ClassLocaleZh)
+	}
+
 	err = models.RecordRepo(db, repo)
 	if err != nil {
 		logger.Error("Record repository err: %v", err)
@@ -114,22 +166,128 @@ func QueryRepoListHandler(w http.ResponseWriter, r *http.Request, params httprou
 
 	r.ParseForm()
 
-	offset, size := api.OptionalOffsetAndSize(r, 30, 1, 1000)
 	sortOrder := models.ValidateSortOrder(r.Form.Get("sortorder"), models.SortOrderDesc)
-	orderBy := models.ValidateOrderBy(r.Form.Get("orderby"))
+	sortKeys, err := models.RepoSortKeys(r.Form.Get("orderby"), sortOrder)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, err.Error()), nil)
+		return
+	}
+	if sort := r.Form.Get("sort"); sort != "" {
+		if sortKeys, err = models.ParseRepoSort(sort); err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, err.Error()), nil)
+			return
+		}
+	}
+	opts, e := optionalListOptions(r, sortKeys)
+	if e != nil {
+		api.JsonResult(w, http.StatusBadRequest, e, nil)
+		return
+	}
 	class := r.Form.Get("class")
-	label := r.Form.Get("label")
 	reponame := r.Form.Get("reponame")
 
-	count, repos, err := models.QueryRepoList(db, class, label, reponame, orderBy, sortOrder, offset, size)
-	if err != nil {
+	var classIds []int
+	if r.Form.Get("classid") != "" {
+		classId, err := strconv.Atoi(r.Form.Get("classid"))
+		if err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "classid"), nil)
+			return
+		}
+		classes, err := models.QueryClassList(db)
+		if err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryClasses, err.Error()), nil)
+			return
+		}
+		// filtering by a class node includes its descendants.
+		classIds = models.ClassDescendants(classes, classId)
+	}
+
+	tags := splitTagsParam(r.Form.Get("tags"), r.Form.Get("label"))
+	matchAllTags := r.Form.Get("tagmatch") == "all"
+
+	filter := &models.RepoFilter{
+		Class:        class,
+		ClassIds:     classIds,
+		RepoName:     reponame,
+		Tags:         tags,
+		MatchAllTags: matchAllTags,
+		Origin:       r.Form.Get("origin"),
+	}
+	page, repos, err := models.QueryRepoList(db, filter, opts)
+	if err == models.ErrInvalidCursor {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "cursor"), nil)
+		return
+	} else if err != nil {
 		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
 		return
 	}
-	api.JsonResult(w, http.StatusOK, nil, api.NewQueryListResult(count, repos))
+	api.JsonResult(w, http.StatusOK, nil, api.NewQueryPageResult(page.Count, page.Next, page.Prev, repos))
 
 }
 
+// splitTagsParam splits the tags param by commas only, as the tags may
+// contain spaces and slashes. label is kept for the old clients, and split as
+// an old style label.
+func splitTagsParam(tags, label string) []string {
+	return models.NormalizeTags(append(strings.Split(tags, ","), models.SplitLabel(label)...))
+}
+
+func QueryItemListHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get ItemList handler.")
+	defer logger.Info("End get ItemList handler.")
+
+	token := r.Header.Get("Authorization")
+
+	if _, err := getDFUserame(token); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	r.ParseForm()
+
+	sortOrder := models.ValidateSortOrder(r.Form.Get("sortorder"), models.SortOrderAsc)
+	sortKeys, err := models.ItemSortKeys(r.Form.Get("orderby"), sortOrder)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, err.Error()), nil)
+		return
+	}
+	if sort := r.Form.Get("sort"); sort != "" {
+		if sortKeys, err = models.ParseItemSort(sort); err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, err.Error()), nil)
+			return
+		}
+	}
+	opts, e := optionalListOptions(r, sortKeys)
+	if e != nil {
+		api.JsonResult(w, http.StatusBadRequest, e, nil)
+		return
+	}
+
+	filter := &models.ItemFilter{
+		RepoName: params.ByName("reponame"),
+		ItemName: r.Form.Get("itemname"),
+		Keyword:  r.Form.Get("q"),
+	}
+	page, items, err := models.QueryItemPage(db, filter, opts)
+	if err == models.ErrInvalidCursor {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "cursor"), nil)
+		return
+	} else if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return
+	}
+	api.JsonResult(w, http.StatusOK, nil, api.NewQueryPageResult(page.Count, page.Next, page.Prev, items))
+}
+
 func QueryRepoHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	logger.Info("Request url: GET %v.", r.URL)
 
@@ -223,6 +381,29 @@ func QueryDataItemHandler(w http.ResponseWriter, r *http.Request, params httprou
 	api.JsonResult(w, http.StatusOK, nil, res)
 }
 
+// optionalListOptions parses the page, size, cursor and count query params.
+func optionalListOptions(r *http.Request, sortKeys []models.SortKey) (*models.ListOptions, *api.Error) {
+	offset, size := api.OptionalOffsetAndSize(r, 30, 1, 1000)
+	token, withCount := api.OptionalCursorAndCount(r)
+
+	opts := &models.ListOptions{
+		SortKeys:  sortKeys,
+		Offset:    offset,
+		Limit:     size,
+		WithCount: withCount,
+	}
+
+	if token != "" {
+		cursor, err := models.DecodeCursor(token)
+		if err != nil {
+			return nil, api.GetError2(api.ErrorCodeInvalidParameters, "cursor")
+		}
+		opts.Cursor = cursor
+	}
+
+	return opts, nil
+}
+
 func CheckAmount(amount float64) uint {
 
 	amount = float64(int64(amount * 100)) * 0.01
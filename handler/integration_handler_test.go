@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -27,3 +28,10 @@ func TestCheckAmount(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitTagsParam(t *testing.T) {
+	tags := splitTagsParam("big data, finance,,Big Data", "stock/bank")
+	if expected := []string{"big data", "finance", "stock", "bank"}; !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expect %v, got %v", expected, tags)
+	}
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/julienschmidt/httprouter"
+	"github.com/rcrowley/go-metrics"
+	"net/http"
+)
+
+// QueryMetricsHandler writes the metrics of the default registry, e.g. the
+// counters of the alarms, as json.
+func QueryMetricsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get Metrics handler.")
+	defer logger.Info("End get Metrics handler.")
+
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	metrics.WriteJSONOnce(metrics.DefaultRegistry, w)
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+// QueryReconcileRunsHandler lists the runs of the reconcilers without the
+// reports, the latest first. The reconciler param selects a reconciler.
+func QueryReconcileRunsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get ReconcileRuns handler.")
+	defer logger.Info("End get ReconcileRuns handler.")
+
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	offset, size := api.OptionalOffsetAndSize(r, 30, 1, 100)
+	count, runs, err := models.QueryReconcileRuns(db, r.FormValue("reconciler"), offset, size)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryReconcileRuns, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, api.NewQueryListResult(count, runs))
+}
+
+// QueryReconcileRunHandler gets a run of a reconciler with its report.
+func QueryReconcileRunHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get ReconcileRun handler.")
+	defer logger.Info("End get ReconcileRun handler.")
+
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	runId, err := strconv.Atoi(params.ByName("runid"))
+	if err != nil || runId <= 0 {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "runid"), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	run, err := models.QueryReconcileRun(db, runId)
+	if err == models.ErrReconcileRunNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeReconcileRunNotFound), nil)
+		return
+	} else if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryReconcileRuns, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, run)
+}
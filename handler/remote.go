@@ -1,11 +1,17 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/discovery"
+	"github.com/rcrowley/go-metrics"
 )
 
 type ObjectMeta struct {
@@ -27,10 +33,89 @@ type User struct {
 
 const DataFoundryHost = "https://dev.dataos.io:8443"
 
+// dataFoundry resolves the datafoundry api server by DATAFOUNDRY_ADDRS or
+// DATAFOUNDRY_CONSUL_SERVICE, and is nil if neither is set.
+var dataFoundry = newDataFoundryWatcher()
+
+func newDataFoundryWatcher() *discovery.Watcher {
+	resolver, err := discovery.FromEnv("DATAFOUNDRY", nil)
+	if err != nil {
+		logger.Error("Resolver of datafoundry err: %v, use %s.", err, DataFoundryHost)
+		return nil
+	}
+	if resolver == nil {
+		return nil
+	}
+	return discovery.NewWatcher("datafoundry", resolver)
+}
+
+// dataFoundryClient calls DataFoundryHost at its resolved endpoint if any.
+// The urls keep the host name, so the tls is verified against it rather than
+// the ip of the endpoint.
+var dataFoundryClient = &http.Client{
+	Timeout:   time.Duration(common.GeneralRemoteCallTimeout) * time.Second,
+	Transport: newEndpointTransport(DataFoundryHost, dataFoundry),
+}
+
+// newEndpointTransport returns a transport, which dials the endpoint of the
+// watcher instead of the address of the host url, if both exist.
+func newEndpointTransport(hostUrl string, watcher *discovery.Watcher) *http.Transport {
+	dialer := &net.Dialer{Timeout: time.Duration(common.GeneralRemoteCallTimeout) * time.Second}
+	u, err := url.Parse(hostUrl)
+	if err != nil || watcher == nil {
+		return &http.Transport{Proxy: http.ProxyFromEnvironment, DialContext: dialer.DialContext}
+	}
+	hostAddr := u.Host
+	if u.Port() == "" {
+		port := "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+		hostAddr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr == hostAddr {
+				watcher.Start(nil)
+				if endpoint, ok := watcher.Endpoint(); ok {
+					addr = endpoint.String()
+				}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// callDataFoundry calls the datafoundry api server with the token.
+func callDataFoundry(method, path, token string) (*http.Response, []byte, error) {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", token)
+	}
+	return common.RemoteCallWithClient(dataFoundryClient, method, DataFoundryHost+path, header, nil)
+}
+
+// the counters of authDF, for the alarm rules of the auth failure rate.
+var (
+	authRequests = metrics.GetOrRegisterCounter("auth.requests", metrics.DefaultRegistry)
+	authFailures = metrics.GetOrRegisterCounter("auth.failures", metrics.DefaultRegistry)
+)
+
 func authDF(token string) (*User, error) {
-	url := fmt.Sprintf("%s/oapi/v1/users/~", DataFoundryHost)
+	authRequests.Inc(1)
+	user, err := _authDF(token)
+	if err != nil {
+		authFailures.Inc(1)
+	}
+	return user, err
+}
+
+func _authDF(token string) (*User, error) {
+	url := DataFoundryHost + "/oapi/v1/users/~"
 
-	response, data, err := common.RemoteCall("GET", url, token, "")
+	response, data, err := callDataFoundry("GET", "/oapi/v1/users/~", token)
 	if err != nil {
 		logger.Error("authDF error: ", err.Error())
 		return nil, err
@@ -67,9 +152,10 @@ func getDFUserame(token string) (string, error) {
 }
 
 func checkNameSpacePermission(ns, token string) error {
-	url := fmt.Sprintf("%s/oapi/v1/projects/%s", DataFoundryHost, ns)
+	path := fmt.Sprintf("/oapi/v1/projects/%s", ns)
+	url := DataFoundryHost + path
 
-	response, data, err := common.RemoteCall("GET", url, token, "")
+	response, data, err := callDataFoundry("GET", path, token)
 	if err != nil {
 		logger.Error("get projects error: ", err.Error())
 		return err
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/discovery"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestEndpointTransport(t *testing.T) {
+	// the certificate of the test server is of example.com and 127.0.0.1.
+	hosts := []string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+	}))
+	defer server.Close()
+
+	resolver, err := discovery.NewStatic(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher := discovery.NewWatcher("datafoundry", resolver)
+	transport := newEndpointTransport("https://example.com", watcher)
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	client := &http.Client{Transport: transport}
+
+	response, err := client.Get("https://example.com/oapi/v1/users/~")
+	if err != nil {
+		t.Fatalf("expect the tls verified against the host name: %v", err)
+	}
+	response.Body.Close()
+
+	// the other hosts are dialed as they are.
+	response, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expect the test server dialed directly: %v", err)
+	}
+	response.Body.Close()
+
+	if !reflect.DeepEqual(hosts, []string{"example.com", server.Listener.Addr().String()}) {
+		t.Errorf("unexpected hosts %v", hosts)
+	}
+}
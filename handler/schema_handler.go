@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"database/sql"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/asiainfoLDP/datafoundry_data_integration/schema"
+	"github.com/julienschmidt/httprouter"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const MaxSampleSize = 10 << 20
+
+var sampleExtensions = map[string]string{
+	".csv":    schema.SampleCsv,
+	".tsv":    schema.SampleTsv,
+	".tab":    schema.SampleTsv,
+	".json":   schema.SampleJson,
+	".ndjson": schema.SampleNdjson,
+	".jsonl":  schema.SampleNdjson,
+}
+
+// ExportSchemaHandler renders the attributes of a dataitem in the format
+// query param, which is jsonschema by default.
+func ExportSchemaHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin export Schema handler.")
+	defer logger.Info("End export Schema handler.")
+
+	item, ok := getVersionedItem(w, r, params)
+	if !ok {
+		return
+	}
+
+	attrs, err := models.QueryAttrList(models.GetDB(), item.ItemId)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryAttribute, err.Error()), nil)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = schema.FormatJsonSchema
+	}
+
+	data, contentType, err := schema.Render(format, &schema.Item{
+		RepoName: params.ByName("reponame"),
+		ItemName: item.ItemName,
+		Attrs:    attrs,
+	})
+	if err == schema.ErrUnknownFormat {
+		api.JsonResult(w, http.StatusBadRequest,
+			api.GetError2(api.ErrorCodeInvalidParameters, "format should be one of "+strings.Join(schema.Formats(), ", ")), nil)
+		return
+	} else if err != nil {
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError2(api.ErrorCodeUnkown, err.Error()), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// readUpload reads the "file" part of a multipart upload, or the whole body.
+// The lowered extension of the file name is returned with the data, so that
+// the format can be guessed.
+func readUpload(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxSampleSize)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", err
+		}
+		defer file.Close()
+
+		data, err := ioutil.ReadAll(file)
+		return data, strings.ToLower(filepath.Ext(header.Filename)), err
+	}
+
+	defer r.Body.Close()
+	data, err := ioutil.ReadAll(r.Body)
+	return data, "", err
+}
+
+// InferAttrsHandler proposes the attributes of an uploaded csv, tsv, json or
+// ndjson sample. The query params format, header and delimiter override the
+// detection. On the dataitem route, apply=true replaces the attributes of the
+// dataitem with the proposal.
+func InferAttrsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin infer Attrs handler.")
+	defer logger.Info("End infer Attrs handler.")
+
+	apply := false
+	if s := r.URL.Query().Get("apply"); s != "" {
+		var err error
+		if apply, err = strconv.ParseBool(s); err != nil || (apply && params.ByName("itemname") == "") {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "apply"), nil)
+			return
+		}
+	}
+
+	var username string
+	var item *models.Dataitem
+	if apply {
+		var ok bool
+		if username, item, ok = getEditableItem(w, r, params); !ok {
+			return
+		}
+	} else if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := &schema.InferOptions{Format: query.Get("format")}
+	if s := query.Get("header"); s != "" {
+		header, err := strconv.ParseBool(s)
+		if err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "header"), nil)
+			return
+		}
+		opts.Header = &header
+	}
+	if s := query.Get("delimiter"); s != "" {
+		if s == "tab" || s == `\t` {
+			s = "\t"
+		}
+		if utf8.RuneCountInString(s) != 1 {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "delimiter"), nil)
+			return
+		}
+		opts.Delimiter, _ = utf8.DecodeRuneInString(s)
+	}
+
+	data, extension, err := readUpload(w, r)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInferAttributes, err.Error()), nil)
+		return
+	}
+	if opts.Format == "" {
+		opts.Format = sampleExtensions[extension]
+	}
+
+	inference, err := schema.Infer(data, opts)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInferAttributes, err.Error()), nil)
+		return
+	}
+
+	if !apply {
+		api.JsonResult(w, http.StatusOK, nil, inference)
+		return
+	}
+
+	version, err := models.UpdateAttrs(models.GetDB(), item.ItemId, username, inference.Attrs)
+	if e, ok := err.(*models.IncompatibleSchemaError); ok {
+		incompatibleSchemaResult(w, e.Mode, e.Violations)
+		return
+	} else if err != nil {
+		logger.Error("Update attributes err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeUpdateAttributes, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, struct {
+		*schema.Inference
+		SchemaVersion int `json:"schemaVersion"`
+	}{inference, version})
+}
+
+type introspectBody struct {
+	Source string `json:"source"`
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+}
+
+// IntrospectAttrsHandler replaces the attributes of a dataitem with the
+// columns of a mysql table. The source names a dsn configured by the env,
+// see schema.SourceDsn.
+func IntrospectAttrsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin introspect Attrs handler.")
+	defer logger.Info("End introspect Attrs handler.")
+
+	username, item, ok := getEditableItem(w, r, params)
+	if !ok {
+		return
+	}
+
+	body := &introspectBody{}
+	if err := common.ParseRequestJsonInto(r, body); err != nil {
+		logger.Error("Parse body err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeParseJsonFailed, err.Error()), nil)
+		return
+	}
+	if body.Table == "" {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "table"), nil)
+		return
+	}
+
+	dsn, err := schema.SourceDsn(body.Source)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "source"), nil)
+		return
+	}
+
+	source, err := sql.Open("mysql", dsn)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeIntrospectTable, err.Error()), nil)
+		return
+	}
+	defer source.Close()
+	source.SetMaxOpenConns(1)
+
+	attrs, err := schema.IntrospectMysql(source, body.Schema, body.Table)
+	if err != nil {
+		logger.Error("Introspect table %s.%s err: %v", body.Source, body.Table, err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeIntrospectTable, err.Error()), nil)
+		return
+	}
+
+	version, err := models.UpdateAttrs(models.GetDB(), item.ItemId, username, attrs)
+	if e, ok := err.(*models.IncompatibleSchemaError); ok {
+		incompatibleSchemaResult(w, e.Mode, e.Violations)
+		return
+	} else if err != nil {
+		logger.Error("Update attributes err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeUpdateAttributes, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, struct {
+		Attrs         []*models.Attribute `json:"attrs"`
+		SchemaVersion int                 `json:"schemaVersion"`
+	}{attrs, version})
+}
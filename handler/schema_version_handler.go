@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+// getVersionedItem authenticates the request and gets the dataitem in the path.
+// The error response has been written if false is returned.
+func getVersionedItem(w http.ResponseWriter, r *http.Request, params httprouter.Params) (*models.Dataitem, bool) {
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return nil, false
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return nil, false
+	}
+
+	item, err := models.QueryItem(db, params.ByName("reponame"), params.ByName("itemname"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return nil, false
+	}
+
+	return item, true
+}
+
+func QuerySchemaVersionsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get SchemaVersions handler.")
+	defer logger.Info("End get SchemaVersions handler.")
+
+	item, ok := getVersionedItem(w, r, params)
+	if !ok {
+		return
+	}
+
+	versions, err := models.QuerySchemaVersions(models.GetDB(), item.ItemId)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQuerySchemaVersions, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, struct {
+		SchemaVersion int                     `json:"schemaVersion"`
+		Versions      []*models.SchemaVersion `json:"versions"`
+	}{item.SchemaVersion, versions})
+}
+
+func QuerySchemaVersionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get SchemaVersion handler.")
+	defer logger.Info("End get SchemaVersion handler.")
+
+	item, ok := getVersionedItem(w, r, params)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.Atoi(params.ByName("version"))
+	if err != nil || version <= 0 {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "version"), nil)
+		return
+	}
+
+	v, err := models.QuerySchemaVersion(models.GetDB(), item.ItemId, version)
+	if err == models.ErrSchemaVersionNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeSchemaVersionNotFound), nil)
+		return
+	} else if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQuerySchemaVersions, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, v)
+}
+
+// DiffSchemaVersionsHandler compares the versions in the from and to query
+// params. to is the current version by default, from is the one before to.
+func DiffSchemaVersionsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin diff SchemaVersions handler.")
+	defer logger.Info("End diff SchemaVersions handler.")
+
+	item, ok := getVersionedItem(w, r, params)
+	if !ok {
+		return
+	}
+
+	to := item.SchemaVersion
+	if s := r.FormValue("to"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "to"), nil)
+			return
+		}
+		to = v
+	}
+
+	from := to - 1
+	if s := r.FormValue("from"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "from"), nil)
+			return
+		}
+		from = v
+	}
+	if from < 0 {
+		from = 0
+	}
+
+	diff, err := models.DiffSchemaVersions(models.GetDB(), item.ItemId, from, to)
+	if err == models.ErrSchemaVersionNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeSchemaVersionNotFound), nil)
+		return
+	} else if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQuerySchemaVersions, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, diff)
+}
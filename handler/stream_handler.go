@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// StreamPollInterval is the interval between the polls of the change log
+	// of each stream.
+	StreamPollInterval = 2 * time.Second
+
+	// StreamHeartbeatInterval keeps the idle streams open through the
+	// proxies.
+	StreamHeartbeatInterval = 15 * time.Second
+
+	// StreamMaxDuration ends the streams, which the clients reconnect with
+	// Last-Event-ID, so that the streams are rebalanced among the instances.
+	StreamMaxDuration = 30 * time.Minute
+)
+
+const (
+	// StreamRetry is the reconnection delay of the clients, in milliseconds.
+	StreamRetry = 3000
+)
+
+// writeStreamEvent writes the event of the change in the text/event-stream
+// format. The id is the sequence number of the change, and the event is the
+// type of the event.
+func writeStreamEvent(w io.Writer, change *models.Change) error {
+	data, err := json.Marshal(models.NewEvent(change))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.Seq,
+		models.EventType(change.Entity, change.Operation), data)
+	return err
+}
+
+// streamToken returns the token of the Authorization header, or of the
+// access_token param for the browsers, whose EventSource can't set headers.
+func streamToken(r *http.Request) string {
+	if token := r.Header.Get("Authorization"); token != "" {
+		return token
+	}
+	if token := r.FormValue("access_token"); token != "" {
+		return "Bearer " + token
+	}
+	return ""
+}
+
+// redactedStreamUrl returns the url of the stream request with the
+// access_token param redacted, for the logs.
+func redactedStreamUrl(u *url.URL) string {
+	query := u.Query()
+	if _, ok := query["access_token"]; !ok {
+		return u.String()
+	}
+	query.Set("access_token", "REDACTED")
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// streamFilter parses the repo, item and events params of a stream.
+func streamFilter(r *http.Request) (*models.EventFilter, error) {
+	filter := &models.EventFilter{
+		RepoName: strings.TrimSpace(r.FormValue("repo")),
+		ItemName: strings.TrimSpace(r.FormValue("item")),
+		Events:   []string{},
+	}
+	if filter.ItemName != "" && filter.RepoName == "" {
+		return nil, fmt.Errorf("the repo of the item is needed")
+	}
+	if events := r.FormValue("events"); events != "" {
+		var err error
+		if filter.Events, err = models.NormalizeEventTypes(strings.Split(events, ",")); err != nil {
+			return nil, err
+		}
+	}
+	return filter, nil
+}
+
+// StreamEventsHandler pushes the events of the changes to the client as
+// server-sent events, filtered by the repo, item and events params like the
+// webhooks. The stream resumes after the Last-Event-ID header, or the
+// lastEventId param, from the change log, or starts with the next change.
+func StreamEventsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", redactedStreamUrl(r.URL))
+
+	logger.Info("Begin stream Events handler.")
+	defer logger.Info("End stream Events handler.")
+
+	if _, err := getDFUserame(streamToken(r)); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	filter, err := streamFilter(r)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, err.Error()), nil)
+		return
+	}
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.FormValue("lastEventId")
+	}
+	since := int64(-1)
+	if lastEventId != "" {
+		if since, err = strconv.ParseInt(lastEventId, 10, 64); err != nil || since < 0 {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "Last-Event-ID"), nil)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError2(api.ErrorCodeUnkown, "streaming unsupported"), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	if since < 0 {
+		if since, err = models.QueryLatestChangeSeq(db); err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryChanges, err.Error()), nil)
+			return
+		}
+	}
+
+	if !api.DisableTimeout(w) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", StreamRetry); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	poll := time.NewTicker(StreamPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(StreamHeartbeatInterval)
+	defer heartbeat.Stop()
+	end := time.After(StreamMaxDuration)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-end:
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-poll.C:
+			for {
+				changes, err := models.QueryChanges(db, since, ChangesDefaultLimit)
+				if err != nil {
+					logger.Error("Query changes of stream err: %v", err)
+					break
+				}
+				for _, change := range changes {
+					since = change.Seq
+					if !filter.Matches(change) {
+						continue
+					}
+					if err := writeStreamEvent(w, change); err != nil {
+						return
+					}
+				}
+				flusher.Flush()
+				if len(changes) < ChangesDefaultLimit {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteStreamEvent(t *testing.T) {
+	createTime := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	change := &models.Change{Seq: 42, Entity: models.EntityDataitem, Name: "sales/orders",
+		Operation: models.ChangeUpdate, Payload: json.RawMessage(`{"itemName":"orders"}`), CreateTime: &createTime}
+
+	buf := &bytes.Buffer{}
+	if err := writeStreamEvent(buf, change); err != nil {
+		t.Fatal(err)
+	}
+	expected := "id: 42\nevent: dataitem.update\n" +
+		`data: {"version":1,"seq":42,"entity":"dataitem","name":"sales/orders","operation":"update",` +
+		`"time":"2026-10-01T08:00:00Z","data":{"itemName":"orders"}}` + "\n\n"
+	if buf.String() != expected {
+		t.Errorf("expect %q, got %q", expected, buf.String())
+	}
+}
+
+func TestStreamFilter(t *testing.T) {
+	r := httptest.NewRequest("GET", "/integration/v1/events/stream?repo=sales&events=dataitem.update,dataitem.create", nil)
+	filter, err := streamFilter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &models.EventFilter{RepoName: "sales", Events: []string{"dataitem.create", "dataitem.update"}}
+	if !reflect.DeepEqual(filter, expected) {
+		t.Errorf("expect %+v, got %+v", expected, filter)
+	}
+
+	for _, query := range []string{"item=orders", "events=dataitem.star"} {
+		r := httptest.NewRequest("GET", "/integration/v1/events/stream?"+query, nil)
+		if _, err := streamFilter(r); err == nil {
+			t.Errorf("%s: expect an error", query)
+		}
+	}
+}
+
+func TestStreamToken(t *testing.T) {
+	r := httptest.NewRequest("GET", "/integration/v1/events/stream?access_token=abc", nil)
+	if token := streamToken(r); token != "Bearer abc" {
+		t.Errorf("unexpected token %s", token)
+	}
+	r.Header.Set("Authorization", "Bearer xyz")
+	if token := streamToken(r); token != "Bearer xyz" {
+		t.Errorf("unexpected token %s", token)
+	}
+
+	r = httptest.NewRequest("GET", "/integration/v1/events/stream?repo=sales&access_token=abc", nil)
+	if u := redactedStreamUrl(r.URL); strings.Contains(u, "abc") || !strings.Contains(u, "repo=sales") {
+		t.Errorf("expect the token redacted, got %s", u)
+	}
+}
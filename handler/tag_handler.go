@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+type tagsBody struct {
+	Tags []string `json:"tags"`
+}
+
+func AddRepoTagsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin add RepoTags handler.")
+	defer logger.Info("End add RepoTags handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	repo, err := models.QueryRepo(db, params.ByName("reponame"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+		return
+	}
+	if !checkEditableRepo(w, username, repo) {
+		return
+	}
+
+	body := &tagsBody{}
+	if err := common.ParseRequestJsonInto(r, body); err != nil {
+		logger.Error("Parse body err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeParseJsonFailed, err.Error()), nil)
+		return
+	}
+	tags := models.NormalizeTags(body.Tags)
+	if len(tags) == 0 {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "tags"), nil)
+		return
+	}
+
+	if err := models.AddRepoTags(db, repo.RepoId, tags); err != nil {
+		logger.Error("Add repository tags err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAddTags, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, nil)
+}
+
+func RemoveRepoTagHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: DELETE %v.", r.URL)
+
+	logger.Info("Begin remove RepoTag handler.")
+	defer logger.Info("End remove RepoTag handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	repo, err := models.QueryRepo(db, params.ByName("reponame"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+		return
+	}
+	if !checkEditableRepo(w, username, repo) {
+		return
+	}
+
+	removed, err := models.RemoveRepoTag(db, repo.RepoId, params.ByName("tag"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeRemoveTag, err.Error()), nil)
+		return
+	}
+	if !removed {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeTagNotFound), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, nil)
+}
+
+func AddItemTagsHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin add ItemTags handler.")
+	defer logger.Info("End add ItemTags handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	repoName := params.ByName("reponame")
+	repo, err := models.QueryRepo(db, repoName)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+		return
+	}
+	if !checkEditableRepo(w, username, repo) {
+		return
+	}
+
+	item, err := models.QueryItem(db, repoName, params.ByName("itemname"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return
+	}
+
+	body := &tagsBody{}
+	if err := common.ParseRequestJsonInto(r, body); err != nil {
+		logger.Error("Parse body err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeParseJsonFailed, err.Error()), nil)
+		return
+	}
+	tags := models.NormalizeTags(body.Tags)
+	if len(tags) == 0 {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "tags"), nil)
+		return
+	}
+
+	if err := models.AddItemTags(db, item.ItemId, tags); err != nil {
+		logger.Error("Add dataitem tags err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAddTags, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, nil)
+}
+
+func RemoveItemTagHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: DELETE %v.", r.URL)
+
+	logger.Info("Begin remove ItemTag handler.")
+	defer logger.Info("End remove ItemTag handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	repoName := params.ByName("reponame")
+	repo, err := models.QueryRepo(db, repoName)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+		return
+	}
+	if !checkEditableRepo(w, username, repo) {
+		return
+	}
+
+	item, err := models.QueryItem(db, repoName, params.ByName("itemname"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+		return
+	}
+
+	removed, err := models.RemoveItemTag(db, item.ItemId, params.ByName("tag"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeRemoveTag, err.Error()), nil)
+		return
+	}
+	if !removed {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeTagNotFound), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, nil)
+}
+
+func QueryTagCloudHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get TagCloud handler.")
+	defer logger.Info("End get TagCloud handler.")
+
+	if _, err := getDFUserame(r.Header.Get("Authorization")); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	r.ParseForm()
+	_, size := api.OptionalOffsetAndSize(r, 100, 1, 1000)
+
+	cloud, err := models.QueryTagCloud(db, size)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryTags, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, cloud)
+}
@@ -0,0 +1,320 @@
+package handler
+
+import (
+	"database/sql"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+// queryOwnWebhook gets the webhook of the webhookid param, and writes the
+// error response if it's not found or not of the user.
+func queryOwnWebhook(w http.ResponseWriter, db *sql.DB, username string, params httprouter.Params) *models.Webhook {
+	webhookId, err := strconv.Atoi(params.ByName("webhookid"))
+	if err != nil || webhookId <= 0 {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "webhookid"), nil)
+		return nil
+	}
+
+	hook, err := models.QueryWebhook(db, webhookId)
+	if err == models.ErrWebhookNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeWebhookNotFound), nil)
+		return nil
+	} else if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryWebhooks, err.Error()), nil)
+		return nil
+	}
+	if hook.CreateUser != username && !isAdmin(username) {
+		api.JsonResult(w, http.StatusForbidden, api.GetError(api.ErrorCodePermissionDenied), nil)
+		return nil
+	}
+	return hook
+}
+
+// CreateWebhookHandler registers a webhook of the catalog, a repository or a
+// dataitem. The secret is generated if not given, and only returned here.
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin create Webhook handler.")
+	defer logger.Info("End create Webhook handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	hook := &models.Webhook{}
+	if err := common.ParseRequestJsonInto(r, hook); err != nil {
+		logger.Error("Parse body err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeParseJsonFailed, err.Error()), nil)
+		return
+	}
+	if err := models.ValidateWebhook(hook); err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, err.Error()), nil)
+		return
+	}
+	if hook.RepoName != "" {
+		if _, err := models.QueryRepo(db, hook.RepoName); err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryRepositorys, err.Error()), nil)
+			return
+		}
+	}
+	if hook.ItemName != "" {
+		if _, err := models.QueryItem(db, hook.RepoName, hook.ItemName); err != nil {
+			api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDataitemss, err.Error()), nil)
+			return
+		}
+	}
+	if hook.Secret == "" {
+		if hook.Secret, err = models.NewWebhookSecret(); err != nil {
+			api.JsonResult(w, http.StatusInternalServerError, api.GetError2(api.ErrorCodeCreateWebhook, err.Error()), nil)
+			return
+		}
+	}
+	hook.WebhookId = 0
+	hook.CreateUser = username
+
+	if err := models.CreateWebhook(db, hook); err != nil {
+		logger.Error("Create webhook err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeCreateWebhook, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, hook)
+}
+
+// QueryWebhooksHandler lists the webhooks of the user, or all of them for the
+// admins.
+func QueryWebhooksHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get Webhooks handler.")
+	defer logger.Info("End get Webhooks handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	user := username
+	if isAdmin(username) {
+		user = ""
+	}
+	hooks, err := models.QueryWebhooks(db, user)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryWebhooks, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, hooks)
+}
+
+func QueryWebhookHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get Webhook handler.")
+	defer logger.Info("End get Webhook handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	hook := queryOwnWebhook(w, db, username, params)
+	if hook == nil {
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, hook)
+}
+
+// DeleteWebhookHandler deletes the webhook with its deliveries.
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: DELETE %v.", r.URL)
+
+	logger.Info("Begin delete Webhook handler.")
+	defer logger.Info("End delete Webhook handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	hook := queryOwnWebhook(w, db, username, params)
+	if hook == nil {
+		return
+	}
+
+	err = models.DeleteWebhook(db, hook.WebhookId)
+	if err == models.ErrWebhookNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeWebhookNotFound), nil)
+		return
+	} else if err != nil {
+		logger.Error("Delete webhook err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeDeleteWebhook, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, nil)
+}
+
+// QueryDeliveriesHandler lists the deliveries of the webhook without the
+// payloads, the latest first.
+func QueryDeliveriesHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get Deliveries handler.")
+	defer logger.Info("End get Deliveries handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	hook := queryOwnWebhook(w, db, username, params)
+	if hook == nil {
+		return
+	}
+
+	offset, size := api.OptionalOffsetAndSize(r, 30, 1, 100)
+	count, deliveries, err := models.QueryDeliveries(db, hook.WebhookId, offset, size)
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDeliveries, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, api.NewQueryListResult(count, deliveries))
+}
+
+// QueryDeliveryHandler gets a delivery of the webhook with its payload.
+func QueryDeliveryHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: GET %v.", r.URL)
+
+	logger.Info("Begin get Delivery handler.")
+	defer logger.Info("End get Delivery handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	deliveryId, err := strconv.ParseInt(params.ByName("deliveryid"), 10, 64)
+	if err != nil || deliveryId <= 0 {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "deliveryid"), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	hook := queryOwnWebhook(w, db, username, params)
+	if hook == nil {
+		return
+	}
+
+	delivery, err := models.QueryDelivery(db, hook.WebhookId, deliveryId)
+	if err == models.ErrDeliveryNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeDeliveryNotFound), nil)
+		return
+	} else if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeQueryDeliveries, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, delivery)
+}
+
+// RedeliverHandler sends the event of a delivery again, as a new delivery.
+func RedeliverHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	logger.Info("Request url: POST %v.", r.URL)
+
+	logger.Info("Begin redeliver handler.")
+	defer logger.Info("End redeliver handler.")
+
+	username, err := getDFUserame(r.Header.Get("Authorization"))
+	if err != nil {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeAuthFailed, err.Error()), nil)
+		return
+	}
+
+	deliveryId, err := strconv.ParseInt(params.ByName("deliveryid"), 10, 64)
+	if err != nil || deliveryId <= 0 {
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeInvalidParameters, "deliveryid"), nil)
+		return
+	}
+
+	db := models.GetDB()
+	if db == nil {
+		logger.Warn("Get db is nil.")
+		api.JsonResult(w, http.StatusInternalServerError, api.GetError(api.ErrorCodeDbNotInitlized), nil)
+		return
+	}
+
+	hook := queryOwnWebhook(w, db, username, params)
+	if hook == nil {
+		return
+	}
+
+	newId, err := models.Redeliver(db, hook.WebhookId, deliveryId)
+	if err == models.ErrDeliveryNotFound {
+		api.JsonResult(w, http.StatusNotFound, api.GetError(api.ErrorCodeDeliveryNotFound), nil)
+		return
+	} else if err != nil {
+		logger.Error("Redeliver err: %v", err)
+		api.JsonResult(w, http.StatusBadRequest, api.GetError2(api.ErrorCodeRedeliver, err.Error()), nil)
+		return
+	}
+
+	api.JsonResult(w, http.StatusOK, nil, struct {
+		DeliveryId int64 `json:"deliveryId"`
+	}{newId})
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/api"
 	"github.com/asiainfoLDP/datafoundry_data_integration/log"
 	"github.com/asiainfoLDP/datafoundry_data_integration/models"
 	"github.com/asiainfoLDP/datafoundry_data_integration/router"
 	"github.com/asiainfoLDP/datahub_commons/httputil"
 	"net/http"
+	"os"
 	"time"
 )
 
@@ -33,18 +35,38 @@ func newService(httpPort int) *Service {
 
 func main() {
 
+	if code, ok := runCommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
 	//new a router
 	router.NewRouter(initRouter)
 
 	//todo init db
 	models.InitDB()
 
+	// the alarms are held until kafka is connected.
+	go api.InitMQ()
+
+	if err := api.StartAlarmRules(os.Getenv("ALARM_RULES_FILE")); err != nil {
+		logger.Error("Start alarm rules err: %v", err)
+	}
+
 	service := newService(SERVERPORT)
 	address := fmt.Sprintf(":%d", service.httpPort)
 	logger.Debug("address: %v", address)
 
 	logger.Info("Listening http at: %s", address)
-	err := http.ListenAndServe(address, httputil.TimeoutHandler(initRouter, 35000*time.Millisecond, ""))
+	timeoutHandler := httputil.TimeoutHandler(initRouter, 35000*time.Millisecond, "")
+	err := http.ListenAndServe(address, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the timeout of the whole request can't be disabled, and its
+		// writer can't flush, so the streams bypass it.
+		if router.StreamPaths[r.URL.Path] {
+			initRouter.ServeHTTP(w, r)
+			return
+		}
+		timeoutHandler.ServeHTTP(w, r)
+	}))
 	if err != nil {
 		logger.Error("http listen and server err: %v", err)
 		return
@@ -52,7 +74,3 @@ func main() {
 
 	return
 }
-
-func init() {
-	//api.InitMQ()
-}
@@ -0,0 +1,725 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ArchiveFormat  = "datafoundry-catalog-archive"
+	ArchiveVersion = 1
+
+	// the conflict policies of RestoreArchive.
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+
+	EntityClass = "class"
+	EntityStat  = "stat"
+)
+
+// Archive is a portable snapshot of the whole catalog, including the deleted
+// repositories and dataitems. The ids are not kept except the class ids,
+// which are only the references of the repositories and the child classes
+// in the archive. There are no ACLs in the catalog: the
+// permissions follow the createUser of the repositories, which is kept.
+type Archive struct {
+	Format       string          `json:"format"`
+	Version      int             `json:"version"`
+	DbVersion    int             `json:"dbVersion"` // the database version of the exporter
+	ExportedAt   *time.Time      `json:"exportedAt,omitempty"`
+	Classes      []*Class        `json:"classes"`
+	Repositories []*ArchivedRepo `json:"repositories"`
+	Stats        []*ArchivedStat `json:"stats"`
+}
+
+type ArchivedRepo struct {
+	*Repository
+	Items []*ArchivedItem `json:"items"`
+}
+
+// ArchivedItem is a dataitem with its attributes and schema versions.
+type ArchivedItem struct {
+	*Dataitem
+	Attrs    []*Attribute     `json:"attrs"`
+	Versions []*SchemaVersion `json:"versions"`
+}
+
+type ArchivedStat struct {
+	Key   string `json:"key"`
+	Value int    `json:"value"`
+}
+
+type RestoreReport struct {
+	DryRun      bool            `json:"dryRun"`
+	Policy      string          `json:"policy"`
+	Created     []*EntityChange `json:"created"`
+	Overwritten []*EntityChange `json:"overwritten"`
+	Skipped     []*EntityChange `json:"skipped"`
+}
+
+// ArchiveConflictError is returned by RestoreArchive with the fail policy
+// if an entity in the archive exists.
+type ArchiveConflictError struct {
+	Kind string
+	Name string
+}
+
+func (e *ArchiveConflictError) Error() string {
+	return fmt.Sprintf("%s %s exists", e.Kind, e.Name)
+}
+
+func ValidateConflictPolicy(policy string) bool {
+	switch policy {
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+		return true
+	}
+	return false
+}
+
+// isDbStatKey reports whether the stat is the version or phase of the
+// database, which belongs to the database instead of the catalog.
+func isDbStatKey(key string) bool {
+	return strings.HasSuffix(key, "#version") || strings.HasSuffix(key, "#phase")
+}
+
+// ExportArchive snapshots the catalog in a transaction.
+func ExportArchive(db *sql.DB) (*Archive, error) {
+	logger.Info("Model begin export archive")
+	defer logger.Info("Model end export archive")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	archive := &Archive{
+		Format:     ArchiveFormat,
+		Version:    ArchiveVersion,
+		DbVersion:  LatestDbVersion(),
+		ExportedAt: &now,
+	}
+
+	if archive.Classes, err = QueryClassList(tx); err != nil {
+		return nil, err
+	}
+	if archive.Repositories, err = exportRepos(tx); err != nil {
+		return nil, err
+	}
+	if archive.Stats, err = exportStats(tx); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func exportRepos(tx DbOrTx) ([]*ArchivedRepo, error) {
+	rows, err := tx.Query(`SELECT REPO_ID, REPO_NAME, CH_REPO_NAME, CLASS, CLASS_ID, LABEL, CREATE_USER,
+		DESCRIPTION, CREATE_TIME, UPDATE_TIME, STATUS, IMAGE_URL, MANAGED_BY, ORIGIN, ORIGIN_URL
+		FROM DF_REPOSITORY
+		ORDER BY REPO_ID`)
+	if err != nil {
+		return nil, err
+	}
+	repos := make([]*ArchivedRepo, 0, 32)
+	index := make(map[string]*ArchivedRepo)
+	for rows.Next() {
+		repo := &Repository{}
+		err := rows.Scan(&repo.RepoId, &repo.RepoName, &repo.ChRepoName, &repo.Class, &repo.ClassId, &repo.Label,
+			&repo.CreateUser, &repo.Description, &repo.CreateTime, &repo.UpdateTime, &repo.Status, &repo.ImageUrl,
+			&repo.ManagedBy, &repo.Origin, &repo.OriginUrl)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		archived := &ArchivedRepo{Repository: repo, Items: []*ArchivedItem{}}
+		repos = append(repos, archived)
+		index[repo.RepoName] = archived
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	repoTags, err := queryAllTags(tx, "DF_REPO_TAG", "REPO_ID")
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		repo.Tags = repoTags[repo.RepoId]
+		repo.RepoId = 0
+	}
+
+	items, err := exportItems(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if repo, ok := index[item.RepoName]; ok {
+			repo.Items = append(repo.Items, item)
+		}
+	}
+	return repos, nil
+}
+
+func exportItems(tx DbOrTx) ([]*ArchivedItem, error) {
+	rows, err := tx.Query(`SELECT ITEM_ID, ITEM_NAME, REPO_NAME, URL, CREATE_TIME, UPDATE_TIME, STATUS,
+		SIMPLE, SCHEMA_VERSION, COMPAT_MODE
+		FROM DF_DATAITEM
+		ORDER BY ITEM_ID`)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*ArchivedItem, 0, 32)
+	index := make(map[int]*ArchivedItem)
+	for rows.Next() {
+		item := &Dataitem{}
+		err := rows.Scan(&item.ItemId, &item.ItemName, &item.RepoName, &item.Url, &item.CreateTime,
+			&item.UpdateTime, &item.Status, &item.Simple, &item.SchemaVersion, &item.CompatMode)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		archived := &ArchivedItem{Dataitem: item, Attrs: []*Attribute{}, Versions: []*SchemaVersion{}}
+		items = append(items, archived)
+		index[item.ItemId] = archived
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	itemTags, err := queryAllTags(tx, "DF_ITEM_TAG", "ITEM_ID")
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := queryAttrs(tx, "", "ORDER BY ITEM_ID, ORDER_ID")
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range attrs {
+		if item, ok := index[attr.ItemId]; ok {
+			attr.AttrId, attr.ItemId = 0, 0
+			item.Attrs = append(item.Attrs, attr)
+		}
+	}
+
+	versionRows, err := tx.Query(`SELECT ITEM_ID, VERSION, AUTHOR, CREATE_TIME, ATTRS
+		FROM DF_SCHEMA_VERSION
+		ORDER BY ITEM_ID, VERSION`)
+	if err != nil {
+		return nil, err
+	}
+	defer versionRows.Close()
+	for versionRows.Next() {
+		v := &SchemaVersion{}
+		data := ""
+		if err := versionRows.Scan(&v.ItemId, &v.Version, &v.Author, &v.CreateTime, &data); err != nil {
+			return nil, err
+		}
+		v.Attrs = []*Attribute{}
+		if err := json.Unmarshal([]byte(data), &v.Attrs); err != nil {
+			return nil, err
+		}
+		if item, ok := index[v.ItemId]; ok {
+			v.ItemId = 0
+			item.Versions = append(item.Versions, v)
+		}
+	}
+	if err := versionRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		item.Tags = itemTags[item.ItemId]
+		item.ItemId = 0
+	}
+	return items, nil
+}
+
+// queryAllTags returns the tags of the whole table, keyed by id.
+func queryAllTags(tx DbOrTx, table, idColumn string) (map[int][]string, error) {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT X.%s, T.TAG_NAME FROM %s X
+		JOIN DF_TAG T ON T.TAG_ID=X.TAG_ID
+		ORDER BY X.CREATE_TIME, T.TAG_NAME`, idColumn, table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[int][]string)
+	for rows.Next() {
+		id, tag := 0, ""
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	return tags, rows.Err()
+}
+
+func exportStats(tx DbOrTx) ([]*ArchivedStat, error) {
+	rows, err := tx.Query(`SELECT STAT_KEY, STAT_VALUE FROM DF_ITEM_STAT ORDER BY STAT_KEY`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]*ArchivedStat, 0, 32)
+	for rows.Next() {
+		stat := &ArchivedStat{}
+		if err := rows.Scan(&stat.Key, &stat.Value); err != nil {
+			return nil, err
+		}
+		if !isDbStatKey(stat.Key) {
+			stats = append(stats, stat)
+		}
+	}
+	return stats, rows.Err()
+}
+
+// ValidateArchive checks the format, the names and the references of the
+// archive. The attributes are not type checked, since the older versions of
+// the catalog accepted any example.
+func ValidateArchive(archive *Archive) error {
+	if archive.Format != ArchiveFormat {
+		return fmt.Errorf("unknown format %q", archive.Format)
+	}
+	if archive.Version < 1 || archive.Version > ArchiveVersion {
+		return fmt.Errorf("unsupported archive version %d", archive.Version)
+	}
+	if archive.DbVersion > LatestDbVersion() {
+		return fmt.Errorf("the archive is exported from a newer database version %d", archive.DbVersion)
+	}
+
+	classIds := make(map[int]bool, len(archive.Classes))
+	for i, class := range archive.Classes {
+		if class == nil || class.ClassId <= 0 || classIds[class.ClassId] {
+			return fmt.Errorf("classes[%d]: invalid or duplicated id", i)
+		}
+		classIds[class.ClassId] = true
+		names, err := ValidateClassNames(class.Names)
+		if err != nil {
+			return fmt.Errorf("classes[%d]: %s", i, err.Error())
+		}
+		class.Names = names
+	}
+	for i, class := range archive.Classes {
+		if class.ParentId != 0 && !classIds[class.ParentId] {
+			return fmt.Errorf("classes[%d]: parent %d not found", i, class.ParentId)
+		}
+		// the classes are restored by their name paths.
+		if err := checkClassPlacement(archive.Classes, class.ClassId, class.ParentId, class.Names); err != nil {
+			return fmt.Errorf("classes[%d]: %s", i, err.Error())
+		}
+	}
+
+	repoNames := make(map[string]bool, len(archive.Repositories))
+	for i, repo := range archive.Repositories {
+		if repo == nil || repo.Repository == nil {
+			return fmt.Errorf("repositories[%d]: empty", i)
+		}
+		name, ok := ValidateRepoName(repo.RepoName, repo.Origin)
+		if !ok || repoNames[name] {
+			return fmt.Errorf("repositories[%d]: invalid or duplicated name %q", i, repo.RepoName)
+		}
+		repoNames[name] = true
+		repo.RepoName = name
+		if repo.ClassId != 0 && !classIds[repo.ClassId] {
+			return fmt.Errorf("%s: class %d not found", name, repo.ClassId)
+		}
+		if repo.Status == "" {
+			repo.Status = "A"
+		}
+
+		itemNames := make(map[string]bool, len(repo.Items))
+		for j, item := range repo.Items {
+			if err := validateArchivedItem(item); err != nil {
+				return fmt.Errorf("%s.items[%d]: %s", name, j, err.Error())
+			}
+			if itemNames[item.ItemName] {
+				return fmt.Errorf("%s.items[%d]: duplicated name %s", name, j, item.ItemName)
+			}
+			itemNames[item.ItemName] = true
+			item.RepoName = name
+		}
+	}
+
+	statKeys := make(map[string]bool, len(archive.Stats))
+	for i, stat := range archive.Stats {
+		if stat == nil || stat.Key == "" || isDbStatKey(stat.Key) || statKeys[stat.Key] {
+			return fmt.Errorf("stats[%d]: invalid or duplicated key", i)
+		}
+		statKeys[stat.Key] = true
+	}
+	return nil
+}
+
+func validateArchivedItem(item *ArchivedItem) error {
+	if item == nil || item.Dataitem == nil {
+		return fmt.Errorf("empty")
+	}
+	name, ok := common.ValidateUrlWord(item.ItemName)
+	if !ok || utf8.RuneCountInString(name) > ItemNameMaxLength {
+		return fmt.Errorf("invalid name %q", item.ItemName)
+	}
+	item.ItemName = name
+	if item.CompatMode, ok = ValidateCompatMode(item.CompatMode); !ok {
+		return fmt.Errorf("invalid compatibility mode %s", item.CompatMode)
+	}
+	if item.Status == "" {
+		item.Status = "A"
+	}
+
+	if err := validateArchivedAttrs(item.Attrs); err != nil {
+		return err
+	}
+	last := 0
+	for _, v := range item.Versions {
+		if v == nil || v.Version <= last {
+			return fmt.Errorf("the versions must be ascending")
+		}
+		last = v.Version
+		if err := validateArchivedAttrs(v.Attrs); err != nil {
+			return fmt.Errorf("version %d: %s", v.Version, err.Error())
+		}
+	}
+	if last > item.SchemaVersion {
+		return fmt.Errorf("version %d is after the schema version %d", last, item.SchemaVersion)
+	}
+	return nil
+}
+
+func validateArchivedAttrs(attrs []*Attribute) error {
+	names := make(map[string]bool, len(attrs))
+	for i, attr := range attrs {
+		if attr == nil || attr.AttrName == "" || utf8.RuneCountInString(attr.AttrName) > AttrNameMaxLength {
+			return fmt.Errorf("attrs[%d]: invalid name", i)
+		}
+		key := attrKey(attr.AttrName)
+		if names[key] {
+			return fmt.Errorf("attrs[%d]: duplicated attribute name %s", i, attr.AttrName)
+		}
+		names[key] = true
+	}
+	return nil
+}
+
+// RestoreArchive loads a validated archive in a transaction. The classes are
+// matched by their name paths, the repositories and the stats by name. The
+// repositories refer to the matched or created classes by their new ids. The policy decides
+// the existing ones: skip them, overwrite them, or fail the whole restore.
+// The dataitems of an overwritten repository are overwritten by name, the
+// ones not in the archive are left alone. The dry run is rolled back at last.
+func RestoreArchive(db *sql.DB, archive *Archive, policy string, dryRun bool) (*RestoreReport, error) {
+	logger.Info("Model begin restore archive")
+	defer logger.Info("Model end restore archive")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RestoreReport{
+		DryRun:      dryRun,
+		Policy:      policy,
+		Created:     []*EntityChange{},
+		Overwritten: []*EntityChange{},
+		Skipped:     []*EntityChange{},
+	}
+	classes, err := restoreClasses(tx, archive.Classes, policy, report)
+	if err == nil {
+		err = restoreRepos(tx, archive.Repositories, classes, policy, report)
+	}
+	if err == nil {
+		err = restoreStats(tx, archive.Stats, policy, report)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if dryRun {
+		return report, tx.Rollback()
+	}
+	return report, tx.Commit()
+}
+
+// resolveConflict reports whether the existing entity is overwritten.
+func resolveConflict(change *EntityChange, policy string, report *RestoreReport) (bool, error) {
+	switch policy {
+	case ConflictOverwrite:
+		report.Overwritten = append(report.Overwritten, change)
+		return true, nil
+	case ConflictSkip:
+		report.Skipped = append(report.Skipped, change)
+		return false, nil
+	}
+	return false, &ArchiveConflictError{change.Kind, change.Name}
+}
+
+// restoreClasses restores the classes, parents first, and returns the
+// restored ones by the archived ids. An archived class matches the existing
+// child of its restored parent with a same name in any locale, which is
+// kept if the class is skipped.
+func restoreClasses(tx DbOrTx, classes []*Class, policy string, report *RestoreReport) (map[int]*Class, error) {
+	if err := lockClasses(tx); err != nil {
+		return nil, err
+	}
+	existing, err := QueryClassList(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := make(map[int]*Class, len(classes))
+	paths := make(map[int]string, len(classes))
+	for _, class := range parentsFirst(classes) {
+		parentId, path := 0, class.Name(ClassLocaleZh)
+		if class.ParentId != 0 {
+			parentId, path = restored[class.ParentId].ClassId, paths[class.ParentId]+"/"+path
+		}
+		paths[class.ClassId] = path
+		change := &EntityChange{Kind: EntityClass, Name: path}
+
+		match := matchClass(existing, parentId, class.Names)
+		if match == nil {
+			result, err := tx.Exec(`INSERT INTO DF_CLASS (PARENT_ID, ORDER_ID, CREATE_TIME, UPDATE_TIME)
+				VALUES (?, ?, ?, ?)`, parentId, class.OrderId, restoredTime(class.CreateTime), class.UpdateTime)
+			if err != nil {
+				return nil, err
+			}
+			classId, err := result.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+			if err := recordClassNames(tx, int(classId), class.Names); err != nil {
+				return nil, err
+			}
+			match = &Class{ClassId: int(classId), ParentId: parentId, Names: class.Names, OrderId: class.OrderId}
+			existing = append(existing, match)
+			restored[class.ClassId] = match
+			report.Created = append(report.Created, change)
+			continue
+		}
+
+		restored[class.ClassId] = match
+		if overwrite, err := resolveConflict(change, policy, report); err != nil {
+			return nil, err
+		} else if !overwrite {
+			continue
+		}
+		// the other names may be taken by the siblings.
+		if err := checkClassPlacement(existing, match.ClassId, parentId, class.Names); err != nil {
+			return nil, fmt.Errorf("class %s: %s", path, err.Error())
+		}
+		_, err := tx.Exec(`UPDATE DF_CLASS SET ORDER_ID=?, CREATE_TIME=?, UPDATE_TIME=? WHERE CLASS_ID=?`,
+			class.OrderId, restoredTime(class.CreateTime), class.UpdateTime, match.ClassId)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`DELETE FROM DF_CLASS_NAME WHERE CLASS_ID=?`, match.ClassId); err != nil {
+			return nil, err
+		}
+		if err := recordClassNames(tx, match.ClassId, class.Names); err != nil {
+			return nil, err
+		}
+		match.Names, match.OrderId = class.Names, class.OrderId
+		if err := updateRepoClass(tx, match.ClassId, match.Name(ClassLocaleZh)); err != nil {
+			return nil, err
+		}
+	}
+	return restored, nil
+}
+
+// parentsFirst orders the classes of a validated archive by their trees.
+func parentsFirst(classes []*Class) []*Class {
+	byId := make(map[int]*Class, len(classes))
+	for _, class := range classes {
+		byId[class.ClassId] = class
+	}
+
+	ordered := make([]*Class, 0, len(classes))
+	var walk func(nodes []*Class)
+	walk = func(nodes []*Class) {
+		for _, node := range nodes {
+			ordered = append(ordered, byId[node.ClassId])
+			walk(node.Children)
+		}
+	}
+	walk(BuildClassTree(classes))
+	return ordered
+}
+
+// matchClass returns the child of the parent with a same name as one of the
+// names in any locale, as the names of the siblings are unique.
+func matchClass(classes []*Class, parentId int, names map[string]string) *Class {
+	for _, class := range classes {
+		if class.ParentId != parentId {
+			continue
+		}
+		for _, className := range class.Names {
+			for _, name := range names {
+				if strings.EqualFold(className, name) {
+					return class
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func restoreRepos(tx DbOrTx, repos []*ArchivedRepo, classes map[int]*Class, policy string,
+	report *RestoreReport) error {
+	for _, repo := range repos {
+		change := &EntityChange{Kind: EntityRepository, Name: repo.RepoName}
+		if class, ok := classes[repo.ClassId]; ok {
+			repo.ClassId, repo.Class = class.ClassId, class.Name(ClassLocaleZh)
+		}
+		repoId, operation := 0, ChangeUpdate
+		err := tx.QueryRow(`SELECT REPO_ID FROM DF_REPOSITORY WHERE REPO_NAME=? FOR UPDATE`,
+			repo.RepoName).Scan(&repoId)
+		if err == sql.ErrNoRows {
+			result, err := tx.Exec(`INSERT INTO DF_REPOSITORY (REPO_NAME, CH_REPO_NAME, CLASS, CLASS_ID, LABEL,
+				CREATE_USER, DESCRIPTION, CREATE_TIME, UPDATE_TIME, STATUS, IMAGE_URL, MANAGED_BY, ORIGIN, ORIGIN_URL)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				repo.RepoName, repo.ChRepoName, repo.Class, repo.ClassId, repo.Label, repo.CreateUser,
+				repo.Description, restoredTime(repo.CreateTime), repo.UpdateTime, repo.Status, repo.ImageUrl,
+				repo.ManagedBy, repo.Origin, repo.OriginUrl)
+			if err != nil {
+				return err
+			}
+			id, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+			repoId, operation = int(id), ChangeCreate
+			report.Created = append(report.Created, change)
+		} else if err != nil {
+			return err
+		} else if overwrite, err := resolveConflict(change, policy, report); err != nil {
+			return err
+		} else if !overwrite {
+			continue
+		} else {
+			_, err := tx.Exec(`UPDATE DF_REPOSITORY SET CH_REPO_NAME=?, CLASS=?, CLASS_ID=?, LABEL=?, CREATE_USER=?,
+				DESCRIPTION=?, CREATE_TIME=?, UPDATE_TIME=?, STATUS=?, IMAGE_URL=?, MANAGED_BY=?, ORIGIN=?, ORIGIN_URL=?
+				WHERE REPO_ID=?`,
+				repo.ChRepoName, repo.Class, repo.ClassId, repo.Label, repo.CreateUser, repo.Description,
+				restoredTime(repo.CreateTime), repo.UpdateTime, repo.Status, repo.ImageUrl, repo.ManagedBy,
+				repo.Origin, repo.OriginUrl, repoId)
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := replaceTags(tx, "DF_REPO_TAG", "REPO_ID", repoId, repo.Tags); err != nil {
+			return err
+		}
+		if err := recordRepoChange(tx, repoId, operation); err != nil {
+			return err
+		}
+		for _, item := range repo.Items {
+			if err := restoreItem(tx, item, report); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreItem creates or overwrites the dataitem of a restored repository.
+func restoreItem(tx DbOrTx, item *ArchivedItem, report *RestoreReport) error {
+	change := &EntityChange{Kind: EntityDataitem, Name: item.RepoName + "/" + item.ItemName,
+		SchemaVersion: item.SchemaVersion}
+	itemId, operation := 0, ChangeUpdate
+	err := tx.QueryRow(`SELECT ITEM_ID FROM DF_DATAITEM WHERE REPO_NAME=? AND ITEM_NAME=? FOR UPDATE`,
+		item.RepoName, item.ItemName).Scan(&itemId)
+	if err == sql.ErrNoRows {
+		result, err := tx.Exec(`INSERT INTO DF_DATAITEM (ITEM_NAME, REPO_NAME, URL, CREATE_TIME, UPDATE_TIME,
+			STATUS, SIMPLE, SCHEMA_VERSION, COMPAT_MODE)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			item.ItemName, item.RepoName, item.Url, restoredTime(item.CreateTime), item.UpdateTime,
+			item.Status, item.Simple, item.SchemaVersion, item.CompatMode)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		itemId, operation = int(id), ChangeCreate
+		report.Created = append(report.Created, change)
+	} else if err != nil {
+		return err
+	} else {
+		_, err := tx.Exec(`UPDATE DF_DATAITEM SET URL=?, CREATE_TIME=?, UPDATE_TIME=?, STATUS=?, SIMPLE=?,
+			SCHEMA_VERSION=?, COMPAT_MODE=? WHERE ITEM_ID=?`,
+			item.Url, restoredTime(item.CreateTime), item.UpdateTime, item.Status, item.Simple,
+			item.SchemaVersion, item.CompatMode, itemId)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM DF_SCHEMA_VERSION WHERE ITEM_ID=?`, itemId); err != nil {
+			return err
+		}
+		report.Overwritten = append(report.Overwritten, change)
+	}
+
+	if _, err := replaceTags(tx, "DF_ITEM_TAG", "ITEM_ID", itemId, item.Tags); err != nil {
+		return err
+	}
+	if err := replaceAttrs(tx, itemId, item.Attrs); err != nil {
+		return err
+	}
+	for _, v := range item.Versions {
+		data, err := json.Marshal(snapshotAttrs(v.Attrs))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO DF_SCHEMA_VERSION (ITEM_ID, VERSION, AUTHOR, ATTRS, CREATE_TIME)
+			VALUES (?, ?, ?, ?, ?)`, itemId, v.Version, v.Author, string(data), restoredTime(v.CreateTime))
+		if err != nil {
+			return err
+		}
+	}
+	return recordItemChange(tx, itemId, operation)
+}
+
+func restoreStats(tx DbOrTx, stats []*ArchivedStat, policy string, report *RestoreReport) error {
+	for _, stat := range stats {
+		change := &EntityChange{Kind: EntityStat, Name: stat.Key}
+		count := 0
+		err := tx.QueryRow(`SELECT COUNT(*) FROM DF_ITEM_STAT WHERE STAT_KEY=? FOR UPDATE`, stat.Key).Scan(&count)
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			report.Created = append(report.Created, change)
+		} else if overwrite, err := resolveConflict(change, policy, report); err != nil {
+			return err
+		} else if !overwrite {
+			continue
+		}
+		_, err = tx.Exec(`INSERT INTO DF_ITEM_STAT (STAT_KEY, STAT_VALUE) VALUES (?, ?)
+			ON DUPLICATE KEY UPDATE STAT_VALUE=?`, stat.Key, stat.Value, stat.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoredTime is the time, or now if it's not archived.
+func restoredTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Now()
+	}
+	return *t
+}
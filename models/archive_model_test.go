@@ -0,0 +1,129 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testArchive = `{
+  "format": "datafoundry-catalog-archive",
+  "version": 1,
+  "dbVersion": 6,
+  "classes": [
+    {"classId": 1, "parentId": 0, "names": {"zh": "金融"}, "orderId": 1},
+    {"classId": 4, "parentId": 1, "names": {"zh": "银行", "en": "Banks"}, "orderId": 2}
+  ],
+  "repositories": [
+    {
+      "repoName": " retail ",
+      "chRepoName": "零售",
+      "classId": 4,
+      "createUser": "alice",
+      "tags": ["sales"],
+      "items": [
+        {
+          "itemName": "orders",
+          "schemaVersion": 2,
+          "compatMode": "Backward",
+          "attrs": [{"attrName": "id", "dataType": "int", "example": "abc"}],
+          "versions": [
+            {"version": 1, "author": "alice", "attrs": []},
+            {"version": 2, "author": "bob", "attrs": [{"attrName": "id"}]}
+          ]
+        }
+      ]
+    }
+  ],
+  "stats": [{"key": "retail/orders#stars", "value": 3}]
+}`
+
+func parseTestArchive(t *testing.T) *Archive {
+	archive := &Archive{}
+	if err := json.Unmarshal([]byte(testArchive), archive); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestValidateArchive(t *testing.T) {
+	archive := parseTestArchive(t)
+	if err := ValidateArchive(archive); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := archive.Repositories[0]
+	if repo.RepoName != "retail" || repo.Status != "A" || repo.CreateUser != "alice" {
+		t.Errorf("repo %+v", repo.Repository)
+	}
+	// the example of an archived attribute is not type checked.
+	item := repo.Items[0]
+	if item.RepoName != "retail" || item.CompatMode != CompatBackward || item.Attrs[0].Example != "abc" {
+		t.Errorf("item %+v", item.Dataitem)
+	}
+	if !item.Attrs[0].Nullable {
+		t.Errorf("the attribute is not nullable by default")
+	}
+
+	cases := []struct {
+		modify func(*Archive)
+		err    string
+	}{
+		{func(a *Archive) { a.Format = "mysqldump" }, "unknown format"},
+		{func(a *Archive) { a.Version = ArchiveVersion + 1 }, "unsupported archive version"},
+		{func(a *Archive) { a.DbVersion = LatestDbVersion() + 1 }, "newer database version"},
+		{func(a *Archive) { a.Classes[1].ClassId = 1 }, "classes[1]: invalid or duplicated id"},
+		{func(a *Archive) { a.Classes[0].ParentId = 9 }, "classes[0]: parent 9 not found"},
+		{func(a *Archive) { a.Classes[0].ParentId = 4 }, "classes[0]: " + ErrClassCycle.Error()},
+		{func(a *Archive) { a.Classes[1].ParentId, a.Classes[1].Names = 0, map[string]string{"en": "金融"} },
+			"classes[0]: " + ErrClassNameExists.Error()},
+		{func(a *Archive) { a.Repositories[0].ClassId = 9 }, "retail: class 9 not found"},
+		{func(a *Archive) { a.Repositories = append(a.Repositories, a.Repositories[0]) }, "repositories[1]"},
+		{func(a *Archive) { a.Repositories[0].Items[0].CompatMode = "sideways" }, "invalid compatibility mode"},
+		{func(a *Archive) { a.Repositories[0].Items[0].SchemaVersion = 1 }, "after the schema version"},
+		{func(a *Archive) { a.Repositories[0].Items[0].Versions[1].Version = 1 }, "ascending"},
+		{func(a *Archive) { a.Stats[0].Key = "integration#version" }, "stats[0]"},
+	}
+	for _, c := range cases {
+		archive := parseTestArchive(t)
+		c.modify(archive)
+		if err := ValidateArchive(archive); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expect %q, got %v", c.err, err)
+		}
+	}
+}
+
+func TestRestoredClasses(t *testing.T) {
+	archive := parseTestArchive(t)
+	archive.Classes[0], archive.Classes[1] = archive.Classes[1], archive.Classes[0]
+	if ordered := parentsFirst(archive.Classes); ordered[0].ClassId != 1 || ordered[1].ClassId != 4 {
+		t.Errorf("expect the parent first, got %d, %d", ordered[0].ClassId, ordered[1].ClassId)
+	}
+
+	// the existing classes have other ids.
+	existing := []*Class{
+		{ClassId: 7, ParentId: 0, Names: map[string]string{"en": "Finance", "zh": "金融"}},
+		{ClassId: 8, ParentId: 7, Names: map[string]string{"en": "banks"}},
+		{ClassId: 9, ParentId: 0, Names: map[string]string{"en": "Banks"}},
+	}
+	if class := matchClass(existing, 0, map[string]string{"zh": "金融"}); class == nil || class.ClassId != 7 {
+		t.Errorf("expect class 7 matched, got %v", class)
+	}
+	if class := matchClass(existing, 7, map[string]string{"zh": "银行", "en": "Banks"}); class == nil || class.ClassId != 8 {
+		t.Errorf("expect class 8 matched, got %v", class)
+	}
+	if class := matchClass(existing, 7, map[string]string{"zh": "保险"}); class != nil {
+		t.Errorf("expect no class matched, got %v", class)
+	}
+}
+
+func TestValidateConflictPolicy(t *testing.T) {
+	for _, policy := range []string{ConflictSkip, ConflictOverwrite, ConflictFail} {
+		if !ValidateConflictPolicy(policy) {
+			t.Errorf("%s is invalid", policy)
+		}
+	}
+	if ValidateConflictPolicy("merge") {
+		t.Errorf("merge is valid")
+	}
+}
@@ -0,0 +1,306 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// the data types of the attributes
+const (
+	DataTypeString   = "string"
+	DataTypeInt      = "int"
+	DataTypeDecimal  = "decimal"
+	DataTypeDate     = "date"
+	DataTypeTime     = "time"
+	DataTypeDatetime = "datetime"
+	DataTypeBoolean  = "boolean"
+	DataTypeEnum     = "enum"
+	DataTypeArray    = "array"
+
+	DecimalMaxPrecision  = 65
+	AttrNameMaxLength    = 128
+	ExampleMaxLength     = 512
+	InstructionMaxLength = 128
+	UnitMaxLength        = 32
+	EnumValuesMaxLength  = 2048
+)
+
+var (
+	scalarDataTypes = map[string]bool{
+		DataTypeString:   true,
+		DataTypeInt:      true,
+		DataTypeDecimal:  true,
+		DataTypeDate:     true,
+		DataTypeTime:     true,
+		DataTypeDatetime: true,
+		DataTypeBoolean:  true,
+	}
+
+	decimalValidator = regexp.MustCompile(`^[+-]?([0-9]*)(\.([0-9]*))?$`)
+
+	datetimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+)
+
+// UnmarshalJSON makes the attributes nullable unless "nullable": false is given.
+func (attr *Attribute) UnmarshalJSON(data []byte) error {
+	type plainAttribute Attribute
+	plain := plainAttribute{Nullable: true}
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return err
+	}
+	*attr = Attribute(plain)
+	return nil
+}
+
+// TypeString returns the declared type, such as "decimal(10,2)" or "array<int>".
+func (attr *Attribute) TypeString() string {
+	switch attr.DataType {
+	case DataTypeDecimal:
+		if attr.Precision > 0 {
+			return fmt.Sprintf("decimal(%d,%d)", attr.Precision, attr.Scale)
+		}
+	case DataTypeArray:
+		return fmt.Sprintf("array<%s>", attr.ElementType)
+	case DataTypeString:
+		if attr.MaxLength > 0 {
+			return fmt.Sprintf("string(%d)", attr.MaxLength)
+		}
+	}
+	return attr.DataType
+}
+
+// ValidateAttrs normalizes and validates an attribute set. The order ids
+// are assigned by the positions if they are not specified.
+func ValidateAttrs(attrs []*Attribute) error {
+	names := make(map[string]bool, len(attrs))
+	for i, attr := range attrs {
+		if err := ValidateAttribute(attr); err != nil {
+			return fmt.Errorf("attrs[%d] (%s): %s", i, attr.AttrName, err.Error())
+		}
+
+		key := attrKey(attr.AttrName)
+		if names[key] {
+			return fmt.Errorf("attrs[%d]: duplicated attribute name %s", i, attr.AttrName)
+		}
+		names[key] = true
+
+		if attr.OrderId == 0 {
+			attr.OrderId = i + 1
+		}
+	}
+	return nil
+}
+
+// AttrFieldError is an invalid field of an attribute, named as in json.
+type AttrFieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *AttrFieldError) Error() string {
+	return e.Message
+}
+
+func attrFieldError(field, format string, args ...interface{}) error {
+	return &AttrFieldError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// attrKey is the key of the attribute names, which are case-insensitive.
+func attrKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// ValidateAttribute normalizes the attribute type and checks that the
+// example conforms to it.
+func ValidateAttribute(attr *Attribute) error {
+	attr.AttrName = strings.TrimSpace(attr.AttrName)
+	if attr.AttrName == "" || utf8.RuneCountInString(attr.AttrName) > AttrNameMaxLength {
+		return attrFieldError("attrName", "attribute name must be 1-%d characters", AttrNameMaxLength)
+	}
+	if utf8.RuneCountInString(attr.Example) > ExampleMaxLength {
+		return attrFieldError("example", "example is longer than %d characters", ExampleMaxLength)
+	}
+	if utf8.RuneCountInString(attr.Instruction) > InstructionMaxLength {
+		return attrFieldError("instruction", "instruction is longer than %d characters", InstructionMaxLength)
+	}
+	if utf8.RuneCountInString(attr.Unit) > UnitMaxLength {
+		return attrFieldError("unit", "unit is longer than %d characters", UnitMaxLength)
+	}
+
+	attr.DataType = strings.ToLower(strings.TrimSpace(attr.DataType))
+	if attr.DataType == "" {
+		attr.DataType = DataTypeString
+	}
+	attr.ElementType = strings.ToLower(strings.TrimSpace(attr.ElementType))
+
+	switch attr.DataType {
+	case DataTypeDecimal:
+		if attr.Precision < 0 || attr.Precision > DecimalMaxPrecision {
+			return attrFieldError("precision", "decimal precision must be in [0, %d]", DecimalMaxPrecision)
+		}
+		if attr.Scale < 0 || (attr.Precision > 0 && attr.Scale > attr.Precision) ||
+			(attr.Precision == 0 && attr.Scale > 0) {
+			return attrFieldError("scale", "decimal scale must be in [0, precision]")
+		}
+	case DataTypeEnum:
+		if len(attr.EnumValues) == 0 {
+			return attrFieldError("enumValues", "enum values are needed")
+		}
+		seen := make(map[string]bool, len(attr.EnumValues))
+		for _, v := range attr.EnumValues {
+			if seen[v] {
+				return attrFieldError("enumValues", "duplicated enum value: %s", v)
+			}
+			seen[v] = true
+		}
+		if data, _ := json.Marshal(attr.EnumValues); len(data) > EnumValuesMaxLength {
+			return attrFieldError("enumValues", "enum values are too long")
+		}
+	case DataTypeArray:
+		if !scalarDataTypes[attr.ElementType] {
+			return attrFieldError("elementType", "invalid array element type: %s", attr.ElementType)
+		}
+	default:
+		if !scalarDataTypes[attr.DataType] {
+			return attrFieldError("dataType", "invalid data type: %s", attr.DataType)
+		}
+	}
+
+	if attr.DataType != DataTypeDecimal && attr.Precision != 0 {
+		return attrFieldError("precision", "precision and scale are only for decimal")
+	}
+	if attr.DataType != DataTypeDecimal && attr.Scale != 0 {
+		return attrFieldError("scale", "precision and scale are only for decimal")
+	}
+	if attr.DataType != DataTypeEnum && len(attr.EnumValues) > 0 {
+		return attrFieldError("enumValues", "enum values are only for enum")
+	}
+	if attr.DataType != DataTypeArray && attr.ElementType != "" {
+		return attrFieldError("elementType", "element type is only for array")
+	}
+	if attr.MaxLength < 0 {
+		return attrFieldError("maxLength", "max length can't be negative")
+	}
+	if attr.MaxLength > 0 && attr.DataType != DataTypeString {
+		return attrFieldError("maxLength", "max length is only for string")
+	}
+	if attr.PrimaryKey && attr.Nullable {
+		return attrFieldError("nullable", "primary key attribute can't be nullable")
+	}
+
+	if attr.Example != "" {
+		if err := ValidateAttrValue(attr, attr.Example); err != nil {
+			return attrFieldError("example", "example %q: %s", attr.Example, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// ValidateAttrValue checks whether the value conforms to the attribute type.
+func ValidateAttrValue(attr *Attribute, value string) error {
+	switch attr.DataType {
+	case DataTypeEnum:
+		for _, v := range attr.EnumValues {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("not one of the enum values")
+	case DataTypeArray:
+		return validateArrayValue(attr.ElementType, value)
+	case DataTypeString:
+		if attr.MaxLength > 0 && utf8.RuneCountInString(value) > attr.MaxLength {
+			return fmt.Errorf("longer than %d characters", attr.MaxLength)
+		}
+		return nil
+	case DataTypeDecimal:
+		return validateDecimal(value, attr.Precision, attr.Scale)
+	}
+
+	return validateScalarValue(attr.DataType, value)
+}
+
+func validateScalarValue(dataType, value string) error {
+	var err error
+	switch dataType {
+	case DataTypeString:
+	case DataTypeInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case DataTypeDecimal:
+		err = validateDecimal(value, 0, 0)
+	case DataTypeBoolean:
+		_, err = strconv.ParseBool(value)
+	case DataTypeDate:
+		_, err = time.Parse("2006-01-02", value)
+	case DataTypeTime:
+		if _, err = time.Parse("15:04:05", value); err != nil {
+			_, err = time.Parse("15:04", value)
+		}
+	case DataTypeDatetime:
+		for _, layout := range datetimeLayouts {
+			if _, err = time.Parse(layout, value); err == nil {
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("unknown data type %s", dataType)
+	}
+
+	if err != nil {
+		return fmt.Errorf("not a valid %s", dataType)
+	}
+	return nil
+}
+
+// validateDecimal checks the digits if precision > 0.
+func validateDecimal(value string, precision, scale int) error {
+	m := decimalValidator.FindStringSubmatch(value)
+	if m == nil || m[1]+m[3] == "" {
+		return fmt.Errorf("not a valid decimal")
+	}
+	if precision > 0 {
+		intDigits := len(strings.TrimLeft(m[1], "0"))
+		if intDigits > precision-scale || len(m[3]) > scale {
+			return fmt.Errorf("doesn't fit decimal(%d,%d)", precision, scale)
+		}
+	}
+	return nil
+}
+
+// array values are json arrays, such as [1, 2, 3] or ["a", "b"].
+func validateArrayValue(elementType, value string) error {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.UseNumber()
+
+	var elements []interface{}
+	if err := decoder.Decode(&elements); err != nil {
+		return fmt.Errorf("not a json array")
+	}
+
+	for i, element := range elements {
+		s := ""
+		switch v := element.(type) {
+		case string:
+			s = v
+		case json.Number:
+			s = v.String()
+		case bool:
+			s = strconv.FormatBool(v)
+		case nil:
+			continue
+		default:
+			return fmt.Errorf("element %d is not a %s", i, elementType)
+		}
+		if err := validateScalarValue(elementType, s); err != nil {
+			return fmt.Errorf("element %d: %s", i, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAttributeNullableByDefault(t *testing.T) {
+	attrs := []*Attribute{}
+	err := json.Unmarshal([]byte(`[{"attrName": "a"}, {"attrName": "b", "nullable": false}]`), &attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !attrs[0].Nullable || attrs[1].Nullable {
+		t.Errorf("nullable: %v, %v", attrs[0].Nullable, attrs[1].Nullable)
+	}
+}
+
+func _testValidateAttribute(t *testing.T, attr *Attribute, expectedOk bool) {
+	err := ValidateAttribute(attr)
+	if (err == nil) != expectedOk {
+		t.Errorf("ValidateAttribute (%#v) => %v, expected ok: %t", attr, err, expectedOk)
+	}
+}
+
+func TestValidateAttribute(t *testing.T) {
+	_testValidateAttribute(t, &Attribute{AttrName: "name", Example: "anything", Nullable: true}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: " ", Nullable: true}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "x", DataType: "float", Nullable: true}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "x", Instruction: strings.Repeat("说", InstructionMaxLength), Unit: strings.Repeat("元", UnitMaxLength), Nullable: true}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "x", Instruction: strings.Repeat("a", InstructionMaxLength+1), Nullable: true}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "x", Unit: strings.Repeat("a", UnitMaxLength+1), Nullable: true}, false)
+
+	_testValidateAttribute(t, &Attribute{AttrName: "id", DataType: "INT", Example: "123", PrimaryKey: true}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "id", DataType: "int", Example: "12.3"}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "id", DataType: "int", PrimaryKey: true, Nullable: true}, false)
+
+	_testValidateAttribute(t, &Attribute{AttrName: "price", DataType: "decimal", Precision: 5, Scale: 2, Example: "123.45"}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "price", DataType: "decimal", Precision: 5, Scale: 2, Example: "1234.5"}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "price", DataType: "decimal", Precision: 5, Scale: 2, Example: "1.234"}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "price", DataType: "decimal", Precision: 2, Scale: 3}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "price", DataType: "decimal", Example: "-0.5"}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "price", DataType: "int", Precision: 5}, false)
+
+	_testValidateAttribute(t, &Attribute{AttrName: "d", DataType: "date", Example: "2016-09-01"}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "d", DataType: "date", Example: "2016/09/01"}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "t", DataType: "time", Example: "10:30:00"}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "dt", DataType: "datetime", Example: "2016-09-01 10:30:00"}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "dt", DataType: "datetime", Example: "2016-09-01T10:30:00+08:00"}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "b", DataType: "boolean", Example: "true"}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "b", DataType: "boolean", Example: "yes"}, false)
+
+	_testValidateAttribute(t, &Attribute{AttrName: "e", DataType: "enum", EnumValues: []string{"M", "F"}, Example: "F"}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "e", DataType: "enum", EnumValues: []string{"M", "F"}, Example: "X"}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "e", DataType: "enum"}, false)
+
+	_testValidateAttribute(t, &Attribute{AttrName: "a", DataType: "array", ElementType: "int", Example: "[1, 2, 3]"}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "a", DataType: "array", ElementType: "int", Example: "[1, \"x\"]"}, false)
+	_testValidateAttribute(t, &Attribute{AttrName: "a", DataType: "array", ElementType: "array"}, false)
+
+	_testValidateAttribute(t, &Attribute{AttrName: "s", MaxLength: 3, Example: "中文字", Nullable: true}, true)
+	_testValidateAttribute(t, &Attribute{AttrName: "s", MaxLength: 3, Example: "abcd", Nullable: true}, false)
+}
+
+func TestValidateAttrs(t *testing.T) {
+	attrs := []*Attribute{{AttrName: "a"}, {AttrName: "b", OrderId: 9}}
+	if err := ValidateAttrs(attrs); err != nil {
+		t.Fatal(err)
+	}
+	if attrs[0].OrderId != 1 || attrs[1].OrderId != 9 || attrs[0].DataType != DataTypeString {
+		t.Errorf("attrs: %#v, %#v", attrs[0], attrs[1])
+	}
+
+	if err := ValidateAttrs([]*Attribute{{AttrName: "a"}, {AttrName: "A"}}); err == nil {
+		t.Errorf("duplicated names are accepted")
+	}
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const BatchGetMaxItems = 100
+
+type ItemKey struct {
+	RepoName string `json:"repoName"`
+	ItemName string `json:"itemName"`
+}
+
+// DataitemDetail is a dataitem with its attributes and the creator of its repository.
+type DataitemDetail struct {
+	*Dataitem
+	CreateUser string       `json:"createUser"`
+	Attrs      []*Attribute `json:"attrs"`
+}
+
+// QueryItemDetails returns the active dataitems of the keys, keyed by their
+// keys. The missing ones are not in the map.
+// The items, attributes and tags are fetched with one query each.
+func QueryItemDetails(db *sql.DB, keys []ItemKey) (map[ItemKey]*DataitemDetail, error) {
+	logger.Debug("QueryItemDetails begin")
+
+	details := make(map[ItemKey]*DataitemDetail, len(keys))
+	if len(keys) == 0 {
+		return details, nil
+	}
+
+	pairs := make([]string, len(keys))
+	sqlParams := make([]interface{}, 0, len(keys)*2)
+	for i, key := range keys {
+		pairs[i] = "(?, ?)"
+		sqlParams = append(sqlParams, key.RepoName, key.ItemName)
+	}
+
+	sqlstr := fmt.Sprintf(`SELECT I.ITEM_ID, I.ITEM_NAME, I.REPO_NAME, I.URL,
+		I.CREATE_TIME, I.UPDATE_TIME, I.SIMPLE, I.SCHEMA_VERSION, I.COMPAT_MODE, R.CREATE_USER
+		FROM DF_DATAITEM I
+		JOIN DF_REPOSITORY R ON R.REPO_NAME=I.REPO_NAME
+		WHERE (I.REPO_NAME, I.ITEM_NAME) IN (%s)
+		AND I.STATUS='A' AND R.STATUS='A'`, strings.Join(pairs, ", "))
+
+	logger.Info(">>> %v", sqlstr)
+	rows, err := db.Query(sqlstr, sqlParams...)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	byId := make(map[int]*DataitemDetail, len(keys))
+	itemIds := make([]int, 0, len(keys))
+	for rows.Next() {
+		detail := &DataitemDetail{Dataitem: &Dataitem{}, Attrs: []*Attribute{}}
+		item := detail.Dataitem
+		err := rows.Scan(&item.ItemId, &item.ItemName, &item.RepoName, &item.Url,
+			&item.CreateTime, &item.UpdateTime, &item.Simple, &item.SchemaVersion, &item.CompatMode, &detail.CreateUser)
+		if err != nil {
+			return nil, err
+		}
+		details[ItemKey{RepoName: item.RepoName, ItemName: item.ItemName}] = detail
+		byId[item.ItemId] = detail
+		itemIds = append(itemIds, item.ItemId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(itemIds) == 0 {
+		return details, nil
+	}
+
+	attrs, err := QueryItemsAttrs(db, itemIds)
+	if err != nil {
+		return nil, err
+	}
+	for id, detail := range byId {
+		if attrs[id] != nil {
+			detail.Attrs = attrs[id]
+		}
+	}
+
+	tags, err := queryTags(db, "DF_ITEM_TAG", "ITEM_ID", itemIds...)
+	if err != nil {
+		return nil, err
+	}
+	for id, detail := range byId {
+		detail.Tags = tags[id]
+	}
+
+	return details, nil
+}
+
+// QueryItemsAttrs returns the attributes of the dataitems in order, keyed by
+// the item ids, with one query.
+func QueryItemsAttrs(db DbOrTx, itemIds []int) (map[int][]*Attribute, error) {
+	attrs := make(map[int][]*Attribute, len(itemIds))
+	if len(itemIds) == 0 {
+		return attrs, nil
+	}
+
+	sqlwhere := fmt.Sprintf("ITEM_ID IN (%s)", sqlPlaceholders(len(itemIds)))
+	sqlParams := make([]interface{}, len(itemIds))
+	for i, id := range itemIds {
+		sqlParams[i] = id
+	}
+	list, err := queryAttrs(db, sqlwhere, "ORDER BY ITEM_ID, ORDER_ID", sqlParams...)
+	if err != nil {
+		return nil, err
+	}
+	for _, attr := range list {
+		attrs[attr.ItemId] = append(attrs[attr.ItemId], attr)
+	}
+	return attrs, nil
+}
+
+// QueryRepoItems returns the active dataitems of the repositories, keyed by
+// the repository names, with one query.
+func QueryRepoItems(db *sql.DB, repoNames []string) (map[string][]*Dataitem, error) {
+	logger.Debug("QueryRepoItems begin")
+
+	items := make(map[string][]*Dataitem, len(repoNames))
+	if len(repoNames) == 0 {
+		return items, nil
+	}
+
+	sqlParams := make([]interface{}, 0, len(repoNames)+1)
+	for _, name := range repoNames {
+		sqlParams = append(sqlParams, name)
+	}
+	sqlParams = append(sqlParams, "A")
+
+	sqlstr := fmt.Sprintf(`SELECT ITEM_ID, ITEM_NAME, REPO_NAME, URL, CREATE_TIME, UPDATE_TIME, SCHEMA_VERSION
+		FROM DF_DATAITEM
+		WHERE REPO_NAME IN (%s) AND STATUS=?
+		ORDER BY CREATE_TIME`, sqlPlaceholders(len(repoNames)))
+
+	logger.Info(">>> %v", sqlstr)
+	rows, err := db.Query(sqlstr, sqlParams...)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &Dataitem{}
+		err := rows.Scan(&item.ItemId, &item.ItemName, &item.RepoName, &item.Url, &item.CreateTime,
+			&item.UpdateTime, &item.SchemaVersion)
+		if err != nil {
+			return nil, err
+		}
+		items[item.RepoName] = append(items[item.RepoName], item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,473 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	RepoNameMaxLength = 128
+	ItemNameMaxLength = 255
+
+	EntityRepository = "repository"
+	EntityDataitem   = "dataitem"
+
+	// MirrorSeparator separates the origin and the remote name in the names
+	// of the mirrored repositories, which the local names can't contain.
+	MirrorSeparator = "."
+)
+
+// ValidateOriginName trims and checks the name of an instance mirrored from.
+func ValidateOriginName(name string) (string, bool) {
+	name, ok := common.ValidateUrlWord(name)
+	return name, ok && name != OriginLocal
+}
+
+// ValidateRepoName trims and checks the name of a repository. The mirrors of
+// the repositories of an origin are named <origin>.<remote name>.
+func ValidateRepoName(name, origin string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if len(name) > RepoNameMaxLength {
+		return name, false
+	}
+	if origin == "" {
+		return common.ValidateUrlWord(name)
+	}
+
+	i := strings.Index(name, MirrorSeparator)
+	if i < 0 || name[:i] != origin {
+		return name, false
+	}
+	_, originOk := ValidateOriginName(origin)
+	remote, remoteOk := common.ValidateUrlWord(name[i+len(MirrorSeparator):])
+	return name, originOk && remoteOk && remote == name[i+len(MirrorSeparator):]
+}
+
+// CatalogManifest declares repositories with their dataitems and attributes.
+type CatalogManifest struct {
+	Repositories []*RepoSpec `json:"repositories"`
+}
+
+// RepoSpec declares a repository. The omitted tags and items are left alone,
+// while the other omitted fields are emptied. ManagedBy is set by the
+// reconciler, see ReconcileCatalog, and so are Origin and OriginUrl, which
+// are kept by the imports without a reconciler.
+type RepoSpec struct {
+	Name        string      `json:"name"`
+	ChName      string      `json:"chName"`
+	ClassId     int         `json:"classId"`
+	Description string      `json:"description"`
+	ImageUrl    string      `json:"imageUrl"`
+	Tags        []string    `json:"tags"`
+	Items       []*ItemSpec `json:"items"`
+	ManagedBy   string      `json:"-"`
+	Origin      string      `json:"-"`
+	OriginUrl   string      `json:"-"`
+}
+
+// ItemSpec declares a dataitem. The omitted tags and attrs are left alone.
+type ItemSpec struct {
+	Name       string       `json:"name"`
+	Url        string       `json:"url"`
+	Simple     string       `json:"simple"`
+	CompatMode string       `json:"compatMode"`
+	Tags       []string     `json:"tags"`
+	Attrs      []*Attribute `json:"attrs"`
+}
+
+// EntityChange is a repository or dataitem (named "repo/item") in an
+// ImportReport.
+type EntityChange struct {
+	Kind          string   `json:"kind"`
+	Name          string   `json:"name"`
+	Fields        []string `json:"fields,omitempty"` // the updated fields
+	SchemaVersion int      `json:"schemaVersion,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun    bool            `json:"dryRun"`
+	Created   []*EntityChange `json:"created"`
+	Updated   []*EntityChange `json:"updated"`
+	Unchanged []*EntityChange `json:"unchanged"`
+	Deleted   []*EntityChange `json:"deleted,omitempty"` // by the reconciler only
+}
+
+func (report *ImportReport) add(change *EntityChange, created bool) {
+	switch {
+	case created:
+		report.Created = append(report.Created, change)
+	case len(change.Fields) > 0:
+		report.Updated = append(report.Updated, change)
+	default:
+		report.Unchanged = append(report.Unchanged, change)
+	}
+}
+
+// RepoNotEditableError is returned if the manifest changes a repository
+// which the importer can't edit.
+type RepoNotEditableError struct {
+	RepoName  string
+	ManagedBy string // the reconciler of the repository, if any
+}
+
+func (e *RepoNotEditableError) Error() string {
+	if e.ManagedBy != "" {
+		return fmt.Sprintf("repository %s is managed by %s", e.RepoName, e.ManagedBy)
+	}
+	return fmt.Sprintf("repository %s is not editable", e.RepoName)
+}
+
+// ParseCatalogManifest parses a json or yaml manifest.
+func ParseCatalogManifest(data []byte) (*CatalogManifest, error) {
+	manifest := &CatalogManifest{}
+	if err := unmarshalManifest(data, manifest); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateCatalogManifest(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ParseRepoSpec parses a json or yaml repository without validating it.
+func ParseRepoSpec(data []byte) (*RepoSpec, error) {
+	spec := &RepoSpec{}
+	if err := unmarshalManifest(data, spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func unmarshalManifest(data []byte, v interface{}) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(v)
+	}
+	return common.UnmarshalYaml(data, v)
+}
+
+// ValidateCatalogManifest checks the names and attributes, and normalizes
+// the compatibility modes and tags.
+func ValidateCatalogManifest(manifest *CatalogManifest) error {
+	repoNames := make(map[string]bool, len(manifest.Repositories))
+	for i, repo := range manifest.Repositories {
+		name, ok := ValidateRepoName(repo.Name, repo.Origin)
+		if !ok {
+			return fmt.Errorf("repositories[%d]: invalid name %q", i, repo.Name)
+		}
+		if repoNames[name] {
+			return fmt.Errorf("repositories[%d]: duplicated name %s", i, name)
+		}
+		repoNames[name] = true
+		repo.Name = name
+
+		if repo.Tags != nil {
+			repo.Tags = NormalizeTags(repo.Tags)
+		}
+
+		itemNames := make(map[string]bool, len(repo.Items))
+		for j, item := range repo.Items {
+			name, ok := common.ValidateUrlWord(item.Name)
+			if !ok || utf8.RuneCountInString(name) > ItemNameMaxLength {
+				return fmt.Errorf("%s.items[%d]: invalid name %q", repo.Name, j, item.Name)
+			}
+			if itemNames[name] {
+				return fmt.Errorf("%s.items[%d]: duplicated name %s", repo.Name, j, name)
+			}
+			itemNames[name] = true
+			item.Name = name
+
+			if item.CompatMode, ok = ValidateCompatMode(item.CompatMode); !ok {
+				return fmt.Errorf("%s/%s: invalid compatibility mode %s", repo.Name, name, item.CompatMode)
+			}
+			if item.Tags != nil {
+				item.Tags = NormalizeTags(item.Tags)
+			}
+			if err := ValidateAttrs(item.Attrs); err != nil {
+				return fmt.Errorf("%s/%s: %s", repo.Name, name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// ImportCatalog upserts the repositories, dataitems and attributes of the
+// manifest by name in a transaction. The created repositories are owned by
+// the user, the existing ones are only changed if canEdit them. The dry run
+// is done in a transaction rolled back at last, so its report is exact.
+func ImportCatalog(db *sql.DB, manifest *CatalogManifest, user string, canEdit func(*Repository) bool,
+	dryRun bool) (*ImportReport, error) {
+	logger.Info("Model begin import catalog")
+	defer logger.Info("Model end import catalog")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{
+		DryRun:    dryRun,
+		Created:   []*EntityChange{},
+		Updated:   []*EntityChange{},
+		Unchanged: []*EntityChange{},
+	}
+	for _, repo := range manifest.Repositories {
+		if err := importRepo(tx, repo, user, canEdit, report); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return report, tx.Rollback()
+	}
+	return report, tx.Commit()
+}
+
+func importRepo(tx DbOrTx, spec *RepoSpec, user string, canEdit func(*Repository) bool, report *ImportReport) error {
+	className := ""
+	if spec.ClassId > 0 {
+		if err := lockClassRef(tx, spec.ClassId); err != nil {
+			return fmt.Errorf("repository %s: %s", spec.Name, err.Error())
+		}
+		class, err := QueryClass(tx, spec.ClassId)
+		if err != nil {
+			return fmt.Errorf("repository %s: %s", spec.Name, err.Error())
+		}
+		className = class.Name(ClassLocaleZh)
+	}
+
+	repo := &Repository{}
+	status := ""
+	err := tx.QueryRow(`SELECT REPO_ID, CH_REPO_NAME, CLASS_ID, CREATE_USER, DESCRIPTION, IMAGE_URL, STATUS, MANAGED_BY,
+		ORIGIN, ORIGIN_URL
+		FROM DF_REPOSITORY WHERE REPO_NAME=? FOR UPDATE`, spec.Name).Scan(
+		&repo.RepoId, &repo.ChRepoName, &repo.ClassId, &repo.CreateUser, &repo.Description, &repo.ImageUrl, &status,
+		&repo.ManagedBy, &repo.Origin, &repo.OriginUrl)
+
+	// the changes of the repository are checked against canEdit at last.
+	repoReport := &ImportReport{}
+	change := &EntityChange{Kind: EntityRepository, Name: spec.Name}
+	created := err == sql.ErrNoRows
+	if created {
+		repo = &Repository{
+			RepoName:    spec.Name,
+			ChRepoName:  spec.ChName,
+			Class:       className,
+			ClassId:     spec.ClassId,
+			CreateUser:  user,
+			Description: spec.Description,
+			Status:      "A",
+			ImageUrl:    spec.ImageUrl,
+			Tags:        spec.Tags,
+			ManagedBy:   spec.ManagedBy,
+			Origin:      spec.Origin,
+			OriginUrl:   spec.OriginUrl,
+		}
+		if repo.RepoId, err = recordRepo(tx, repo); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		repo.RepoName = spec.Name
+		if change.Fields, err = updateRepoSpec(tx, repo, status, className, spec); err != nil {
+			return err
+		}
+		if len(change.Fields) > 0 {
+			if err := recordRepoChange(tx, repo.RepoId, ChangeUpdate); err != nil {
+				return err
+			}
+		}
+	}
+	repoReport.add(change, created)
+
+	for _, item := range spec.Items {
+		if err := importItem(tx, repo.RepoName, item, user, repoReport); err != nil {
+			return err
+		}
+	}
+
+	if !created && len(repoReport.Unchanged) < 1+len(spec.Items) && !canEdit(repo) {
+		return &RepoNotEditableError{spec.Name, repo.ManagedBy}
+	}
+
+	report.Created = append(report.Created, repoReport.Created...)
+	report.Updated = append(report.Updated, repoReport.Updated...)
+	report.Unchanged = append(report.Unchanged, repoReport.Unchanged...)
+	return nil
+}
+
+func updateRepoSpec(tx DbOrTx, repo *Repository, status, className string, spec *RepoSpec) ([]string, error) {
+	fields := make([]string, 0, 4)
+	if repo.ChRepoName != spec.ChName {
+		fields = append(fields, "chName")
+	}
+	if repo.ClassId != spec.ClassId {
+		fields = append(fields, "classId")
+	}
+	if repo.Description != spec.Description {
+		fields = append(fields, "description")
+	}
+	if repo.ImageUrl != spec.ImageUrl {
+		fields = append(fields, "imageUrl")
+	}
+	if status != "A" {
+		fields = append(fields, "status")
+	}
+	// the manifests without a reconciler keep the reconciler of the repository.
+	managedBy, origin, originUrl := repo.ManagedBy, repo.Origin, repo.OriginUrl
+	if spec.ManagedBy != "" {
+		if spec.ManagedBy != managedBy {
+			fields = append(fields, "managedBy")
+			managedBy = spec.ManagedBy
+		}
+		if spec.Origin != origin || spec.OriginUrl != originUrl {
+			fields = append(fields, "origin")
+			origin, originUrl = spec.Origin, spec.OriginUrl
+		}
+	}
+	if len(fields) > 0 {
+		_, err := tx.Exec(`UPDATE DF_REPOSITORY SET CH_REPO_NAME=?, CLASS=?, CLASS_ID=?, DESCRIPTION=?,
+			IMAGE_URL=?, STATUS='A', MANAGED_BY=?, ORIGIN=?, ORIGIN_URL=?, UPDATE_TIME=CURRENT_TIMESTAMP WHERE REPO_ID=?`,
+			spec.ChName, className, spec.ClassId, spec.Description, spec.ImageUrl, managedBy, origin, originUrl,
+			repo.RepoId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.Tags != nil {
+		changed, err := replaceTags(tx, "DF_REPO_TAG", "REPO_ID", repo.RepoId, spec.Tags)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			fields = append(fields, "tags")
+		}
+	}
+	return fields, nil
+}
+
+func importItem(tx DbOrTx, repoName string, spec *ItemSpec, user string, report *ImportReport) error {
+	itemId, url, simple, mode, status := 0, "", "", "", ""
+	err := tx.QueryRow(`SELECT ITEM_ID, URL, SIMPLE, COMPAT_MODE, STATUS FROM DF_DATAITEM
+		WHERE REPO_NAME=? AND ITEM_NAME=? FOR UPDATE`, repoName, spec.Name).Scan(
+		&itemId, &url, &simple, &mode, &status)
+
+	change := &EntityChange{Kind: EntityDataitem, Name: repoName + "/" + spec.Name, Fields: []string{}}
+	created := err == sql.ErrNoRows
+	if created {
+		result, err := tx.Exec(`INSERT INTO DF_DATAITEM (ITEM_NAME, REPO_NAME, URL, STATUS, SIMPLE, COMPAT_MODE)
+			VALUES (?, ?, ?, 'A', ?, ?)`, spec.Name, repoName, spec.Url, spec.Simple, spec.CompatMode)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		itemId = int(id)
+		if err := addTags(tx, "DF_ITEM_TAG", "ITEM_ID", itemId, spec.Tags); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		if url != spec.Url {
+			change.Fields = append(change.Fields, "url")
+		}
+		if simple != spec.Simple {
+			change.Fields = append(change.Fields, "simple")
+		}
+		if mode != spec.CompatMode {
+			change.Fields = append(change.Fields, "compatMode")
+		}
+		if status != "A" {
+			change.Fields = append(change.Fields, "status")
+		}
+		if len(change.Fields) > 0 {
+			_, err := tx.Exec(`UPDATE DF_DATAITEM SET URL=?, SIMPLE=?, COMPAT_MODE=?, STATUS='A',
+				UPDATE_TIME=CURRENT_TIMESTAMP WHERE ITEM_ID=?`, spec.Url, spec.Simple, spec.CompatMode, itemId)
+			if err != nil {
+				return err
+			}
+		}
+
+		if spec.Tags != nil {
+			changed, err := replaceTags(tx, "DF_ITEM_TAG", "ITEM_ID", itemId, spec.Tags)
+			if err != nil {
+				return err
+			}
+			if changed {
+				change.Fields = append(change.Fields, "tags")
+			}
+		}
+	}
+
+	// the changes of the attrs are logged by updateAttrs.
+	if created || len(change.Fields) > 0 {
+		operation := ChangeUpdate
+		if created {
+			operation = ChangeCreate
+		}
+		if err := recordItemChange(tx, itemId, operation); err != nil {
+			return err
+		}
+	}
+
+	if spec.Attrs != nil {
+		oldVersion := 0
+		if err := tx.QueryRow(`SELECT SCHEMA_VERSION FROM DF_DATAITEM WHERE ITEM_ID=?`, itemId).Scan(&oldVersion); err != nil {
+			return err
+		}
+		version, err := updateAttrs(tx, itemId, user, spec.Attrs)
+		if err != nil {
+			return fmt.Errorf("dataitem %s: %s", change.Name, err.Error())
+		}
+		if version != oldVersion && !created {
+			change.Fields = append(change.Fields, "attrs")
+		}
+		change.SchemaVersion = version
+	}
+
+	report.add(change, created)
+	return nil
+}
+
+// replaceTags makes the tags of the id the given ones, and reports whether
+// they are changed.
+func replaceTags(tx DbOrTx, table, idColumn string, id int, tags []string) (bool, error) {
+	current, err := queryTags(tx, table, idColumn, id)
+	if err != nil {
+		return false, err
+	}
+	if sameTags(current[id], tags) {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s=?`, table, idColumn), id); err != nil {
+		return false, err
+	}
+	return true, addTags(tx, table, idColumn, id, tags)
+}
+
+func sameTags(a, b []string) bool {
+	lower := func(tags []string) []string {
+		result := make([]string, len(tags))
+		for i, tag := range tags {
+			result[i] = strings.ToLower(tag)
+		}
+		sort.Strings(result)
+		return result
+	}
+	return strings.Join(lower(a), "\n") == strings.Join(lower(b), "\n")
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCatalogManifestYaml(t *testing.T) {
+	data := `
+repositories:
+  - name: retail
+    chName: 零售
+    classId: 3
+    tags: [sales, Sales, " pos "]
+    items:
+      - name: orders
+        compatMode: Backward
+        attrs:
+          - attrName: id
+            dataType: int
+            primaryKey: true
+            nullable: false
+          - attrName: code
+            example: 0012
+      - name: stores
+  - name: hr
+    description: |
+      human resources
+`
+	manifest, err := ParseCatalogManifest([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Repositories) != 2 {
+		t.Fatalf("repositories %v", manifest.Repositories)
+	}
+
+	retail, hr := manifest.Repositories[0], manifest.Repositories[1]
+	if retail.ChName != "零售" || retail.ClassId != 3 || strings.Join(retail.Tags, ",") != "sales,pos" {
+		t.Errorf("retail %+v", retail)
+	}
+	if hr.Description != "human resources\n" || hr.Tags != nil || hr.Items != nil {
+		t.Errorf("hr %+v", hr)
+	}
+
+	orders, stores := retail.Items[0], retail.Items[1]
+	if orders.CompatMode != CompatBackward || len(orders.Attrs) != 2 {
+		t.Fatalf("orders %+v", orders)
+	}
+	if id := orders.Attrs[0]; !id.PrimaryKey || id.Nullable || id.OrderId != 1 {
+		t.Errorf("id %+v", id)
+	}
+	// the attributes are nullable by default, and the example stays a string.
+	if code := orders.Attrs[1]; !code.Nullable || code.Example != "0012" || code.DataType != DataTypeString {
+		t.Errorf("code %+v", code)
+	}
+	if stores.CompatMode != CompatNone || stores.Attrs != nil {
+		t.Errorf("stores %+v", stores)
+	}
+}
+
+func TestParseCatalogManifestJson(t *testing.T) {
+	data := `{"repositories": [{"name": "retail", "items": [{"name": "orders", "attrs": []}]}]}`
+	manifest, err := ParseCatalogManifest([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs := manifest.Repositories[0].Items[0].Attrs; attrs == nil || len(attrs) != 0 {
+		t.Errorf("attrs %v", attrs)
+	}
+
+	if _, err := ParseCatalogManifest([]byte(`{"repos": []}`)); err == nil {
+		t.Error("no error of unknown field")
+	}
+}
+
+func TestValidateCatalogManifest(t *testing.T) {
+	cases := []struct{ data, message string }{
+		{"repositories:\n- name: a b\n", `invalid name "a b"`},
+		{"repositories:\n- name: east.a\n", `invalid name "east.a"`},
+		{"repositories:\n- name: a\n- name: a\n", "duplicated name a"},
+		{"repositories:\n- name: a\n  items:\n  - name: x\n  - name: x\n", "a.items[1]: duplicated name x"},
+		{"repositories:\n- name: a\n  items:\n  - name: x\n    compatMode: sideways\n", "a/x: invalid compatibility mode"},
+		{"repositories:\n- name: a\n  items:\n  - name: x\n    attrs:\n    - {attrName: n, dataType: blob}\n",
+			"a/x: attrs[0] (n): invalid data type"},
+		{"repositories:\n- name: a\n  owner: b\n", `unknown field "owner"`},
+	}
+	for _, c := range cases {
+		_, err := ParseCatalogManifest([]byte(c.data))
+		if err == nil || !strings.Contains(err.Error(), c.message) {
+			t.Errorf("ParseCatalogManifest(%q) => %v, %q expected", c.data, err, c.message)
+		}
+	}
+}
+
+func TestValidateRepoName(t *testing.T) {
+	cases := []struct {
+		name, origin string
+		ok           bool
+	}{
+		{" sales ", "", true},
+		{"east.sales", "", false},
+		{"east.sales", "east", true},
+		{"east-sales", "east", false},
+		{"east.sales", "west", false},
+		{"east.a.b", "east", false},
+		{"local.sales", OriginLocal, false},
+		{strings.Repeat("a", RepoNameMaxLength+1), "", false},
+	}
+	for _, c := range cases {
+		if _, ok := ValidateRepoName(c.name, c.origin); ok != c.ok {
+			t.Errorf("ValidateRepoName(%q, %q) => %t, expected %t", c.name, c.origin, ok, c.ok)
+		}
+	}
+}
+
+func TestSameTags(t *testing.T) {
+	if !sameTags([]string{"a", "B"}, []string{"b", "A"}) || !sameTags(nil, []string{}) {
+		t.Error("same tags are different")
+	}
+	if sameTags([]string{"a"}, []string{"a", "b"}) {
+		t.Error("different tags are the same")
+	}
+}
+
+func TestNormalizeReconcileSpecs(t *testing.T) {
+	manifest, err := ParseCatalogManifest([]byte("repositories:\n  - name: retail\n    items:\n      - name: orders\n  - name: hr\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	normalizeReconcileSpecs(manifest.Repositories, "gitops")
+	retail, hr := manifest.Repositories[0], manifest.Repositories[1]
+	// the omitted tags, items and attrs are emptied instead of left alone.
+	if retail.ManagedBy != "gitops" || retail.Tags == nil || len(retail.Items) != 1 {
+		t.Errorf("retail %+v", retail)
+	}
+	if orders := retail.Items[0]; orders.Tags == nil || orders.Attrs == nil || len(orders.Attrs) != 0 {
+		t.Errorf("orders %+v", orders)
+	}
+	if hr.ManagedBy != "gitops" || hr.Items == nil || len(hr.Items) != 0 {
+		t.Errorf("hr %+v", hr)
+	}
+}
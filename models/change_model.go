@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Change is an entry of the change log. Payload is the snapshot of the
+// repository, or of the dataitem with its attributes, right after the
+// change. The attribute changes are the updates of their dataitems.
+type Change struct {
+	Seq        int64           `json:"seq"`
+	Entity     string          `json:"entity"` // EntityRepository or EntityDataitem
+	Name       string          `json:"name"`   // "repo" or "repo/item"
+	Operation  string          `json:"operation"`
+	Payload    json.RawMessage `json:"payload"`
+	CreateTime *time.Time      `json:"createTime,omitempty"`
+}
+
+// nextChangeSeq allocates the next sequence number of the change log. The
+// sequence row stays locked until the transaction ends, so the changes are
+// committed in the order of their sequence numbers, and a consumer never
+// misses a change committed after a bigger one has been read.
+func nextChangeSeq(tx DbOrTx) (int64, error) {
+	// LAST_INSERT_ID(expr) makes LastInsertId return the new sequence number.
+	result, err := tx.Exec(`INSERT INTO DF_CHANGE_SEQ (SEQ_ID, SEQ) VALUES (1, LAST_INSERT_ID(1))
+		ON DUPLICATE KEY UPDATE SEQ=LAST_INSERT_ID(SEQ+1)`)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func recordChange(tx DbOrTx, entity, name, operation string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	seq, err := nextChangeSeq(tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO DF_CHANGE_LOG (SEQ, ENTITY, NAME, OPERATION, PAYLOAD) VALUES (?, ?, ?, ?, ?)`,
+		seq, entity, name, operation, string(data))
+	if err != nil {
+		return err
+	}
+
+	change := &Change{Seq: seq, Entity: entity, Name: name, Operation: operation, Payload: data}
+	event, err := marshalEvent(change)
+	if err != nil {
+		return err
+	}
+	if err := enqueueEvent(tx, change, event); err != nil {
+		return err
+	}
+	return enqueueDeliveries(tx, change, event)
+}
+
+// recordRepoChange logs the change of the repository with its snapshot.
+func recordRepoChange(tx DbOrTx, repoId int, operation string) error {
+	repo := &Repository{}
+	err := tx.QueryRow(`SELECT REPO_ID, REPO_NAME, CH_REPO_NAME, CLASS, CLASS_ID, LABEL, CREATE_USER,
+		DESCRIPTION, CREATE_TIME, UPDATE_TIME, STATUS, IMAGE_URL, MANAGED_BY, ORIGIN, ORIGIN_URL
+		FROM DF_REPOSITORY WHERE REPO_ID=?`, repoId).Scan(
+		&repo.RepoId, &repo.RepoName, &repo.ChRepoName, &repo.Class, &repo.ClassId, &repo.Label,
+		&repo.CreateUser, &repo.Description, &repo.CreateTime, &repo.UpdateTime, &repo.Status, &repo.ImageUrl,
+		&repo.ManagedBy, &repo.Origin, &repo.OriginUrl)
+	if err != nil {
+		return err
+	}
+
+	tags, err := queryTags(tx, "DF_REPO_TAG", "REPO_ID", repoId)
+	if err != nil {
+		return err
+	}
+	repo.Tags = tags[repoId]
+	if repo.Tags == nil {
+		repo.Tags = []string{}
+	}
+
+	return recordChange(tx, EntityRepository, repo.RepoName, operation, repo)
+}
+
+// recordItemChange logs the change of the dataitem with its snapshot.
+func recordItemChange(tx DbOrTx, itemId int, operation string) error {
+	item := &Dataitem{}
+	detail := &DataitemDetail{Dataitem: item}
+	err := tx.QueryRow(`SELECT I.ITEM_ID, I.ITEM_NAME, I.REPO_NAME, I.URL, I.CREATE_TIME, I.UPDATE_TIME,
+		I.STATUS, I.SIMPLE, I.SCHEMA_VERSION, I.COMPAT_MODE, R.CREATE_USER
+		FROM DF_DATAITEM I
+		JOIN DF_REPOSITORY R ON R.REPO_NAME=I.REPO_NAME
+		WHERE I.ITEM_ID=?`, itemId).Scan(
+		&item.ItemId, &item.ItemName, &item.RepoName, &item.Url, &item.CreateTime, &item.UpdateTime,
+		&item.Status, &item.Simple, &item.SchemaVersion, &item.CompatMode, &detail.CreateUser)
+	if err != nil {
+		return err
+	}
+
+	tags, err := queryTags(tx, "DF_ITEM_TAG", "ITEM_ID", itemId)
+	if err != nil {
+		return err
+	}
+	item.Tags = tags[itemId]
+	if item.Tags == nil {
+		item.Tags = []string{}
+	}
+	if detail.Attrs, err = queryAttrs(tx, "ITEM_ID=?", "ORDER BY ORDER_ID", itemId); err != nil {
+		return err
+	}
+
+	return recordChange(tx, EntityDataitem, item.RepoName+"/"+item.ItemName, operation, detail)
+}
+
+// QueryChanges returns up to limit changes after the since sequence number,
+// in the order of their sequence numbers.
+func QueryChanges(db *sql.DB, since int64, limit int) ([]*Change, error) {
+	logger.Debug("QueryChanges begin")
+
+	rows, err := db.Query(`SELECT SEQ, ENTITY, NAME, OPERATION, PAYLOAD, CREATE_TIME
+		FROM DF_CHANGE_LOG
+		WHERE SEQ>?
+		ORDER BY SEQ
+		LIMIT ?`, since, limit)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]*Change, 0, limit)
+	for rows.Next() {
+		change := &Change{}
+		payload := ""
+		err := rows.Scan(&change.Seq, &change.Entity, &change.Name, &change.Operation, &payload, &change.CreateTime)
+		if err != nil {
+			return nil, err
+		}
+		change.Payload = json.RawMessage(payload)
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// QueryLatestChangeSeq returns the sequence number of the latest change, or 0
+// if there are no changes.
+func QueryLatestChangeSeq(db *sql.DB) (int64, error) {
+	var seq sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(SEQ) FROM DF_CHANGE_LOG`).Scan(&seq); err != nil {
+		logger.Error(err.Error())
+		return 0, err
+	}
+	return seq.Int64, nil
+}
@@ -0,0 +1,463 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ClassLocaleEn = "en"
+	ClassLocaleZh = "zh"
+
+	ClassNameMaxLength = 128
+)
+
+var (
+	ErrClassNotFound     = errors.New("class not found")
+	ErrClassNameRequired = errors.New("at least one class name is needed")
+	ErrClassNameExists   = errors.New("a sibling class has the same name")
+	ErrClassCycle        = errors.New("a class can't be moved under itself or its descendants")
+	ErrClassInUse        = errors.New("class has children or is referenced by repositories")
+
+	localeValidator = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+)
+
+// Class is a node of the class taxonomy tree. Root nodes have ParentId 0.
+type Class struct {
+	ClassId    int               `json:"classId"`
+	ParentId   int               `json:"parentId"`
+	Names      map[string]string `json:"names"`
+	OrderId    int               `json:"orderId"`
+	CreateTime *time.Time        `json:"createTime,omitempty"`
+	UpdateTime *time.Time        `json:"updateTime,omitempty"`
+	Children   []*Class          `json:"children,omitempty"`
+}
+
+// Name returns the name in the locale, falling back to zh, en and then any name.
+func (class *Class) Name(locale string) string {
+	for _, l := range []string{locale, ClassLocaleZh, ClassLocaleEn} {
+		if name, ok := class.Names[l]; ok {
+			return name
+		}
+	}
+	for _, name := range class.Names {
+		return name
+	}
+	return ""
+}
+
+// ValidateClassNames trims the localized names and checks the locales.
+func ValidateClassNames(names map[string]string) (map[string]string, error) {
+	result := make(map[string]string, len(names))
+	for locale, name := range names {
+		locale = strings.TrimSpace(locale)
+		name = strings.TrimSpace(name)
+		if !localeValidator.MatchString(locale) {
+			return nil, fmt.Errorf("invalid locale: %s", locale)
+		}
+		if name == "" || utf8.RuneCountInString(name) > ClassNameMaxLength {
+			return nil, fmt.Errorf("invalid name for locale %s", locale)
+		}
+		result[locale] = name
+	}
+
+	if len(result) == 0 {
+		return nil, ErrClassNameRequired
+	}
+
+	return result, nil
+}
+
+// BuildClassTree links the flat class list into trees and returns the roots.
+// Nodes whose parent is missing are treated as roots.
+func BuildClassTree(classes []*Class) []*Class {
+	nodes := make(map[int]*Class, len(classes))
+	for _, class := range classes {
+		node := *class
+		node.Children = nil
+		nodes[class.ClassId] = &node
+	}
+
+	roots := make([]*Class, 0, 8)
+	for _, class := range classes {
+		node := nodes[class.ClassId]
+		if parent, ok := nodes[class.ParentId]; ok && class.ParentId != class.ClassId {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	return roots
+}
+
+// ClassDescendants returns the id of the class and the ids of all its descendants.
+func ClassDescendants(classes []*Class, classId int) []int {
+	children := make(map[int][]int, len(classes))
+	for _, class := range classes {
+		children[class.ParentId] = append(children[class.ParentId], class.ClassId)
+	}
+
+	ids := []int{classId}
+	visited := map[int]bool{classId: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !visited[child] {
+				visited[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+
+	return ids
+}
+
+func findClass(classes []*Class, classId int) *Class {
+	for _, class := range classes {
+		if class.ClassId == classId {
+			return class
+		}
+	}
+	return nil
+}
+
+// checkClassPlacement checks whether the class (classId is 0 for a new one)
+// with the names can be put under the parent.
+func checkClassPlacement(classes []*Class, classId, parentId int, names map[string]string) error {
+	if parentId != 0 {
+		if findClass(classes, parentId) == nil {
+			return ErrClassNotFound
+		}
+		if classId != 0 {
+			for _, id := range ClassDescendants(classes, classId) {
+				if id == parentId {
+					return ErrClassCycle
+				}
+			}
+		}
+	}
+
+	for _, sibling := range classes {
+		if sibling.ParentId != parentId || sibling.ClassId == classId {
+			continue
+		}
+		for _, siblingName := range sibling.Names {
+			for _, name := range names {
+				if strings.EqualFold(siblingName, name) {
+					return ErrClassNameExists
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func QueryClassList(db DbOrTx) ([]*Class, error) {
+	logger.Debug("QueryClassList begin")
+
+	rows, err := db.Query(`SELECT CLASS_ID, PARENT_ID, ORDER_ID, CREATE_TIME, UPDATE_TIME
+		FROM DF_CLASS
+		ORDER BY PARENT_ID, ORDER_ID, CLASS_ID`)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	classes := make([]*Class, 0, 32)
+	index := make(map[int]*Class)
+	for rows.Next() {
+		class := &Class{Names: make(map[string]string)}
+		err := rows.Scan(&class.ClassId, &class.ParentId, &class.OrderId, &class.CreateTime, &class.UpdateTime)
+		if err != nil {
+			return nil, err
+		}
+		classes = append(classes, class)
+		index[class.ClassId] = class
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	nameRows, err := db.Query(`SELECT CLASS_ID, LOCALE, NAME FROM DF_CLASS_NAME`)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	defer nameRows.Close()
+
+	for nameRows.Next() {
+		classId, locale, name := 0, "", ""
+		if err := nameRows.Scan(&classId, &locale, &name); err != nil {
+			return nil, err
+		}
+		if class, ok := index[classId]; ok {
+			class.Names[locale] = name
+		}
+	}
+	if err := nameRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return classes, nil
+}
+
+// QueryClass returns the class with its subtree.
+func QueryClass(db DbOrTx, classId int) (*Class, error) {
+	classes, err := QueryClassList(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, root := range BuildClassTree(classes) {
+		if class := findClassInTree(root, classId); class != nil {
+			return class, nil
+		}
+	}
+
+	return nil, ErrClassNotFound
+}
+
+func findClassInTree(node *Class, classId int) *Class {
+	if node.ClassId == classId {
+		return node
+	}
+	for _, child := range node.Children {
+		if class := findClassInTree(child, classId); class != nil {
+			return class
+		}
+	}
+	return nil
+}
+
+func CreateClass(db *sql.DB, class *Class) (int, error) {
+	logger.Info("Model begin create class")
+	defer logger.Info("Model end create class")
+
+	names, err := ValidateClassNames(class.Names)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := lockClasses(tx); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	classes, err := QueryClassList(tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := checkClassPlacement(classes, 0, class.ParentId, names); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO DF_CLASS (PARENT_ID, ORDER_ID) VALUES (?, ?)`,
+		class.ParentId, class.OrderId)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	classId, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := recordClassNames(tx, int(classId), names); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return int(classId), tx.Commit()
+}
+
+func UpdateClass(db *sql.DB, class *Class) error {
+	logger.Info("Model begin update class")
+	defer logger.Info("Model end update class")
+
+	names, err := ValidateClassNames(class.Names)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := lockClasses(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	classes, err := QueryClassList(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if findClass(classes, class.ClassId) == nil {
+		tx.Rollback()
+		return ErrClassNotFound
+	}
+	if err := checkClassPlacement(classes, class.ClassId, class.ParentId, names); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE DF_CLASS SET PARENT_ID=?, ORDER_ID=? WHERE CLASS_ID=?`,
+		class.ParentId, class.OrderId, class.ClassId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM DF_CLASS_NAME WHERE CLASS_ID=?`, class.ClassId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordClassNames(tx, class.ClassId, names); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := updateRepoClass(tx, class.ClassId, (&Class{Names: names}).Name(ClassLocaleZh)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteClass removes a leaf class which is not referenced by any repository.
+func DeleteClass(db *sql.DB, classId int) error {
+	logger.Info("Model begin delete class")
+	defer logger.Info("Model end delete class")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	// the repositories assigned the class meanwhile wait for the deletion,
+	// in lockClassRef.
+	if err := lockClasses(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	count := 0
+	err = tx.QueryRow(`SELECT COUNT(*) FROM DF_REPOSITORY WHERE CLASS_ID=? AND STATUS='A' FOR UPDATE`,
+		classId).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	children := 0
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM DF_CLASS WHERE PARENT_ID=?`, classId).Scan(&children); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count+children > 0 {
+		tx.Rollback()
+		return ErrClassInUse
+	}
+
+	result, err := tx.Exec(`DELETE FROM DF_CLASS WHERE CLASS_ID=?`, classId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		tx.Rollback()
+		return err
+	} else if n == 0 {
+		tx.Rollback()
+		return ErrClassNotFound
+	}
+
+	return tx.Commit()
+}
+
+// updateRepoClass updates the copy of the class name in the repositories of
+// the class, which is kept for the class filter, and records the changes of
+// the active ones.
+func updateRepoClass(tx DbOrTx, classId int, className string) error {
+	rows, err := tx.Query(`SELECT REPO_ID, CLASS, STATUS FROM DF_REPOSITORY WHERE CLASS_ID=? FOR UPDATE`, classId)
+	if err != nil {
+		return err
+	}
+	changed := []int{}
+	for rows.Next() {
+		repoId, class, status := 0, "", ""
+		if err := rows.Scan(&repoId, &class, &status); err != nil {
+			rows.Close()
+			return err
+		}
+		if class != className && status == "A" {
+			changed = append(changed, repoId)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE DF_REPOSITORY SET CLASS=?, UPDATE_TIME=UPDATE_TIME WHERE CLASS_ID=?`, className, classId)
+	if err != nil {
+		return err
+	}
+	for _, repoId := range changed {
+		if err := recordRepoChange(tx, repoId, ChangeUpdate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockClasses locks the classes until the transaction ends, so that the
+// placements checked in it, the unique sibling names and no cycles, hold
+// when it commits.
+func lockClasses(tx DbOrTx) error {
+	count := 0
+	return tx.QueryRow(`SELECT COUNT(*) FROM DF_CLASS FOR UPDATE`).Scan(&count)
+}
+
+// lockClassRef locks the class assigned to a repository in the transaction,
+// so that it's not deleted until the transaction ends.
+func lockClassRef(tx DbOrTx, classId int) error {
+	err := tx.QueryRow(`SELECT CLASS_ID FROM DF_CLASS WHERE CLASS_ID=? LOCK IN SHARE MODE`, classId).Scan(&classId)
+	if err == sql.ErrNoRows {
+		return ErrClassNotFound
+	}
+	return err
+}
+
+func recordClassNames(db DbOrTx, classId int, names map[string]string) error {
+	locales := make([]string, 0, len(names))
+	for locale := range names {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	for _, locale := range locales {
+		_, err := db.Exec(`INSERT INTO DF_CLASS_NAME (CLASS_ID, LOCALE, NAME) VALUES (?, ?, ?)`,
+			classId, locale, names[locale])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
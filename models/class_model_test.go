@@ -0,0 +1,63 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testClasses() []*Class {
+	return []*Class{
+		{ClassId: 1, ParentId: 0, Names: map[string]string{"en": "Finance", "zh": "金融"}},
+		{ClassId: 2, ParentId: 1, Names: map[string]string{"en": "Stock"}},
+		{ClassId: 3, ParentId: 1, Names: map[string]string{"en": "Bank"}},
+		{ClassId: 4, ParentId: 2, Names: map[string]string{"en": "A-Share"}},
+		{ClassId: 5, ParentId: 0, Names: map[string]string{"en": "Traffic"}},
+	}
+}
+
+func TestClassDescendants(t *testing.T) {
+	classes := testClasses()
+
+	if ids := ClassDescendants(classes, 1); !reflect.DeepEqual(ids, []int{1, 2, 3, 4}) {
+		t.Errorf("ClassDescendants(1) => %v", ids)
+	}
+	if ids := ClassDescendants(classes, 2); !reflect.DeepEqual(ids, []int{2, 4}) {
+		t.Errorf("ClassDescendants(2) => %v", ids)
+	}
+	if ids := ClassDescendants(classes, 5); !reflect.DeepEqual(ids, []int{5}) {
+		t.Errorf("ClassDescendants(5) => %v", ids)
+	}
+}
+
+func TestBuildClassTree(t *testing.T) {
+	roots := BuildClassTree(testClasses())
+	if len(roots) != 2 || roots[0].ClassId != 1 || roots[1].ClassId != 5 {
+		t.Fatalf("roots: %#v", roots)
+	}
+	if len(roots[0].Children) != 2 || len(roots[0].Children[0].Children) != 1 {
+		t.Errorf("children of root 1: %#v", roots[0].Children)
+	}
+}
+
+func TestCheckClassPlacement(t *testing.T) {
+	classes := testClasses()
+
+	if err := checkClassPlacement(classes, 1, 4, map[string]string{"en": "Finance"}); err != ErrClassCycle {
+		t.Errorf("move 1 under 4: %v", err)
+	}
+	if err := checkClassPlacement(classes, 0, 0, map[string]string{"en": "finance"}); err != ErrClassNameExists {
+		t.Errorf("new root finance: %v", err)
+	}
+	if err := checkClassPlacement(classes, 0, 0, map[string]string{"zh": "金融"}); err != ErrClassNameExists {
+		t.Errorf("new root 金融: %v", err)
+	}
+	if err := checkClassPlacement(classes, 0, 9, map[string]string{"en": "Other"}); err != ErrClassNotFound {
+		t.Errorf("new class under 9: %v", err)
+	}
+	if err := checkClassPlacement(classes, 3, 2, map[string]string{"en": "Bank"}); err != nil {
+		t.Errorf("move 3 under 2: %v", err)
+	}
+	if err := checkClassPlacement(classes, 1, 0, map[string]string{"en": "Finance"}); err != nil {
+		t.Errorf("rename 1 with the same name: %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// the compatibility modes of the dataitem schemas, as in a schema registry.
+// backward: the new schema can read the data written with the old one.
+// forward: the old schema can read the data written with the new one.
+// full: both backward and forward.
+const (
+	CompatNone     = "none"
+	CompatBackward = "backward"
+	CompatForward  = "forward"
+	CompatFull     = "full"
+)
+
+// ValidateCompatMode returns the normalized mode, "" means none.
+func ValidateCompatMode(mode string) (string, bool) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return CompatNone, true
+	case CompatNone, CompatBackward, CompatForward, CompatFull:
+		return mode, true
+	}
+	return mode, false
+}
+
+type CompatViolation struct {
+	AttrName  string `json:"attrName"`
+	Direction string `json:"direction"` // backward or forward
+	Reason    string `json:"reason"`
+}
+
+func (v *CompatViolation) String() string {
+	return fmt.Sprintf("%s: %s %s", v.Direction, v.AttrName, v.Reason)
+}
+
+// IncompatibleSchemaError is returned when an attribute update violates the
+// compatibility mode of the dataitem.
+type IncompatibleSchemaError struct {
+	Mode       string
+	Violations []*CompatViolation
+}
+
+func (e *IncompatibleSchemaError) Error() string {
+	reasons := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		reasons[i] = v.String()
+	}
+	return fmt.Sprintf("not %s compatible: %s", e.Mode, strings.Join(reasons, "; "))
+}
+
+// CheckCompatibility returns the violations of changing the attributes from
+// oldAttrs to newAttrs under the mode.
+func CheckCompatibility(mode string, oldAttrs, newAttrs []*Attribute) []*CompatViolation {
+	violations := []*CompatViolation{}
+	if mode == CompatBackward || mode == CompatFull {
+		violations = append(violations, checkReadable(CompatBackward, oldAttrs, newAttrs)...)
+	}
+	if mode == CompatForward || mode == CompatFull {
+		violations = append(violations, checkReadable(CompatForward, newAttrs, oldAttrs)...)
+	}
+	return violations
+}
+
+// checkReadable checks whether the data written with the writer attributes
+// can be read with the reader attributes.
+func checkReadable(direction string, writer, reader []*Attribute) []*CompatViolation {
+	writers := make(map[string]*Attribute, len(writer))
+	for _, attr := range writer {
+		writers[attrKey(attr.AttrName)] = attr
+	}
+
+	violations := []*CompatViolation{}
+	violate := func(attrName, reason string) {
+		violations = append(violations, &CompatViolation{AttrName: attrName, Direction: direction, Reason: reason})
+	}
+
+	for _, r := range reader {
+		w, ok := writers[attrKey(r.AttrName)]
+		if !ok {
+			if !r.Nullable {
+				if direction == CompatBackward {
+					violate(r.AttrName, "is added as non-nullable")
+				} else {
+					violate(r.AttrName, "is non-nullable and removed")
+				}
+			}
+			continue
+		}
+
+		if w.Nullable && !r.Nullable {
+			if direction == CompatBackward {
+				violate(r.AttrName, "becomes non-nullable")
+			} else {
+				violate(r.AttrName, "becomes nullable")
+			}
+		}
+
+		if !typeWidens(w, r) {
+			if direction == CompatBackward {
+				violate(r.AttrName, fmt.Sprintf("type is narrowed from %s to %s", w.TypeString(), r.TypeString()))
+			} else {
+				violate(r.AttrName, fmt.Sprintf("type is changed from %s to %s, which the old schema can't read",
+					r.TypeString(), w.TypeString()))
+			}
+		}
+	}
+
+	return violations
+}
+
+// typeWidens checks whether every value of the from type is a valid value
+// of the to type.
+func typeWidens(from, to *Attribute) bool {
+	if from.DataType != DataTypeEnum && from.TypeString() == to.TypeString() {
+		return true
+	}
+
+	switch to.DataType {
+	case DataTypeString:
+		if to.MaxLength == 0 {
+			return from.DataType != DataTypeArray
+		}
+		switch from.DataType {
+		case DataTypeString:
+			return from.MaxLength > 0 && from.MaxLength <= to.MaxLength
+		case DataTypeEnum:
+			for _, v := range from.EnumValues {
+				if utf8.RuneCountInString(v) > to.MaxLength {
+					return false
+				}
+			}
+			return true
+		}
+	case DataTypeDecimal:
+		switch from.DataType {
+		case DataTypeInt:
+			return to.Precision == 0 || to.Precision-to.Scale >= 19
+		case DataTypeDecimal:
+			return to.Precision == 0 || (from.Precision > 0 &&
+				from.Scale <= to.Scale && from.Precision-from.Scale <= to.Precision-to.Scale)
+		}
+	case DataTypeDatetime:
+		return from.DataType == DataTypeDate
+	case DataTypeEnum:
+		if from.DataType != DataTypeEnum {
+			return false
+		}
+		values := make(map[string]bool, len(to.EnumValues))
+		for _, v := range to.EnumValues {
+			values[v] = true
+		}
+		for _, v := range from.EnumValues {
+			if !values[v] {
+				return false
+			}
+		}
+		return true
+	case DataTypeArray:
+		return from.DataType == DataTypeArray &&
+			typeWidens(&Attribute{DataType: from.ElementType}, &Attribute{DataType: to.ElementType})
+	}
+
+	return false
+}
+
+// CheckItemCompatibility checks the proposed attributes against the current
+// ones of the dataitem. If mode is "", the mode of the dataitem is used.
+func CheckItemCompatibility(db *sql.DB, itemId int, mode string, attrs []*Attribute) (*SchemaDiff, []*CompatViolation, error) {
+	if mode == "" {
+		err := db.QueryRow(`SELECT COMPAT_MODE FROM DF_DATAITEM WHERE ITEM_ID=?`, itemId).Scan(&mode)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	oldAttrs, err := queryAttrs(db, "ITEM_ID=?", "ORDER BY ORDER_ID", itemId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	violations := []*CompatViolation{}
+	if len(oldAttrs) > 0 {
+		violations = CheckCompatibility(mode, oldAttrs, attrs)
+	}
+
+	return DiffAttrs(oldAttrs, attrs), violations, nil
+}
+
+func UpdateCompatMode(db *sql.DB, itemId int, mode string) error {
+	logger.Info("Model begin update compatibility mode")
+	defer logger.Info("Model end update compatibility mode")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE DF_DATAITEM SET COMPAT_MODE=? WHERE ITEM_ID=?`, mode, itemId)
+	if err == nil {
+		err = recordItemChange(tx, itemId, ChangeUpdate)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"testing"
+)
+
+func _testCompatibility(t *testing.T, mode string, oldAttrs, newAttrs []*Attribute, expected int) {
+	violations := CheckCompatibility(mode, oldAttrs, newAttrs)
+	if len(violations) != expected {
+		t.Errorf("CheckCompatibility (%s) => %v, expected %d violations", mode, violations, expected)
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	id := &Attribute{AttrName: "id", DataType: DataTypeInt}
+	name := &Attribute{AttrName: "name", DataType: DataTypeString, MaxLength: 32, Nullable: true}
+	base := []*Attribute{id, name}
+
+	// removing a non-nullable attribute
+	removed := []*Attribute{name}
+	_testCompatibility(t, CompatNone, base, removed, 0)
+	_testCompatibility(t, CompatBackward, base, removed, 0)
+	_testCompatibility(t, CompatForward, base, removed, 1)
+	_testCompatibility(t, CompatFull, base, removed, 1)
+
+	// adding a non-nullable attribute
+	added := []*Attribute{id, name, {AttrName: "code", DataType: DataTypeString}}
+	_testCompatibility(t, CompatBackward, base, added, 1)
+	_testCompatibility(t, CompatForward, base, added, 0)
+
+	// adding a nullable attribute
+	_testCompatibility(t, CompatFull, base, []*Attribute{id, name, {AttrName: "memo", Nullable: true, DataType: DataTypeString}}, 0)
+
+	// widening and narrowing the types
+	widened := []*Attribute{{AttrName: "id", DataType: DataTypeDecimal}, {AttrName: "name", DataType: DataTypeString, Nullable: true}}
+	_testCompatibility(t, CompatBackward, base, widened, 0)
+	_testCompatibility(t, CompatForward, base, widened, 2)
+	_testCompatibility(t, CompatBackward, widened, base, 2)
+
+	// nullability
+	nonNull := []*Attribute{id, {AttrName: "name", DataType: DataTypeString, MaxLength: 32}}
+	_testCompatibility(t, CompatBackward, base, nonNull, 1)
+	_testCompatibility(t, CompatForward, base, nonNull, 0)
+	_testCompatibility(t, CompatForward, nonNull, base, 1)
+}
+
+func TestTypeWidens(t *testing.T) {
+	cases := []struct {
+		from, to *Attribute
+		expected bool
+	}{
+		{&Attribute{DataType: DataTypeInt}, &Attribute{DataType: DataTypeString}, true},
+		{&Attribute{DataType: DataTypeInt}, &Attribute{DataType: DataTypeDecimal, Precision: 10}, false},
+		{&Attribute{DataType: DataTypeInt}, &Attribute{DataType: DataTypeDecimal, Precision: 21, Scale: 2}, true},
+		{&Attribute{DataType: DataTypeDecimal, Precision: 5, Scale: 2}, &Attribute{DataType: DataTypeDecimal, Precision: 6, Scale: 3}, true},
+		{&Attribute{DataType: DataTypeDecimal, Precision: 5, Scale: 2}, &Attribute{DataType: DataTypeDecimal, Precision: 5, Scale: 3}, false},
+		{&Attribute{DataType: DataTypeDecimal}, &Attribute{DataType: DataTypeDecimal, Precision: 5}, false},
+		{&Attribute{DataType: DataTypeDate}, &Attribute{DataType: DataTypeDatetime}, true},
+		{&Attribute{DataType: DataTypeDatetime}, &Attribute{DataType: DataTypeDate}, false},
+		{&Attribute{DataType: DataTypeString, MaxLength: 10}, &Attribute{DataType: DataTypeString, MaxLength: 20}, true},
+		{&Attribute{DataType: DataTypeString}, &Attribute{DataType: DataTypeString, MaxLength: 20}, false},
+		{&Attribute{DataType: DataTypeEnum, EnumValues: []string{"a"}}, &Attribute{DataType: DataTypeEnum, EnumValues: []string{"a", "b"}}, true},
+		{&Attribute{DataType: DataTypeEnum, EnumValues: []string{"a", "b"}}, &Attribute{DataType: DataTypeEnum, EnumValues: []string{"a"}}, false},
+		{&Attribute{DataType: DataTypeArray, ElementType: DataTypeInt}, &Attribute{DataType: DataTypeArray, ElementType: DataTypeString}, true},
+		{&Attribute{DataType: DataTypeArray, ElementType: DataTypeInt}, &Attribute{DataType: DataTypeString}, false},
+	}
+
+	for _, c := range cases {
+		if typeWidens(c.from, c.to) != c.expected {
+			t.Errorf("typeWidens (%s, %s) should be %t", c.from.TypeString(), c.to.TypeString(), c.expected)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortKey is one column of the order of a listing.
+type SortKey struct {
+	Column string // sql expression
+	Desc   bool
+}
+
+// Cursor is the position of the boundary row of a keyset paginated listing.
+// Values are the sort key values of the row, the last one is the row id.
+type Cursor struct {
+	Sort     string   `json:"s"`
+	Values   []string `json:"v"`
+	Backward bool     `json:"b,omitempty"`
+}
+
+// ListOptions describes the order and the page of a listing.
+// If Cursor is not nil, Offset is ignored.
+type ListOptions struct {
+	SortKeys  []SortKey
+	Offset    int64
+	Limit     int
+	Cursor    *Cursor
+	WithCount bool
+}
+
+// Page is the pagination info of a listing. Next and Prev are opaque cursor
+// tokens, Count is nil if it is not asked.
+type Page struct {
+	Count *int64
+	Next  string
+	Prev  string
+}
+
+func EncodeCursor(cursor *Cursor) string {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := &Cursor{}
+	if err := json.Unmarshal(data, cursor); err != nil || len(cursor.Values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// sortSignature identifies the order, so that a cursor can't be used with
+// another order.
+func sortSignature(keys []SortKey) string {
+	words := make([]string, len(keys))
+	for i, key := range keys {
+		if key.Desc {
+			words[i] = "-" + key.Column
+		} else {
+			words[i] = key.Column
+		}
+	}
+	return strings.Join(words, ",")
+}
+
+// withIdKey appends the id column as the last sort key to make the order total.
+// The keys after the id column are useless, for the id is unique.
+func withIdKey(keys []SortKey, idColumn string) []SortKey {
+	result := make([]SortKey, 0, len(keys)+1)
+	for _, key := range keys {
+		result = append(result, key)
+		if key.Column == idColumn {
+			return result
+		}
+	}
+
+	desc := false
+	if len(keys) > 0 {
+		desc = keys[0].Desc
+	}
+	return append(result, SortKey{Column: idColumn, Desc: desc})
+}
+
+func keysetOrder(keys []SortKey, backward bool) string {
+	words := make([]string, len(keys))
+	for i, key := range keys {
+		if key.Desc != backward {
+			words[i] = key.Column + " DESC"
+		} else {
+			words[i] = key.Column + " ASC"
+		}
+	}
+	return "ORDER BY " + strings.Join(words, ", ")
+}
+
+// keysetWhere returns the condition selecting the rows after the cursor:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+func keysetWhere(keys []SortKey, cursor *Cursor) (string, []interface{}, error) {
+	if cursor.Sort != sortSignature(keys) || len(cursor.Values) != len(keys) {
+		return "", nil, ErrInvalidCursor
+	}
+
+	ors := make([]string, 0, len(keys))
+	sqlParams := make([]interface{}, 0, len(keys)*(len(keys)+1)/2)
+	for i, key := range keys {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, fmt.Sprintf("%s=?", keys[j].Column))
+			sqlParams = append(sqlParams, cursor.Values[j])
+		}
+
+		op := ">"
+		if key.Desc != cursor.Backward {
+			op = "<"
+		}
+		ands = append(ands, fmt.Sprintf("%s%s?", key.Column, op))
+		sqlParams = append(sqlParams, cursor.Values[i])
+
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+
+	return "(" + strings.Join(ors, " OR ") + ")", sqlParams, nil
+}
+
+// newCursor makes a cursor from the values of a boundary row.
+func newCursor(keys []SortKey, values []string, backward bool) string {
+	return EncodeCursor(&Cursor{Sort: sortSignature(keys), Values: values, Backward: backward})
+}
+
+func cursorTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05.999999")
+}
+
+// keysetPageWhere adds the cursor condition to the where clause. The returned
+// offset is 0 in cursor mode.
+func keysetPageWhere(keys []SortKey, opts *ListOptions, sqlwhere string, sqlParams []interface{}) (string, []interface{}, int64, error) {
+	if opts.Cursor == nil {
+		return sqlwhere, sqlParams, opts.Offset, nil
+	}
+
+	cursorwhere, cursorParams, err := keysetWhere(keys, opts.Cursor)
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	if sqlwhere == "" {
+		sqlwhere = cursorwhere
+	} else {
+		sqlwhere = sqlwhere + " and " + cursorwhere
+	}
+	return sqlwhere, append(sqlParams, cursorParams...), 0, nil
+}
+
+// fillPage is called with the n rows (at most opts.Limit+1) fetched in the
+// keyset order. It restores the order of a backward page, sets the cursors of
+// the page and returns the number of rows in the page.
+func fillPage(page *Page, keys []SortKey, opts *ListOptions, n int,
+	swap func(i, j int), rowValues func(i int) []string) int {
+
+	hasMore := n > opts.Limit
+	if hasMore {
+		n = opts.Limit
+	}
+	if n <= 0 {
+		return 0
+	}
+
+	backward := opts.Cursor != nil && opts.Cursor.Backward
+	if backward {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+
+		if hasMore {
+			page.Prev = newCursor(keys, rowValues(0), true)
+		}
+		page.Next = newCursor(keys, rowValues(n-1), false)
+	} else {
+		if hasMore {
+			page.Next = newCursor(keys, rowValues(n-1), false)
+		}
+		if opts.Cursor != nil || opts.Offset > 0 {
+			page.Prev = newCursor(keys, rowValues(0), true)
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCursorEncoding(t *testing.T) {
+	keys := withIdKey([]SortKey{{Column: "CREATE_TIME", Desc: true}}, "REPO_ID")
+	token := newCursor(keys, []string{"2016-09-01 10:00:00", "12"}, true)
+
+	cursor, err := DecodeCursor(token)
+	if err != nil {
+		t.Fatalf("DecodeCursor (%s) error: %v", token, err)
+	}
+	if !cursor.Backward || !reflect.DeepEqual(cursor.Values, []string{"2016-09-01 10:00:00", "12"}) {
+		t.Errorf("DecodeCursor (%s) => %#v", token, cursor)
+	}
+
+	if _, err := DecodeCursor("not a cursor"); err != ErrInvalidCursor {
+		t.Errorf("DecodeCursor (not a cursor) error: %v", err)
+	}
+}
+
+func TestWithIdKey(t *testing.T) {
+	keys := withIdKey([]SortKey{{Column: "CREATE_TIME", Desc: true}}, "REPO_ID")
+	expected := []SortKey{{Column: "CREATE_TIME", Desc: true}, {Column: "REPO_ID", Desc: true}}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("withIdKey => %#v", keys)
+	}
+
+	keys = withIdKey([]SortKey{{Column: "REPO_ID"}, {Column: "CREATE_TIME"}}, "REPO_ID")
+	if !reflect.DeepEqual(keys, []SortKey{{Column: "REPO_ID"}}) {
+		t.Errorf("withIdKey => %#v", keys)
+	}
+}
+
+func TestKeysetWhere(t *testing.T) {
+	keys := []SortKey{{Column: "CREATE_TIME", Desc: true}, {Column: "REPO_ID", Desc: true}}
+
+	cursor := &Cursor{Sort: sortSignature(keys), Values: []string{"t", "12"}}
+	where, params, err := keysetWhere(keys, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if where != "((CREATE_TIME<?) OR (CREATE_TIME=? AND REPO_ID<?))" {
+		t.Errorf("forward where: %s", where)
+	}
+	if !reflect.DeepEqual(params, []interface{}{"t", "t", "12"}) {
+		t.Errorf("forward params: %#v", params)
+	}
+	if order := keysetOrder(keys, false); order != "ORDER BY CREATE_TIME DESC, REPO_ID DESC" {
+		t.Errorf("forward order: %s", order)
+	}
+
+	cursor.Backward = true
+	where, _, _ = keysetWhere(keys, cursor)
+	if where != "((CREATE_TIME>?) OR (CREATE_TIME=? AND REPO_ID>?))" {
+		t.Errorf("backward where: %s", where)
+	}
+	if order := keysetOrder(keys, true); order != "ORDER BY CREATE_TIME ASC, REPO_ID ASC" {
+		t.Errorf("backward order: %s", order)
+	}
+
+	cursor.Sort = "REPO_ID"
+	if _, _, err := keysetWhere(keys, cursor); err != ErrInvalidCursor {
+		t.Errorf("cursor of another order: %v", err)
+	}
+}
+
+func TestFillPage(t *testing.T) {
+	keys := []SortKey{{Column: "REPO_ID"}}
+	rows := []string{"5", "4", "3"} // fetched backward, limit is 2
+
+	opts := &ListOptions{Limit: 2, Cursor: &Cursor{Sort: "REPO_ID", Values: []string{"6"}, Backward: true}}
+	page := &Page{}
+	n := fillPage(page, keys, opts, len(rows),
+		func(i, j int) { rows[i], rows[j] = rows[j], rows[i] },
+		func(i int) []string { return []string{rows[i]} })
+
+	if n != 2 || !reflect.DeepEqual(rows[:n], []string{"4", "5"}) {
+		t.Errorf("backward page rows: %v", rows[:n])
+	}
+
+	prev, _ := DecodeCursor(page.Prev)
+	next, _ := DecodeCursor(page.Next)
+	if prev == nil || !prev.Backward || prev.Values[0] != "4" {
+		t.Errorf("prev cursor: %#v", prev)
+	}
+	if next == nil || next.Backward || next.Values[0] != "5" {
+		t.Errorf("next cursor: %#v", next)
+	}
+
+	page = &Page{}
+	n = fillPage(page, keys, &ListOptions{Limit: 2}, 2, nil, func(i int) []string { return []string{"x"} })
+	if n != 2 || page.Next != "" || page.Prev != "" {
+		t.Errorf("first and last page: %d %#v", n, page)
+	}
+}
+
+func TestParseSortKeys(t *testing.T) {
+	keys, err := ParseItemSort("-updatetime, itemname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SortKey{{Column: updateTimeColumn, Desc: true}, {Column: "ITEM_NAME"}}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("ParseItemSort => %#v", keys)
+	}
+
+	if _, err := ParseItemSort("-updatetime,reponame"); err == nil {
+		t.Errorf("ParseItemSort accepts reponame")
+	}
+	if _, err := ParseRepoSort("reponame,-reponame"); err == nil {
+		t.Errorf("ParseRepoSort accepts duplicated keys")
+	}
+	if _, err := ParseRepoSort("createtime,"); err == nil {
+		t.Errorf("ParseRepoSort accepts blank key")
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	keys, err := ItemSortKeys("", SortOrderAsc)
+	if err != nil || !reflect.DeepEqual(keys, []SortKey{{Column: "CREATE_TIME"}}) {
+		t.Errorf("ItemSortKeys => %#v, %v", keys, err)
+	}
+	keys, err = RepoSortKeys("updatetime", SortOrderDesc)
+	if err != nil || !reflect.DeepEqual(keys, []SortKey{{Column: updateTimeColumn, Desc: true}}) {
+		t.Errorf("RepoSortKeys => %#v, %v", keys, err)
+	}
+	if _, err := RepoSortKeys("name", SortOrderAsc); err == nil || !strings.Contains(err.Error(), "createtime, repoid, updatetime") {
+		t.Errorf("RepoSortKeys accepts unknown orderby: %v", err)
+	}
+}
@@ -3,7 +3,9 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/discovery"
 	"github.com/asiainfoLDP/datafoundry_data_integration/log"
+	"github.com/rcrowley/go-metrics"
 	"os"
 	"sync"
 	"time"
@@ -11,8 +13,26 @@ import (
 
 var (
 	logger = log.GetLogger()
+
+	// dbUnreachableTicks is the number of the successive ticks of updateDB
+	// that the db is unreachable, for the alarm rules.
+	dbUnreachableTicks = metrics.GetOrRegisterGauge("db.unreachable.ticks", metrics.DefaultRegistry)
+
+	// mysqlWatcher resolves the db by MYSQL_ADDRS or MYSQL_CONSUL_SERVICE,
+	// or by the envs named by ENV_NAME_MYSQL_ADDR and ENV_NAME_MYSQL_PORT.
+	mysqlWatcher = newMysqlWatcher()
 )
 
+func newMysqlWatcher() *discovery.Watcher {
+	var fallback discovery.Resolver = &discovery.Env{AddrEnv: "ENV_NAME_MYSQL_ADDR", PortEnv: "ENV_NAME_MYSQL_PORT", Indirect: true}
+	resolver, err := discovery.FromEnv("MYSQL", fallback)
+	if err != nil {
+		logger.Error("Resolver of mysql err: %v, fall back to ENV_NAME_MYSQL_ADDR.", err)
+		resolver = fallback
+	}
+	return discovery.NewWatcher("mysql", resolver)
+}
+
 //================================================
 
 type DbOrTx interface {
@@ -26,6 +46,11 @@ type DbOrTx interface {
 
 func InitDB() {
 
+	mysqlWatcher.OnChange(func(endpoints []discovery.Endpoint) {
+		logger.Info("Mysql moved to %v, reconnect.", endpoints)
+		reconnectDB()
+	})
+
 	for i := 0; i < 3; i++ {
 		connectDB()
 
@@ -40,29 +65,45 @@ func InitDB() {
 	}
 
 	if DB() == nil {
-		logger.Error("dbInstance is nil.")
+		// the db is connected and upgraded later by updateDB.
+		logger.Error("dbInstance is nil, retry in the background.")
+		go updateDB(false)
 		return
 	}
 
 	upgradeDB()
 
-	go updateDB()
+	go updateDB(true)
 
 	logger.Info("Init db succeed.")
 	return
 }
 
-func updateDB() {
+// updateDB reconnects to the db when it's unreachable, and upgrades it once
+// connected if not upgraded yet.
+func updateDB(upgraded bool) {
 	var err error
 	ticker := time.Tick(5 * time.Second)
 	for range ticker {
-		db := GetDB()
+		// not GetDB, which is nil until the db is upgraded.
+		dbMutex.Lock()
+		db := dbInstance
+		dbMutex.Unlock()
 		if db == nil {
-			connectDB()
+			if err = connectDB(); err == nil && !upgraded {
+				upgradeDB()
+				upgraded = true
+				logger.Info("Init db succeed.")
+			}
 		} else if err = db.Ping(); err != nil {
-			db.Close()
-			// setDB(nil) // draw snake feet
-			connectDB()
+			// the old connections are closed by connectDB.
+			err = connectDB()
+		}
+
+		if err != nil {
+			dbUnreachableTicks.Update(dbUnreachableTicks.Value() + 1)
+		} else {
+			dbUnreachableTicks.Update(0)
 		}
 	}
 }
@@ -77,22 +118,43 @@ func GetDB() *sql.DB {
 	}
 }
 
+// setDB replaces the db, and closes the old one after dbCloseGrace, so
+// that the callers which got it just before still run their queries.
 func setDB(db *sql.DB) {
 	dbMutex.Lock()
+	old := dbInstance
 	dbInstance = db
 	dbMutex.Unlock()
+
+	if old != nil && old != db {
+		time.AfterFunc(dbCloseGrace, func() { old.Close() })
+	}
 }
 
 var (
 	dbInstance *sql.DB
 	dbMutex    sync.Mutex
+
+	// connectMutex serializes connectDB.
+	connectMutex sync.Mutex
 )
 
+// dbCloseGrace is the time the replaced db is kept open.
+const dbCloseGrace = time.Minute
+
 func DB() *sql.DB {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
 	return dbInstance
 }
 
-func connectDB() {
+// connectDB connects to the db, and replaces the old connections. The
+// connections are serialized, so that a reconnection for the new address is
+// not replaced by an older one.
+func connectDB() error {
+	connectMutex.Lock()
+	defer connectMutex.Unlock()
+
 	DB_ADDR, DB_PORT := MysqlAddrPort()
 	DB_DATABASE, DB_USER, DB_PASSWORD := MysqlDatabaseUsernamePassword()
 	logger.Info("Mysql_addr: %s\n"+
@@ -112,9 +174,20 @@ func connectDB() {
 	if err != nil {
 		logger.Error("connect db error: %s.", err)
 		//logger.Alert("connect db error: %s.", err)
-	} else {
-		setDB(db)
+		if db != nil {
+			db.Close()
+		}
+		return err
 	}
+
+	setDB(db)
+	return nil
+}
+
+// reconnectDB connects to the db at its new address, and closes the old
+// connections after their queries.
+func reconnectDB() {
+	connectDB()
 }
 
 func upgradeDB() {
@@ -125,8 +198,9 @@ func upgradeDB() {
 }
 
 func MysqlAddrPort() (string, string) {
-	return os.Getenv(os.Getenv("ENV_NAME_MYSQL_ADDR")),
-		os.Getenv(os.Getenv("ENV_NAME_MYSQL_PORT"))
+	mysqlWatcher.Start(nil)
+	endpoint, _ := mysqlWatcher.Endpoint()
+	return endpoint.Host, endpoint.Port
 }
 
 func MysqlDatabaseUsernamePassword() (string, string, string) {
@@ -0,0 +1,226 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// EventVersion is the version of the Event format, increased on the
+	// incompatible changes.
+	EventVersion = 1
+
+	EventErrorMaxLength = 1024
+)
+
+// Event is published for each change of the change log, so it's only
+// published after the change is committed.
+type Event struct {
+	Version   int             `json:"version"`
+	Seq       int64           `json:"seq"` // of the change
+	Entity    string          `json:"entity"`
+	Name      string          `json:"name"`
+	Operation string          `json:"operation"`
+	Time      time.Time       `json:"time"`
+	Data      json.RawMessage `json:"data"` // the payload of the change
+}
+
+// OutboxEvent is an event waiting in the outbox to be published. Payload is
+// the json of the Event, and Key is the name of its entity.
+type OutboxEvent struct {
+	EventId  int64
+	Entity   string
+	Key      string
+	Payload  []byte
+	Attempts int
+}
+
+// NewEvent returns the event of the change, at the time of the change if
+// known, or now.
+func NewEvent(change *Change) *Event {
+	eventTime := time.Now().UTC()
+	if change.CreateTime != nil {
+		eventTime = change.CreateTime.UTC()
+	}
+	return &Event{
+		Version:   EventVersion,
+		Seq:       change.Seq,
+		Entity:    change.Entity,
+		Name:      change.Name,
+		Operation: change.Operation,
+		Time:      eventTime,
+		Data:      change.Payload,
+	}
+}
+
+// marshalEvent returns the json of the event of the change.
+func marshalEvent(change *Change) ([]byte, error) {
+	return json.Marshal(NewEvent(change))
+}
+
+// EventFilter selects the events of the catalog, a repository or a dataitem,
+// of the types. Empty Events match all the types.
+type EventFilter struct {
+	RepoName string
+	ItemName string
+	Events   []string
+}
+
+// Matches reports whether the event of the change is selected. The filters
+// of a dataitem don't select the events of its repository.
+func (f *EventFilter) Matches(change *Change) bool {
+	if f.RepoName != "" {
+		repoName, itemName := splitChangeName(change)
+		if repoName != f.RepoName || (f.ItemName != "" && itemName != f.ItemName) {
+			return false
+		}
+	}
+	if len(f.Events) == 0 {
+		return true
+	}
+	eventType := EventType(change.Entity, change.Operation)
+	for _, t := range f.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// splitChangeName returns the repository and the dataitem, if any, of the
+// change.
+func splitChangeName(change *Change) (repoName, itemName string) {
+	if change.Entity == EntityDataitem {
+		if i := strings.IndexByte(change.Name, '/'); i >= 0 {
+			return change.Name[:i], change.Name[i+1:]
+		}
+	}
+	return change.Name, ""
+}
+
+// enqueueEvent puts the event of the change into the outbox.
+func enqueueEvent(tx DbOrTx, change *Change, payload []byte) error {
+	_, err := tx.Exec(`INSERT INTO DF_EVENT_OUTBOX (ENTITY, EVENT_KEY, PAYLOAD) VALUES (?, ?, ?)`,
+		change.Entity, change.Name, string(payload))
+	return err
+}
+
+// ClaimUnsentEvents returns up to limit unsent events in the order of their
+// changes, and leases them to the caller, so that they are published outside
+// of any transaction, and again by the other relays if the lease expires.
+// Nothing is claimed while the first unsent events are leased to another
+// relay, so that the events are never reordered by the relays.
+func ClaimUnsentEvents(db *sql.DB, limit int, lease time.Duration) ([]*OutboxEvent, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT EVENT_ID, ENTITY, EVENT_KEY, PAYLOAD, ATTEMPTS,
+			LEASE_TIME IS NOT NULL AND LEASE_TIME>CURRENT_TIMESTAMP
+		FROM DF_EVENT_OUTBOX
+		WHERE SENT_TIME IS NULL
+		ORDER BY EVENT_ID
+		LIMIT ?
+		FOR UPDATE`, limit)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	events := make([]*OutboxEvent, 0, limit)
+	leased := false
+	for rows.Next() {
+		event := &OutboxEvent{}
+		payload := ""
+		if err := rows.Scan(&event.EventId, &event.Entity, &event.Key, &payload, &event.Attempts, &leased); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		if leased {
+			break
+		}
+		event.Payload = []byte(payload)
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	// the events after the leased ones wait for them.
+	if leased {
+		events = events[:0]
+	}
+
+	if len(events) > 0 {
+		sqlParams := make([]interface{}, 0, len(events)+1)
+		sqlParams = append(sqlParams, int64(lease/time.Second))
+		for _, event := range events {
+			sqlParams = append(sqlParams, event.EventId)
+		}
+		_, err := tx.Exec(`UPDATE DF_EVENT_OUTBOX SET LEASE_TIME=CURRENT_TIMESTAMP + INTERVAL ? SECOND
+			WHERE EVENT_ID IN (`+sqlPlaceholders(len(events))+`)`, sqlParams...)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return events, tx.Commit()
+}
+
+// MarkEventsSent marks the published events.
+func MarkEventsSent(db *sql.DB, eventIds []int64) error {
+	if len(eventIds) == 0 {
+		return nil
+	}
+
+	sqlParams := make([]interface{}, len(eventIds))
+	for i, eventId := range eventIds {
+		sqlParams[i] = eventId
+	}
+	_, err := db.Exec(`UPDATE DF_EVENT_OUTBOX SET SENT_TIME=CURRENT_TIMESTAMP, ATTEMPTS=ATTEMPTS+1, LEASE_TIME=NULL
+		WHERE EVENT_ID IN (`+sqlPlaceholders(len(eventIds))+`)`, sqlParams...)
+	return err
+}
+
+// MarkEventFailed records a failed attempt to publish the event.
+func MarkEventFailed(db *sql.DB, eventId int64, message string) error {
+	if utf8.RuneCountInString(message) > EventErrorMaxLength {
+		message = string([]rune(message)[:EventErrorMaxLength])
+	}
+	_, err := db.Exec(`UPDATE DF_EVENT_OUTBOX SET ATTEMPTS=ATTEMPTS+1, LAST_ERROR=? WHERE EVENT_ID=?`,
+		message, eventId)
+	return err
+}
+
+// ReleaseEvents releases the leases of the unsent events, so that they are
+// published again at the next poll rather than after the leases expire.
+func ReleaseEvents(db *sql.DB, eventIds []int64) error {
+	if len(eventIds) == 0 {
+		return nil
+	}
+
+	sqlParams := make([]interface{}, len(eventIds))
+	for i, eventId := range eventIds {
+		sqlParams[i] = eventId
+	}
+	_, err := db.Exec(`UPDATE DF_EVENT_OUTBOX SET LEASE_TIME=NULL
+		WHERE SENT_TIME IS NULL AND EVENT_ID IN (`+sqlPlaceholders(len(eventIds))+`)`, sqlParams...)
+	return err
+}
+
+// PurgeSentEvents deletes the events sent longer than the retention ago, by
+// the clock of the db, which sets the sent times.
+func PurgeSentEvents(db *sql.DB, retention time.Duration) (int64, error) {
+	result, err := db.Exec(`DELETE FROM DF_EVENT_OUTBOX WHERE SENT_TIME<CURRENT_TIMESTAMP - INTERVAL ? SECOND`,
+		int64(retention/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestEventFilter(t *testing.T) {
+	repoUpdate := &Change{Entity: EntityRepository, Name: "sales", Operation: ChangeUpdate}
+	itemUpdate := &Change{Entity: EntityDataitem, Name: "sales/orders", Operation: ChangeUpdate}
+	otherItem := &Change{Entity: EntityDataitem, Name: "hr/staff", Operation: ChangeDelete}
+
+	for _, c := range []struct {
+		filter  *EventFilter
+		matches []bool
+	}{
+		{&EventFilter{}, []bool{true, true, true}},
+		{&EventFilter{RepoName: "sales"}, []bool{true, true, false}},
+		{&EventFilter{RepoName: "sales", ItemName: "orders"}, []bool{false, true, false}},
+		{&EventFilter{Events: []string{"dataitem.update", "dataitem.delete"}}, []bool{false, true, true}},
+	} {
+		for i, change := range []*Change{repoUpdate, itemUpdate, otherItem} {
+			if c.filter.Matches(change) != c.matches[i] {
+				t.Errorf("%+v matches %s %s: expect %v", c.filter, change.Entity, change.Name, c.matches[i])
+			}
+		}
+	}
+}
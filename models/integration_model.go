@@ -2,8 +2,11 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -11,6 +14,9 @@ import (
 const (
 	SortOrderDesc = "desc"
 	SortOrderAsc  = "asc"
+
+	// OriginLocal filters the repositories not mirrored from other instances.
+	OriginLocal = "local"
 )
 
 type Repository struct {
@@ -18,6 +24,7 @@ type Repository struct {
 	RepoName    string     `json:"repoName"`
 	ChRepoName  string     `json:"chRepoName"`
 	Class       string     `json:"class,omitempty"`
+	ClassId     int        `json:"classId,omitempty"`
 	Label       string     `json:"label,omitempty"`
 	CreateUser  string     `json:"createUser,omitempty"`
 	Description string     `json:"description,omitempty"`
@@ -25,26 +32,42 @@ type Repository struct {
 	UpdateTime  *time.Time `json:"updateTime,omitempty"`
 	Status      string     `json:"status,omitempty"`
 	ImageUrl    string     `json:"imageUrl,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	ManagedBy   string     `json:"managedBy,omitempty"` // the reconciler, which makes it read-only
+	Origin      string     `json:"origin,omitempty"`    // the instance which the repository is mirrored from
+	OriginUrl   string     `json:"originUrl,omitempty"` // the repository in the origin instance
 }
 
 type Dataitem struct {
-	ItemId     int        `json:"itemId,omitempty"`
-	ItemName   string     `json:"itemName"`
-	RepoName   string     `json:"repoName"`
-	Url        string     `json:"url,omitempty"`
-	CreateTime *time.Time `json:"createTime,omitempty"`
-	UpdateTime *time.Time `json:"updateTime,omitempty"`
-	Status     string     `json:"status,omitempty"`
-	Simple     string     `json:"simple,omitempty"`
+	ItemId        int        `json:"itemId,omitempty"`
+	ItemName      string     `json:"itemName"`
+	RepoName      string     `json:"repoName"`
+	Url           string     `json:"url,omitempty"`
+	CreateTime    *time.Time `json:"createTime,omitempty"`
+	UpdateTime    *time.Time `json:"updateTime,omitempty"`
+	Status        string     `json:"status,omitempty"`
+	Simple        string     `json:"simple,omitempty"`
+	SchemaVersion int        `json:"schemaVersion"`
+	CompatMode    string     `json:"compatMode,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
 }
 
 type Attribute struct {
-	AttrId      int    `json:"attrId,omitempty"`
-	ItemId      int    `json:"itemId,omitempty"`
-	AttrName    string `json:"attrName,omitempty"`
-	Instruction string `json:"instruction,omitempty"`
-	OrderId     int    `json:"orderId,omitempty"`
-	Example     string `json:"example,omitempty"`
+	AttrId      int      `json:"attrId,omitempty"`
+	ItemId      int      `json:"itemId,omitempty"`
+	AttrName    string   `json:"attrName,omitempty"`
+	Instruction string   `json:"instruction,omitempty"`
+	OrderId     int      `json:"orderId,omitempty"`
+	Example     string   `json:"example,omitempty"`
+	DataType    string   `json:"dataType,omitempty"`
+	Precision   int      `json:"precision,omitempty"`
+	Scale       int      `json:"scale,omitempty"`
+	EnumValues  []string `json:"enumValues,omitempty"`
+	ElementType string   `json:"elementType,omitempty"`
+	Nullable    bool     `json:"nullable"`
+	PrimaryKey  bool     `json:"primaryKey,omitempty"`
+	Unit        string   `json:"unit,omitempty"`
+	MaxLength   int      `json:"maxLength,omitempty"`
 }
 
 func ValidateSortOrder(sortOrder string, defaultOrder string) string {
@@ -65,77 +88,237 @@ func ValidateOrderBy(orderBy string) string {
 	case "repoid":
 		return "REPO_ID"
 	case "updatetime":
-		return "UPDATE_TIME"
+		return updateTimeColumn
 	}
 	return ""
 }
 
-func validateOffsetAndLimit(count int64, offset *int64, limit *int) {
-	if *limit < 1 {
-		*limit = 1
+// UPDATE_TIME is NULL until the row is updated, which can't be compared in
+// the keyset conditions.
+const updateTimeColumn = "IFNULL(UPDATE_TIME, CREATE_TIME)"
+
+var (
+	repoSortColumns = map[string]string{
+		"createtime": "CREATE_TIME",
+		"updatetime": updateTimeColumn,
+		"repoid":     "REPO_ID",
+		"reponame":   "REPO_NAME",
+		"chreponame": "CH_REPO_NAME",
 	}
-	if *offset >= count {
-		*offset = count - int64(*limit)
+	itemSortColumns = map[string]string{
+		"createtime": "CREATE_TIME",
+		"updatetime": updateTimeColumn,
+		"itemid":     "ITEM_ID",
+		"itemname":   "ITEM_NAME",
 	}
-	if *offset < 0 {
-		*offset = 0
+)
+
+// ParseRepoSort parses a sort param such as "-updatetime,reponame".
+func ParseRepoSort(sort string) ([]SortKey, error) {
+	return parseSortKeys(sort, repoSortColumns)
+}
+
+// ParseItemSort parses a sort param such as "-updatetime,itemname".
+func ParseItemSort(sort string) ([]SortKey, error) {
+	return parseSortKeys(sort, itemSortColumns)
+}
+
+// parseSortKeys parses comma separated sort keys, a key prefixed with "-"
+// means descending order.
+func parseSortKeys(param string, columns map[string]string) ([]SortKey, error) {
+	words := strings.Split(param, ",")
+	keys := make([]SortKey, 0, len(words))
+	seen := make(map[string]bool, len(words))
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		desc := false
+		if strings.HasPrefix(word, "-") {
+			desc = true
+			word = word[1:]
+		} else if strings.HasPrefix(word, "+") {
+			word = word[1:]
+		}
+
+		column, ok := columns[strings.ToLower(word)]
+		if !ok {
+			allowed := make([]string, 0, len(columns))
+			for key := range columns {
+				allowed = append(allowed, key)
+			}
+			sort.Strings(allowed)
+			return nil, fmt.Errorf("unknown sort key: %s, allowed: %s", word, strings.Join(allowed, ", "))
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("duplicated sort key: %s", word)
+		}
+		seen[column] = true
+
+		keys = append(keys, SortKey{Column: column, Desc: desc})
 	}
-	if *offset+int64(*limit) > count {
-		*limit = int(count - *offset)
+
+	return keys, nil
+}
+
+// OrderByValues are the values of the orderby query param.
+var OrderByValues = []string{"createtime", "repoid", "updatetime"}
+
+func unknownOrderBy(orderBy string) error {
+	return fmt.Errorf("unknown orderby: %s, allowed: %s", orderBy, strings.Join(OrderByValues, ", "))
+}
+
+// RepoSortKeys returns the sort keys of the orderby and sortorder query params.
+func RepoSortKeys(orderBy, sortOrder string) ([]SortKey, error) {
+	column := ValidateOrderBy(orderBy)
+	if column == "" {
+		if orderBy != "" {
+			return nil, unknownOrderBy(orderBy)
+		}
+		column = "REPO_ID"
 	}
+	return []SortKey{{Column: column, Desc: sortOrder == SortOrderDesc}}, nil
+}
+
+// ItemSortKeys is like RepoSortKeys, items are ordered by create time by default.
+func ItemSortKeys(orderBy, sortOrder string) ([]SortKey, error) {
+	column := ValidateOrderBy(orderBy)
+	switch column {
+	case "":
+		if orderBy != "" {
+			return nil, unknownOrderBy(orderBy)
+		}
+		column = "CREATE_TIME"
+	case "REPO_ID":
+		column = "CREATE_TIME"
+	}
+	return []SortKey{{Column: column, Desc: sortOrder == SortOrderDesc}}, nil
 }
 
 func RecordRepo(db *sql.DB, repositoryInfo *Repository) error {
 	logger.Info("Model begin record repository")
 	defer logger.Info("Model end record repository")
 
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := recordRepo(tx, repositoryInfo); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func recordRepo(tx DbOrTx, repositoryInfo *Repository) (int, error) {
+	if repositoryInfo.ClassId > 0 {
+		if err := lockClassRef(tx, repositoryInfo.ClassId); err != nil {
+			return 0, err
+		}
+	}
+
 	nowstr := time.Now().Format("2006-01-02 15:04:05.999999")
 	sqlstr := fmt.Sprintf(`insert into DF_REPOSITORY (
-				REPO_NAME, CH_REPO_NAME, CLASS, LABEL, CREATE_USER, DESCRIPTION,
-				CREATE_TIME, UPDATE_TIME, STATUS
+				REPO_NAME, CH_REPO_NAME, CLASS, CLASS_ID, LABEL, CREATE_USER, DESCRIPTION,
+				CREATE_TIME, UPDATE_TIME, STATUS, IMAGE_URL, MANAGED_BY, ORIGIN, ORIGIN_URL
 				) values (
-				?, ?, ?, ?, ?,
-				'%s', '%s', ? )`,
+				?, ?, ?, ?, ?, ?, ?,
+				'%s', '%s', ?, ?, ?, ?, ? )`,
 		nowstr, nowstr)
-	_, err := db.Exec(sqlstr,
-		repositoryInfo.RepoName, repositoryInfo.ChRepoName, repositoryInfo.Class, repositoryInfo.Label,
-		repositoryInfo.CreateUser, repositoryInfo.Description, repositoryInfo.Status)
-	return err
+	result, err := tx.Exec(sqlstr,
+		repositoryInfo.RepoName, repositoryInfo.ChRepoName, repositoryInfo.Class, repositoryInfo.ClassId, repositoryInfo.Label,
+		repositoryInfo.CreateUser, repositoryInfo.Description, repositoryInfo.Status, repositoryInfo.ImageUrl,
+		repositoryInfo.ManagedBy, repositoryInfo.Origin, repositoryInfo.OriginUrl)
+	if err != nil {
+		return 0, err
+	}
+
+	repoId, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
 
+	tags := append(SplitLabel(repositoryInfo.Label), repositoryInfo.Tags...)
+	if err := addTags(tx, "DF_REPO_TAG", "REPO_ID", int(repoId), tags); err != nil {
+		return 0, err
+	}
+
+	if err := recordRepoChange(tx, int(repoId), ChangeCreate); err != nil {
+		return 0, err
+	}
+
+	return int(repoId), nil
 }
 
-func QueryRepoList(db *sql.DB, class, label, reponame, orderBy, sortOrder string,
-	offset int64, limit int) (int64, []*Repository, error) {
+type RepoFilter struct {
+	Class    string
+	ClassIds []int // any of
+	RepoName string
+	Tags     []string
+	Origin   string // the instance mirrored from, or OriginLocal
+
+	// the repositories must have all of the tags instead of any of them.
+	MatchAllTags bool
+}
+
+// QueryRepoList returns a page of the active repositories matching the filter.
+func QueryRepoList(db *sql.DB, filter *RepoFilter, opts *ListOptions) (*Page, []*Repository, error) {
 
 	logger.Debug("QueryRepoList begin")
 
 	sqlParams := make([]interface{}, 0, 4)
 	sqlwhere := ""
-	if class != "" {
+	if filter.Class != "" {
 		if sqlwhere == "" {
 			sqlwhere = "CLASS=?"
 		} else {
 			sqlwhere = sqlwhere + " and CLASS=?"
 		}
-		sqlParams = append(sqlParams, class)
+		sqlParams = append(sqlParams, filter.Class)
+	}
+
+	if len(filter.ClassIds) > 0 {
+		classwhere := fmt.Sprintf("CLASS_ID IN (%s)", sqlPlaceholders(len(filter.ClassIds)))
+		if sqlwhere == "" {
+			sqlwhere = classwhere
+		} else {
+			sqlwhere = sqlwhere + " and " + classwhere
+		}
+		for _, classId := range filter.ClassIds {
+			sqlParams = append(sqlParams, classId)
+		}
 	}
 
-	if label != "" {
+	if len(filter.Tags) > 0 {
+		tagwhere, tagParams := tagsWhere(filter.Tags, filter.MatchAllTags)
 		if sqlwhere == "" {
-			sqlwhere = "LABEL=?"
+			sqlwhere = tagwhere
 		} else {
-			sqlwhere = sqlwhere + " and LABEL=?"
+			sqlwhere = sqlwhere + " and " + tagwhere
 		}
-		sqlParams = append(sqlParams, label)
+		sqlParams = append(sqlParams, tagParams...)
 	}
 
-	if reponame != "" {
+	if filter.RepoName != "" {
 		if sqlwhere == "" {
 			sqlwhere = "REPO_NAME=?"
 		} else {
 			sqlwhere = sqlwhere + " and REPO_NAME=?"
 		}
-		sqlParams = append(sqlParams, reponame)
+		sqlParams = append(sqlParams, filter.RepoName)
+	}
+
+	if filter.Origin != "" {
+		origin := filter.Origin
+		if origin == OriginLocal {
+			origin = ""
+		}
+		if sqlwhere == "" {
+			sqlwhere = "ORIGIN=?"
+		} else {
+			sqlwhere = sqlwhere + " and ORIGIN=?"
+		}
+		sqlParams = append(sqlParams, origin)
 	}
 
 	if sqlwhere == "" {
@@ -145,27 +328,60 @@ func QueryRepoList(db *sql.DB, class, label, reponame, orderBy, sortOrder string
 	}
 	sqlParams = append(sqlParams, "A")
 
-	sqlorder := ""
-	if orderBy != "" {
-		sqlorder = fmt.Sprintf(" order by %s", orderBy)
+	page := &Page{}
+	if opts.WithCount {
+		count, err := queryRepoCount(db, sqlwhere, sqlParams...)
+		if err != nil {
+			logger.Error(err.Error())
+			return nil, nil, err
+		}
+		page.Count = &count
 	}
 
-	count, err := queryRepoCount(db, sqlwhere, sqlParams...)
+	keys := withIdKey(opts.SortKeys, "REPO_ID")
+	sqlwhere, sqlParams, offset, err := keysetPageWhere(keys, opts, sqlwhere, sqlParams)
 	if err != nil {
-		logger.Error(err.Error())
-		return 0, nil, err
+		return nil, nil, err
 	}
-	validateOffsetAndLimit(count, &offset, &limit)
 
+	// one more row is fetched to know whether or not there is a next page.
 	repos, err := queryRepos(db,
-		sqlwhere, sqlorder,
-		limit, offset, sqlParams...)
+		sqlwhere, keysetOrder(keys, opts.Cursor != nil && opts.Cursor.Backward),
+		opts.Limit+1, offset, sqlParams...)
 
 	if err != nil {
 		logger.Error(err.Error())
-		return 0, nil, err
+		return nil, nil, err
+	}
+
+	n := fillPage(page, keys, opts, len(repos),
+		func(i, j int) { repos[i], repos[j] = repos[j], repos[i] },
+		func(i int) []string { return repoSortValues(repos[i], keys) })
+
+	return page, repos[:n], nil
+}
+
+func repoSortValues(repo *Repository, keys []SortKey) []string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		switch key.Column {
+		case "REPO_ID":
+			values[i] = strconv.Itoa(repo.RepoId)
+		case "REPO_NAME":
+			values[i] = repo.RepoName
+		case "CH_REPO_NAME":
+			values[i] = repo.ChRepoName
+		case "CREATE_TIME":
+			values[i] = cursorTime(repo.CreateTime)
+		case updateTimeColumn:
+			if repo.UpdateTime != nil {
+				values[i] = cursorTime(repo.UpdateTime)
+			} else {
+				values[i] = cursorTime(repo.CreateTime)
+			}
+		}
 	}
-	return count, repos, nil
+	return values
 }
 
 func QueryRepo(db *sql.DB, reponame string) (*Repository, error) {
@@ -176,8 +392,12 @@ func QueryRepo(db *sql.DB, reponame string) (*Repository, error) {
 		REPO_ID,
 		REPO_NAME,
 		CH_REPO_NAME,
+		CLASS_ID,
 		CREATE_USER,
-		DESCRIPTION
+		DESCRIPTION,
+		MANAGED_BY,
+		ORIGIN,
+		ORIGIN_URL
 		FROM DF_REPOSITORY
 		WHERE
 		REPO_NAME=? AND STATUS = ?`,
@@ -185,14 +405,23 @@ func QueryRepo(db *sql.DB, reponame string) (*Repository, error) {
 		&repo.RepoId,
 		&repo.RepoName,
 		&repo.ChRepoName,
+		&repo.ClassId,
 		&repo.CreateUser,
-		&repo.Description)
+		&repo.Description,
+		&repo.ManagedBy,
+		&repo.Origin,
+		&repo.OriginUrl)
 
 	if err != nil {
 		logger.Error(err.Error())
 		return nil, err
 	}
 
+	repo.Tags, err = QueryRepoTags(db, repo.RepoId)
+	if err != nil {
+		return nil, err
+	}
+
 	return repo, nil
 }
 
@@ -206,7 +435,6 @@ func QueryItemList(db *sql.DB, reponame string) ([]*Dataitem, error) {
 	sqlParams = append(sqlParams, reponame)
 	sqlParams = append(sqlParams, "A")
 
-	//count, err := queryItemCount(db, sqlwhere, sqlParams...)
 	items, err := queryItems(db, sqlwhere, sqlorder, sqlParams...)
 	if err != nil {
 		logger.Error(err.Error())
@@ -216,11 +444,86 @@ func QueryItemList(db *sql.DB, reponame string) ([]*Dataitem, error) {
 	return items, nil
 }
 
+type ItemFilter struct {
+	RepoName string
+	ItemName string
+	Keyword  string // part of the item name
+}
+
+// QueryItemPage returns a page of the active dataitems matching the filter.
+func QueryItemPage(db *sql.DB, filter *ItemFilter, opts *ListOptions) (*Page, []*Dataitem, error) {
+	logger.Debug("QueryItemPage begin")
+
+	sqlwhere := "REPO_NAME=? AND STATUS=?"
+	sqlParams := []interface{}{filter.RepoName, "A"}
+
+	if filter.ItemName != "" {
+		sqlwhere = sqlwhere + " AND ITEM_NAME=?"
+		sqlParams = append(sqlParams, filter.ItemName)
+	}
+
+	if filter.Keyword != "" {
+		sqlwhere = sqlwhere + " AND ITEM_NAME LIKE ?"
+		sqlParams = append(sqlParams, "%"+escapeLike(filter.Keyword)+"%")
+	}
+
+	page := &Page{}
+	if opts.WithCount {
+		count, err := queryItemCount(db, sqlwhere, sqlParams...)
+		if err != nil {
+			logger.Error(err.Error())
+			return nil, nil, err
+		}
+		page.Count = &count
+	}
+
+	keys := withIdKey(opts.SortKeys, "ITEM_ID")
+	sqlwhere, sqlParams, offset, err := keysetPageWhere(keys, opts, sqlwhere, sqlParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sqlorder := fmt.Sprintf("%s LIMIT %d OFFSET %d",
+		keysetOrder(keys, opts.Cursor != nil && opts.Cursor.Backward), opts.Limit+1, offset)
+	items, err := queryItems(db, sqlwhere, sqlorder, sqlParams...)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, nil, err
+	}
+
+	n := fillPage(page, keys, opts, len(items),
+		func(i, j int) { items[i], items[j] = items[j], items[i] },
+		func(i int) []string { return itemSortValues(items[i], keys) })
+
+	return page, items[:n], nil
+}
+
+func itemSortValues(item *Dataitem, keys []SortKey) []string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		switch key.Column {
+		case "ITEM_ID":
+			values[i] = strconv.Itoa(item.ItemId)
+		case "ITEM_NAME":
+			values[i] = item.ItemName
+		case "CREATE_TIME":
+			values[i] = cursorTime(item.CreateTime)
+		case updateTimeColumn:
+			if item.UpdateTime != nil {
+				values[i] = cursorTime(item.UpdateTime)
+			} else {
+				values[i] = cursorTime(item.CreateTime)
+			}
+		}
+	}
+	return values
+}
+
 func QueryItem(db *sql.DB, repoName, itemName string) (*Dataitem, error) {
 	logger.Debug("QueryRepoList begin")
 	item := new(Dataitem)
 
-	err := db.QueryRow(`SELECT ITEM_ID,ITEM_NAME,URL,UPDATE_TIME,SIMPLE
+	err := db.QueryRow(`SELECT ITEM_ID,ITEM_NAME,URL,UPDATE_TIME,SIMPLE,SCHEMA_VERSION,COMPAT_MODE
 		FROM DF_DATAITEM
 		WHERE
 		REPO_NAME=? AND ITEM_NAME=? AND STATUS = ?`,
@@ -229,13 +532,20 @@ func QueryItem(db *sql.DB, repoName, itemName string) (*Dataitem, error) {
 		&item.ItemName,
 		&item.Url,
 		&item.UpdateTime,
-		&item.Simple)
+		&item.Simple,
+		&item.SchemaVersion,
+		&item.CompatMode)
 
 	if err != nil {
 		logger.Error(err.Error())
 		return nil, err
 	}
 
+	item.Tags, err = QueryItemTags(db, item.ItemId)
+	if err != nil {
+		return nil, err
+	}
+
 	return item, nil
 }
 
@@ -257,6 +567,139 @@ func QueryAttrList(db *sql.DB, itemId int) ([]*Attribute, error) {
 	return attrs, nil
 }
 
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// UpdateAttrs replaces the attributes of the dataitem and records a new
+// schema version if they are changed. The attributes should have been
+// validated by ValidateAttrs. The current schema version is returned.
+func UpdateAttrs(db *sql.DB, itemId int, author string, attrs []*Attribute) (int, error) {
+	logger.Info("Model begin update attributes")
+	defer logger.Info("Model end update attributes")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := updateAttrs(tx, itemId, author, attrs)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return version, tx.Commit()
+}
+
+// ItemAttrs is the new attributes of a dataitem.
+type ItemAttrs struct {
+	ItemId int
+	Attrs  []*Attribute
+}
+
+// UpdateItemsAttrs updates the attributes of the dataitems in a transaction,
+// so that all or none of them are updated. The new schema versions are
+// returned, or the index of the failed dataitem with the error.
+func UpdateItemsAttrs(db *sql.DB, author string, items []*ItemAttrs) ([]int, int, error) {
+	logger.Info("Model begin update attributes of %d dataitems", len(items))
+	defer logger.Info("Model end update attributes of dataitems")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, -1, err
+	}
+
+	versions := make([]int, len(items))
+	for i, item := range items {
+		if versions[i], err = updateAttrs(tx, item.ItemId, author, item.Attrs); err != nil {
+			tx.Rollback()
+			return nil, i, err
+		}
+	}
+
+	return versions, -1, tx.Commit()
+}
+
+func updateAttrs(tx DbOrTx, itemId int, author string, attrs []*Attribute) (int, error) {
+	// lock the dataitem row, so that concurrent updates get sequential versions.
+	version, mode := 0, ""
+	err := tx.QueryRow(`SELECT SCHEMA_VERSION, COMPAT_MODE FROM DF_DATAITEM WHERE ITEM_ID=? FOR UPDATE`,
+		itemId).Scan(&version, &mode)
+	if err != nil {
+		return 0, err
+	}
+
+	oldAttrs, err := queryAttrs(tx, "ITEM_ID=?", "ORDER BY ORDER_ID", itemId)
+	if err != nil {
+		return 0, err
+	}
+	if DiffAttrs(oldAttrs, attrs).Empty() && (version > 0 || len(attrs) == 0) {
+		return version, nil
+	}
+
+	// the first schema of a dataitem is always accepted.
+	if len(oldAttrs) > 0 {
+		if violations := CheckCompatibility(mode, oldAttrs, attrs); len(violations) > 0 {
+			return 0, &IncompatibleSchemaError{Mode: mode, Violations: violations}
+		}
+	}
+
+	if err := replaceAttrs(tx, itemId, attrs); err != nil {
+		return 0, err
+	}
+
+	version++
+	if err := recordSchemaVersion(tx, itemId, version, author, attrs); err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`UPDATE DF_DATAITEM SET SCHEMA_VERSION=?, UPDATE_TIME=CURRENT_TIMESTAMP WHERE ITEM_ID=?`,
+		version, itemId)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := recordItemChange(tx, itemId, ChangeUpdate); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func replaceAttrs(tx DbOrTx, itemId int, attrs []*Attribute) error {
+	_, err := tx.Exec(`DELETE FROM DF_ATTRIBUTE WHERE ITEM_ID=?`, itemId)
+	if err != nil {
+		return err
+	}
+
+	sqlstr := `INSERT INTO DF_ATTRIBUTE (
+		ITEM_ID, ATTR_NAME, INSTRUCTION, ORDER_ID, EXAMPLE,
+		DATA_TYPE, NUM_PRECISION, NUM_SCALE, ENUM_VALUES, ELEMENT_TYPE,
+		NULLABLE, PRIMARY_KEY, UNIT, MAX_LENGTH
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, attr := range attrs {
+		enumValues := ""
+		if len(attr.EnumValues) > 0 {
+			data, err := json.Marshal(attr.EnumValues)
+			if err != nil {
+				return err
+			}
+			enumValues = string(data)
+		}
+
+		_, err := tx.Exec(sqlstr,
+			itemId, attr.AttrName, attr.Instruction, attr.OrderId, attr.Example,
+			attr.DataType, attr.Precision, attr.Scale, enumValues, attr.ElementType,
+			attr.Nullable, attr.PrimaryKey, attr.Unit, attr.MaxLength)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func queryRepoCount(db *sql.DB, sqlwhere string, sqlParams ...interface{}) (int64, error) {
 
 	count := int64(0)
@@ -273,7 +716,7 @@ func queryRepoCount(db *sql.DB, sqlwhere string, sqlParams ...interface{}) (int6
 	return count, err
 }
 
-/*func queryItemCount(db *sql.DB, sqlwhere string, sqlParams ...interface{}) (int64, error) {
+func queryItemCount(db *sql.DB, sqlwhere string, sqlParams ...interface{}) (int64, error) {
 
 	count := int64(0)
 
@@ -287,7 +730,7 @@ func queryRepoCount(db *sql.DB, sqlwhere string, sqlParams ...interface{}) (int6
 	err := db.QueryRow(sqlstr, sqlParams...).Scan(&count)
 
 	return count, err
-}*/
+}
 
 func queryRepos(db *sql.DB, sqlwhere, sqlorder string, limit int,
 	offset int64, sqlParams ...interface{}) ([]*Repository, error) {
@@ -300,7 +743,8 @@ func queryRepos(db *sql.DB, sqlwhere, sqlorder string, limit int,
 		sqlwhereall = fmt.Sprintf("WHERE %s", sqlwhere)
 	}
 	sqlstr := fmt.Sprintf(`SELECT REPO_ID, REPO_NAME,
-		CH_REPO_NAME, CLASS, LABEL, DESCRIPTION, IMAGE_URL
+		CH_REPO_NAME, CLASS, CLASS_ID, LABEL, DESCRIPTION, IMAGE_URL,
+		CREATE_TIME, UPDATE_TIME, MANAGED_BY, ORIGIN, ORIGIN_URL
 		FROM DF_REPOSITORY
 		%s
 		%s
@@ -318,18 +762,29 @@ func queryRepos(db *sql.DB, sqlwhere, sqlorder string, limit int,
 	defer rows.Close()
 
 	repos := make([]*Repository, 0, 32)
+	repoIds := make([]int, 0, 32)
 	for rows.Next() {
 		repo := &Repository{}
-		err := rows.Scan(&repo.RepoId, &repo.RepoName, &repo.ChRepoName, &repo.Class, &repo.Label, &repo.Description, &repo.ImageUrl)
+		err := rows.Scan(&repo.RepoId, &repo.RepoName, &repo.ChRepoName, &repo.Class, &repo.ClassId, &repo.Label, &repo.Description, &repo.ImageUrl,
+			&repo.CreateTime, &repo.UpdateTime, &repo.ManagedBy, &repo.Origin, &repo.OriginUrl)
 		if err != nil {
 			return nil, err
 		}
 		repos = append(repos, repo)
+		repoIds = append(repoIds, repo.RepoId)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
+	tags, err := queryTags(db, "DF_REPO_TAG", "REPO_ID", repoIds...)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		repo.Tags = tags[repo.RepoId]
+	}
+
 	return repos, nil
 }
 
@@ -342,7 +797,7 @@ func queryItems(db *sql.DB, sqlwhere, sqlorder string, sqlParams ...interface{})
 	if sqlwhere != "" {
 		sqlwhereall = fmt.Sprintf("where %s", sqlwhere)
 	}
-	sqlstr := fmt.Sprintf(`SELECT ITEM_ID,ITEM_NAME,URL
+	sqlstr := fmt.Sprintf(`SELECT ITEM_ID,ITEM_NAME,URL,CREATE_TIME,UPDATE_TIME,SCHEMA_VERSION
 		FROM DF_DATAITEM
 		%s
 		%s`,
@@ -360,7 +815,7 @@ func queryItems(db *sql.DB, sqlwhere, sqlorder string, sqlParams ...interface{})
 	items := make([]*Dataitem, 0, 32)
 	for rows.Next() {
 		item := &Dataitem{}
-		err := rows.Scan(&item.ItemId, &item.ItemName, &item.Url)
+		err := rows.Scan(&item.ItemId, &item.ItemName, &item.Url, &item.CreateTime, &item.UpdateTime, &item.SchemaVersion)
 		if err != nil {
 			return nil, err
 		}
@@ -373,7 +828,7 @@ func queryItems(db *sql.DB, sqlwhere, sqlorder string, sqlParams ...interface{})
 	return items, nil
 }
 
-func queryAttrs(db *sql.DB, sqlwhere, sqlorder string, sqlParams ...interface{}) ([]*Attribute, error) {
+func queryAttrs(db DbOrTx, sqlwhere, sqlorder string, sqlParams ...interface{}) ([]*Attribute, error) {
 
 	logger.Info("Model begin queryAttrs")
 	defer logger.Info("Model end queryAttrs")
@@ -382,7 +837,9 @@ func queryAttrs(db *sql.DB, sqlwhere, sqlorder string, sqlParams ...interface{})
 	if sqlwhere != "" {
 		sqlwhereall = fmt.Sprintf("where %s", sqlwhere)
 	}
-	sqlstr := fmt.Sprintf(`SELECT ATTR_NAME,INSTRUCTION,ORDER_ID,EXAMPLE
+	sqlstr := fmt.Sprintf(`SELECT ATTR_ID,ITEM_ID,ATTR_NAME,INSTRUCTION,ORDER_ID,EXAMPLE,
+		DATA_TYPE,NUM_PRECISION,NUM_SCALE,ENUM_VALUES,ELEMENT_TYPE,
+		NULLABLE,PRIMARY_KEY,UNIT,MAX_LENGTH
 		FROM DF_ATTRIBUTE
 		%s
 		%s`,
@@ -401,11 +858,19 @@ func queryAttrs(db *sql.DB, sqlwhere, sqlorder string, sqlParams ...interface{})
 	for rows.Next() {
 		attr := &Attribute{}
 
-		err := rows.Scan(&attr.AttrName, &attr.Instruction, &attr.OrderId, &attr.Example)
+		enumValues := ""
+		err := rows.Scan(&attr.AttrId, &attr.ItemId, &attr.AttrName, &attr.Instruction, &attr.OrderId, &attr.Example,
+			&attr.DataType, &attr.Precision, &attr.Scale, &enumValues, &attr.ElementType,
+			&attr.Nullable, &attr.PrimaryKey, &attr.Unit, &attr.MaxLength)
 
 		if err != nil {
 			return nil, err
 		}
+		if enumValues != "" {
+			if err := json.Unmarshal([]byte(enumValues), &attr.EnumValues); err != nil {
+				return nil, err
+			}
+		}
 		attrs = append(attrs, attr)
 	}
 	if err := rows.Err(); err != nil {
@@ -0,0 +1,312 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ReconcileStatusOk     = "ok"
+	ReconcileStatusFailed = "failed"
+
+	ReconcilerNameMaxLength = 64
+	ReconcileErrorMaxLength = 1024
+)
+
+var ErrReconcileRunNotFound = errors.New("reconcile run not found")
+
+type ReconcileOptions struct {
+	Reconciler string // the name of the reconciler, which manages the repositories
+	Owner      string // the owner of the created repositories
+	Prune      bool   // delete the managed entities not in the specs, instead of releasing them
+	DryRun     bool
+
+	// fail on the unmanaged repositories in the specs instead of taking them
+	// over, so that the local repositories are never overwritten.
+	Exclusive bool
+}
+
+// ReconcileRun records a run of a reconciler. Report is omitted in the run
+// list.
+type ReconcileRun struct {
+	RunId      int           `json:"runId"`
+	Reconciler string        `json:"reconciler"`
+	Dir        string        `json:"dir"`
+	DryRun     bool          `json:"dryRun"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	Report     *ImportReport `json:"report,omitempty"`
+	StartTime  *time.Time    `json:"startTime,omitempty"`
+	EndTime    *time.Time    `json:"endTime,omitempty"`
+}
+
+// ReconcileCatalog converges the catalog to the specs in a transaction, as
+// ImportCatalog does, except that the specs are authoritative: the omitted
+// tags, items and attrs are emptied. The repositories in the specs become
+// managed by the reconciler, which fails if another reconciler manages any
+// of them, or if exclusive and any is unmanaged. The managed repositories
+// not in the specs are released, or deleted with their dataitems if pruned,
+// and so are the dataitems not in the specs of the managed repositories.
+func ReconcileCatalog(db *sql.DB, specs []*RepoSpec, opts *ReconcileOptions) (*ImportReport, error) {
+	logger.Info("Model begin reconcile catalog")
+	defer logger.Info("Model end reconcile catalog")
+
+	normalizeReconcileSpecs(specs, opts.Reconciler)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{
+		DryRun:    opts.DryRun,
+		Created:   []*EntityChange{},
+		Updated:   []*EntityChange{},
+		Unchanged: []*EntityChange{},
+		Deleted:   []*EntityChange{},
+	}
+	canEdit := func(repo *Repository) bool {
+		return (repo.ManagedBy == "" && !opts.Exclusive) || repo.ManagedBy == opts.Reconciler
+	}
+	names := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		names[spec.Name] = true
+		err := importRepo(tx, spec, opts.Owner, canEdit, report)
+		if err == nil && opts.Prune {
+			err = pruneItems(tx, spec, report)
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := releaseRepos(tx, names, opts, report); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return report, tx.Rollback()
+	}
+	return report, tx.Commit()
+}
+
+func normalizeReconcileSpecs(specs []*RepoSpec, reconciler string) {
+	for _, spec := range specs {
+		spec.ManagedBy = reconciler
+		if spec.Tags == nil {
+			spec.Tags = []string{}
+		}
+		if spec.Items == nil {
+			spec.Items = []*ItemSpec{}
+		}
+		for _, item := range spec.Items {
+			if item.Tags == nil {
+				item.Tags = []string{}
+			}
+			if item.Attrs == nil {
+				item.Attrs = []*Attribute{}
+			}
+		}
+	}
+}
+
+// pruneItems deletes the dataitems of the repository not in the spec.
+func pruneItems(tx DbOrTx, spec *RepoSpec, report *ImportReport) error {
+	rows, err := tx.Query(`SELECT ITEM_ID, ITEM_NAME FROM DF_DATAITEM
+		WHERE REPO_NAME=? AND STATUS='A' ORDER BY ITEM_ID FOR UPDATE`, spec.Name)
+	if err != nil {
+		return err
+	}
+	names := make(map[string]bool, len(spec.Items))
+	for _, item := range spec.Items {
+		names[item.Name] = true
+	}
+	prunedIds, prunedNames := []int{}, []string{}
+	for rows.Next() {
+		itemId, itemName := 0, ""
+		if err := rows.Scan(&itemId, &itemName); err != nil {
+			rows.Close()
+			return err
+		}
+		if !names[itemName] {
+			prunedIds = append(prunedIds, itemId)
+			prunedNames = append(prunedNames, itemName)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, itemId := range prunedIds {
+		_, err := tx.Exec(`UPDATE DF_DATAITEM SET STATUS='D', UPDATE_TIME=CURRENT_TIMESTAMP WHERE ITEM_ID=?`, itemId)
+		if err != nil {
+			return err
+		}
+		if err := recordItemChange(tx, itemId, ChangeDelete); err != nil {
+			return err
+		}
+		report.Deleted = append(report.Deleted, &EntityChange{Kind: EntityDataitem,
+			Name: spec.Name + "/" + prunedNames[i]})
+	}
+	return nil
+}
+
+// releaseRepos releases, or deletes if pruned, the repositories managed by
+// the reconciler not in the names.
+func releaseRepos(tx DbOrTx, names map[string]bool, opts *ReconcileOptions, report *ImportReport) error {
+	rows, err := tx.Query(`SELECT REPO_ID, REPO_NAME FROM DF_REPOSITORY
+		WHERE MANAGED_BY=? AND STATUS='A' ORDER BY REPO_ID FOR UPDATE`, opts.Reconciler)
+	if err != nil {
+		return err
+	}
+	unlistedIds, unlistedNames := []int{}, []string{}
+	for rows.Next() {
+		repoId, repoName := 0, ""
+		if err := rows.Scan(&repoId, &repoName); err != nil {
+			rows.Close()
+			return err
+		}
+		if !names[repoName] {
+			unlistedIds = append(unlistedIds, repoId)
+			unlistedNames = append(unlistedNames, repoName)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, repoId := range unlistedIds {
+		repoName := unlistedNames[i]
+		if !opts.Prune {
+			_, err := tx.Exec(`UPDATE DF_REPOSITORY SET MANAGED_BY='', UPDATE_TIME=CURRENT_TIMESTAMP
+				WHERE REPO_ID=?`, repoId)
+			if err != nil {
+				return err
+			}
+			if err := recordRepoChange(tx, repoId, ChangeUpdate); err != nil {
+				return err
+			}
+			report.Updated = append(report.Updated, &EntityChange{Kind: EntityRepository, Name: repoName,
+				Fields: []string{"managedBy"}})
+			continue
+		}
+
+		spec := &RepoSpec{Name: repoName, Items: []*ItemSpec{}}
+		if err := pruneItems(tx, spec, report); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`UPDATE DF_REPOSITORY SET STATUS='D', UPDATE_TIME=CURRENT_TIMESTAMP WHERE REPO_ID=?`, repoId)
+		if err != nil {
+			return err
+		}
+		if err := recordRepoChange(tx, repoId, ChangeDelete); err != nil {
+			return err
+		}
+		report.Deleted = append(report.Deleted, &EntityChange{Kind: EntityRepository, Name: repoName})
+	}
+	return nil
+}
+
+// RecordReconcileRun saves the run and sets its id.
+func RecordReconcileRun(db *sql.DB, run *ReconcileRun) error {
+	report := []byte("null")
+	if run.Report != nil {
+		var err error
+		if report, err = json.Marshal(run.Report); err != nil {
+			return err
+		}
+	}
+
+	message := run.Error
+	if utf8.RuneCountInString(message) > ReconcileErrorMaxLength {
+		message = string([]rune(message)[:ReconcileErrorMaxLength])
+	}
+	result, err := db.Exec(`INSERT INTO DF_RECONCILE_RUN (RECONCILER, DIR, DRY_RUN, STATUS, ERROR, REPORT, START_TIME)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		run.Reconciler, run.Dir, run.DryRun, run.Status, message, string(report), run.StartTime)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	run.RunId = int(id)
+	return nil
+}
+
+// QueryReconcileRuns returns the runs without the reports, the latest first,
+// and the number of all runs. An empty reconciler matches any.
+func QueryReconcileRuns(db *sql.DB, reconciler string, offset int64, limit int) (int64, []*ReconcileRun, error) {
+	logger.Debug("QueryReconcileRuns begin")
+
+	sqlwhere := "1=1"
+	sqlParams := make([]interface{}, 0, 1)
+	if reconciler != "" {
+		sqlwhere = "RECONCILER=?"
+		sqlParams = append(sqlParams, reconciler)
+	}
+
+	var count int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM DF_RECONCILE_RUN WHERE `+sqlwhere, sqlParams...).Scan(&count); err != nil {
+		logger.Error(err.Error())
+		return 0, nil, err
+	}
+
+	rows, err := db.Query(`SELECT RUN_ID, RECONCILER, DIR, DRY_RUN, STATUS, ERROR, START_TIME, END_TIME
+		FROM DF_RECONCILE_RUN
+		WHERE `+sqlwhere+`
+		ORDER BY RUN_ID DESC
+		LIMIT ? OFFSET ?`, append(sqlParams, limit, offset)...)
+	if err != nil {
+		logger.Error(err.Error())
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]*ReconcileRun, 0, limit)
+	for rows.Next() {
+		run := &ReconcileRun{}
+		err := rows.Scan(&run.RunId, &run.Reconciler, &run.Dir, &run.DryRun, &run.Status, &run.Error,
+			&run.StartTime, &run.EndTime)
+		if err != nil {
+			return 0, nil, err
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	return count, runs, nil
+}
+
+func QueryReconcileRun(db *sql.DB, runId int) (*ReconcileRun, error) {
+	logger.Debug("QueryReconcileRun begin")
+
+	run := &ReconcileRun{}
+	report := ""
+	err := db.QueryRow(`SELECT RUN_ID, RECONCILER, DIR, DRY_RUN, STATUS, ERROR, REPORT, START_TIME, END_TIME
+		FROM DF_RECONCILE_RUN
+		WHERE RUN_ID=?`, runId).Scan(
+		&run.RunId, &run.Reconciler, &run.Dir, &run.DryRun, &run.Status, &run.Error, &report,
+		&run.StartTime, &run.EndTime)
+	if err == sql.ErrNoRows {
+		return nil, ErrReconcileRunNotFound
+	} else if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(report), &run.Report); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+var ErrSchemaVersionNotFound = errors.New("schema version not found")
+
+// SchemaVersion is an immutable snapshot of the attributes of a dataitem.
+// Attrs is omitted in the version list.
+type SchemaVersion struct {
+	ItemId     int          `json:"itemId"`
+	Version    int          `json:"version"`
+	Author     string       `json:"author"`
+	CreateTime *time.Time   `json:"createTime,omitempty"`
+	Attrs      []*Attribute `json:"attrs,omitempty"`
+}
+
+// AttrChange is an attribute in both versions with different definitions.
+// Fields are the json names of the changed fields.
+type AttrChange struct {
+	AttrName string     `json:"attrName"`
+	Fields   []string   `json:"fields"`
+	Old      *Attribute `json:"old"`
+	New      *Attribute `json:"new"`
+}
+
+type SchemaDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Added   []*Attribute  `json:"added"`
+	Removed []*Attribute  `json:"removed"`
+	Changed []*AttrChange `json:"changed"`
+}
+
+func (diff *SchemaDiff) Empty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+// DiffAttrs compares two attribute sets by the case-insensitive attribute
+// names. A name changed only in case is a changed field.
+func DiffAttrs(oldAttrs, newAttrs []*Attribute) *SchemaDiff {
+	diff := &SchemaDiff{
+		Added:   []*Attribute{},
+		Removed: []*Attribute{},
+		Changed: []*AttrChange{},
+	}
+
+	olds := make(map[string]*Attribute, len(oldAttrs))
+	for _, attr := range oldAttrs {
+		olds[attrKey(attr.AttrName)] = attr
+	}
+	news := make(map[string]*Attribute, len(newAttrs))
+	for _, attr := range newAttrs {
+		news[attrKey(attr.AttrName)] = attr
+	}
+
+	for _, attr := range newAttrs {
+		old, ok := olds[attrKey(attr.AttrName)]
+		if !ok {
+			diff.Added = append(diff.Added, attr)
+			continue
+		}
+		if fields := attrChangedFields(old, attr); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, &AttrChange{
+				AttrName: attr.AttrName,
+				Fields:   fields,
+				Old:      old,
+				New:      attr,
+			})
+		}
+	}
+	for _, attr := range oldAttrs {
+		if _, ok := news[attrKey(attr.AttrName)]; !ok {
+			diff.Removed = append(diff.Removed, attr)
+		}
+	}
+
+	return diff
+}
+
+func attrChangedFields(old, attr *Attribute) []string {
+	fields := make([]string, 0, 4)
+	add := func(changed bool, field string) {
+		if changed {
+			fields = append(fields, field)
+		}
+	}
+
+	add(old.AttrName != attr.AttrName, "attrName")
+	add(old.Instruction != attr.Instruction, "instruction")
+	add(old.OrderId != attr.OrderId, "orderId")
+	add(old.Example != attr.Example, "example")
+	add(old.DataType != attr.DataType, "dataType")
+	add(old.Precision != attr.Precision, "precision")
+	add(old.Scale != attr.Scale, "scale")
+	add(len(old.EnumValues)+len(attr.EnumValues) > 0 && !reflect.DeepEqual(old.EnumValues, attr.EnumValues), "enumValues")
+	add(old.ElementType != attr.ElementType, "elementType")
+	add(old.Nullable != attr.Nullable, "nullable")
+	add(old.PrimaryKey != attr.PrimaryKey, "primaryKey")
+	add(old.Unit != attr.Unit, "unit")
+	add(old.MaxLength != attr.MaxLength, "maxLength")
+
+	return fields
+}
+
+// snapshotAttrs drops the row ids, which change on every update.
+func snapshotAttrs(attrs []*Attribute) []*Attribute {
+	snapshot := make([]*Attribute, len(attrs))
+	for i, attr := range attrs {
+		a := *attr
+		a.AttrId = 0
+		a.ItemId = 0
+		snapshot[i] = &a
+	}
+	return snapshot
+}
+
+func recordSchemaVersion(tx DbOrTx, itemId, version int, author string, attrs []*Attribute) error {
+	data, err := json.Marshal(snapshotAttrs(attrs))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO DF_SCHEMA_VERSION (ITEM_ID, VERSION, AUTHOR, ATTRS) VALUES (?, ?, ?, ?)`,
+		itemId, version, author, string(data))
+	return err
+}
+
+// QuerySchemaVersions returns the versions of the dataitem without the
+// attributes, the latest first.
+func QuerySchemaVersions(db *sql.DB, itemId int) ([]*SchemaVersion, error) {
+	logger.Debug("QuerySchemaVersions begin")
+
+	rows, err := db.Query(`SELECT ITEM_ID, VERSION, AUTHOR, CREATE_TIME
+		FROM DF_SCHEMA_VERSION
+		WHERE ITEM_ID=?
+		ORDER BY VERSION DESC`, itemId)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]*SchemaVersion, 0, 16)
+	for rows.Next() {
+		v := &SchemaVersion{}
+		if err := rows.Scan(&v.ItemId, &v.Version, &v.Author, &v.CreateTime); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func QuerySchemaVersion(db *sql.DB, itemId, version int) (*SchemaVersion, error) {
+	logger.Debug("QuerySchemaVersion begin")
+
+	v := &SchemaVersion{}
+	attrs := ""
+	err := db.QueryRow(`SELECT ITEM_ID, VERSION, AUTHOR, CREATE_TIME, ATTRS
+		FROM DF_SCHEMA_VERSION
+		WHERE ITEM_ID=? AND VERSION=?`, itemId, version).Scan(
+		&v.ItemId, &v.Version, &v.Author, &v.CreateTime, &attrs)
+	if err == sql.ErrNoRows {
+		return nil, ErrSchemaVersionNotFound
+	} else if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	v.Attrs = []*Attribute{}
+	if err := json.Unmarshal([]byte(attrs), &v.Attrs); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// DiffSchemaVersions compares two versions of the dataitem. Version 0 is the
+// empty attribute set before the first version.
+func DiffSchemaVersions(db *sql.DB, itemId, from, to int) (*SchemaDiff, error) {
+	attrsOf := func(version int) ([]*Attribute, error) {
+		if version == 0 {
+			return []*Attribute{}, nil
+		}
+		v, err := QuerySchemaVersion(db, itemId, version)
+		if err != nil {
+			return nil, err
+		}
+		return v.Attrs, nil
+	}
+
+	fromAttrs, err := attrsOf(from)
+	if err != nil {
+		return nil, err
+	}
+	toAttrs, err := attrsOf(to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := DiffAttrs(fromAttrs, toAttrs)
+	diff.From, diff.To = from, to
+	return diff, nil
+}
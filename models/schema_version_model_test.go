@@ -0,0 +1,48 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffAttrs(t *testing.T) {
+	oldAttrs := []*Attribute{
+		{AttrName: "id", OrderId: 1, DataType: DataTypeInt, PrimaryKey: true},
+		{AttrName: "name", OrderId: 2, DataType: DataTypeString, Nullable: true},
+		{AttrName: "level", OrderId: 3, DataType: DataTypeEnum, EnumValues: []string{"a", "b"}, Nullable: true},
+	}
+	newAttrs := []*Attribute{
+		{AttrName: "id", OrderId: 1, DataType: DataTypeInt, PrimaryKey: true},
+		{AttrName: "level", OrderId: 2, DataType: DataTypeEnum, EnumValues: []string{"a", "b", "c"}, Nullable: true},
+		{AttrName: "price", OrderId: 3, DataType: DataTypeDecimal, Precision: 10, Scale: 2, Nullable: true},
+	}
+
+	diff := DiffAttrs(oldAttrs, newAttrs)
+	if len(diff.Added) != 1 || diff.Added[0].AttrName != "price" {
+		t.Errorf("added: %v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].AttrName != "name" {
+		t.Errorf("removed: %v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].AttrName != "level" {
+		t.Fatalf("changed: %v", diff.Changed)
+	}
+	if fields := diff.Changed[0].Fields; !reflect.DeepEqual(fields, []string{"orderId", "enumValues"}) {
+		t.Errorf("changed fields: %v", fields)
+	}
+
+	if !DiffAttrs(oldAttrs, snapshotAttrs(oldAttrs)).Empty() {
+		t.Errorf("a snapshot should equal the attributes")
+	}
+	renamed := snapshotAttrs(oldAttrs)
+	renamed[1].AttrName = "Name"
+	diff = DiffAttrs(oldAttrs, renamed)
+	if len(diff.Added)+len(diff.Removed) != 0 || len(diff.Changed) != 1 ||
+		!reflect.DeepEqual(diff.Changed[0].Fields, []string{"attrName"}) {
+		t.Errorf("expect the name changed in case, got %+v", diff)
+	}
+
+	if !DiffAttrs(nil, []*Attribute{}).Empty() {
+		t.Errorf("no attributes should equal empty attributes")
+	}
+}
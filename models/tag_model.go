@@ -0,0 +1,295 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	TagNameMaxLength = 64
+)
+
+type TagCount struct {
+	TagName string `json:"tagName"`
+	Repos   int64  `json:"repos"`
+	Items   int64  `json:"items"`
+}
+
+// SplitLabel splits an old style LABEL value, such as "finance,stock；bank",
+// into tags. Duplicated tags (case insensitive) are removed.
+func SplitLabel(label string) []string {
+	words := strings.FieldsFunc(label, func(r rune) bool {
+		switch r {
+		case ',', '，', ';', '；', '|', '、', '/':
+			return true
+		}
+		return unicode.IsSpace(r)
+	})
+
+	return NormalizeTags(words)
+}
+
+// NormalizeTags trims the tags and removes the blank and duplicated ones.
+func NormalizeTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag, ok := ValidateTagName(tag)
+		if !ok {
+			continue
+		}
+		key := strings.ToLower(tag)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, tag)
+	}
+
+	return result
+}
+
+func ValidateTagName(tag string) (string, bool) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || utf8.RuneCountInString(tag) > TagNameMaxLength {
+		return tag, false
+	}
+	return tag, true
+}
+
+func AddRepoTags(db *sql.DB, repoId int, tags []string) error {
+	logger.Info("Model begin add repository tags")
+	defer logger.Info("Model end add repository tags")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = addTags(tx, "DF_REPO_TAG", "REPO_ID", repoId, tags)
+	if err == nil {
+		err = recordRepoChange(tx, repoId, ChangeUpdate)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func RemoveRepoTag(db *sql.DB, repoId int, tag string) (bool, error) {
+	return removeRecordedTag(db, "DF_REPO_TAG", "REPO_ID", repoId, tag, recordRepoChange)
+}
+
+func QueryRepoTags(db *sql.DB, repoId int) ([]string, error) {
+	tags, err := queryTags(db, "DF_REPO_TAG", "REPO_ID", repoId)
+	if err != nil {
+		return nil, err
+	}
+	return tags[repoId], nil
+}
+
+func AddItemTags(db *sql.DB, itemId int, tags []string) error {
+	logger.Info("Model begin add dataitem tags")
+	defer logger.Info("Model end add dataitem tags")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = addTags(tx, "DF_ITEM_TAG", "ITEM_ID", itemId, tags)
+	if err == nil {
+		err = recordItemChange(tx, itemId, ChangeUpdate)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func RemoveItemTag(db *sql.DB, itemId int, tag string) (bool, error) {
+	return removeRecordedTag(db, "DF_ITEM_TAG", "ITEM_ID", itemId, tag, recordItemChange)
+}
+
+func QueryItemTags(db *sql.DB, itemId int) ([]string, error) {
+	tags, err := queryTags(db, "DF_ITEM_TAG", "ITEM_ID", itemId)
+	if err != nil {
+		return nil, err
+	}
+	return tags[itemId], nil
+}
+
+// QueryTagCloud returns the tags used by active repositories and dataitems,
+// the most used ones first.
+func QueryTagCloud(db *sql.DB, limit int) ([]*TagCount, error) {
+	logger.Debug("QueryTagCloud begin")
+
+	sqlstr := fmt.Sprintf(`SELECT TAG_NAME, REPOS, ITEMS FROM (
+		SELECT T.TAG_NAME,
+		(SELECT COUNT(*) FROM DF_REPO_TAG RT
+			JOIN DF_REPOSITORY R ON R.REPO_ID=RT.REPO_ID
+			WHERE RT.TAG_ID=T.TAG_ID AND R.STATUS='A') AS REPOS,
+		(SELECT COUNT(*) FROM DF_ITEM_TAG IT
+			JOIN DF_DATAITEM I ON I.ITEM_ID=IT.ITEM_ID
+			WHERE IT.TAG_ID=T.TAG_ID AND I.STATUS='A') AS ITEMS
+		FROM DF_TAG T
+		) C
+		WHERE REPOS+ITEMS>0
+		ORDER BY REPOS+ITEMS DESC, TAG_NAME
+		LIMIT %d`, limit)
+
+	logger.Info(">>> %v", sqlstr)
+	rows, err := db.Query(sqlstr)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	cloud := make([]*TagCount, 0, 32)
+	for rows.Next() {
+		tc := &TagCount{}
+		if err := rows.Scan(&tc.TagName, &tc.Repos, &tc.Items); err != nil {
+			return nil, err
+		}
+		cloud = append(cloud, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cloud, nil
+}
+
+// tagsWhere returns the sql condition selecting the repositories which have
+// any of (or all of, if matchAll is true) the tags.
+func tagsWhere(tags []string, matchAll bool) (string, []interface{}) {
+	sqlParams := make([]interface{}, 0, len(tags)+1)
+	for _, tag := range tags {
+		sqlParams = append(sqlParams, tag)
+	}
+
+	sqlwhere := fmt.Sprintf(`REPO_ID IN (SELECT RT.REPO_ID FROM DF_REPO_TAG RT
+		JOIN DF_TAG T ON T.TAG_ID=RT.TAG_ID
+		WHERE T.TAG_NAME IN (%s)`, sqlPlaceholders(len(tags)))
+	if matchAll {
+		sqlwhere += " GROUP BY RT.REPO_ID HAVING COUNT(DISTINCT RT.TAG_ID)=?"
+		sqlParams = append(sqlParams, len(tags))
+	}
+	sqlwhere += ")"
+
+	return sqlwhere, sqlParams
+}
+
+func sqlPlaceholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
+
+func getOrCreateTagId(db DbOrTx, tag string) (int, error) {
+	// LAST_INSERT_ID(expr) makes LastInsertId return the id of the existed tag.
+	result, err := db.Exec(`INSERT INTO DF_TAG (TAG_NAME) VALUES (?)
+		ON DUPLICATE KEY UPDATE TAG_ID=LAST_INSERT_ID(TAG_ID)`, tag)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func addTags(db DbOrTx, table, idColumn string, id int, tags []string) error {
+	sqlstr := fmt.Sprintf(`INSERT IGNORE INTO %s (%s, TAG_ID) VALUES (?, ?)`, table, idColumn)
+	for _, tag := range NormalizeTags(tags) {
+		tagId, err := getOrCreateTagId(db, tag)
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(sqlstr, id, tagId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeTag(db DbOrTx, table, idColumn string, id int, tag string) (bool, error) {
+	sqlstr := fmt.Sprintf(`DELETE X FROM %s X
+		JOIN DF_TAG T ON T.TAG_ID=X.TAG_ID
+		WHERE X.%s=? AND T.TAG_NAME=?`, table, idColumn)
+	result, err := db.Exec(sqlstr, id, strings.TrimSpace(tag))
+	if err != nil {
+		logger.Error(err.Error())
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// removeRecordedTag removes the tag in a transaction, with the change
+// recorded if it's removed.
+func removeRecordedTag(db *sql.DB, table, idColumn string, id int, tag string,
+	recordChange func(tx DbOrTx, id int, operation string) error) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	removed, err := removeTag(tx, table, idColumn, id, tag)
+	if err == nil && removed {
+		err = recordChange(tx, id, ChangeUpdate)
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	return removed, tx.Commit()
+}
+
+// queryTags returns the tags of the ids, keyed by id.
+func queryTags(db DbOrTx, table, idColumn string, ids ...int) (map[int][]string, error) {
+	tags := make(map[int][]string, len(ids))
+	if len(ids) == 0 {
+		return tags, nil
+	}
+
+	sqlParams := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		sqlParams = append(sqlParams, id)
+	}
+
+	sqlstr := fmt.Sprintf(`SELECT X.%s, T.TAG_NAME FROM %s X
+		JOIN DF_TAG T ON T.TAG_ID=X.TAG_ID
+		WHERE X.%s IN (%s)
+		ORDER BY X.CREATE_TIME, T.TAG_NAME`,
+		idColumn, table, idColumn, sqlPlaceholders(len(ids)))
+	rows, err := db.Query(sqlstr, sqlParams...)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		id, tag := 0, ""
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
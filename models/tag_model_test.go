@@ -0,0 +1,22 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func _testSplitLabel(t *testing.T, label string, expectedTags []string) {
+	tags := SplitLabel(label)
+	if !reflect.DeepEqual(tags, expectedTags) {
+		t.Errorf("SplitLabel (%s) => (%#v) != (%#v)\n", label, tags, expectedTags)
+	}
+}
+
+func TestSplitLabel(t *testing.T) {
+	_testSplitLabel(t, "", []string{})
+	_testSplitLabel(t, "finance", []string{"finance"})
+	_testSplitLabel(t, " finance, stock ;bank ", []string{"finance", "stock", "bank"})
+	_testSplitLabel(t, "金融，股票；银行、保险", []string{"金融", "股票", "银行", "保险"})
+	_testSplitLabel(t, "Finance finance|FINANCE", []string{"Finance"})
+	_testSplitLabel(t, ",,;", []string{})
+}
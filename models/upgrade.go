@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	stat "github.com/asiainfoLDP/datafoundry_data_integration/statistics"
+	"github.com/rcrowley/go-metrics"
 	"io/ioutil"
 	"path/filepath"
 	"time"
@@ -17,8 +18,18 @@ import (
 
 var dbUpgraders = []DatabaseUpgrader{
 	newDatabaseUpgrader_0(),
-	//newDatabaseUpgrader_1(),
-	//newDatabaseUpgrader_2(),
+	newDatabaseUpgrader_1(),
+	newDatabaseUpgrader_2(),
+	newDatabaseUpgrader_3(),
+	newDatabaseUpgrader_4(),
+	newDatabaseUpgrader_5(),
+	newDatabaseUpgrader_6(),
+	newDatabaseUpgrader_7(),
+	newDatabaseUpgrader_8(),
+	newDatabaseUpgrader_9(),
+	newDatabaseUpgrader_10(),
+	newDatabaseUpgrader_11(),
+	newDatabaseUpgrader_12(),
 }
 
 const (
@@ -29,6 +40,18 @@ const (
 
 var dbPhase = DbPhase_Unkown
 
+// dbPhaseGauge is the phase of the db, for the alarm rules.
+var dbPhaseGauge = metrics.GetOrRegisterGauge("db.phase", metrics.DefaultRegistry)
+
+func init() {
+	dbPhaseGauge.Update(DbPhase_Unkown)
+}
+
+func setDbPhase(phase int) {
+	dbPhase = phase
+	dbPhaseGauge.Update(int64(phase))
+}
+
 func IsServing() bool {
 	return dbPhase == DbPhase_Serving
 }
@@ -73,7 +96,7 @@ func TryToUpgradeDatabase(db *sql.DB, dbName string, reallyNeedUpgrade bool) err
 
 			logger.Info("mysql start upgrading ...")
 
-			dbPhase = DbPhase_Unkown
+			setDbPhase(DbPhase_Unkown)
 
 			for _, dbupgrader := range dbUpgraders {
 				if err = _upgradeDatabase(db, dbName, dbupgrader); err != nil {
@@ -83,7 +106,7 @@ func TryToUpgradeDatabase(db *sql.DB, dbName string, reallyNeedUpgrade bool) err
 		}
 	}
 
-	dbPhase = DbPhase_Serving
+	setDbPhase(DbPhase_Serving)
 
 	logger.Info("mysql start serving ...")
 
@@ -120,7 +143,7 @@ func _upgradeDatabase(db *sql.DB, dbName string, upgrader DatabaseUpgrader) erro
 
 	// ...
 
-	dbPhase = DbPhase_Upgrading
+	setDbPhase(DbPhase_Upgrading)
 
 	err = upgrader.Upgrade(db)
 	if err != nil {
@@ -191,3 +214,44 @@ func (upgrader DatabaseUpgrader_Base) TryToCreateTables(db *sql.DB) error {
 
 	return nil
 }
+
+// tables created in the latest sql file may already have the column, so the
+// upgraders should use this function to add columns.
+func addColumnIfNotExists(db *sql.DB, table, column, definition string) error {
+	count := 0
+	err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=? AND COLUMN_NAME=?`,
+		table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// addIndexIfNotExists adds the index of the columns, e.g. "CLASS_ID", unless
+// the table has the index already.
+func addIndexIfNotExists(db *sql.DB, table, index, columns string) error {
+	count := 0
+	err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=? AND INDEX_NAME=?`,
+		table, index).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD KEY `%s` (%s)", table, index, columns))
+	return err
+}
+
+// LatestDbVersion is the version of the database after all the upgrades.
+func LatestDbVersion() int {
+	return dbUpgraders[len(dbUpgraders)-1].NewVersion()
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_1 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_1() *DatabaseUpgrader_1 {
+	updater := &DatabaseUpgrader_1{}
+
+	updater.currentTableCreationSqlFile = "initdb_v002.sql"
+
+	updater.oldVersion = 1
+	updater.newVersion = 2
+
+	return updater
+}
+
+// the tag tables are created by TryToCreateTables, here we only split
+// the old single LABEL values into tags. The sql is against the tables of
+// version 2, instead of the tag models, which may use the later columns.
+func (upgrader DatabaseUpgrader_1) Upgrade(db *sql.DB) error {
+	rows, err := db.Query(`SELECT REPO_ID, LABEL FROM DF_REPOSITORY WHERE LABEL<>''`)
+	if err != nil {
+		return err
+	}
+
+	labels := make(map[int]string)
+	for rows.Next() {
+		repoId, label := 0, ""
+		if err := rows.Scan(&repoId, &label); err != nil {
+			rows.Close()
+			return err
+		}
+		labels[repoId] = label
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for repoId, label := range labels {
+		for _, tag := range NormalizeTags(SplitLabel(label)) {
+			result, err := tx.Exec(`INSERT INTO DF_TAG (TAG_NAME) VALUES (?)
+				ON DUPLICATE KEY UPDATE TAG_ID=LAST_INSERT_ID(TAG_ID)`, tag)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			tagId, err := result.LastInsertId()
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			_, err = tx.Exec(`INSERT IGNORE INTO DF_REPO_TAG (REPO_ID, TAG_ID) VALUES (?, ?)`, repoId, tagId)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+type DatabaseUpgrader_2 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_2() *DatabaseUpgrader_2 {
+	updater := &DatabaseUpgrader_2{}
+
+	updater.currentTableCreationSqlFile = "initdb_v003.sql"
+
+	updater.oldVersion = 2
+	updater.newVersion = 3
+
+	return updater
+}
+
+// create a class node for each distinct (case insensitive) CLASS value and
+// let the repositories reference the nodes. The sql is against the tables
+// of version 3, instead of the class models, which may use the later columns.
+func (upgrader DatabaseUpgrader_2) Upgrade(db *sql.DB) error {
+	err := addColumnIfNotExists(db, "DF_REPOSITORY", "CLASS_ID", "INT(8) NOT NULL DEFAULT 0 AFTER CLASS")
+	if err != nil {
+		return err
+	}
+	err = addIndexIfNotExists(db, "DF_REPOSITORY", "IDX_REPO_CLASS_ID", "CLASS_ID")
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT DISTINCT CLASS FROM DF_REPOSITORY WHERE CLASS<>'' AND CLASS_ID=0`)
+	if err != nil {
+		return err
+	}
+
+	classes := make(map[string]string)
+	for rows.Next() {
+		class := ""
+		if err := rows.Scan(&class); err != nil {
+			rows.Close()
+			return err
+		}
+		class = strings.TrimSpace(class)
+		if _, ok := classes[strings.ToLower(class)]; !ok && class != "" {
+			classes[strings.ToLower(class)] = class
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range classes {
+		locale := ClassLocaleEn
+		for _, r := range name {
+			if unicode.Is(unicode.Han, r) {
+				locale = ClassLocaleZh
+				break
+			}
+		}
+
+		if err := createRepoClass(db, locale, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createRepoClass(db *sql.DB, locale, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`INSERT INTO DF_CLASS (PARENT_ID, ORDER_ID) VALUES (0, 0)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	classId, err := result.LastInsertId()
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO DF_CLASS_NAME (CLASS_ID, LOCALE, NAME) VALUES (?, ?, ?)`, classId, locale, name)
+	}
+	if err == nil {
+		_, err = tx.Exec(`UPDATE DF_REPOSITORY SET CLASS_ID=?, UPDATE_TIME=UPDATE_TIME WHERE LOWER(TRIM(CLASS))=LOWER(?)`,
+			classId, name)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
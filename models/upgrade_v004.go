@@ -0,0 +1,43 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_3 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_3() *DatabaseUpgrader_3 {
+	updater := &DatabaseUpgrader_3{}
+
+	updater.currentTableCreationSqlFile = "initdb_v004.sql"
+
+	updater.oldVersion = 3
+	updater.newVersion = 4
+
+	return updater
+}
+
+// the existing attributes become nullable strings.
+func (upgrader DatabaseUpgrader_3) Upgrade(db *sql.DB) error {
+	columns := [][2]string{
+		{"DATA_TYPE", "VARCHAR(16) NOT NULL DEFAULT 'string'"},
+		{"NUM_PRECISION", "INT(4) NOT NULL DEFAULT 0"},
+		{"NUM_SCALE", "INT(4) NOT NULL DEFAULT 0"},
+		{"ENUM_VALUES", "VARCHAR(2048) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL DEFAULT ''"},
+		{"ELEMENT_TYPE", "VARCHAR(16) NOT NULL DEFAULT ''"},
+		{"NULLABLE", "TINYINT(1) NOT NULL DEFAULT 1"},
+		{"PRIMARY_KEY", "TINYINT(1) NOT NULL DEFAULT 0"},
+		{"UNIT", "VARCHAR(32) CHARACTER SET utf8 COLLATE utf8_bin NOT NULL DEFAULT ''"},
+		{"MAX_LENGTH", "INT(8) NOT NULL DEFAULT 0"},
+	}
+
+	for _, column := range columns {
+		if err := addColumnIfNotExists(db, "DF_ATTRIBUTE", column[0], column[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
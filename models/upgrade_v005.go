@@ -0,0 +1,110 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+type DatabaseUpgrader_4 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_4() *DatabaseUpgrader_4 {
+	updater := &DatabaseUpgrader_4{}
+
+	updater.currentTableCreationSqlFile = "initdb_v005.sql"
+
+	updater.oldVersion = 4
+	updater.newVersion = 5
+
+	return updater
+}
+
+// the current attributes of each dataitem become its schema version 1. The
+// sql is against the tables of version 5, instead of the attribute models,
+// which may use the later columns.
+func (upgrader DatabaseUpgrader_4) Upgrade(db *sql.DB) error {
+	err := addColumnIfNotExists(db, "DF_DATAITEM", "SCHEMA_VERSION", "INT(8) NOT NULL DEFAULT 0 AFTER SIMPLE")
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT I.ITEM_ID, R.CREATE_USER FROM DF_DATAITEM I
+		JOIN DF_REPOSITORY R ON R.REPO_NAME=I.REPO_NAME
+		WHERE I.SCHEMA_VERSION=0
+		AND EXISTS (SELECT 1 FROM DF_ATTRIBUTE A WHERE A.ITEM_ID=I.ITEM_ID)`)
+	if err != nil {
+		return err
+	}
+
+	authors := make(map[int]string)
+	for rows.Next() {
+		itemId, author := 0, ""
+		if err := rows.Scan(&itemId, &author); err != nil {
+			rows.Close()
+			return err
+		}
+		authors[itemId] = author
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for itemId, author := range authors {
+		if err := recordFirstSchemaVersion(db, itemId, author); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func recordFirstSchemaVersion(db *sql.DB, itemId int, author string) error {
+	rows, err := db.Query(`SELECT ATTR_NAME, INSTRUCTION, ORDER_ID, EXAMPLE, DATA_TYPE, NUM_PRECISION,
+		NUM_SCALE, ENUM_VALUES, ELEMENT_TYPE, NULLABLE, PRIMARY_KEY, UNIT, MAX_LENGTH
+		FROM DF_ATTRIBUTE WHERE ITEM_ID=? ORDER BY ORDER_ID`, itemId)
+	if err != nil {
+		return err
+	}
+	attrs := make([]*Attribute, 0, 16)
+	for rows.Next() {
+		attr, enumValues := &Attribute{}, ""
+		err := rows.Scan(&attr.AttrName, &attr.Instruction, &attr.OrderId, &attr.Example, &attr.DataType,
+			&attr.Precision, &attr.Scale, &enumValues, &attr.ElementType, &attr.Nullable, &attr.PrimaryKey,
+			&attr.Unit, &attr.MaxLength)
+		if err == nil && enumValues != "" {
+			err = json.Unmarshal([]byte(enumValues), &attr.EnumValues)
+		}
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		attrs = append(attrs, attr)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO DF_SCHEMA_VERSION (ITEM_ID, VERSION, AUTHOR, ATTRS) VALUES (?, 1, ?, ?)`,
+		itemId, author, string(data))
+	if err == nil {
+		_, err = tx.Exec(`UPDATE DF_DATAITEM SET SCHEMA_VERSION=1 WHERE ITEM_ID=?`, itemId)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
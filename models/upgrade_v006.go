@@ -0,0 +1,25 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_5 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_5() *DatabaseUpgrader_5 {
+	updater := &DatabaseUpgrader_5{}
+
+	updater.currentTableCreationSqlFile = "initdb_v006.sql"
+
+	updater.oldVersion = 5
+	updater.newVersion = 6
+
+	return updater
+}
+
+// the existing dataitems are not checked for compatibility.
+func (upgrader DatabaseUpgrader_5) Upgrade(db *sql.DB) error {
+	return addColumnIfNotExists(db, "DF_DATAITEM", "COMPAT_MODE", "VARCHAR(16) NOT NULL DEFAULT 'none' AFTER SCHEMA_VERSION")
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_6 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_6() *DatabaseUpgrader_6 {
+	updater := &DatabaseUpgrader_6{}
+
+	updater.currentTableCreationSqlFile = "initdb_v007.sql"
+
+	updater.oldVersion = 6
+	updater.newVersion = 7
+
+	return updater
+}
+
+// the existing repositories are not managed by any reconciler.
+func (upgrader DatabaseUpgrader_6) Upgrade(db *sql.DB) error {
+	return addColumnIfNotExists(db, "DF_REPOSITORY", "MANAGED_BY", "VARCHAR(64) NOT NULL DEFAULT '' AFTER IMAGE_URL")
+}
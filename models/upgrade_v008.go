@@ -0,0 +1,29 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_7 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_7() *DatabaseUpgrader_7 {
+	updater := &DatabaseUpgrader_7{}
+
+	updater.currentTableCreationSqlFile = "initdb_v008.sql"
+
+	updater.oldVersion = 7
+	updater.newVersion = 8
+
+	return updater
+}
+
+// the existing repositories are local, not mirrored from other instances.
+func (upgrader DatabaseUpgrader_7) Upgrade(db *sql.DB) error {
+	err := addColumnIfNotExists(db, "DF_REPOSITORY", "ORIGIN", "VARCHAR(64) NOT NULL DEFAULT '' AFTER MANAGED_BY")
+	if err != nil {
+		return err
+	}
+	return addColumnIfNotExists(db, "DF_REPOSITORY", "ORIGIN_URL", "VARCHAR(1024) NOT NULL DEFAULT '' AFTER ORIGIN")
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_8 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_8() *DatabaseUpgrader_8 {
+	updater := &DatabaseUpgrader_8{}
+
+	updater.currentTableCreationSqlFile = "initdb_v009.sql"
+
+	updater.oldVersion = 8
+	updater.newVersion = 9
+
+	return updater
+}
+
+// the change log starts with the changes after the upgrade.
+func (upgrader DatabaseUpgrader_8) Upgrade(db *sql.DB) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_9 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_9() *DatabaseUpgrader_9 {
+	updater := &DatabaseUpgrader_9{}
+
+	updater.currentTableCreationSqlFile = "initdb_v010.sql"
+
+	updater.oldVersion = 9
+	updater.newVersion = 10
+
+	return updater
+}
+
+// the events are published for the changes after the upgrade.
+func (upgrader DatabaseUpgrader_9) Upgrade(db *sql.DB) error {
+	return nil
+}
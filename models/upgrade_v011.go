@@ -0,0 +1,25 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_10 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_10() *DatabaseUpgrader_10 {
+	updater := &DatabaseUpgrader_10{}
+
+	updater.currentTableCreationSqlFile = "initdb_v011.sql"
+
+	updater.oldVersion = 10
+	updater.newVersion = 11
+
+	return updater
+}
+
+// the webhooks are new, so there is nothing to upgrade.
+func (upgrader DatabaseUpgrader_10) Upgrade(db *sql.DB) error {
+	return nil
+}
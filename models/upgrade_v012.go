@@ -0,0 +1,45 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_11 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_11() *DatabaseUpgrader_11 {
+	updater := &DatabaseUpgrader_11{}
+
+	updater.currentTableCreationSqlFile = "initdb_v012.sql"
+
+	updater.oldVersion = 11
+	updater.newVersion = 12
+
+	return updater
+}
+
+// widen CLASS to the max length of the class names, which may be truncated
+// or renamed since they were copied, so they are copied again.
+func (upgrader DatabaseUpgrader_11) Upgrade(db *sql.DB) error {
+	_, err := db.Exec(`ALTER TABLE DF_REPOSITORY MODIFY CLASS VARCHAR(128) NOT NULL`)
+	if err != nil {
+		return err
+	}
+
+	err = addIndexIfNotExists(db, "DF_REPOSITORY", "IDX_REPO_CLASS_ID", "CLASS_ID")
+	if err != nil {
+		return err
+	}
+
+	// the zh names are preferred, as by Class.Name(ClassLocaleZh).
+	for _, locale := range []string{ClassLocaleEn, ClassLocaleZh} {
+		_, err = db.Exec(`UPDATE DF_REPOSITORY R JOIN DF_CLASS_NAME N ON N.CLASS_ID=R.CLASS_ID AND N.LOCALE=?
+			SET R.CLASS=N.NAME, R.UPDATE_TIME=R.UPDATE_TIME`, locale)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
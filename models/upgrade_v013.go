@@ -0,0 +1,26 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type DatabaseUpgrader_12 struct {
+	DatabaseUpgrader_Base
+}
+
+func newDatabaseUpgrader_12() *DatabaseUpgrader_12 {
+	updater := &DatabaseUpgrader_12{}
+
+	updater.currentTableCreationSqlFile = "initdb_v013.sql"
+
+	updater.oldVersion = 12
+	updater.newVersion = 13
+
+	return updater
+}
+
+// the events in the outbox are leased to a relay while being published,
+// instead of locked.
+func (upgrader DatabaseUpgrader_12) Upgrade(db *sql.DB) error {
+	return addColumnIfNotExists(db, "DF_EVENT_OUTBOX", "LEASE_TIME", "TIMESTAMP NULL DEFAULT NULL AFTER SENT_TIME")
+}
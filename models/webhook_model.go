@@ -0,0 +1,470 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+
+	WebhookUrlMaxLength    = 1024
+	WebhookSecretMaxLength = 128
+	DeliveryErrorMaxLength = 1024
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+
+	// EventTypes are the types of the events, which the webhooks filter.
+	EventTypes = []string{
+		EventType(EntityRepository, ChangeCreate),
+		EventType(EntityRepository, ChangeUpdate),
+		EventType(EntityRepository, ChangeDelete),
+		EventType(EntityDataitem, ChangeCreate),
+		EventType(EntityDataitem, ChangeUpdate),
+		EventType(EntityDataitem, ChangeDelete),
+	}
+)
+
+// EventType is the type of the event of a change, e.g. dataitem.update.
+func EventType(entity, operation string) string {
+	return entity + "." + operation
+}
+
+// Webhook is called with the events of the catalog, a repository or a
+// dataitem, in the scope of its RepoName and ItemName. Empty Events match
+// all the types. Secret is only shown when the webhook is created.
+type Webhook struct {
+	WebhookId  int        `json:"webhookId"`
+	CreateUser string     `json:"createUser"`
+	RepoName   string     `json:"repoName,omitempty"`
+	ItemName   string     `json:"itemName,omitempty"`
+	Url        string     `json:"url"`
+	Secret     string     `json:"secret,omitempty"`
+	Events     []string   `json:"events"`
+	CreateTime *time.Time `json:"createTime,omitempty"`
+	UpdateTime *time.Time `json:"updateTime,omitempty"`
+}
+
+// Matches reports whether the webhook is called with the events of the type.
+func (hook *Webhook) Matches(eventType string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, t := range hook.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is a call of a webhook with an event. Payload is omitted in the
+// delivery list.
+type Delivery struct {
+	DeliveryId   int64           `json:"deliveryId"`
+	WebhookId    int             `json:"webhookId"`
+	EventType    string          `json:"eventType"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	ResponseCode int             `json:"responseCode,omitempty"`
+	LastError    string          `json:"lastError,omitempty"`
+	RedeliveryOf int64           `json:"redeliveryOf,omitempty"`
+	NextTime     *time.Time      `json:"nextTime,omitempty"`
+	CreateTime   *time.Time      `json:"createTime,omitempty"`
+	UpdateTime   *time.Time      `json:"updateTime,omitempty"`
+}
+
+// DueDelivery is a delivery to be sent, with the url and the secret of its
+// webhook.
+type DueDelivery struct {
+	*Delivery
+	Url    string
+	Secret string
+}
+
+// NewWebhookSecret generates a random secret.
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ValidateWebhook checks the webhook and normalizes its scope and events.
+func ValidateWebhook(hook *Webhook) error {
+	hook.RepoName = strings.TrimSpace(hook.RepoName)
+	hook.ItemName = strings.TrimSpace(hook.ItemName)
+	if hook.ItemName != "" && hook.RepoName == "" {
+		return errors.New("the repository of the dataitem is needed")
+	}
+
+	if len(hook.Url) > WebhookUrlMaxLength {
+		return errors.New("url is too long")
+	}
+	u, err := url.Parse(hook.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url: %s", hook.Url)
+	}
+	if utf8.RuneCountInString(hook.Secret) > WebhookSecretMaxLength {
+		return errors.New("secret is too long")
+	}
+
+	hook.Events, err = NormalizeEventTypes(hook.Events)
+	return err
+}
+
+// NormalizeEventTypes checks, trims, dedups and sorts the event types.
+func NormalizeEventTypes(types []string) ([]string, error) {
+	valid := make(map[string]bool, len(EventTypes))
+	for _, t := range EventTypes {
+		valid[t] = true
+	}
+	seen := make(map[string]bool, len(types))
+	events := make([]string, 0, len(types))
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if !valid[t] {
+			return nil, fmt.Errorf("invalid event type: %s", t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			events = append(events, t)
+		}
+	}
+	sort.Strings(events)
+	return events, nil
+}
+
+func splitEvents(events string) []string {
+	if events == "" {
+		return []string{}
+	}
+	return strings.Split(events, ",")
+}
+
+// CreateWebhook saves the validated webhook and sets its id.
+func CreateWebhook(db *sql.DB, hook *Webhook) error {
+	logger.Info("Model begin create webhook")
+	defer logger.Info("Model end create webhook")
+
+	result, err := db.Exec(`INSERT INTO DF_WEBHOOK (CREATE_USER, REPO_NAME, ITEM_NAME, URL, SECRET, EVENTS)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		hook.CreateUser, hook.RepoName, hook.ItemName, hook.Url, hook.Secret, strings.Join(hook.Events, ","))
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	hook.WebhookId = int(id)
+	return nil
+}
+
+// QueryWebhooks returns the webhooks of the user without the secrets. An
+// empty user matches any.
+func QueryWebhooks(db *sql.DB, user string) ([]*Webhook, error) {
+	logger.Debug("QueryWebhooks begin")
+
+	sqlwhere := "1=1"
+	sqlParams := make([]interface{}, 0, 1)
+	if user != "" {
+		sqlwhere = "CREATE_USER=?"
+		sqlParams = append(sqlParams, user)
+	}
+
+	rows, err := db.Query(`SELECT WEBHOOK_ID, CREATE_USER, REPO_NAME, ITEM_NAME, URL, EVENTS, CREATE_TIME, UPDATE_TIME
+		FROM DF_WEBHOOK
+		WHERE `+sqlwhere+`
+		ORDER BY WEBHOOK_ID`, sqlParams...)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := make([]*Webhook, 0, 16)
+	for rows.Next() {
+		hook := &Webhook{}
+		events := ""
+		err := rows.Scan(&hook.WebhookId, &hook.CreateUser, &hook.RepoName, &hook.ItemName, &hook.Url, &events,
+			&hook.CreateTime, &hook.UpdateTime)
+		if err != nil {
+			return nil, err
+		}
+		hook.Events = splitEvents(events)
+		hooks = append(hooks, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// QueryWebhook returns the webhook without the secret.
+func QueryWebhook(db *sql.DB, webhookId int) (*Webhook, error) {
+	logger.Debug("QueryWebhook begin")
+
+	hook := &Webhook{}
+	events := ""
+	err := db.QueryRow(`SELECT WEBHOOK_ID, CREATE_USER, REPO_NAME, ITEM_NAME, URL, EVENTS, CREATE_TIME, UPDATE_TIME
+		FROM DF_WEBHOOK
+		WHERE WEBHOOK_ID=?`, webhookId).Scan(
+		&hook.WebhookId, &hook.CreateUser, &hook.RepoName, &hook.ItemName, &hook.Url, &events,
+		&hook.CreateTime, &hook.UpdateTime)
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	} else if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	hook.Events = splitEvents(events)
+	return hook, nil
+}
+
+// DeleteWebhook deletes the webhook with its deliveries.
+func DeleteWebhook(db *sql.DB, webhookId int) error {
+	logger.Info("Model begin delete webhook")
+	defer logger.Info("Model end delete webhook")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM DF_WEBHOOK WHERE WEBHOOK_ID=?`, webhookId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		tx.Rollback()
+		if err == nil {
+			err = ErrWebhookNotFound
+		}
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM DF_WEBHOOK_DELIVERY WHERE WEBHOOK_ID=?`, webhookId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// enqueueDeliveries creates the deliveries of the event of the change to the
+// webhooks in its scope.
+func enqueueDeliveries(tx DbOrTx, change *Change, payload []byte) error {
+	repoName, itemName := splitChangeName(change)
+
+	// the webhooks of a dataitem are not called with the events of its
+	// repository, whose itemName is empty.
+	rows, err := tx.Query(`SELECT WEBHOOK_ID, EVENTS FROM DF_WEBHOOK
+		WHERE REPO_NAME='' OR (REPO_NAME=? AND (ITEM_NAME='' OR ITEM_NAME=?))
+		ORDER BY WEBHOOK_ID`, repoName, itemName)
+	if err != nil {
+		return err
+	}
+	eventType := EventType(change.Entity, change.Operation)
+	webhookIds := []int{}
+	for rows.Next() {
+		hook := &Webhook{}
+		events := ""
+		if err := rows.Scan(&hook.WebhookId, &events); err != nil {
+			rows.Close()
+			return err
+		}
+		hook.Events = splitEvents(events)
+		if hook.Matches(eventType) {
+			webhookIds = append(webhookIds, hook.WebhookId)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, webhookId := range webhookIds {
+		_, err := tx.Exec(`INSERT INTO DF_WEBHOOK_DELIVERY (WEBHOOK_ID, EVENT_TYPE, PAYLOAD, STATUS)
+			VALUES (?, ?, ?, ?)`, webhookId, eventType, string(payload), DeliveryPending)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryDeliveries returns the deliveries of the webhook without the payloads,
+// the latest first, and the number of all its deliveries.
+func QueryDeliveries(db *sql.DB, webhookId int, offset int64, limit int) (int64, []*Delivery, error) {
+	logger.Debug("QueryDeliveries begin")
+
+	var count int64
+	err := db.QueryRow(`SELECT COUNT(*) FROM DF_WEBHOOK_DELIVERY WHERE WEBHOOK_ID=?`, webhookId).Scan(&count)
+	if err != nil {
+		logger.Error(err.Error())
+		return 0, nil, err
+	}
+
+	rows, err := db.Query(`SELECT DELIVERY_ID, WEBHOOK_ID, EVENT_TYPE, STATUS, ATTEMPTS, RESPONSE_CODE, LAST_ERROR,
+		REDELIVERY_OF, NEXT_TIME, CREATE_TIME, UPDATE_TIME
+		FROM DF_WEBHOOK_DELIVERY
+		WHERE WEBHOOK_ID=?
+		ORDER BY DELIVERY_ID DESC
+		LIMIT ? OFFSET ?`, webhookId, limit, offset)
+	if err != nil {
+		logger.Error(err.Error())
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*Delivery, 0, limit)
+	for rows.Next() {
+		d := &Delivery{}
+		err := rows.Scan(&d.DeliveryId, &d.WebhookId, &d.EventType, &d.Status, &d.Attempts, &d.ResponseCode,
+			&d.LastError, &d.RedeliveryOf, &d.NextTime, &d.CreateTime, &d.UpdateTime)
+		if err != nil {
+			return 0, nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	return count, deliveries, nil
+}
+
+// QueryDelivery returns the delivery of the webhook with its payload.
+func QueryDelivery(db *sql.DB, webhookId int, deliveryId int64) (*Delivery, error) {
+	logger.Debug("QueryDelivery begin")
+
+	d := &Delivery{}
+	payload := ""
+	err := db.QueryRow(`SELECT DELIVERY_ID, WEBHOOK_ID, EVENT_TYPE, PAYLOAD, STATUS, ATTEMPTS, RESPONSE_CODE,
+		LAST_ERROR, REDELIVERY_OF, NEXT_TIME, CREATE_TIME, UPDATE_TIME
+		FROM DF_WEBHOOK_DELIVERY
+		WHERE DELIVERY_ID=? AND WEBHOOK_ID=?`, deliveryId, webhookId).Scan(
+		&d.DeliveryId, &d.WebhookId, &d.EventType, &payload, &d.Status, &d.Attempts, &d.ResponseCode,
+		&d.LastError, &d.RedeliveryOf, &d.NextTime, &d.CreateTime, &d.UpdateTime)
+	if err == sql.ErrNoRows {
+		return nil, ErrDeliveryNotFound
+	} else if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	d.Payload = json.RawMessage(payload)
+	return d, nil
+}
+
+// Redeliver creates a new delivery with the event of the delivery, so that
+// the attempts of the delivery are kept, and returns its id.
+func Redeliver(db *sql.DB, webhookId int, deliveryId int64) (int64, error) {
+	logger.Info("Model begin redeliver")
+	defer logger.Info("Model end redeliver")
+
+	result, err := db.Exec(`INSERT INTO DF_WEBHOOK_DELIVERY (WEBHOOK_ID, EVENT_TYPE, PAYLOAD, STATUS, REDELIVERY_OF)
+		SELECT WEBHOOK_ID, EVENT_TYPE, PAYLOAD, ?, DELIVERY_ID
+		FROM DF_WEBHOOK_DELIVERY
+		WHERE DELIVERY_ID=? AND WEBHOOK_ID=?`, DeliveryPending, deliveryId, webhookId)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, ErrDeliveryNotFound
+	}
+	return result.LastInsertId()
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries due now, and
+// postpones them by the lease, so that the other dispatchers don't send them
+// meanwhile, and they are sent again if the dispatcher dies.
+func ClaimDueDeliveries(db *sql.DB, limit int, lease time.Duration) ([]*DueDelivery, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT D.DELIVERY_ID, D.WEBHOOK_ID, D.EVENT_TYPE, D.PAYLOAD, D.ATTEMPTS, W.URL, W.SECRET
+		FROM DF_WEBHOOK_DELIVERY D
+		JOIN DF_WEBHOOK W ON W.WEBHOOK_ID=D.WEBHOOK_ID
+		WHERE D.STATUS=? AND D.NEXT_TIME<=CURRENT_TIMESTAMP
+		ORDER BY D.NEXT_TIME, D.DELIVERY_ID
+		LIMIT ?
+		FOR UPDATE`, DeliveryPending, limit)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	deliveries := make([]*DueDelivery, 0, limit)
+	for rows.Next() {
+		d := &DueDelivery{Delivery: &Delivery{Status: DeliveryPending}}
+		payload := ""
+		err := rows.Scan(&d.DeliveryId, &d.WebhookId, &d.EventType, &payload, &d.Attempts, &d.Url, &d.Secret)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		d.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if len(deliveries) > 0 {
+		sqlParams := make([]interface{}, 0, len(deliveries)+1)
+		sqlParams = append(sqlParams, int64(lease/time.Second))
+		for _, d := range deliveries {
+			sqlParams = append(sqlParams, d.DeliveryId)
+		}
+		_, err := tx.Exec(`UPDATE DF_WEBHOOK_DELIVERY SET NEXT_TIME=CURRENT_TIMESTAMP + INTERVAL ? SECOND
+			WHERE DELIVERY_ID IN (`+sqlPlaceholders(len(deliveries))+`)`, sqlParams...)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return deliveries, tx.Commit()
+}
+
+// RecordDeliveryAttempt records an attempt of the delivery, with its status
+// after the attempt and the wait before the retry if still pending. The next
+// time is computed by the db, like the due times are compared.
+func RecordDeliveryAttempt(db *sql.DB, deliveryId int64, status string, responseCode int, message string,
+	retryAfter time.Duration) error {
+	if utf8.RuneCountInString(message) > DeliveryErrorMaxLength {
+		message = string([]rune(message)[:DeliveryErrorMaxLength])
+	}
+	_, err := db.Exec(`UPDATE DF_WEBHOOK_DELIVERY
+		SET STATUS=?, ATTEMPTS=ATTEMPTS+1, RESPONSE_CODE=?, LAST_ERROR=?,
+			NEXT_TIME=CURRENT_TIMESTAMP + INTERVAL ? SECOND, UPDATE_TIME=CURRENT_TIMESTAMP
+		WHERE DELIVERY_ID=?`, status, responseCode, message, int64(retryAfter/time.Second), deliveryId)
+	return err
+}
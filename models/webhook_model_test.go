@@ -0,0 +1,39 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateWebhook(t *testing.T) {
+	hook := &Webhook{RepoName: " sales ", Url: "https://example.com/hook",
+		Events: []string{"dataitem.update", " repository.create", "dataitem.update"}}
+	if err := ValidateWebhook(hook); err != nil {
+		t.Fatal(err)
+	}
+	if hook.RepoName != "sales" || !reflect.DeepEqual(hook.Events, []string{"dataitem.update", "repository.create"}) {
+		t.Errorf("unexpected webhook %+v", hook)
+	}
+
+	for _, hook := range []*Webhook{
+		{ItemName: "orders", Url: "https://example.com/hook"},
+		{Url: "ftp://example.com/hook"},
+		{Url: "/hook"},
+		{Url: "https://example.com/hook", Events: []string{"dataitem.star"}},
+	} {
+		if err := ValidateWebhook(hook); err == nil {
+			t.Errorf("%+v: expect an error", hook)
+		}
+	}
+}
+
+func TestWebhookMatches(t *testing.T) {
+	all := &Webhook{Events: []string{}}
+	updates := &Webhook{Events: []string{EventType(EntityDataitem, ChangeUpdate)}}
+	if !all.Matches("repository.delete") || !updates.Matches("dataitem.update") || updates.Matches("dataitem.delete") {
+		t.Errorf("unexpected matches")
+	}
+	if !reflect.DeepEqual(splitEvents(""), []string{}) || !reflect.DeepEqual(splitEvents("a,b"), []string{"a", "b"}) {
+		t.Errorf("unexpected split events")
+	}
+}
@@ -0,0 +1,207 @@
+package reconcile
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/log"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var logger = log.GetLogger()
+
+// DefaultMaxBackoff caps the waits before the retries of the failed runs.
+const DefaultMaxBackoff = 30 * time.Minute
+
+// ManifestExtensions are the extensions of the manifest files, in lower case.
+var ManifestExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+}
+
+// ErrNoManifests protects the catalog from a missing or unmounted directory,
+// which would release or prune every managed repository.
+var ErrNoManifests = errors.New("no manifests in the directory")
+
+// manifestFiles lists the manifest files in the dir by name. The hidden files
+// and the sub directories are skipped.
+func manifestFiles(dir string) ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || strings.HasPrefix(name, ".") || !ManifestExtensions[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// LoadDir parses and validates the manifest files in the dir, a repository
+// per file, named after the file by default.
+func LoadDir(dir string) ([]*models.RepoSpec, error) {
+	files, err := manifestFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrNoManifests
+	}
+
+	specs := make([]*models.RepoSpec, 0, len(files))
+	fileNames := make(map[string]string, len(files))
+	for _, file := range files {
+		name := file.Name()
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		spec, err := models.ParseRepoSpec(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+		if strings.TrimSpace(spec.Name) == "" {
+			spec.Name = strings.TrimSuffix(name, filepath.Ext(name))
+		}
+		manifest := &models.CatalogManifest{Repositories: []*models.RepoSpec{spec}}
+		if err := models.ValidateCatalogManifest(manifest); err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+
+		if other, ok := fileNames[spec.Name]; ok {
+			return nil, fmt.Errorf("%s: repository %s is also in %s", name, spec.Name, other)
+		}
+		fileNames[spec.Name] = name
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// Fingerprint changes if a manifest file in the dir is added, removed or
+// modified.
+func Fingerprint(dir string) (string, error) {
+	files, err := manifestFiles(dir)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha1.New()
+	for _, file := range files {
+		fmt.Fprintf(h, "%s\t%d\t%d\n", file.Name(), file.Size(), file.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Reconciler converges the catalog to the manifest files in Dir.
+type Reconciler struct {
+	Dir        string
+	Options    models.ReconcileOptions
+	Interval   time.Duration // between the checks of the dir in Watch
+	MaxBackoff time.Duration // of the retries of the failed runs in Watch
+}
+
+// runReconciler is replaced in the tests.
+var runReconciler = (*Reconciler).Run
+
+// backoff returns the wait after the failures, from Interval doubled after
+// each one.
+func (r *Reconciler) backoff(failures int) time.Duration {
+	backoff, maxBackoff := r.Interval, r.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	for i := 1; i < failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// Run reconciles the catalog once and records the run, failed or not.
+func (r *Reconciler) Run(db *sql.DB) (*models.ReconcileRun, error) {
+	startTime := time.Now()
+	run := &models.ReconcileRun{
+		Reconciler: r.Options.Reconciler,
+		Dir:        r.Dir,
+		DryRun:     r.Options.DryRun,
+		Status:     models.ReconcileStatusOk,
+		StartTime:  &startTime,
+	}
+
+	specs, err := LoadDir(r.Dir)
+	if err == nil {
+		opts := r.Options
+		run.Report, err = models.ReconcileCatalog(db, specs, &opts)
+	}
+	if err != nil {
+		run.Status = models.ReconcileStatusFailed
+		run.Error = err.Error()
+	}
+	endTime := time.Now()
+	run.EndTime = &endTime
+
+	if err := models.RecordReconcileRun(db, run); err != nil {
+		logger.Error("Record reconcile run of %s err: %v", r.Dir, err)
+	}
+	return run, err
+}
+
+// Watch runs the reconciler at first and whenever the manifest files change,
+// until the stop channel is closed. A failed run is retried with exponential
+// backoff until it succeeds or the files change. The runs are sent to the
+// runs channel if it's not nil.
+func (r *Reconciler) Watch(db *sql.DB, stop <-chan struct{}, runs chan<- *models.ReconcileRun) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	// the fingerprint of the last successful run, and of the failed runs
+	// since, which are retried at retryTime.
+	lastFingerprint, failedFingerprint := "", ""
+	failures := 0
+	var retryTime time.Time
+	for {
+		fingerprint, err := Fingerprint(r.Dir)
+		if err != nil {
+			logger.Error("Read reconcile dir %s err: %v", r.Dir, err)
+		} else if fingerprint != lastFingerprint &&
+			(fingerprint != failedFingerprint || !time.Now().Before(retryTime)) {
+			run, err := runReconciler(r, db)
+			if err != nil {
+				if fingerprint != failedFingerprint {
+					failedFingerprint, failures = fingerprint, 0
+				}
+				failures++
+				backoff := r.backoff(failures)
+				retryTime = time.Now().Add(backoff)
+				logger.Error("Reconcile %s err: %v, retry in %v", r.Dir, err, backoff)
+			} else {
+				lastFingerprint = fingerprint
+				failedFingerprint, failures = "", 0
+			}
+			if runs != nil {
+				runs <- run
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package reconcile
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconcile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := LoadDir(dir); err != ErrNoManifests {
+		t.Errorf("empty dir err %v", err)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "sub.yaml"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		"retail.yaml": "chName: 零售\nitems:\n  - name: orders\n    attrs:\n      - attrName: id\n        dataType: int\n",
+		"hr.JSON":     `{"name": "people", "tags": ["Staff"]}`,
+		".draft.yaml": "name: draft\n",
+		"README.md":   "# catalog\n",
+	})
+
+	specs, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 2 {
+		t.Fatalf("specs %v", specs)
+	}
+	// the files are sorted by name, and the repositories are named after the
+	// files by default.
+	hr, retail := specs[0], specs[1]
+	if hr.Name != "people" || strings.Join(hr.Tags, ",") != "Staff" || hr.Items != nil {
+		t.Errorf("hr %+v", hr)
+	}
+	if retail.Name != "retail" || len(retail.Items) != 1 || len(retail.Items[0].Attrs) != 1 {
+		t.Errorf("retail %+v", retail)
+	}
+
+	writeFiles(t, dir, map[string]string{"people.yml": "description: duplicated\n"})
+	if _, err := LoadDir(dir); err == nil || !strings.Contains(err.Error(), "hr.JSON") {
+		t.Errorf("duplicated err %v", err)
+	}
+	os.Remove(filepath.Join(dir, "people.yml"))
+
+	writeFiles(t, dir, map[string]string{"bad.yaml": "items:\n  - name: orders\n    compatMode: sideways\n"})
+	if _, err := LoadDir(dir); err == nil || !strings.HasPrefix(err.Error(), "bad.yaml: ") {
+		t.Errorf("invalid err %v", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconcile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, dir, map[string]string{"retail.yaml": "chName: retail\n"})
+	first, err := Fingerprint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, dir, map[string]string{"notes.txt": "ignored\n"})
+	if fingerprint, _ := Fingerprint(dir); fingerprint != first {
+		t.Errorf("changed by a non manifest file")
+	}
+
+	writeFiles(t, dir, map[string]string{"hr.yaml": "chName: hr\n"})
+	second, _ := Fingerprint(dir)
+	if second == first {
+		t.Errorf("not changed by an added file")
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "hr.yaml"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if third, _ := Fingerprint(dir); third == second {
+		t.Errorf("not changed by a modified file")
+	}
+
+	if _, err := Fingerprint(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("no error for a missing dir")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := &Reconciler{Interval: time.Second, MaxBackoff: 5 * time.Second}
+	for i, expected := range []time.Duration{1, 2, 4, 5, 5} {
+		if backoff := r.backoff(i + 1); backoff != expected*time.Second {
+			t.Errorf("failures %d: expect %v, got %v", i+1, expected*time.Second, backoff)
+		}
+	}
+}
+
+func TestWatchRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconcile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{"retail.yaml": "chName: retail\n"})
+
+	// the first two runs fail.
+	calls := 0
+	defer func(run func(*Reconciler, *sql.DB) (*models.ReconcileRun, error)) { runReconciler = run }(runReconciler)
+	runReconciler = func(r *Reconciler, db *sql.DB) (*models.ReconcileRun, error) {
+		calls++
+		if calls <= 2 {
+			return &models.ReconcileRun{Status: models.ReconcileStatusFailed}, errors.New("db is down")
+		}
+		return &models.ReconcileRun{Status: models.ReconcileStatusOk}, nil
+	}
+
+	r := &Reconciler{Dir: dir, Interval: 5 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	stop := make(chan struct{})
+	runs := make(chan *models.ReconcileRun, 10)
+	go r.Watch(nil, stop, runs)
+	defer close(stop)
+
+	next := func() *models.ReconcileRun {
+		select {
+		case run := <-runs:
+			return run
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for a run")
+		}
+		return nil
+	}
+	for i, status := range []string{models.ReconcileStatusFailed, models.ReconcileStatusFailed, models.ReconcileStatusOk} {
+		if run := next(); run.Status != status {
+			t.Fatalf("run %d: expect %s, got %s", i, status, run.Status)
+		}
+	}
+
+	// no more runs until the files change.
+	select {
+	case run := <-runs:
+		t.Fatalf("unexpected run %+v", run)
+	case <-time.After(50 * time.Millisecond):
+	}
+	writeFiles(t, dir, map[string]string{"hr.yaml": "chName: hr\n"})
+	if run := next(); run.Status != models.ReconcileStatusOk {
+		t.Errorf("expect a run of the changed files, got %+v", run)
+	}
+}
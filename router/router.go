@@ -17,6 +17,12 @@ const (
 var (
 	Platform = Platform_DataOS
 	logger   = log.GetLogger()
+
+	// StreamPaths are the paths of the streaming responses, which disable
+	// their timeouts by api.DisableTimeout.
+	StreamPaths = map[string]bool{
+		"/integration/v1/events/stream": true,
+	}
 )
 
 //==============================================================
@@ -66,7 +72,53 @@ func NewRouter(router *httprouter.Router) {
 	router.POST("/integration/v1/repository", api.TimeoutHandle(35000*time.Millisecond, handler.CreateRepoHandler))
 	router.GET("/integration/v1/repositories", api.TimeoutHandle(35000*time.Millisecond, handler.QueryRepoListHandler))
 	router.GET("/integration/v1/repository/:reponame", api.TimeoutHandle(35000*time.Millisecond, handler.QueryRepoHandler))
+	router.GET("/integration/v1/repository/:reponame/dictionary", api.TimeoutHandle(35000*time.Millisecond, handler.DataDictionaryHandler))
+	router.POST("/integration/v1/repository/:reponame/attrs/import", api.TimeoutHandle(35000*time.Millisecond, handler.ImportAttrsHandler))
+	router.GET("/integration/v1/repository/:reponame/attrs/export", api.TimeoutHandle(35000*time.Millisecond, handler.ExportAttrsHandler))
+	router.POST("/integration/v1/catalog/import", api.TimeoutHandle(35000*time.Millisecond, handler.ImportCatalogHandler))
+	router.GET("/integration/v1/catalog/export", api.TimeoutHandle(35000*time.Millisecond, handler.ExportArchiveHandler))
+	router.GET("/integration/v1/catalog.jsonld", api.TimeoutHandle(35000*time.Millisecond, handler.CatalogDcatHandler))
+	router.GET("/integration/v1/repository/:reponame/catalog.jsonld", api.TimeoutHandle(35000*time.Millisecond, handler.RepoDcatHandler))
+	router.GET("/integration/v1/dataitem/:reponame/:itemname/dataset.jsonld", api.TimeoutHandle(35000*time.Millisecond, handler.ItemDcatHandler))
+	router.GET("/integration/v1/events/stream", api.TimeoutHandle(35000*time.Millisecond, handler.StreamEventsHandler))
+	router.GET("/integration/v1/metrics", api.TimeoutHandle(35000*time.Millisecond, handler.QueryMetricsHandler))
+	router.GET("/integration/v1/changes", api.TimeoutHandle(35000*time.Millisecond, handler.QueryChangesHandler))
+	router.POST("/integration/v1/webhooks", api.TimeoutHandle(35000*time.Millisecond, handler.CreateWebhookHandler))
+	router.GET("/integration/v1/webhooks", api.TimeoutHandle(35000*time.Millisecond, handler.QueryWebhooksHandler))
+	router.GET("/integration/v1/webhooks/:webhookid", api.TimeoutHandle(35000*time.Millisecond, handler.QueryWebhookHandler))
+	router.DELETE("/integration/v1/webhooks/:webhookid", api.TimeoutHandle(35000*time.Millisecond, handler.DeleteWebhookHandler))
+	router.GET("/integration/v1/webhooks/:webhookid/deliveries", api.TimeoutHandle(35000*time.Millisecond, handler.QueryDeliveriesHandler))
+	router.GET("/integration/v1/webhooks/:webhookid/deliveries/:deliveryid", api.TimeoutHandle(35000*time.Millisecond, handler.QueryDeliveryHandler))
+	router.POST("/integration/v1/webhooks/:webhookid/deliveries/:deliveryid/redeliver", api.TimeoutHandle(35000*time.Millisecond, handler.RedeliverHandler))
+	router.GET("/integration/v1/reconcile/runs", api.TimeoutHandle(35000*time.Millisecond, handler.QueryReconcileRunsHandler))
+	router.GET("/integration/v1/reconcile/runs/:runid", api.TimeoutHandle(35000*time.Millisecond, handler.QueryReconcileRunHandler))
+	router.GET("/integration/v1/repository/:reponame/items", api.TimeoutHandle(35000*time.Millisecond, handler.QueryItemListHandler))
 	router.GET("/integration/v1/dataitem/:reponame/:itemname", api.TimeoutHandle(35000*time.Millisecond, handler.QueryDataItemHandler))
+	// httprouter takes ":action" as a param, the custom methods (":batchGet") are dispatched by the handler.
+	router.POST("/integration/v1/dataitems:action", api.TimeoutHandle(35000*time.Millisecond, handler.DataItemsActionHandler))
+
+	router.POST("/integration/v1/repository/:reponame/tags", api.TimeoutHandle(35000*time.Millisecond, handler.AddRepoTagsHandler))
+	router.DELETE("/integration/v1/repository/:reponame/tags/:tag", api.TimeoutHandle(35000*time.Millisecond, handler.RemoveRepoTagHandler))
+	router.PUT("/integration/v1/dataitem/:reponame/:itemname/attrs", api.TimeoutHandle(35000*time.Millisecond, handler.UpdateAttrsHandler))
+	router.POST("/integration/v1/dataitem/:reponame/:itemname/attrs/check", api.TimeoutHandle(35000*time.Millisecond, handler.CheckAttrsHandler))
+	router.POST("/integration/v1/dataitem/:reponame/:itemname/attrs/infer", api.TimeoutHandle(35000*time.Millisecond, handler.InferAttrsHandler))
+	router.POST("/integration/v1/dataitem/:reponame/:itemname/attrs/introspect", api.TimeoutHandle(35000*time.Millisecond, handler.IntrospectAttrsHandler))
+	router.POST("/integration/v1/attrs/infer", api.TimeoutHandle(35000*time.Millisecond, handler.InferAttrsHandler))
+	router.PUT("/integration/v1/dataitem/:reponame/:itemname/compatibility", api.TimeoutHandle(35000*time.Millisecond, handler.UpdateCompatModeHandler))
+	router.GET("/integration/v1/dataitem/:reponame/:itemname/versions", api.TimeoutHandle(35000*time.Millisecond, handler.QuerySchemaVersionsHandler))
+	router.GET("/integration/v1/dataitem/:reponame/:itemname/versions/:version", api.TimeoutHandle(35000*time.Millisecond, handler.QuerySchemaVersionHandler))
+	router.GET("/integration/v1/dataitem/:reponame/:itemname/diff", api.TimeoutHandle(35000*time.Millisecond, handler.DiffSchemaVersionsHandler))
+	router.GET("/integration/v1/dataitem/:reponame/:itemname/schema", api.TimeoutHandle(35000*time.Millisecond, handler.ExportSchemaHandler))
+
+	router.POST("/integration/v1/dataitem/:reponame/:itemname/tags", api.TimeoutHandle(35000*time.Millisecond, handler.AddItemTagsHandler))
+	router.DELETE("/integration/v1/dataitem/:reponame/:itemname/tags/:tag", api.TimeoutHandle(35000*time.Millisecond, handler.RemoveItemTagHandler))
+	router.GET("/integration/v1/tags", api.TimeoutHandle(35000*time.Millisecond, handler.QueryTagCloudHandler))
+
+	router.GET("/integration/v1/classes", api.TimeoutHandle(35000*time.Millisecond, handler.QueryClassTreeHandler))
+	router.GET("/integration/v1/classes/:classid", api.TimeoutHandle(35000*time.Millisecond, handler.QueryClassHandler))
+	router.POST("/integration/v1/classes", api.TimeoutHandle(35000*time.Millisecond, handler.CreateClassHandler))
+	router.PUT("/integration/v1/classes/:classid", api.TimeoutHandle(35000*time.Millisecond, handler.UpdateClassHandler))
+	router.DELETE("/integration/v1/classes/:classid", api.TimeoutHandle(35000*time.Millisecond, handler.DeleteClassHandler))
 
 	//router.GET("/saasappapi/v1/apps", api.TimeoutHandle(500*time.Millisecond, QueryAppList))
 }
@@ -0,0 +1,75 @@
+package schema
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"regexp"
+)
+
+var avroSymbolValidator = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// renderAvro renders an avro record schema. The attribute names which are
+// not valid avro names are converted, the original names are kept in the
+// x-attrName properties.
+func renderAvro(item *Item) ([]byte, error) {
+	idents := identifiers(item.Attrs)
+	fields := make([]object, len(item.Attrs))
+	for i, attr := range item.Attrs {
+		field := object{{"name", idents[i]}}
+
+		t := avroType(attr.DataType, attr, idents[i])
+		if attr.Nullable {
+			field = append(field, member{"type", []interface{}{"null", t}}, member{"default", nil})
+		} else {
+			field = append(field, member{"type", t})
+		}
+
+		if attr.Instruction != "" {
+			field = append(field, member{"doc", attr.Instruction})
+		}
+		if idents[i] != attr.AttrName {
+			field = append(field, member{"x-attrName", attr.AttrName})
+		}
+		fields[i] = field
+	}
+
+	record := object{
+		{"type", "record"},
+		{"name", camelCase(identifier(item.ItemName))},
+		{"namespace", "datafoundry." + identifier(item.RepoName)},
+		{"fields", fields},
+	}
+
+	return marshalIndent(record)
+}
+
+func avroType(dataType string, attr *models.Attribute, name string) interface{} {
+	switch dataType {
+	case models.DataTypeInt:
+		return "long"
+	case models.DataTypeDecimal:
+		if attr == nil || attr.Precision == 0 {
+			// avro decimals must have a precision.
+			return "string"
+		}
+		return object{{"type", "bytes"}, {"logicalType", "decimal"},
+			{"precision", attr.Precision}, {"scale", attr.Scale}}
+	case models.DataTypeDate:
+		return object{{"type", "int"}, {"logicalType", "date"}}
+	case models.DataTypeTime:
+		return object{{"type", "int"}, {"logicalType", "time-millis"}}
+	case models.DataTypeDatetime:
+		return object{{"type", "long"}, {"logicalType", "timestamp-millis"}}
+	case models.DataTypeBoolean:
+		return "boolean"
+	case models.DataTypeEnum:
+		for _, v := range attr.EnumValues {
+			if !avroSymbolValidator.MatchString(v) {
+				return "string"
+			}
+		}
+		return object{{"type", "enum"}, {"name", camelCase(name)}, {"symbols", attr.EnumValues}}
+	case models.DataTypeArray:
+		return object{{"type", "array"}, {"items", avroType(attr.ElementType, nil, name)}}
+	}
+	return "string"
+}
@@ -0,0 +1,172 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"strings"
+)
+
+// mysqlKeyLength is the length of the string key columns without a max
+// length, as mysql can't index TEXT columns without a prefix length.
+const mysqlKeyLength = 255
+
+func mysqlQuote(ident string) string {
+	return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+}
+
+func postgresQuote(ident string) string {
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+func sqlString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func sqlStrings(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = sqlString(v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func primaryKeys(attrs []*models.Attribute, quote func(string) string) []string {
+	keys := make([]string, 0, 2)
+	for _, attr := range attrs {
+		if attr.PrimaryKey {
+			keys = append(keys, quote(attr.AttrName))
+		}
+	}
+	return keys
+}
+
+// renderMysqlDdl renders a CREATE TABLE statement, the instructions are
+// kept as column comments.
+func renderMysqlDdl(item *Item) ([]byte, error) {
+	lines := make([]string, 0, len(item.Attrs)+1)
+	for _, attr := range item.Attrs {
+		line := mysqlQuote(attr.AttrName) + " " + mysqlType(attr)
+		if !attr.Nullable {
+			line += " NOT NULL"
+		}
+		if attr.Instruction != "" {
+			line += " COMMENT " + mysqlString(attr.Instruction)
+		}
+		lines = append(lines, line)
+	}
+	if keys := primaryKeys(item.Attrs, mysqlQuote); len(keys) > 0 {
+		lines = append(lines, "PRIMARY KEY ("+strings.Join(keys, ", ")+")")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CREATE TABLE %s (\n  %s\n) DEFAULT CHARSET=utf8mb4;\n",
+		mysqlQuote(item.ItemName), strings.Join(lines, ",\n  "))
+	return buf.Bytes(), nil
+}
+
+// mysql also treats backslashes in strings as escapes.
+func mysqlString(s string) string {
+	return sqlString(strings.Replace(s, `\`, `\\`, -1))
+}
+
+func mysqlType(attr *models.Attribute) string {
+	switch attr.DataType {
+	case models.DataTypeString:
+		if attr.MaxLength > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", attr.MaxLength)
+		}
+		if attr.PrimaryKey {
+			return fmt.Sprintf("VARCHAR(%d)", mysqlKeyLength)
+		}
+		return "TEXT"
+	case models.DataTypeInt:
+		return "BIGINT"
+	case models.DataTypeDecimal:
+		if attr.Precision > 0 {
+			return fmt.Sprintf("DECIMAL(%d,%d)", attr.Precision, attr.Scale)
+		}
+		return "DECIMAL(65,30)"
+	case models.DataTypeDate:
+		return "DATE"
+	case models.DataTypeTime:
+		return "TIME"
+	case models.DataTypeDatetime:
+		return "DATETIME"
+	case models.DataTypeBoolean:
+		return "TINYINT(1)"
+	case models.DataTypeEnum:
+		return "ENUM(" + mysqlStrings(attr.EnumValues) + ")"
+	case models.DataTypeArray:
+		return "JSON"
+	}
+	return "TEXT"
+}
+
+func mysqlStrings(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = mysqlString(v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// renderPostgresDdl renders a CREATE TABLE statement followed by the
+// COMMENT ON COLUMN statements of the instructions.
+func renderPostgresDdl(item *Item) ([]byte, error) {
+	table := postgresQuote(item.ItemName)
+
+	lines := make([]string, 0, len(item.Attrs)+1)
+	for _, attr := range item.Attrs {
+		column := postgresQuote(attr.AttrName)
+		line := column + " " + postgresType(attr)
+		if !attr.Nullable {
+			line += " NOT NULL"
+		}
+		if attr.DataType == models.DataTypeEnum {
+			line += fmt.Sprintf(" CHECK (%s IN (%s))", column, sqlStrings(attr.EnumValues))
+		}
+		lines = append(lines, line)
+	}
+	if keys := primaryKeys(item.Attrs, postgresQuote); len(keys) > 0 {
+		lines = append(lines, "PRIMARY KEY ("+strings.Join(keys, ", ")+")")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CREATE TABLE %s (\n  %s\n);\n", table, strings.Join(lines, ",\n  "))
+	for _, attr := range item.Attrs {
+		if attr.Instruction != "" {
+			fmt.Fprintf(&buf, "COMMENT ON COLUMN %s.%s IS %s;\n",
+				table, postgresQuote(attr.AttrName), sqlString(attr.Instruction))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func postgresType(attr *models.Attribute) string {
+	switch attr.DataType {
+	case models.DataTypeString:
+		if attr.MaxLength > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", attr.MaxLength)
+		}
+		return "TEXT"
+	case models.DataTypeDecimal:
+		if attr.Precision > 0 {
+			return fmt.Sprintf("NUMERIC(%d,%d)", attr.Precision, attr.Scale)
+		}
+		return "NUMERIC"
+	case models.DataTypeEnum:
+		return "TEXT"
+	case models.DataTypeArray:
+		return postgresType(&models.Attribute{DataType: attr.ElementType}) + "[]"
+	}
+	return postgresScalarTypes[attr.DataType]
+}
+
+var postgresScalarTypes = map[string]string{
+	models.DataTypeInt:      "BIGINT",
+	models.DataTypeDate:     "DATE",
+	models.DataTypeTime:     "TIME",
+	models.DataTypeDatetime: "TIMESTAMP",
+	models.DataTypeBoolean:  "BOOLEAN",
+}
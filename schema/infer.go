@@ -0,0 +1,533 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// the sample formats of Infer.
+const (
+	SampleCsv    = "csv"
+	SampleTsv    = "tsv"
+	SampleJson   = "json"
+	SampleNdjson = "ndjson"
+
+	MaxSampleRows = 1000
+)
+
+var (
+	ErrUnknownSampleFormat = errors.New("unknown sample format")
+	ErrEmptySample         = errors.New("no columns found in the sample")
+
+	sniffedDelimiters = []rune{',', '\t', ';', '|'}
+
+	// the candidate types of the text values, by priority.
+	textTypes = []string{
+		models.DataTypeInt,
+		models.DataTypeDecimal,
+		models.DataTypeBoolean,
+		models.DataTypeDate,
+		models.DataTypeDatetime,
+		models.DataTypeTime,
+	}
+)
+
+type InferOptions struct {
+	Format    string // detected if empty
+	Header    *bool  // detected if nil, only for csv and tsv
+	Delimiter rune   // detected if 0, only for csv
+}
+
+// Inference is the attributes proposed for a sample.
+type Inference struct {
+	Format    string              `json:"format"`
+	Header    bool                `json:"header,omitempty"`
+	Delimiter string              `json:"delimiter,omitempty"`
+	Rows      int                 `json:"rows"`
+	Attrs     []*models.Attribute `json:"attrs"`
+}
+
+// Infer proposes the attributes of the columns of a sample. At most
+// MaxSampleRows rows are read.
+func Infer(data []byte, opts *InferOptions) (*Inference, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	format := strings.ToLower(opts.Format)
+	if format == "" {
+		format = detectSampleFormat(data)
+	}
+
+	var inference *Inference
+	var err error
+	switch format {
+	case SampleCsv, SampleTsv:
+		inference, err = inferDelimited(data, format, opts)
+	case SampleJson, SampleNdjson:
+		inference, err = inferJson(data, format)
+	default:
+		return nil, ErrUnknownSampleFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inference.Attrs) == 0 {
+		return nil, ErrEmptySample
+	}
+	if err := models.ValidateAttrs(inference.Attrs); err != nil {
+		return nil, err
+	}
+	return inference, nil
+}
+
+func detectSampleFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return SampleJson
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return SampleNdjson
+	case sniffDelimiter(data) == '\t':
+		return SampleTsv
+	}
+	return SampleCsv
+}
+
+// sniffDelimiter chooses the delimiter which occurs the same times in the
+// first lines, the most frequent one if none is consistent.
+func sniffDelimiter(data []byte) rune {
+	lines := make([]string, 0, 10)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+		if len(lines) == cap(lines) {
+			break
+		}
+	}
+
+	best, bestCount, bestConsistent := ',', 0, false
+	for _, d := range sniffedDelimiters {
+		count, consistent := 0, true
+		for i, line := range lines {
+			n := strings.Count(line, string(d))
+			if i > 0 && n != count {
+				consistent = false
+			}
+			count = n
+		}
+		if count == 0 {
+			continue
+		}
+		if (consistent && !bestConsistent) || (consistent == bestConsistent && count > bestCount) {
+			best, bestCount, bestConsistent = d, count, consistent
+		}
+	}
+	return best
+}
+
+func inferDelimited(data []byte, format string, opts *InferOptions) (*Inference, error) {
+	delimiter := opts.Delimiter
+	if format == SampleTsv {
+		delimiter = '\t'
+	} else if delimiter == 0 {
+		delimiter = sniffDelimiter(data)
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records := make([][]string, 0, 64)
+	for len(records) <= MaxSampleRows {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return nil, ErrEmptySample
+	}
+
+	header := false
+	if opts.Header != nil {
+		header = *opts.Header
+	} else {
+		header = detectHeader(records)
+	}
+
+	var names []string
+	if header {
+		names, records = records[0], records[1:]
+	} else if len(records) > MaxSampleRows {
+		records = records[:MaxSampleRows]
+	}
+
+	width := len(names)
+	for _, record := range records {
+		if len(record) > width {
+			width = len(record)
+		}
+	}
+
+	columns := make([]*column, width)
+	for i := range columns {
+		columns[i] = newColumn()
+	}
+	for _, record := range records {
+		for i, c := range columns {
+			if i < len(record) {
+				c.addText(record[i], true)
+			} else {
+				c.addNull()
+			}
+		}
+	}
+
+	attrs := make([]*models.Attribute, width)
+	for i, c := range columns {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		attrs[i] = c.attribute(name)
+	}
+
+	return &Inference{
+		Format:    format,
+		Header:    header,
+		Delimiter: string(delimiter),
+		Rows:      len(records),
+		Attrs:     uniqueNames(attrs),
+	}, nil
+}
+
+// detectHeader votes with the columns whose values below the first row have
+// a non-string type. If no column votes, the first row is a header if its
+// values are distinct words.
+func detectHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return false
+	}
+
+	first := records[0]
+	votes := 0
+	for i, cell := range first {
+		c := newColumn()
+		for _, record := range records[1:] {
+			if i < len(record) {
+				c.addText(record[i], true)
+			}
+		}
+		t := c.scalarType()
+		if t == models.DataTypeString || c.count == 0 {
+			continue
+		}
+		if models.ValidateAttrValue(&models.Attribute{DataType: t}, strings.TrimSpace(cell)) == nil {
+			votes--
+		} else {
+			votes++
+		}
+	}
+	if votes != 0 {
+		return votes > 0
+	}
+
+	seen := make(map[string]bool, len(first))
+	for _, cell := range first {
+		cell = strings.TrimSpace(cell)
+		if cell == "" || seen[cell] {
+			return false
+		}
+		if _, err := strconv.ParseFloat(cell, 64); err == nil {
+			return false
+		}
+		seen[cell] = true
+	}
+	return true
+}
+
+func inferJson(data []byte, format string) (*Inference, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if format == SampleJson {
+		if t, err := decoder.Token(); err != nil {
+			return nil, err
+		} else if t != json.Delim('[') {
+			return nil, fmt.Errorf("a json sample should be an array of objects")
+		}
+	}
+
+	names := make([]string, 0, 16)
+	columns := make(map[string]*column, 16)
+	rows := 0
+	for rows < MaxSampleRows {
+		if format == SampleJson && !decoder.More() {
+			break
+		}
+
+		keys, values, err := decodeObject(decoder)
+		if err == io.EOF && format == SampleNdjson {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("row %d: %s", rows+1, err.Error())
+		}
+
+		present := make(map[string]bool, len(keys))
+		for i, key := range keys {
+			c, ok := columns[key]
+			if !ok {
+				// the rows before don't have this column
+				c = newColumn()
+				c.nulls = rows
+				columns[key] = c
+				names = append(names, key)
+			}
+			c.addJson(values[i])
+			present[key] = true
+		}
+		for _, name := range names {
+			if !present[name] {
+				columns[name].addNull()
+			}
+		}
+		rows++
+	}
+
+	attrs := make([]*models.Attribute, len(names))
+	for i, name := range names {
+		attrs[i] = columns[name].attribute(name)
+	}
+
+	return &Inference{Format: format, Rows: rows, Attrs: uniqueNames(attrs)}, nil
+}
+
+// decodeObject decodes the next json object, keeping the order of the keys.
+func decodeObject(decoder *json.Decoder) ([]string, []interface{}, error) {
+	t, err := decoder.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if t != json.Delim('{') {
+		return nil, nil, fmt.Errorf("not a json object")
+	}
+
+	keys := make([]string, 0, 16)
+	values := make([]interface{}, 0, 16)
+	for decoder.More() {
+		t, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, _ := t.(string)
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
+
+// uniqueNames names the unnamed columns column_N and renames the duplicated
+// (case insensitive) names, which ValidateAttrs rejects.
+func uniqueNames(attrs []*models.Attribute) []*models.Attribute {
+	seen := make(map[string]bool, len(attrs))
+	for i, attr := range attrs {
+		name := strings.TrimSpace(attr.AttrName)
+		if utf8.RuneCountInString(name) > models.AttrNameMaxLength {
+			name = string([]rune(name)[:models.AttrNameMaxLength])
+		}
+		if name == "" || seen[strings.ToLower(name)] {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		seen[strings.ToLower(name)] = true
+		attr.AttrName = name
+	}
+	return attrs
+}
+
+// column collects the values of a sample column.
+type column struct {
+	count      int // non-null values
+	nulls      int
+	candidates map[string]bool
+	example    string
+
+	// the digits of the decimal values
+	intDigits int
+	scale     int
+
+	sawScalar bool
+	sawArray  bool
+	sawObject bool
+	elements  *column
+}
+
+func newColumn() *column {
+	c := &column{candidates: make(map[string]bool, len(textTypes))}
+	for _, t := range textTypes {
+		c.candidates[t] = true
+	}
+	return c
+}
+
+func (c *column) addNull() {
+	c.nulls++
+}
+
+func (c *column) setExample(example string) {
+	if c.example == "" {
+		if utf8.RuneCountInString(example) > models.ExampleMaxLength {
+			example = string([]rune(example)[:models.ExampleMaxLength])
+		}
+		c.example = example
+	}
+}
+
+// addText adds a text value. Blank values are nulls in the delimited
+// samples, as well as NULL.
+func (c *column) addText(value string, delimited bool) {
+	trimmed := strings.TrimSpace(value)
+	if delimited && (trimmed == "" || trimmed == "NULL" || trimmed == `\N`) {
+		c.addNull()
+		return
+	}
+
+	c.count++
+	c.sawScalar = true
+	for t := range c.candidates {
+		if models.ValidateAttrValue(&models.Attribute{DataType: t}, trimmed) != nil {
+			delete(c.candidates, t)
+		}
+	}
+
+	// leading zeros, such as those in zip codes, would be lost in numbers.
+	if len(trimmed) > 1 && trimmed[0] == '0' && trimmed[1] != '.' {
+		delete(c.candidates, models.DataTypeInt)
+		delete(c.candidates, models.DataTypeDecimal)
+	}
+
+	if c.candidates[models.DataTypeDecimal] {
+		digits := strings.TrimLeft(trimmed, "+-")
+		intPart, fraction := digits, ""
+		if i := strings.Index(digits, "."); i >= 0 {
+			intPart, fraction = digits[:i], digits[i+1:]
+		}
+		if n := len(strings.TrimLeft(intPart, "0")); n > c.intDigits {
+			c.intDigits = n
+		}
+		if len(fraction) > c.scale {
+			c.scale = len(fraction)
+		}
+	}
+
+	if c.candidates[models.DataTypeDecimal] || c.candidates[models.DataTypeInt] {
+		c.setExample(trimmed)
+	} else {
+		c.setExample(value)
+	}
+}
+
+func (c *column) addJson(value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		c.addNull()
+	case bool:
+		for t := range c.candidates {
+			if t != models.DataTypeBoolean {
+				delete(c.candidates, t)
+			}
+		}
+		c.addText(strconv.FormatBool(v), false)
+	case json.Number:
+		for t := range c.candidates {
+			if t != models.DataTypeInt && t != models.DataTypeDecimal {
+				delete(c.candidates, t)
+			}
+		}
+		c.addText(v.String(), false)
+	case string:
+		c.addText(v, false)
+	case []interface{}:
+		c.count++
+		c.sawArray = true
+		if c.elements == nil {
+			c.elements = newColumn()
+		}
+		for _, element := range v {
+			c.elements.addJson(element)
+		}
+		if data, err := json.Marshal(v); err == nil {
+			c.setExample(string(data))
+		}
+	default:
+		c.count++
+		c.sawObject = true
+		if data, err := json.Marshal(v); err == nil {
+			c.setExample(string(data))
+		}
+	}
+}
+
+func (c *column) scalarType() string {
+	for _, t := range textTypes {
+		if c.candidates[t] {
+			return t
+		}
+	}
+	return models.DataTypeString
+}
+
+func (c *column) attribute(name string) *models.Attribute {
+	attr := &models.Attribute{
+		AttrName: name,
+		DataType: models.DataTypeString,
+		Nullable: c.nulls > 0 || c.count == 0,
+		Example:  c.example,
+	}
+
+	switch {
+	case c.count == 0 || c.sawObject || (c.sawArray && c.sawScalar):
+	case c.sawArray:
+		attr.DataType = models.DataTypeArray
+		attr.ElementType = models.DataTypeString
+		if e := c.elements; e.count > 0 && !e.sawArray && !e.sawObject {
+			attr.ElementType = e.scalarType()
+		}
+		if c.elements.sawArray || c.elements.sawObject {
+			// nested arrays and objects are not valid string elements.
+			attr.Example = ""
+		}
+	default:
+		attr.DataType = c.scalarType()
+		if attr.DataType == models.DataTypeDecimal && c.intDigits+c.scale <= models.DecimalMaxPrecision {
+			attr.Precision = c.intDigits + c.scale
+			attr.Scale = c.scale
+			if attr.Precision == 0 {
+				attr.Scale = 0
+			}
+		}
+	}
+
+	return attr
+}
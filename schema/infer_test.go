@@ -0,0 +1,114 @@
+package schema
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"testing"
+)
+
+func _testAttr(t *testing.T, attr *models.Attribute, name, typeString string, nullable bool, example string) {
+	if attr.AttrName != name || attr.TypeString() != typeString || attr.Nullable != nullable || attr.Example != example {
+		t.Errorf("inferred %s %s (nullable: %t, example: %q), expected %s %s (nullable: %t, example: %q)",
+			attr.AttrName, attr.TypeString(), attr.Nullable, attr.Example, name, typeString, nullable, example)
+	}
+}
+
+func TestInferCsv(t *testing.T) {
+	sample := "code,trade_date,close,volume,suspended,zip,memo\n" +
+		"600000,2016-08-01,10.25,1200,false,010020,\n" +
+		"600001,2016-08-02,9.5,,true,200001,\"a, b\"\n"
+
+	inference, err := Infer([]byte(sample), &InferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inference.Format != SampleCsv || !inference.Header || inference.Delimiter != "," || inference.Rows != 2 {
+		t.Errorf("inference: %+v", inference)
+	}
+
+	attrs := inference.Attrs
+	if len(attrs) != 7 {
+		t.Fatalf("attrs: %d", len(attrs))
+	}
+	_testAttr(t, attrs[0], "code", "int", false, "600000")
+	_testAttr(t, attrs[1], "trade_date", "date", false, "2016-08-01")
+	_testAttr(t, attrs[2], "close", "decimal(4,2)", false, "10.25")
+	_testAttr(t, attrs[3], "volume", "int", true, "1200")
+	_testAttr(t, attrs[4], "suspended", "boolean", false, "false")
+	_testAttr(t, attrs[5], "zip", "string", false, "010020")
+	_testAttr(t, attrs[6], "memo", "string", true, "a, b")
+}
+
+func TestInferTsvWithoutHeader(t *testing.T) {
+	sample := "1\t2016-08-01 09:30:00\tx\n2\t2016-08-01 15:00:00\ty\n"
+
+	inference, err := Infer([]byte(sample), &InferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inference.Format != SampleTsv || inference.Header {
+		t.Errorf("inference: %+v", inference)
+	}
+	_testAttr(t, inference.Attrs[0], "column_1", "int", false, "1")
+	_testAttr(t, inference.Attrs[1], "column_2", "datetime", false, "2016-08-01 09:30:00")
+	_testAttr(t, inference.Attrs[2], "column_3", "string", false, "x")
+
+	header := true
+	inference, err = Infer([]byte(sample), &InferOptions{Header: &header})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inference.Rows != 1 || inference.Attrs[0].AttrName != "1" {
+		t.Errorf("inference with header: %+v", inference)
+	}
+}
+
+func TestSniffDelimiter(t *testing.T) {
+	if d := sniffDelimiter([]byte("a;b;c\n1;2,5;3\n")); d != ';' {
+		t.Errorf("sniffDelimiter => %q", d)
+	}
+	if d := sniffDelimiter([]byte("a|b\n1|2\n")); d != '|' {
+		t.Errorf("sniffDelimiter => %q", d)
+	}
+	if d := sniffDelimiter([]byte("abc\n")); d != ',' {
+		t.Errorf("sniffDelimiter => %q", d)
+	}
+}
+
+func TestInferJson(t *testing.T) {
+	sample := `[
+		{"id": 1, "price": 1.5, "tags": ["a", "b"], "ok": true, "at": "2016-08-01T09:30:00Z"},
+		{"id": 2, "price": 10, "tags": [], "ok": false, "extra": {"k": 1}, "at": null}
+	]`
+
+	inference, err := Infer([]byte(sample), &InferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inference.Format != SampleJson || inference.Rows != 2 || len(inference.Attrs) != 6 {
+		t.Fatalf("inference: %+v", inference)
+	}
+	_testAttr(t, inference.Attrs[0], "id", "int", false, "1")
+	_testAttr(t, inference.Attrs[1], "price", "decimal(3,1)", false, "1.5")
+	_testAttr(t, inference.Attrs[2], "tags", "array<string>", false, `["a","b"]`)
+	_testAttr(t, inference.Attrs[3], "ok", "boolean", false, "true")
+	_testAttr(t, inference.Attrs[4], "at", "datetime", true, "2016-08-01T09:30:00Z")
+	_testAttr(t, inference.Attrs[5], "extra", "string", true, `{"k":1}`)
+}
+
+func TestInferNdjson(t *testing.T) {
+	sample := "{\"n\": \"1\", \"s\": \"x\"}\n{\"n\": \"2\"}\n"
+
+	inference, err := Infer([]byte(sample), &InferOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inference.Format != SampleNdjson || inference.Rows != 2 {
+		t.Fatalf("inference: %+v", inference)
+	}
+	_testAttr(t, inference.Attrs[0], "n", "int", false, "1")
+	_testAttr(t, inference.Attrs[1], "s", "string", true, "x")
+
+	if _, err := Infer([]byte("[1, 2]"), &InferOptions{}); err == nil {
+		t.Errorf("a json array of numbers should be rejected")
+	}
+}
@@ -0,0 +1,193 @@
+package schema
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DsnEnvPrefix prefixes the env vars of the introspection sources. The dsn
+// of source "warehouse" is in INTROSPECT_DSN_WAREHOUSE, so that no dsn (and
+// password) is passed in the requests.
+const DsnEnvPrefix = "INTROSPECT_DSN_"
+
+var (
+	ErrUnknownSource = errors.New("unknown introspection source")
+	ErrTableNotFound = errors.New("table not found or has no columns")
+
+	sourceNameValidator = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	enumTypeValidator   = regexp.MustCompile(`^enum\((.*)\)$`)
+)
+
+// SourceDsn returns the dsn of the source configured by the env.
+func SourceDsn(source string) (string, error) {
+	if !sourceNameValidator.MatchString(source) {
+		return "", ErrUnknownSource
+	}
+	dsn := os.Getenv(DsnEnvPrefix + strings.ToUpper(source))
+	if dsn == "" {
+		return "", ErrUnknownSource
+	}
+	return dsn, nil
+}
+
+// MysqlColumn is a row of information_schema.COLUMNS.
+type MysqlColumn struct {
+	Name          string
+	Position      int
+	Nullable      bool
+	DataType      string // such as "varchar"
+	ColumnType    string // such as "varchar(32)" or "enum('a','b')"
+	CharMaxLength sql.NullInt64
+	Precision     sql.NullInt64
+	Scale         sql.NullInt64
+	Key           string
+	Comment       string
+}
+
+// IntrospectMysql reads the columns of the table in the schema (the current
+// database if schemaName is empty) and converts them to attributes.
+func IntrospectMysql(db *sql.DB, schemaName, table string) ([]*models.Attribute, error) {
+	sqlstr := `SELECT COLUMN_NAME, ORDINAL_POSITION, IS_NULLABLE, DATA_TYPE, COLUMN_TYPE,
+		CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE, COLUMN_KEY, COLUMN_COMMENT
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA=IFNULL(NULLIF(?, ''), DATABASE()) AND TABLE_NAME=?
+		ORDER BY ORDINAL_POSITION`
+	rows, err := db.Query(sqlstr, schemaName, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attrs := make([]*models.Attribute, 0, 32)
+	for rows.Next() {
+		c := &MysqlColumn{}
+		nullable := ""
+		err := rows.Scan(&c.Name, &c.Position, &nullable, &c.DataType, &c.ColumnType,
+			&c.CharMaxLength, &c.Precision, &c.Scale, &c.Key, &c.Comment)
+		if err != nil {
+			return nil, err
+		}
+		c.Nullable = nullable == "YES"
+		attrs = append(attrs, MysqlColumnAttribute(c))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(attrs) == 0 {
+		return nil, ErrTableNotFound
+	}
+
+	if err := models.ValidateAttrs(attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// MysqlColumnAttribute maps a mysql column to an attribute. The types without
+// an equivalent, such as json, blob and set, become strings. The comments,
+// up to 1024 characters in mysql, are truncated to the instructions.
+func MysqlColumnAttribute(c *MysqlColumn) *models.Attribute {
+	instruction := c.Comment
+	if utf8.RuneCountInString(instruction) > models.InstructionMaxLength {
+		instruction = string([]rune(instruction)[:models.InstructionMaxLength])
+	}
+	attr := &models.Attribute{
+		AttrName:    c.Name,
+		OrderId:     c.Position,
+		Instruction: instruction,
+		DataType:    models.DataTypeString,
+		PrimaryKey:  c.Key == "PRI",
+		Nullable:    c.Nullable && c.Key != "PRI",
+	}
+
+	columnType := strings.ToLower(c.ColumnType)
+	switch strings.ToLower(c.DataType) {
+	case "tinyint":
+		if strings.HasPrefix(columnType, "tinyint(1)") {
+			attr.DataType = models.DataTypeBoolean
+		} else {
+			attr.DataType = models.DataTypeInt
+		}
+	case "bit":
+		if columnType == "bit(1)" {
+			attr.DataType = models.DataTypeBoolean
+		}
+	case "smallint", "mediumint", "int", "integer", "bigint", "year":
+		attr.DataType = models.DataTypeInt
+	case "decimal", "numeric":
+		attr.DataType = models.DataTypeDecimal
+		if c.Precision.Valid && c.Precision.Int64 <= models.DecimalMaxPrecision {
+			attr.Precision = int(c.Precision.Int64)
+			attr.Scale = int(c.Scale.Int64)
+		}
+	case "float", "double", "real":
+		attr.DataType = models.DataTypeDecimal
+	case "char", "varchar":
+		if c.CharMaxLength.Valid {
+			attr.MaxLength = int(c.CharMaxLength.Int64)
+		}
+	case "date":
+		attr.DataType = models.DataTypeDate
+	case "time":
+		attr.DataType = models.DataTypeTime
+	case "datetime", "timestamp":
+		attr.DataType = models.DataTypeDatetime
+	case "enum":
+		values := parseMysqlEnum(c.ColumnType)
+		if data, _ := json.Marshal(values); len(values) > 0 && len(data) <= models.EnumValuesMaxLength {
+			attr.DataType = models.DataTypeEnum
+			attr.EnumValues = values
+		}
+	}
+
+	return attr
+}
+
+// parseMysqlEnum parses the values of a column type like enum('a','b'),
+// in which the quotes of the values are doubled.
+func parseMysqlEnum(columnType string) []string {
+	m := enumTypeValidator.FindStringSubmatch(columnType)
+	if m == nil {
+		return nil
+	}
+
+	values := make([]string, 0, 8)
+	s := m[1]
+	for len(s) > 0 {
+		if s[0] != '\'' {
+			return nil
+		}
+
+		var value []byte
+		i := 1
+		for ; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					value = append(value, '\'')
+					i++
+					continue
+				}
+				break
+			}
+			value = append(value, s[i])
+		}
+		if i >= len(s) {
+			return nil
+		}
+		values = append(values, string(value))
+
+		s = s[i+1:]
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		} else if s != "" {
+			return nil
+		}
+	}
+	return values
+}
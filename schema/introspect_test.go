@@ -0,0 +1,163 @@
+package schema
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// fakeInformationSchema is a database/sql driver standing in for mysql,
+// which answers the information_schema.COLUMNS query of IntrospectMysql.
+type fakeInformationSchema map[string][][]driver.Value
+
+var fakeColumns = []string{"COLUMN_NAME", "ORDINAL_POSITION", "IS_NULLABLE", "DATA_TYPE", "COLUMN_TYPE",
+	"CHARACTER_MAXIMUM_LENGTH", "NUMERIC_PRECISION", "NUMERIC_SCALE", "COLUMN_KEY", "COLUMN_COMMENT"}
+
+func init() {
+	sql.Register("fakemysql", fakeInformationSchema{
+		"market.stock": {
+			{"code", int64(1), "NO", "varchar", "varchar(16)", int64(16), nil, nil, "PRI", "证券代码"},
+			{"trade_date", int64(2), "NO", "date", "date", nil, nil, nil, "PRI", ""},
+			{"close", int64(3), "YES", "decimal", "decimal(10,2)", nil, int64(10), int64(2), "", "closing price"},
+			{"volume", int64(4), "YES", "bigint", "bigint(20) unsigned", nil, int64(20), int64(0), "", ""},
+			{"suspended", int64(5), "NO", "tinyint", "tinyint(1)", nil, int64(3), int64(0), "", ""},
+			{"board", int64(6), "YES", "enum", "enum('main','sme','it''s')", int64(4), nil, nil, "", ""},
+			{"extra", int64(7), "YES", "json", "json", nil, nil, nil, "", ""},
+			{"updated_at", int64(8), "YES", "timestamp", "timestamp", nil, nil, nil, "", strings.Repeat("更新时间", 200)},
+		},
+	})
+}
+
+func (schemas fakeInformationSchema) Open(name string) (driver.Conn, error) {
+	return &fakeConn{schemas: schemas, database: name}, nil
+}
+
+type fakeConn struct {
+	schemas  fakeInformationSchema
+	database string
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	conn *fakeConn
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return 2 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	schemaName, _ := args[0].(string)
+	if schemaName == "" {
+		schemaName = s.conn.database
+	}
+	table, _ := args[1].(string)
+	return &fakeRows{data: s.conn.schemas[schemaName+"."+table]}, nil
+}
+
+type fakeRows struct {
+	data [][]driver.Value
+	next int
+}
+
+func (r *fakeRows) Columns() []string { return fakeColumns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.next])
+	r.next++
+	return nil
+}
+
+func TestIntrospectMysql(t *testing.T) {
+	db, err := sql.Open("fakemysql", "market")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	attrs, err := IntrospectMysql(db, "", "stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 8 {
+		t.Fatalf("attrs: %d", len(attrs))
+	}
+
+	expected := []struct {
+		name, typeString string
+		nullable, key    bool
+	}{
+		{"code", "string(16)", false, true},
+		{"trade_date", "date", false, true},
+		{"close", "decimal(10,2)", true, false},
+		{"volume", "int", true, false},
+		{"suspended", "boolean", false, false},
+		{"board", "enum", true, false},
+		{"extra", "string", true, false},
+		{"updated_at", "datetime", true, false},
+	}
+	for i, e := range expected {
+		attr := attrs[i]
+		if attr.AttrName != e.name || attr.TypeString() != e.typeString ||
+			attr.Nullable != e.nullable || attr.PrimaryKey != e.key || attr.OrderId != i+1 {
+			t.Errorf("attrs[%d] = %s %s (nullable: %t, key: %t), expected %+v",
+				i, attr.AttrName, attr.TypeString(), attr.Nullable, attr.PrimaryKey, e)
+		}
+	}
+
+	if attrs[0].Instruction != "证券代码" || attrs[2].Instruction != "closing price" {
+		t.Errorf("column comments should be the instructions: %q, %q", attrs[0].Instruction, attrs[2].Instruction)
+	}
+	// the long comments are truncated rather than failing the table.
+	if n := utf8.RuneCountInString(attrs[7].Instruction); n != models.InstructionMaxLength ||
+		!strings.HasPrefix(attrs[7].Instruction, "更新时间") {
+		t.Errorf("expect the long comment truncated, got %d characters", n)
+	}
+	if !reflect.DeepEqual(attrs[5].EnumValues, []string{"main", "sme", "it's"}) {
+		t.Errorf("enum values: %q", attrs[5].EnumValues)
+	}
+
+	if _, err := IntrospectMysql(db, "market", "missing"); err != ErrTableNotFound {
+		t.Errorf("IntrospectMysql (missing) => %v, expected ErrTableNotFound", err)
+	}
+}
+
+func TestParseMysqlEnum(t *testing.T) {
+	if values := parseMysqlEnum("enum('a','b,c','')"); !reflect.DeepEqual(values, []string{"a", "b,c", ""}) {
+		t.Errorf("parseMysqlEnum => %q", values)
+	}
+	if values := parseMysqlEnum("enum('a"); values != nil {
+		t.Errorf("parseMysqlEnum (unterminated) => %q", values)
+	}
+}
+
+func TestSourceDsn(t *testing.T) {
+	os.Setenv(DsnEnvPrefix+"WAREHOUSE", "user:pass@tcp(db:3306)/dw")
+	defer os.Unsetenv(DsnEnvPrefix + "WAREHOUSE")
+
+	if dsn, err := SourceDsn("warehouse"); err != nil || dsn != "user:pass@tcp(db:3306)/dw" {
+		t.Errorf("SourceDsn (warehouse) => %q, %v", dsn, err)
+	}
+	for _, source := range []string{"missing", "", "../x"} {
+		if _, err := SourceDsn(source); err != ErrUnknownSource {
+			t.Errorf("SourceDsn (%s) => %v, expected ErrUnknownSource", source, err)
+		}
+	}
+}
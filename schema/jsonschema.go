@@ -0,0 +1,90 @@
+package schema
+
+import (
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+)
+
+// renderJsonSchema renders a draft-07 json schema of a row object.
+func renderJsonSchema(item *Item) ([]byte, error) {
+	properties := make(object, 0, len(item.Attrs))
+	required := make([]string, 0, len(item.Attrs))
+	for _, attr := range item.Attrs {
+		properties = append(properties, member{attr.AttrName, jsonSchemaProperty(attr)})
+		if !attr.Nullable {
+			required = append(required, attr.AttrName)
+		}
+	}
+
+	doc := object{
+		{"$schema", "http://json-schema.org/draft-07/schema#"},
+		{"$id", "urn:datafoundry:dataitem:" + item.RepoName + ":" + item.ItemName},
+		{"title", item.ItemName},
+		{"type", "object"},
+		{"properties", properties},
+	}
+	if len(required) > 0 {
+		doc = append(doc, member{"required", required})
+	}
+
+	return marshalIndent(doc)
+}
+
+func jsonSchemaProperty(attr *models.Attribute) object {
+	property := jsonSchemaType(attr.DataType, attr)
+	if attr.Nullable {
+		for i, m := range property {
+			switch m.key {
+			case "type":
+				property[i].value = []interface{}{m.value, "null"}
+			case "enum":
+				property[i].value = append(m.value.([]interface{}), nil)
+			}
+		}
+	}
+
+	if attr.Instruction != "" {
+		property = append(property, member{"description", attr.Instruction})
+	}
+	if attr.Example != "" {
+		property = append(property, member{"examples", []string{attr.Example}})
+	}
+	if attr.Unit != "" {
+		property = append(property, member{"x-unit", attr.Unit})
+	}
+	if attr.PrimaryKey {
+		property = append(property, member{"x-primaryKey", true})
+	}
+	return property
+}
+
+func jsonSchemaType(dataType string, attr *models.Attribute) object {
+	switch dataType {
+	case models.DataTypeString:
+		if attr != nil && attr.MaxLength > 0 {
+			return object{{"type", "string"}, {"maxLength", attr.MaxLength}}
+		}
+		return object{{"type", "string"}}
+	case models.DataTypeInt:
+		return object{{"type", "integer"}}
+	case models.DataTypeDecimal:
+		// decimals are strings to keep the precision.
+		return object{{"type", "string"}, {"pattern", `^[+-]?[0-9]*(\.[0-9]*)?$`}}
+	case models.DataTypeDate:
+		return object{{"type", "string"}, {"format", "date"}}
+	case models.DataTypeTime:
+		return object{{"type", "string"}, {"format", "time"}}
+	case models.DataTypeDatetime:
+		return object{{"type", "string"}, {"format", "date-time"}}
+	case models.DataTypeBoolean:
+		return object{{"type", "boolean"}}
+	case models.DataTypeEnum:
+		values := make([]interface{}, len(attr.EnumValues))
+		for i, v := range attr.EnumValues {
+			values[i] = v
+		}
+		return object{{"type", "string"}, {"enum", values}}
+	case models.DataTypeArray:
+		return object{{"type", "array"}, {"items", jsonSchemaType(attr.ElementType, nil)}}
+	}
+	return object{{"type", "string"}}
+}
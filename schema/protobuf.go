@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"strings"
+)
+
+var protobufScalarTypes = map[string]string{
+	models.DataTypeString:   "string",
+	models.DataTypeInt:      "int64",
+	models.DataTypeDecimal:  "string",
+	models.DataTypeDate:     "string",
+	models.DataTypeTime:     "string",
+	models.DataTypeDatetime: "google.protobuf.Timestamp",
+	models.DataTypeBoolean:  "bool",
+}
+
+// renderProtobuf renders a proto3 message, nullable fields are optional.
+// Enums are nested in the message, with an UNSPECIFIED zero value.
+func renderProtobuf(item *Item) ([]byte, error) {
+	message := camelCase(identifier(item.ItemName))
+	idents := identifiers(item.Attrs)
+
+	var enums, fields bytes.Buffer
+	usesTimestamp := false
+	for i, attr := range item.Attrs {
+		dataType := attr.DataType
+		label := ""
+		if dataType == models.DataTypeArray {
+			dataType = attr.ElementType
+			label = "repeated "
+		} else if attr.Nullable {
+			label = "optional "
+		}
+
+		t := protobufScalarTypes[dataType]
+		if dataType == models.DataTypeEnum {
+			t = camelCase(idents[i])
+			writeProtobufEnum(&enums, t, strings.ToUpper(idents[i]), attr.EnumValues)
+		}
+		if dataType == models.DataTypeDatetime {
+			usesTimestamp = true
+		}
+
+		if idents[i] != attr.AttrName {
+			writeProtobufComment(&fields, "  ", attr.AttrName)
+		}
+		writeProtobufComment(&fields, "  ", attr.Instruction)
+		fmt.Fprintf(&fields, "  %s%s %s = %d;\n", label, t, strings.ToLower(idents[i]), i+1)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&buf, "package datafoundry.%s;\n\n", strings.ToLower(identifier(item.RepoName)))
+	if usesTimestamp {
+		buf.WriteString("import \"google/protobuf/timestamp.proto\";\n\n")
+	}
+	fmt.Fprintf(&buf, "message %s {\n", message)
+	buf.Write(enums.Bytes())
+	buf.Write(fields.Bytes())
+	buf.WriteString("}\n")
+
+	return buf.Bytes(), nil
+}
+
+func writeProtobufEnum(buf *bytes.Buffer, name, prefix string, values []string) {
+	fmt.Fprintf(buf, "  enum %s {\n", name)
+	fmt.Fprintf(buf, "    %s_UNSPECIFIED = 0;\n", prefix)
+	seen := make(map[string]bool, len(values))
+	for i, v := range values {
+		constant := strings.ToUpper(identifier(v))
+		if seen[constant] {
+			constant = fmt.Sprintf("%s_%d", constant, i+1)
+		}
+		seen[constant] = true
+
+		if identifier(v) != v {
+			fmt.Fprintf(buf, "    // %s\n", v)
+		}
+		fmt.Fprintf(buf, "    %s_%s = %d;\n", prefix, constant, i+1)
+	}
+	buf.WriteString("  }\n")
+}
+
+func writeProtobufComment(buf *bytes.Buffer, indent, comment string) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		fmt.Fprintf(buf, "%s// %s\n", indent, strings.TrimRight(line, "\r"))
+	}
+}
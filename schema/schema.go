@@ -0,0 +1,160 @@
+// Package schema renders the attributes of dataitems in the schema languages
+// used by the data consumers.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatJsonSchema  = "jsonschema"
+	FormatAvro        = "avro"
+	FormatDdlMysql    = "ddl-mysql"
+	FormatDdlPostgres = "ddl-postgres"
+	FormatProtobuf    = "protobuf"
+)
+
+var ErrUnknownFormat = errors.New("unknown schema format")
+
+// Item is the dataitem to render.
+type Item struct {
+	RepoName string
+	ItemName string
+	Attrs    []*models.Attribute
+}
+
+type renderer struct {
+	contentType string
+	render      func(item *Item) ([]byte, error)
+}
+
+var renderers = map[string]renderer{
+	FormatJsonSchema:  {"application/schema+json; charset=utf-8", renderJsonSchema},
+	FormatAvro:        {"application/json; charset=utf-8", renderAvro},
+	FormatDdlMysql:    {"application/sql; charset=utf-8", renderMysqlDdl},
+	FormatDdlPostgres: {"application/sql; charset=utf-8", renderPostgresDdl},
+	FormatProtobuf:    {"text/plain; charset=utf-8", renderProtobuf},
+}
+
+// Formats returns the supported formats.
+func Formats() []string {
+	formats := make([]string, 0, len(renderers))
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Render returns the schema of the item in the format and its content type.
+// The attributes are rendered in the order of OrderId.
+func Render(format string, item *Item) ([]byte, string, error) {
+	r, ok := renderers[strings.ToLower(format)]
+	if !ok {
+		return nil, "", ErrUnknownFormat
+	}
+
+	sorted := *item
+	sorted.Attrs = make([]*models.Attribute, len(item.Attrs))
+	copy(sorted.Attrs, item.Attrs)
+	sort.SliceStable(sorted.Attrs, func(i, j int) bool {
+		return sorted.Attrs[i].OrderId < sorted.Attrs[j].OrderId
+	})
+
+	data, err := r.render(&sorted)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, r.contentType, nil
+}
+
+// object is a json object which keeps the order of the members.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(strconv.Quote(m.key))
+		buf.WriteByte(':')
+		data, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func marshalIndent(v interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+var nonIdentChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// identifier converts a name to [A-Za-z_][A-Za-z0-9_]*, which is valid in
+// most schema languages.
+func identifier(name string) string {
+	ident := strings.Trim(nonIdentChars.ReplaceAllString(name, "_"), "_")
+	if ident == "" {
+		return "_"
+	}
+	if ident[0] >= '0' && ident[0] <= '9' {
+		ident = "_" + ident
+	}
+	return ident
+}
+
+// identifiers converts the attribute names with identifier. The names without
+// any ascii letter or digit become field_N, duplicated ones are suffixed
+// with their positions.
+func identifiers(attrs []*models.Attribute) []string {
+	idents := make([]string, len(attrs))
+	seen := make(map[string]bool, len(attrs))
+	for i, attr := range attrs {
+		ident := identifier(attr.AttrName)
+		if ident == "_" {
+			ident = "field_" + strconv.Itoa(i+1)
+		} else if seen[strings.ToLower(ident)] {
+			ident = ident + "_" + strconv.Itoa(i+1)
+		}
+		seen[strings.ToLower(ident)] = true
+		idents[i] = ident
+	}
+	return idents
+}
+
+// camelCase converts an identifier such as "stock_price" to "StockPrice".
+func camelCase(ident string) string {
+	words := strings.Split(ident, "_")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	s := strings.Join(words, "")
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "X" + s
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"bytes"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// set UPDATE_GOLDEN=1 to rewrite the golden files.
+var updateGolden = os.Getenv("UPDATE_GOLDEN") != ""
+
+func testItem() *Item {
+	return &Item{
+		RepoName: "finance",
+		ItemName: "stock_daily",
+		Attrs: []*models.Attribute{
+			{AttrName: "close", OrderId: 3, DataType: models.DataTypeDecimal, Precision: 10, Scale: 2,
+				Nullable: true, Unit: "CNY", Instruction: "closing price, 'adjusted'", Example: "12.34"},
+			{AttrName: "code", OrderId: 1, DataType: models.DataTypeString, MaxLength: 16,
+				PrimaryKey: true, Instruction: "证券代码"},
+			{AttrName: "trade_date", OrderId: 2, DataType: models.DataTypeDate, PrimaryKey: true},
+			{AttrName: "volume", OrderId: 4, DataType: models.DataTypeInt, Instruction: "shares\ntraded"},
+			{AttrName: "board", OrderId: 5, DataType: models.DataTypeEnum, EnumValues: []string{"main", "sme", "gem"}},
+			{AttrName: "suspended", OrderId: 6, DataType: models.DataTypeBoolean, Nullable: true},
+			{AttrName: "tags", OrderId: 7, DataType: models.DataTypeArray, ElementType: models.DataTypeString, Nullable: true},
+			{AttrName: "updated_at", OrderId: 8, DataType: models.DataTypeDatetime, Nullable: true},
+			{AttrName: "涨跌幅", OrderId: 9, DataType: models.DataTypeDecimal, Nullable: true},
+		},
+	}
+}
+
+func TestRenderGolden(t *testing.T) {
+	extensions := map[string]string{
+		FormatJsonSchema:  ".json",
+		FormatAvro:        ".avsc",
+		FormatDdlMysql:    ".sql",
+		FormatDdlPostgres: ".sql",
+		FormatProtobuf:    ".proto",
+	}
+
+	for _, format := range Formats() {
+		data, _, err := Render(format, testItem())
+		if err != nil {
+			t.Errorf("Render (%s) error: %v", format, err)
+			continue
+		}
+
+		golden := filepath.Join("testdata", format+extensions[format]+".golden")
+		if updateGolden {
+			if err := ioutil.WriteFile(golden, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("Render (%s) mismatches %s:\n%s", format, golden, data)
+		}
+	}
+}
+
+func TestMysqlKeyType(t *testing.T) {
+	attr := &models.Attribute{AttrName: "code", DataType: models.DataTypeString}
+	if typ := mysqlType(attr); typ != "TEXT" {
+		t.Errorf("unexpected type %s", typ)
+	}
+	attr.PrimaryKey = true
+	if typ := mysqlType(attr); typ != "VARCHAR(255)" {
+		t.Errorf("expect a string key as VARCHAR(255), got %s", typ)
+	}
+	attr.MaxLength = 16
+	if typ := mysqlType(attr); typ != "VARCHAR(16)" {
+		t.Errorf("unexpected type %s", typ)
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	if _, _, err := Render("xml", testItem()); err != ErrUnknownFormat {
+		t.Errorf("Render (xml) => %v, expected ErrUnknownFormat", err)
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	attrs := []*models.Attribute{{AttrName: "a b"}, {AttrName: "a_b"}, {AttrName: "1st"}, {AttrName: "涨跌幅"}}
+	idents := identifiers(attrs)
+	expected := []string{"a_b", "a_b_2", "_1st", "field_4"}
+	for i := range expected {
+		if idents[i] != expected[i] {
+			t.Errorf("identifiers => %v, expected %v", idents, expected)
+			break
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// the formats of the attribute sheets.
+const (
+	SheetCsv  = "csv"
+	SheetXlsx = "xlsx"
+
+	MaxSheetRows = 10000
+)
+
+// the columns of the attribute sheets.
+const (
+	ColumnItem        = "item"
+	ColumnName        = "name"
+	ColumnType        = "type"
+	ColumnPrecision   = "precision"
+	ColumnScale       = "scale"
+	ColumnMaxLength   = "maxLength"
+	ColumnElementType = "elementType"
+	ColumnEnumValues  = "enumValues"
+	ColumnNullable    = "nullable"
+	ColumnPrimaryKey  = "primaryKey"
+	ColumnUnit        = "unit"
+	ColumnExample     = "example"
+	ColumnInstruction = "instruction"
+	ColumnOrder       = "order"
+)
+
+var (
+	ErrUnknownSheetFormat = errors.New("unknown sheet format")
+	ErrEmptySheet         = errors.New("no header row found in the sheet")
+	ErrTooManyRows        = fmt.Errorf("the sheet has more than %d rows", MaxSheetRows)
+
+	// SheetColumns are the columns written by WriteAttrSheet.
+	SheetColumns = []string{ColumnItem, ColumnName, ColumnType, ColumnPrecision, ColumnScale,
+		ColumnMaxLength, ColumnElementType, ColumnEnumValues, ColumnNullable, ColumnPrimaryKey,
+		ColumnUnit, ColumnExample, ColumnInstruction}
+
+	// the columns of the attribute fields in the validation errors.
+	fieldColumns = map[string]string{
+		"attrName":    ColumnName,
+		"dataType":    ColumnType,
+		"precision":   ColumnPrecision,
+		"scale":       ColumnScale,
+		"maxLength":   ColumnMaxLength,
+		"elementType": ColumnElementType,
+		"enumValues":  ColumnEnumValues,
+		"nullable":    ColumnNullable,
+		"primaryKey":  ColumnPrimaryKey,
+		"unit":        ColumnUnit,
+		"example":     ColumnExample,
+		"instruction": ColumnInstruction,
+		"orderId":     ColumnOrder,
+	}
+
+	// the header aliases of the columns, besides the column names.
+	columnAliases = map[string]string{
+		"dataitem":    ColumnItem,
+		"itemname":    ColumnItem,
+		"数据项":         ColumnItem,
+		"attrname":    ColumnName,
+		"attribute":   ColumnName,
+		"名称":          ColumnName,
+		"属性":          ColumnName,
+		"datatype":    ColumnType,
+		"类型":          ColumnType,
+		"精度":          ColumnPrecision,
+		"小数位":         ColumnScale,
+		"最大长度":        ColumnMaxLength,
+		"元素类型":        ColumnElementType,
+		"枚举值":         ColumnEnumValues,
+		"可为空":         ColumnNullable,
+		"主键":          ColumnPrimaryKey,
+		"单位":          ColumnUnit,
+		"示例":          ColumnExample,
+		"description": ColumnInstruction,
+		"说明":          ColumnInstruction,
+		"orderid":     ColumnOrder,
+		"序号":          ColumnOrder,
+	}
+
+	boolValues = map[string]bool{
+		"true": true, "yes": true, "y": true, "1": true, "是": true,
+		"false": false, "no": false, "n": false, "0": false, "否": false,
+	}
+)
+
+// SheetItem is the attributes of a dataitem in a sheet, with the sheet row
+// of every attribute.
+type SheetItem struct {
+	ItemName string
+	Rows     []int
+	Attrs    []*models.Attribute
+}
+
+// RowError is a validation error of a sheet row. The rows are numbered from
+// 1 as in the spreadsheet programs, the header is row 1.
+type RowError struct {
+	Row     int    `json:"row"`
+	Item    string `json:"item,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ReadSheet reads the rows of a csv sheet or the first worksheet of a xlsx
+// workbook. The format is detected if empty.
+func ReadSheet(data []byte, format string) ([][]string, error) {
+	if format == "" {
+		format = SheetCsv
+		if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+			format = SheetXlsx
+		}
+	}
+
+	switch format {
+	case SheetXlsx:
+		sheets, err := common.ReadXlsx(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(sheets) == 0 {
+			return nil, ErrEmptySheet
+		}
+		if len(sheets[0].Rows) > MaxSheetRows+1 {
+			return nil, ErrTooManyRows
+		}
+		return sheets[0].Rows, nil
+	case SheetCsv:
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.Comma = sniffDelimiter(data)
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+
+		rows := make([][]string, 0, 64)
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			if len(rows) > MaxSheetRows {
+				return nil, ErrTooManyRows
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+	return nil, ErrUnknownSheetFormat
+}
+
+// normalizeHeader lowers the header and removes the spaces, dashes and
+// underscores, so that "Max Length" and "max_length" match maxLength.
+func normalizeHeader(header string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(header)))
+}
+
+// sheetColumn returns the column of a header. The mapping from the headers
+// to the columns takes priority over the column names and aliases.
+func sheetColumn(header string, mapping map[string]string) string {
+	if column, ok := mapping[strings.TrimSpace(header)]; ok {
+		return column
+	}
+
+	key := normalizeHeader(header)
+	for _, column := range SheetColumns {
+		if key == strings.ToLower(column) {
+			return column
+		}
+	}
+	if key == ColumnOrder {
+		return ColumnOrder
+	}
+	return columnAliases[key]
+}
+
+// ValidateColumnMapping checks that the mapping targets known columns.
+func ValidateColumnMapping(mapping map[string]string) error {
+	for header, column := range mapping {
+		known := column == ColumnOrder || column == ""
+		for _, c := range SheetColumns {
+			if column == c {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown column %q for header %q", column, header)
+		}
+	}
+	return nil
+}
+
+// ParseAttrSheet groups the rows of an attribute sheet by dataitem, in the
+// order of their first rows. The first non-empty row is the header, whose
+// unknown headers are ignored (or mapped to "" to ignore them explicitly).
+// defaultItem is used if the sheet has no item column or an empty item.
+// The rows of a dataitem with any error are not returned.
+func ParseAttrSheet(rows [][]string, mapping map[string]string, defaultItem string) ([]*SheetItem, []*RowError, error) {
+	headerRow := 0
+	for headerRow < len(rows) && emptyRow(rows[headerRow]) {
+		headerRow++
+	}
+	if headerRow == len(rows) {
+		return nil, nil, ErrEmptySheet
+	}
+
+	columns := make(map[string]int)
+	for i, header := range rows[headerRow] {
+		column := sheetColumn(header, mapping)
+		if column == "" {
+			continue
+		}
+		if _, ok := columns[column]; ok {
+			return nil, nil, fmt.Errorf("duplicated column %s", column)
+		}
+		columns[column] = i
+	}
+	if _, ok := columns[ColumnName]; !ok {
+		return nil, nil, fmt.Errorf("no %s column found", ColumnName)
+	}
+	if _, ok := columns[ColumnItem]; !ok && defaultItem == "" {
+		return nil, nil, fmt.Errorf("no %s column found", ColumnItem)
+	}
+
+	items := make([]*SheetItem, 0, 8)
+	byName := make(map[string]*SheetItem)
+	failed := make(map[string]bool)
+	errs := make([]*RowError, 0)
+	for i := headerRow + 1; i < len(rows); i++ {
+		row := rows[i]
+		if emptyRow(row) {
+			continue
+		}
+		cell := func(column string) string {
+			if j, ok := columns[column]; ok && j < len(row) {
+				return strings.TrimSpace(row[j])
+			}
+			return ""
+		}
+
+		itemName := cell(ColumnItem)
+		if itemName == "" {
+			itemName = defaultItem
+		}
+		fail := func(field, message string) {
+			errs = append(errs, &RowError{Row: i + 1, Item: itemName, Field: field, Message: message})
+			failed[itemName] = true
+		}
+		if itemName == "" {
+			fail(ColumnItem, "dataitem is empty")
+			continue
+		}
+
+		attr, field, err := parseAttrRow(cell)
+		if err != nil {
+			fail(field, err.Error())
+			continue
+		}
+
+		item := byName[itemName]
+		if item == nil {
+			item = &SheetItem{ItemName: itemName}
+			byName[itemName] = item
+			items = append(items, item)
+		}
+		for _, a := range item.Attrs {
+			if strings.EqualFold(a.AttrName, attr.AttrName) {
+				fail(ColumnName, "duplicated attribute name "+attr.AttrName)
+				attr = nil
+				break
+			}
+		}
+		if attr != nil {
+			if attr.OrderId == 0 {
+				attr.OrderId = len(item.Attrs) + 1
+			}
+			item.Rows = append(item.Rows, i+1)
+			item.Attrs = append(item.Attrs, attr)
+		}
+	}
+
+	valid := make([]*SheetItem, 0, len(items))
+	for _, item := range items {
+		if !failed[item.ItemName] {
+			valid = append(valid, item)
+		}
+	}
+	return valid, errs, nil
+}
+
+func emptyRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAttrRow parses and validates the attribute of a row. The field of
+// the error is returned if it is known.
+func parseAttrRow(cell func(column string) string) (*models.Attribute, string, error) {
+	attr := &models.Attribute{
+		AttrName:    cell(ColumnName),
+		DataType:    cell(ColumnType),
+		ElementType: cell(ColumnElementType),
+		Unit:        cell(ColumnUnit),
+		Example:     cell(ColumnExample),
+		Instruction: cell(ColumnInstruction),
+		Nullable:    true,
+	}
+
+	ints := []struct {
+		column string
+		value  *int
+	}{
+		{ColumnPrecision, &attr.Precision},
+		{ColumnScale, &attr.Scale},
+		{ColumnMaxLength, &attr.MaxLength},
+		{ColumnOrder, &attr.OrderId},
+	}
+	for _, c := range ints {
+		if s := cell(c.column); s != "" {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, ".0"))
+			if err != nil {
+				return nil, c.column, fmt.Errorf("not an integer: %s", s)
+			}
+			*c.value = n
+		}
+	}
+
+	bools := []struct {
+		column string
+		value  *bool
+	}{
+		{ColumnNullable, &attr.Nullable},
+		{ColumnPrimaryKey, &attr.PrimaryKey},
+	}
+	for _, c := range bools {
+		if s := cell(c.column); s != "" {
+			b, ok := boolValues[strings.ToLower(s)]
+			if !ok {
+				return nil, c.column, fmt.Errorf("not a boolean: %s", s)
+			}
+			*c.value = b
+		}
+	}
+	// primary keys are not nullable unless the sheet says so.
+	if attr.PrimaryKey && cell(ColumnNullable) == "" {
+		attr.Nullable = false
+	}
+
+	if s := cell(ColumnEnumValues); s != "" {
+		values, err := parseEnumValues(s)
+		if err != nil {
+			return nil, ColumnEnumValues, err
+		}
+		attr.EnumValues = values
+	}
+
+	if attr.AttrName == "" {
+		return nil, ColumnName, errors.New("attribute name is empty")
+	}
+	if err := models.ValidateAttribute(attr); err != nil {
+		if e, ok := err.(*models.AttrFieldError); ok {
+			return nil, fieldColumns[e.Field], err
+		}
+		return nil, "", err
+	}
+	return attr, "", nil
+}
+
+// parseEnumValues parses a json array, or the values separated by commas or
+// line breaks.
+func parseEnumValues(s string) ([]string, error) {
+	if strings.HasPrefix(s, "[") {
+		var values []string
+		if err := json.Unmarshal([]byte(s), &values); err != nil {
+			return nil, errors.New("not a json array of strings")
+		}
+		return values, nil
+	}
+
+	values := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' })
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values, nil
+}
+
+// formatEnumValues is the reverse of parseEnumValues.
+func formatEnumValues(values []string) string {
+	for _, v := range values {
+		if v != strings.TrimSpace(v) || v == "" || strings.ContainsAny(v, ",\n") || strings.HasPrefix(v, "[") {
+			data, _ := json.Marshal(values)
+			return string(data)
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// AttrSheetRows returns the header and a row per attribute of the items,
+// which ParseAttrSheet reads back.
+func AttrSheetRows(items []*SheetItem) [][]string {
+	rows := [][]string{SheetColumns}
+	for _, item := range items {
+		for _, attr := range item.Attrs {
+			row := []string{item.ItemName, attr.AttrName, attr.DataType, "", "", "", attr.ElementType,
+				formatEnumValues(attr.EnumValues), strconv.FormatBool(attr.Nullable),
+				strconv.FormatBool(attr.PrimaryKey), attr.Unit, attr.Example, attr.Instruction}
+			if attr.Precision > 0 || attr.Scale > 0 {
+				row[3], row[4] = strconv.Itoa(attr.Precision), strconv.Itoa(attr.Scale)
+			}
+			if attr.MaxLength > 0 {
+				row[5] = strconv.Itoa(attr.MaxLength)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// WriteAttrSheet writes the attributes of the items as a csv sheet or a
+// xlsx workbook, and returns the content type.
+func WriteAttrSheet(w io.Writer, format string, items []*SheetItem) (string, error) {
+	rows := AttrSheetRows(items)
+	switch format {
+	case SheetXlsx:
+		sheet := &common.XlsxSheet{Name: "attributes", Rows: rows, HeaderRows: 1}
+		return common.XlsxContentType, common.WriteXlsx(w, []*common.XlsxSheet{sheet})
+	case SheetCsv:
+		// the bom makes excel read the csv as utf-8.
+		if _, err := io.WriteString(w, "\xef\xbb\xbf"); err != nil {
+			return "", err
+		}
+		writer := csv.NewWriter(w)
+		writer.WriteAll(rows)
+		return "text/csv; charset=utf-8", writer.Error()
+	}
+	return "", ErrUnknownSheetFormat
+}
@@ -0,0 +1,134 @@
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"strings"
+	"testing"
+)
+
+func TestParseAttrSheet(t *testing.T) {
+	rows := [][]string{
+		{},
+		{"Dataitem", "Attribute", "Data Type", "Precision", "Scale", "Enum Values", "Primary Key", "说明", "Source"},
+		{"orders", "id", "int", "", "", "", "yes", "order id", "erp"},
+		{"orders", "amount", "decimal", "10", "2", "", "", "", ""},
+		{"", "", "", "", "", "", "", "", ""},
+		{"orders", "status", "enum", "", "", "new, paid", "no", "", ""},
+		{"users", "id", "int", "x", "", "", "", "", ""},
+		{"users", "name", "string", "", "", "", "", "", ""},
+		{"", "name", "string", "", "", "", "", "", ""},
+		{"events", "kind", "enum", "", "", `["a,b","c"]`, "", "", ""},
+		{"events", "Kind", "string", "", "", "", "", "", ""},
+		{"events", "flag", "boolean", "2", "", "", "", "", ""},
+		{"events", "level", "enum", "", "", "", "", "", ""},
+		{"events", "note", "float", "", "", "", "", "", ""},
+	}
+	items, errs, err := ParseAttrSheet(rows, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 1 || items[0].ItemName != "orders" || len(items[0].Attrs) != 3 {
+		t.Fatalf("items %v", items)
+	}
+	orders := items[0]
+	if fmt.Sprint(orders.Rows) != "[3 4 6]" {
+		t.Errorf("rows %v", orders.Rows)
+	}
+	id, amount, status := orders.Attrs[0], orders.Attrs[1], orders.Attrs[2]
+	if !id.PrimaryKey || id.Nullable || id.Instruction != "order id" || id.OrderId != 1 {
+		t.Errorf("id %+v", id)
+	}
+	if amount.TypeString() != "decimal(10,2)" || !amount.Nullable || amount.OrderId != 2 {
+		t.Errorf("amount %+v", amount)
+	}
+	if strings.Join(status.EnumValues, "|") != "new|paid" || status.PrimaryKey {
+		t.Errorf("status %+v", status)
+	}
+
+	expected := []RowError{
+		{7, "users", ColumnPrecision, "not an integer: x"},
+		{9, "", ColumnItem, "dataitem is empty"},
+		{11, "events", ColumnName, "duplicated attribute name Kind"},
+		{12, "events", ColumnPrecision, "precision and scale are only for decimal"},
+		{13, "events", ColumnEnumValues, "enum values are needed"},
+		{14, "events", ColumnType, "invalid data type: float"},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("errors %v", errs)
+	}
+	for i, e := range errs {
+		if *e != expected[i] {
+			t.Errorf("errors[%d] %+v != %+v", i, *e, expected[i])
+		}
+	}
+}
+
+func TestParseAttrSheetMapping(t *testing.T) {
+	rows := [][]string{
+		{"Field", "Kind", "Comment"},
+		{"id", "int", "ignored"},
+	}
+	mapping := map[string]string{"Field": ColumnName, "Kind": ColumnType, "Comment": ""}
+	items, errs, err := ParseAttrSheet(rows, mapping, "orders")
+	if err != nil || len(errs) > 0 {
+		t.Fatal(err, errs)
+	}
+	if len(items) != 1 || items[0].ItemName != "orders" || items[0].Attrs[0].DataType != models.DataTypeInt ||
+		items[0].Attrs[0].Instruction != "" {
+		t.Errorf("items %v", items)
+	}
+
+	if _, _, err := ParseAttrSheet(rows, nil, "orders"); err == nil {
+		t.Error("no error without the name column")
+	}
+	if _, _, err := ParseAttrSheet(rows, mapping, ""); err == nil {
+		t.Error("no error without the item column")
+	}
+	if err := ValidateColumnMapping(map[string]string{"a": "size"}); err == nil {
+		t.Error("no error of unknown column")
+	}
+}
+
+func TestAttrSheetRoundTrip(t *testing.T) {
+	items := []*SheetItem{
+		{ItemName: "orders", Attrs: []*models.Attribute{
+			{AttrName: "id", DataType: models.DataTypeInt, PrimaryKey: true, OrderId: 1},
+			{AttrName: "amount", DataType: models.DataTypeDecimal, Precision: 10, Scale: 2, Nullable: true,
+				Unit: "CNY", Example: "1.50", Instruction: "total, with tax\nin yuan", OrderId: 2},
+			{AttrName: "code", DataType: models.DataTypeString, MaxLength: 8, OrderId: 3},
+			{AttrName: "tags", DataType: models.DataTypeArray, ElementType: models.DataTypeString, Nullable: true, OrderId: 4},
+		}},
+		{ItemName: "状态", Attrs: []*models.Attribute{
+			{AttrName: "kind", DataType: models.DataTypeEnum, EnumValues: []string{"a,b", "c"}, OrderId: 1},
+		}},
+	}
+
+	for _, format := range []string{SheetCsv, SheetXlsx} {
+		var buf bytes.Buffer
+		if _, err := WriteAttrSheet(&buf, format, items); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := ReadSheet(buf.Bytes(), "")
+		if err != nil {
+			t.Fatal(format, err)
+		}
+		parsed, errs, err := ParseAttrSheet(rows, nil, "")
+		if err != nil || len(errs) > 0 {
+			t.Fatal(format, err, errs)
+		}
+		if len(parsed) != len(items) {
+			t.Fatalf("%s: items %v", format, parsed)
+		}
+		for i, item := range items {
+			if parsed[i].ItemName != item.ItemName {
+				t.Errorf("%s: item %s != %s", format, parsed[i].ItemName, item.ItemName)
+			}
+			if diff := models.DiffAttrs(item.Attrs, parsed[i].Attrs); !diff.Empty() {
+				t.Errorf("%s: %s diff %+v", format, item.ItemName, diff)
+			}
+		}
+	}
+}
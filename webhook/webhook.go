@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/log"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var logger = log.GetLogger()
+
+const (
+	HeaderEvent     = "X-Integration-Event"
+	HeaderDelivery  = "X-Integration-Delivery"
+	HeaderSignature = "X-Integration-Signature"
+
+	// SignaturePrefix is the prefix of the signature, which names the hash.
+	SignaturePrefix = "sha256="
+
+	DefaultMaxAttempts = 8
+	DefaultBackoff     = 30 * time.Second
+	DefaultMaxBackoff  = time.Hour
+	DefaultBatchSize   = 20
+	DefaultInterval    = 5 * time.Second
+)
+
+// errAddrNotAllowed is the error of dialing the addresses of the internal
+// networks, which the webhooks may not reach.
+var errAddrNotAllowed = errors.New("address not allowed")
+
+// publicIP reports whether the ip is outside of the loopback, private,
+// link-local and unspecified addresses.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// dialAllowed checks the resolved ips, replaced in the tests.
+var dialAllowed = publicIP
+
+// checkDialAddr rejects the internal addresses, after the names are resolved,
+// so that neither the names resolved to them nor the redirects reach them.
+func checkDialAddr(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !dialAllowed(ip) {
+		return fmt.Errorf("%s: %w", host, errAddrNotAllowed)
+	}
+	return nil
+}
+
+// client sends the deliveries directly, not by the proxies of the env,
+// which would dial the internal addresses for them.
+var client = &http.Client{
+	Timeout: time.Duration(common.GeneralRemoteCallTimeout) * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: time.Duration(common.GeneralRemoteCallTimeout) * time.Second,
+			Control: checkDialAddr,
+		}).DialContext,
+	},
+}
+
+// Sign returns the signature of the body, the hex of its HMAC-SHA256 with the
+// secret, with the SignaturePrefix.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return SignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of the body in constant time, for the
+// receivers written in go.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Dispatcher sends the pending deliveries to the webhooks. A delivery fails
+// on a status other than 2xx, or is retried with exponential backoff after a
+// network error or a retryable status, until MaxAttempts.
+type Dispatcher struct {
+	MaxAttempts int
+	Backoff     time.Duration // before the first retry
+	MaxBackoff  time.Duration
+	BatchSize   int
+	Interval    time.Duration // between the polls of the deliveries in Loop
+}
+
+func (d *Dispatcher) maxAttempts() int {
+	if d.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return d.MaxAttempts
+}
+
+// backoff returns the wait after the attempts, doubled after each one.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff, maxBackoff := d.Backoff, d.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// send posts the payload of the delivery, signed with the secret of its
+// webhook, and returns the status of the delivery after the attempt.
+func (d *Dispatcher) send(delivery *models.DueDelivery) (status string, responseCode int, err error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set(HeaderEvent, delivery.EventType)
+	header.Set(HeaderDelivery, fmt.Sprint(delivery.DeliveryId))
+	header.Set(HeaderSignature, Sign(delivery.Secret, delivery.Payload))
+
+	response, _, err := common.RemoteCallWithClient(client, "POST", delivery.Url, header, delivery.Payload)
+	if err == nil {
+		responseCode = response.StatusCode
+		if responseCode >= 200 && responseCode < 300 {
+			return models.DeliverySucceeded, responseCode, nil
+		}
+		err = fmt.Errorf("status code: %d", responseCode)
+	}
+
+	if errors.Is(err, errAddrNotAllowed) {
+		return models.DeliveryFailed, responseCode, err
+	}
+	if delivery.Attempts+1 < d.maxAttempts() && (responseCode == 0 || common.RetryableStatus(responseCode)) {
+		return models.DeliveryPending, responseCode, err
+	}
+	return models.DeliveryFailed, responseCode, err
+}
+
+// DeliverOnce sends a batch of the due deliveries, and returns the number of
+// the sent ones, succeeded or not.
+func (d *Dispatcher) DeliverOnce(db *sql.DB) (int, error) {
+	batchSize := d.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	// the lease covers the timeouts of the whole batch.
+	lease := time.Duration(batchSize*(common.GeneralRemoteCallTimeout+1)) * time.Second
+	deliveries, err := models.ClaimDueDeliveries(db, batchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		status, responseCode, err := d.send(delivery)
+		message, retryAfter := "", time.Duration(0)
+		if err != nil {
+			message = err.Error()
+			logger.Warn("Delivery %d to webhook %d err: %v", delivery.DeliveryId, delivery.WebhookId, err)
+		}
+		if status == models.DeliveryPending {
+			retryAfter = d.backoff(delivery.Attempts + 1)
+		}
+		if err := models.RecordDeliveryAttempt(db, delivery.DeliveryId, status, responseCode, message, retryAfter); err != nil {
+			return 0, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// Loop sends the due deliveries every interval, without waiting while the
+// batches are full, until the stop channel is closed.
+func (d *Dispatcher) Loop(db *sql.DB, stop <-chan struct{}) {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	batchSize := d.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := d.DeliverOnce(db)
+			if err != nil {
+				logger.Error("Deliver webhooks err: %v", err)
+			}
+			if err != nil || n < batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
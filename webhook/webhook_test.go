@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/asiainfoLDP/datafoundry_data_integration/common"
+	"github.com/asiainfoLDP/datafoundry_data_integration/models"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '{"seq":1}' | openssl dgst -sha256 -hmac abc
+	signature := Sign("abc", []byte(`{"seq":1}`))
+	if signature != "sha256=e302bf24e7728b6cf3058bc3a8a8e3e6b75a2aa08f1f944d66b6615d8ea9dab2" {
+		t.Errorf("unexpected signature %s", signature)
+	}
+	if !Verify("abc", []byte(`{"seq":1}`), signature) {
+		t.Errorf("expect the signature verified")
+	}
+	if Verify("abd", []byte(`{"seq":1}`), signature) || Verify("abc", []byte(`{"seq":2}`), signature) {
+		t.Errorf("expect the signature not verified")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+	for attempts, expected := range map[int]time.Duration{
+		1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 20: 10 * time.Second,
+	} {
+		if backoff := d.backoff(attempts); backoff != expected {
+			t.Errorf("attempts %d: expect %v, got %v", attempts, expected, backoff)
+		}
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for ip, expected := range map[string]bool{
+		"8.8.8.8": true, "2001:4860:4860::8888": true,
+		"127.0.0.1": false, "::1": false, "10.1.2.3": false, "172.16.0.1": false, "192.168.1.1": false,
+		"169.254.169.254": false, "fe80::1": false, "0.0.0.0": false, "::": false, "fd00::1": false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if publicIP(net.ParseIP(ip)) != expected {
+			t.Errorf("%s: expect public %v", ip, expected)
+		}
+	}
+}
+
+func TestSendRejectsInternalAddrs(t *testing.T) {
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+
+	d := &Dispatcher{MaxAttempts: 3}
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+	for _, url := range []string{server.URL, fmt.Sprintf("http://localhost:%d", port)} {
+		delivery := &models.DueDelivery{
+			Delivery: &models.Delivery{DeliveryId: 7, WebhookId: 1, EventType: "dataitem.update",
+				Payload: json.RawMessage(`{}`)},
+			Url: url,
+		}
+		if status, _, err := d.send(delivery); status != models.DeliveryFailed || err == nil {
+			t.Errorf("%s: expect failed, got %s %v", url, status, err)
+		}
+	}
+	if requested {
+		t.Errorf("expect the loopback server not requested")
+	}
+}
+
+func TestSend(t *testing.T) {
+	defer func(allowed func(net.IP) bool) { dialAllowed = allowed }(dialAllowed)
+	dialAllowed = func(net.IP) bool { return true }
+
+	statusCode := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := common.GetRequestData(r)
+		if r.Method != "POST" || r.Header.Get(HeaderEvent) != "dataitem.update" || r.Header.Get(HeaderDelivery) != "7" ||
+			!Verify("abc", body, r.Header.Get(HeaderSignature)) {
+			t.Errorf("unexpected request %s %v", r.Method, r.Header)
+		}
+		var event models.Event
+		if err := json.Unmarshal(body, &event); err != nil || event.Seq != 3 {
+			t.Errorf("unexpected body %s", body)
+		}
+		w.WriteHeader(statusCode)
+	}))
+	defer server.Close()
+
+	d := &Dispatcher{MaxAttempts: 3}
+	delivery := &models.DueDelivery{
+		Delivery: &models.Delivery{DeliveryId: 7, WebhookId: 1, EventType: "dataitem.update",
+			Payload: json.RawMessage(`{"version":1,"seq":3}`)},
+		Url:    server.URL,
+		Secret: "abc",
+	}
+
+	for _, c := range []struct {
+		statusCode int
+		attempts   int
+		status     string
+	}{
+		{http.StatusNoContent, 0, models.DeliverySucceeded},
+		{http.StatusServiceUnavailable, 0, models.DeliveryPending},
+		{http.StatusTooManyRequests, 1, models.DeliveryPending},
+		{http.StatusServiceUnavailable, 2, models.DeliveryFailed},
+		{http.StatusNotFound, 0, models.DeliveryFailed},
+	} {
+		statusCode = c.statusCode
+		delivery.Attempts = c.attempts
+		status, responseCode, err := d.send(delivery)
+		if status != c.status || responseCode != c.statusCode || (err == nil) != (status == models.DeliverySucceeded) {
+			t.Errorf("%d after %d attempts: expect %s, got %s %d %v", c.statusCode, c.attempts, c.status,
+				status, responseCode, err)
+		}
+	}
+
+	server.Close()
+	delivery.Attempts = 0
+	if status, responseCode, err := d.send(delivery); status != models.DeliveryPending || responseCode != 0 || err == nil {
+		t.Errorf("expect pending after a network error, got %s %d %v", status, responseCode, err)
+	}
+}